@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"lpml/ast"
+	"lpml/lexer"
+	"lpml/parser"
+)
+
+// runAST prints a file's parsed document as JSON. Parse errors go to
+// stderr, after the document as far as it could be parsed, so the output
+// can still be compared against an expected tree. It returns the exit
+// status.
+func runAST(args []string) int {
+	fs := flag.NewFlagSet("ast", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml ast <file.lpml>")
+		fmt.Println("  Prints the parsed document as JSON: each node's type, properties, and span")
+	}
+	files := parseInterspersed(fs, args)
+	if len(files) != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	file := files[0]
+	if !checkFileType(file) {
+		fmt.Fprintln(os.Stderr, "invalid file type: needs to end in suffix .lpml")
+		return exitUsage
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read file: %v\n", err)
+		return exitIO
+	}
+	p := parser.NewForFile(lexer.New(string(content)), file, os.ReadFile)
+	doc := p.ParseDocument()
+
+	out, err := ast.JSON(doc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIO
+	}
+
+	if len(p.Errors()) > 0 {
+		fmt.Fprintf(os.Stderr, "Errors in %s:\n", file)
+		for _, msg := range withSnippets(p.Diagnostics(), "  ") {
+			fmt.Fprintf(os.Stderr, "  %s\n", msg)
+		}
+		return exitParse
+	}
+	return exitOK
+}
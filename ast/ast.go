@@ -1,17 +1,65 @@
+// Package ast defines the parsed form of an LPML document, for the
+// generator and for tools built on it: editors, converters, and plugins.
+//
+// The AST is versioned. Version changes whenever a change could break code
+// using the AST: a node, field, or method removed or renamed, or its
+// meaning changed. Adding node types, fields, or methods doesn't change
+// it, so tools should ignore node types they don't know and check
+// Document.Version before relying on anything else.
 package ast
 
 import (
+	"path/filepath"
+	"strings"
+
 	"lpml/tokens"
 )
 
+// Version is the version of the AST this package produces
+const Version = 1
+
 // Node represents any node in the AST
 type Node interface {
 	TokenLiteral() string
+	Pos() Position
+	Start() Position // Where the node starts, the same as Pos
+	End() Position   // Just past where it ends: after an element's closing tag, or the last character of a value
+}
+
+// Position is a place in a source file: where a node starts, or just past
+// where it ends. The zero Position is a node made by a program rather
+// than parsed.
+type Position struct {
+	Line   int // 1-based
+	Column int // 1-based
+}
+
+// pos returns a token's position
+func pos(tok tokens.Token) Position {
+	return Position{Line: tok.Line, Column: tok.Column}
+}
+
+// end returns the position just past a token
+func end(tok tokens.Token) Position {
+	return Position{Line: tok.EndLine, Column: tok.EndColumn}
+}
+
+// Container is a node with properties and children of its own: a page
+// section or an element
+type Container interface {
+	Node
+	Props() map[string]Value
+	ChildNodes() []Node
 }
 
 // Document is the root node of the AST
 type Document struct {
+	Version  int                         // The AST version the document was parsed as, see Version
+	Meta     map[string]Value            // Front matter from a [meta] block, nil without one
+	Defines  map[string]Value            // Constants from [define] blocks, referenced as $name
+	Presets  map[string]map[string]Value // Style properties of [preset] blocks by name, for use_preset
 	Sections []*PageSection
+	Comments *CommentMap // Its comments and the nodes they're beside; nil if it has none
 }
 
 func (d *Document) TokenLiteral() string {
@@ -21,30 +69,148 @@ func (d *Document) TokenLiteral() string {
 	return ""
 }
 
+// Pos returns the position of the first section
+func (d *Document) Pos() Position {
+	if len(d.Sections) > 0 {
+		return d.Sections[0].Pos()
+	}
+	return Position{}
+}
+
+func (d *Document) Start() Position { return d.Pos() }
+
+// End returns the end of the last section
+func (d *Document) End() Position {
+	if len(d.Sections) > 0 {
+		return d.Sections[len(d.Sections)-1].End()
+	}
+	return Position{}
+}
+
 // PageSection represents a page section (top, mid, bottom)
 type PageSection struct {
-	Token    tokens.Token // TOP_OF_PAGE_START, MID_PAGE_START, BOTTOM_OF_PAGE_START
-	Type     string       // "top", "mid", "bottom"
-	Children []Node
+	Token      tokens.Token     // TOP_OF_PAGE_START, MID_PAGE_START, BOTTOM_OF_PAGE_START
+	Type       string           // "top", "mid", "bottom"
+	Properties map[string]Value // Properties applied to the section wrapper
+	Children   []Node
+	Close      tokens.Token // The closing tag, or in an [indented] file the section's last token
 }
 
 func (ps *PageSection) TokenLiteral() string {
 	return ps.Token.Literal
 }
 
+func (ps *PageSection) Pos() Position           { return pos(ps.Token) }
+func (ps *PageSection) Start() Position         { return pos(ps.Token) }
+func (ps *PageSection) End() Position           { return end(ps.Close) }
+func (ps *PageSection) Props() map[string]Value { return ps.Properties }
+func (ps *PageSection) ChildNodes() []Node      { return ps.Children }
+
 // Element represents an LPML element like divide, p, h, link, etc.
 type Element struct {
 	Token      tokens.Token     // The opening tag token
 	TagType    string           // "divide", "p", "h", "link", etc.
 	Properties map[string]Value // Property assignments
 	Children   []Node           // Nested elements
+	File       string           // Source file it was written in, the included file's for included elements; "" if unknown
+	Close      tokens.Token     // The closing tag, or the element's last token without one, as in an [indented] file
 }
 
 func (e *Element) TokenLiteral() string {
 	return e.Token.Literal
 }
 
-// Value represents a property value (string literal, number, variable reference, or array)
+// Module returns the name other files use to reach the element's labels,
+// as in $header.site_title: the base name of its file without the
+// extension, like header for partials/header.lpml. It's "" if the file
+// isn't known.
+func (e *Element) Module() string {
+	if e.File == "" {
+		return ""
+	}
+	base := filepath.Base(e.File)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (e *Element) Pos() Position           { return pos(e.Token) }
+func (e *Element) Start() Position         { return pos(e.Token) }
+func (e *Element) End() Position           { return end(e.Close) }
+func (e *Element) Props() map[string]Value { return e.Properties }
+func (e *Element) ChildNodes() []Node      { return e.Children }
+
+// TextNode represents a run of bare text inside an element, like "Read the "
+type TextNode struct {
+	Token tokens.Token
+	Value string
+}
+
+func (tn *TextNode) TokenLiteral() string {
+	return tn.Token.Literal
+}
+
+func (tn *TextNode) Pos() Position   { return pos(tn.Token) }
+func (tn *TextNode) Start() Position { return pos(tn.Token) }
+func (tn *TextNode) End() Position   { return end(tn.Token) }
+
+// Conditional represents an [if cond=...] block: Then is rendered when
+// the condition holds, Else otherwise. The condition tests Left alone, or
+// compares it with Right.
+type Conditional struct {
+	Token tokens.Token // The [if] tag, with the condition as written
+	Not   bool         // The condition starts with !
+	Left  Value
+	Op    string // "==", "!=", or "" to test Left alone
+	Right Value
+	Then  []Node
+	Else  []Node
+	Close tokens.Token // The [if-end], or in an [indented] file the block's last token
+}
+
+func (c *Conditional) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+func (c *Conditional) Pos() Position   { return pos(c.Token) }
+func (c *Conditional) Start() Position { return pos(c.Token) }
+func (c *Conditional) End() Position   { return end(c.Close) }
+
+// Contents returns both branches' nodes, Then first
+func (c *Conditional) Contents() []Node {
+	return append(append([]Node{}, c.Then...), c.Else...)
+}
+
+// Repeat represents a [repeat over=$items as="item"] block, whose children
+// are rendered once per item with $item bound to it
+type Repeat struct {
+	Token    tokens.Token // The [repeat] tag, with its attributes as written
+	Over     Value        // The array to repeat over, usually a $constant
+	As       string       // Name of the loop variable, without the $
+	Children []Node
+	Close    tokens.Token // The [repeat-end], or in an [indented] file the block's last token
+}
+
+func (r *Repeat) TokenLiteral() string {
+	return r.Token.Literal
+}
+
+func (r *Repeat) Pos() Position   { return pos(r.Token) }
+func (r *Repeat) Start() Position { return pos(r.Token) }
+func (r *Repeat) End() Position   { return end(r.Close) }
+
+// Contents returns the nodes repeated for each item
+func (r *Repeat) Contents() []Node {
+	return r.Children
+}
+
+// Block is a construct like [if] or [repeat] that holds nodes without
+// being an element itself. The generator decides what it renders; walks
+// over everything a page could show descend into its Contents.
+type Block interface {
+	Node
+	Contents() []Node
+}
+
+// Value represents a property value (string literal, number, boolean, variable reference, or array)
 type Value interface {
 	Node
 	valueNode()
@@ -57,6 +223,9 @@ type StringValue struct {
 }
 
 func (sv *StringValue) TokenLiteral() string { return sv.Token.Literal }
+func (sv *StringValue) Pos() Position        { return pos(sv.Token) }
+func (sv *StringValue) Start() Position      { return pos(sv.Token) }
+func (sv *StringValue) End() Position        { return end(sv.Token) }
 func (sv *StringValue) valueNode()           {}
 
 // NumberValue represents a numeric literal like 123 or 3.14
@@ -66,26 +235,184 @@ type NumberValue struct {
 }
 
 func (nv *NumberValue) TokenLiteral() string { return nv.Token.Literal }
+func (nv *NumberValue) Pos() Position        { return pos(nv.Token) }
+func (nv *NumberValue) Start() Position      { return pos(nv.Token) }
+func (nv *NumberValue) End() Position        { return end(nv.Token) }
 func (nv *NumberValue) valueNode()           {}
 
-// VariableRef represents a variable reference like $label_name
-type VariableRef struct {
+// DimensionValue represents a number with a CSS unit like 16px, 1.5rem,
+// or 50%
+type DimensionValue struct {
 	Token tokens.Token
-	Name  string
+	Value string // The number, like "16"
+	Unit  string // The unit, like "px" or "%"
+}
+
+func (dv *DimensionValue) TokenLiteral() string { return dv.Token.Literal }
+func (dv *DimensionValue) Pos() Position        { return pos(dv.Token) }
+func (dv *DimensionValue) Start() Position      { return pos(dv.Token) }
+func (dv *DimensionValue) End() Position        { return end(dv.Token) }
+func (dv *DimensionValue) valueNode()           {}
+
+// ColorValue represents a color literal like #ff6600 or rgb(255, 102, 0),
+// written without quotes. RGBA reads it.
+type ColorValue struct {
+	Token tokens.Token
+	Value string // As written
+}
+
+func (cv *ColorValue) TokenLiteral() string { return cv.Token.Literal }
+func (cv *ColorValue) Pos() Position        { return pos(cv.Token) }
+func (cv *ColorValue) Start() Position      { return pos(cv.Token) }
+func (cv *ColorValue) End() Position        { return end(cv.Token) }
+func (cv *ColorValue) valueNode()           {}
+
+// DateValue represents a date literal like 2024-06-01, or a date and time
+// like 2024-06-01T18:00 or 2024-06-01T18:00:00+02:00, written without
+// quotes. Time reads it.
+type DateValue struct {
+	Token tokens.Token
+	Value string // As written
+}
+
+func (dv *DateValue) TokenLiteral() string { return dv.Token.Literal }
+func (dv *DateValue) Pos() Position        { return pos(dv.Token) }
+func (dv *DateValue) Start() Position      { return pos(dv.Token) }
+func (dv *DateValue) End() Position        { return end(dv.Token) }
+func (dv *DateValue) valueNode()           {}
+
+// BoolValue represents a boolean literal, true or false
+type BoolValue struct {
+	Token tokens.Token
+	Value bool
+}
+
+func (bv *BoolValue) TokenLiteral() string { return bv.Token.Literal }
+func (bv *BoolValue) Pos() Position        { return pos(bv.Token) }
+func (bv *BoolValue) Start() Position      { return pos(bv.Token) }
+func (bv *BoolValue) End() Position        { return end(bv.Token) }
+func (bv *BoolValue) valueNode()           {}
+
+// TemplateValue represents a string with ${name} references in it, like
+// "Hello, ${user_name}!"
+type TemplateValue struct {
+	Token tokens.Token
+	Parts []Value // StringValue text and VariableRef references, in order
+}
+
+func (tv *TemplateValue) TokenLiteral() string { return tv.Token.Literal }
+func (tv *TemplateValue) Pos() Position        { return pos(tv.Token) }
+func (tv *TemplateValue) Start() Position      { return pos(tv.Token) }
+func (tv *TemplateValue) End() Position        { return end(tv.Token) }
+func (tv *TemplateValue) valueNode()           {}
+
+// VariableRef represents a variable reference like $label_name, or
+// $label_name ?? "fallback"
+type VariableRef struct {
+	Token   tokens.Token
+	Name    string
+	Default Value // Used when Name isn't defined; nil without ??
+}
+
+// End returns the end of the reference, or of its fallback after ??
+func (vr *VariableRef) End() Position {
+	if vr.Default != nil {
+		return vr.Default.End()
+	}
+	return end(vr.Token)
 }
 
 func (vr *VariableRef) TokenLiteral() string { return vr.Token.Literal }
+func (vr *VariableRef) Pos() Position        { return pos(vr.Token) }
+func (vr *VariableRef) Start() Position      { return pos(vr.Token) }
 func (vr *VariableRef) valueNode()           {}
 
+// PipeValue represents a $reference passed through filters in turn, like
+// $intro | upper | truncate(80)
+type PipeValue struct {
+	Token   tokens.Token // The first |
+	Value   Value        // The reference, with its fallback if it has one
+	Filters []Filter
+}
+
+func (pv *PipeValue) TokenLiteral() string { return pv.Token.Literal }
+func (pv *PipeValue) Pos() Position        { return pv.Value.Pos() }
+func (pv *PipeValue) Start() Position      { return pv.Value.Start() }
+func (pv *PipeValue) End() Position        { return end(pv.Filters[len(pv.Filters)-1].Close) }
+func (pv *PipeValue) valueNode()           {}
+
+// Filter is one step of a PipeValue, like upper or truncate(80)
+type Filter struct {
+	Token tokens.Token // The filter's name, or its CALL token with the '('
+	Name  string
+	Args  []Value
+	Close tokens.Token // The closing ), or the name of a filter without arguments
+}
+
+// String formats the filter as it's written, like truncate(80)
+func (f Filter) String() string {
+	if len(f.Args) == 0 {
+		return f.Name
+	}
+	args := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		args[i] = ValueString(arg)
+	}
+	return f.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
 // ArrayValue represents an array of values like [1, 2, 3] or [$ref1, $ref2]
 type ArrayValue struct {
 	Token  tokens.Token
 	Values []Value
+	Close  tokens.Token // The closing ]
 }
 
 func (av *ArrayValue) TokenLiteral() string { return av.Token.Literal }
+func (av *ArrayValue) Pos() Position        { return pos(av.Token) }
+func (av *ArrayValue) Start() Position      { return pos(av.Token) }
+func (av *ArrayValue) End() Position        { return end(av.Close) }
 func (av *ArrayValue) valueNode()           {}
 
+// MapValue represents nested key/value pairs like
+// { color = "red", padding = "large" }
+type MapValue struct {
+	Token   tokens.Token
+	Entries []Property   // In source order, keys unique
+	Close   tokens.Token // The closing }
+}
+
+func (mv *MapValue) TokenLiteral() string { return mv.Token.Literal }
+func (mv *MapValue) Pos() Position        { return pos(mv.Token) }
+func (mv *MapValue) Start() Position      { return pos(mv.Token) }
+func (mv *MapValue) End() Position        { return end(mv.Close) }
+func (mv *MapValue) valueNode()           {}
+
+// Get returns the value of a map's key
+func (mv *MapValue) Get(key string) (Value, bool) {
+	for _, e := range mv.Entries {
+		if e.Name == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// CallValue represents a call to a build-time function, like now() or
+// date($page.date, "Monday 2 January"), worked out when the page is built
+type CallValue struct {
+	Token tokens.Token // The CALL token, with the function's name
+	Name  string
+	Args  []Value
+	Close tokens.Token // The closing )
+}
+
+func (cv *CallValue) TokenLiteral() string { return cv.Token.Literal }
+func (cv *CallValue) Pos() Position        { return pos(cv.Token) }
+func (cv *CallValue) Start() Position      { return pos(cv.Token) }
+func (cv *CallValue) End() Position        { return end(cv.Close) }
+func (cv *CallValue) valueNode()           {}
+
 // CodeBlockValue represents code content inside { }
 type CodeBlockValue struct {
 	Token   tokens.Token
@@ -93,6 +420,9 @@ type CodeBlockValue struct {
 }
 
 func (cb *CodeBlockValue) TokenLiteral() string { return cb.Token.Literal }
+func (cb *CodeBlockValue) Pos() Position        { return pos(cb.Token) }
+func (cb *CodeBlockValue) Start() Position      { return pos(cb.Token) }
+func (cb *CodeBlockValue) End() Position        { return end(cb.Token) }
 func (cb *CodeBlockValue) valueNode()           {}
 
 // Property represents a property assignment like label = "value"
@@ -140,6 +470,26 @@ func GetTagName(t tokens.TokenType) string {
 		return "italic"
 	case tokens.CODE_START, tokens.CODE_END:
 		return "code"
+	case tokens.FAQ_START, tokens.FAQ_END:
+		return "faq"
+	case tokens.QUESTION_START, tokens.QUESTION_END:
+		return "question"
+	case tokens.ANSWER_START, tokens.ANSWER_END:
+		return "answer"
+	case tokens.EVENT_START, tokens.EVENT_END:
+		return "event"
+	case tokens.CONTACT_START, tokens.CONTACT_END:
+		return "contact"
+	case tokens.QUERY_START, tokens.QUERY_END:
+		return "query"
+	case tokens.NAV_START, tokens.NAV_END:
+		return "nav"
+	case tokens.ARTICLE_START, tokens.ARTICLE_END:
+		return "article"
+	case tokens.SECTION_START, tokens.SECTION_END:
+		return "section"
+	case tokens.ASIDE_START, tokens.ASIDE_END:
+		return "aside"
 	case tokens.TOP_OF_PAGE_START, tokens.TOP_OF_PAGE_END:
 		return "top-of-page"
 	case tokens.MID_PAGE_START, tokens.MID_PAGE_END:
@@ -147,6 +497,9 @@ func GetTagName(t tokens.TokenType) string {
 	case tokens.BOTTOM_OF_PAGE_START, tokens.BOTTOM_OF_PAGE_END:
 		return "bottom-of-page"
 	}
+	if name, ok := tokens.CustomTagName(t); ok {
+		return name
+	}
 	return ""
 }
 
@@ -0,0 +1,159 @@
+package ast
+
+// Clone returns a deep copy of node: changing the copy, its properties, or
+// anything under it leaves the original untouched, so a transformation can
+// work on a copy of a parsed document. Tokens are copied with their nodes.
+func Clone[N Node](node N) N {
+	return cloneNode(node).(N)
+}
+
+// cloneNode copies any node. Node types it doesn't know are returned as
+// they are.
+func cloneNode(node Node) Node {
+	switch n := node.(type) {
+	case *Document:
+		doc := *n
+		doc.Meta = cloneProperties(n.Meta)
+		doc.Defines = cloneProperties(n.Defines)
+		if n.Presets != nil {
+			doc.Presets = make(map[string]map[string]Value, len(n.Presets))
+			for name, props := range n.Presets {
+				doc.Presets[name] = cloneProperties(props)
+			}
+		}
+		if n.Sections != nil {
+			doc.Sections = make([]*PageSection, len(n.Sections))
+			for i, section := range n.Sections {
+				doc.Sections[i] = cloneNode(section).(*PageSection)
+			}
+		}
+		doc.Comments = n.Comments.remap(n, &doc)
+		return &doc
+	case *PageSection:
+		section := *n
+		section.Properties = cloneProperties(n.Properties)
+		section.Children = cloneNodes(n.Children)
+		return &section
+	case *Element:
+		elem := *n
+		elem.Properties = cloneProperties(n.Properties)
+		elem.Children = cloneNodes(n.Children)
+		return &elem
+	case *TextNode:
+		text := *n
+		return &text
+	case *Conditional:
+		cond := *n
+		cond.Left, cond.Right = cloneValue(n.Left), cloneValue(n.Right)
+		cond.Then, cond.Else = cloneNodes(n.Then), cloneNodes(n.Else)
+		return &cond
+	case *Repeat:
+		repeat := *n
+		repeat.Over = cloneValue(n.Over)
+		repeat.Children = cloneNodes(n.Children)
+		return &repeat
+	case Value:
+		return cloneValue(n)
+	}
+	return node
+}
+
+// cloneNodes copies a list of nodes, keeping nil as nil
+func cloneNodes(nodes []Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	out := make([]Node, len(nodes))
+	for i, node := range nodes {
+		out[i] = cloneNode(node)
+	}
+	return out
+}
+
+// cloneProperties copies a property set, keeping nil as nil
+func cloneProperties(props map[string]Value) map[string]Value {
+	if props == nil {
+		return nil
+	}
+	out := make(map[string]Value, len(props))
+	for name, val := range props {
+		out[name] = cloneValue(val)
+	}
+	return out
+}
+
+// cloneValue copies a value and any values inside it
+func cloneValue(val Value) Value {
+	switch v := val.(type) {
+	case *StringValue:
+		sv := *v
+		return &sv
+	case *NumberValue:
+		nv := *v
+		return &nv
+	case *DimensionValue:
+		dv := *v
+		return &dv
+	case *ColorValue:
+		cv := *v
+		return &cv
+	case *DateValue:
+		dv := *v
+		return &dv
+	case *BoolValue:
+		bv := *v
+		return &bv
+	case *VariableRef:
+		vr := *v
+		if v.Default != nil {
+			vr.Default = cloneValue(v.Default)
+		}
+		return &vr
+	case *CodeBlockValue:
+		cb := *v
+		return &cb
+	case *TemplateValue:
+		tv := *v
+		tv.Parts = cloneValues(v.Parts)
+		return &tv
+	case *ArrayValue:
+		av := *v
+		av.Values = cloneValues(v.Values)
+		return &av
+	case *CallValue:
+		cv := *v
+		cv.Args = cloneValues(v.Args)
+		return &cv
+	case *PipeValue:
+		pv := *v
+		pv.Value = cloneValue(v.Value)
+		pv.Filters = make([]Filter, len(v.Filters))
+		for i, filter := range v.Filters {
+			filter.Args = cloneValues(filter.Args)
+			pv.Filters[i] = filter
+		}
+		return &pv
+	case *MapValue:
+		mv := *v
+		if v.Entries != nil {
+			mv.Entries = make([]Property, len(v.Entries))
+			for i, e := range v.Entries {
+				mv.Entries[i] = Property{Name: e.Name, Value: cloneValue(e.Value)}
+			}
+		}
+		return &mv
+	}
+	return val
+}
+
+// cloneValues copies a list of values, keeping nil as nil
+func cloneValues(vals []Value) []Value {
+	if vals == nil {
+		return nil
+	}
+	out := make([]Value, len(vals))
+	for i, val := range vals {
+		out[i] = cloneValue(val)
+	}
+	return out
+}
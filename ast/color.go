@@ -0,0 +1,122 @@
+package ast
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RGBA returns the color's red, green, and blue channels and its alpha,
+// from 0 to 1. It reads #rgb, #rgba, #rrggbb, and #rrggbbaa hex colors and
+// the rgb(), rgba(), hsl(), and hsla() functions, with commas or CSS's
+// space-separated form. ok is false for anything else.
+func (cv *ColorValue) RGBA() (r, g, b uint8, a float64, ok bool) {
+	if hex, isHex := strings.CutPrefix(cv.Value, "#"); isHex {
+		return hexRGBA(hex)
+	}
+
+	name, rest, found := strings.Cut(cv.Value, "(")
+	args, closed := strings.CutSuffix(rest, ")")
+	if !found || !closed {
+		return 0, 0, 0, 0, false
+	}
+	fields := strings.Fields(strings.NewReplacer(",", " ", "/", " ").Replace(args))
+	if len(fields) != 3 && len(fields) != 4 {
+		return 0, 0, 0, 0, false
+	}
+	a = 1
+	if len(fields) == 4 {
+		if a, ok = fraction(fields[3], 1); !ok || a > 1 {
+			return 0, 0, 0, 0, false
+		}
+	}
+
+	switch name {
+	case "rgb", "rgba":
+		var channels [3]uint8
+		for i, field := range fields[:3] {
+			c, ok := fraction(field, 255)
+			if !ok || c > 255 {
+				return 0, 0, 0, 0, false
+			}
+			channels[i] = uint8(math.Round(c))
+		}
+		return channels[0], channels[1], channels[2], a, true
+	case "hsl", "hsla":
+		h, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "deg"), 64)
+		s, sok := percent(fields[1])
+		l, lok := percent(fields[2])
+		if err != nil || !sok || !lok {
+			return 0, 0, 0, 0, false
+		}
+		r, g, b = hslToRGB(h, s, l)
+		return r, g, b, a, true
+	}
+	return 0, 0, 0, 0, false
+}
+
+// hexRGBA reads the digits of a hex color, 3, 4, 6, or 8 of them
+func hexRGBA(hex string) (r, g, b uint8, a float64, ok bool) {
+	if len(hex) == 3 || len(hex) == 4 {
+		var long strings.Builder
+		for _, c := range hex {
+			long.WriteString(string(c) + string(c))
+		}
+		hex = long.String()
+	}
+	if len(hex) != 6 && len(hex) != 8 {
+		return 0, 0, 0, 0, false
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, 0, false
+	}
+	if len(hex) == 6 {
+		return uint8(n >> 16), uint8(n >> 8), uint8(n), 1, true
+	}
+	return uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), float64(uint8(n)) / 255, true
+}
+
+// fraction reads a channel written as a number or as a percentage of max
+func fraction(s string, max float64) (float64, bool) {
+	if _, isPercent := strings.CutSuffix(s, "%"); isPercent {
+		p, ok := percent(s)
+		return p * max, ok
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil && n >= 0
+}
+
+// percent reads a percentage like 50% as a fraction from 0 to 1
+func percent(s string) (float64, bool) {
+	number, isPercent := strings.CutSuffix(s, "%")
+	n, err := strconv.ParseFloat(number, 64)
+	return n / 100, isPercent && err == nil && n >= 0 && n <= 100
+}
+
+// hslToRGB converts a hue in degrees and saturation and lightness from 0
+// to 1 to RGB channels
+func hslToRGB(h, s, l float64) (r, g, b uint8) {
+	h = math.Mod(math.Mod(h, 360)+360, 360) / 360
+	channel := func(t float64) uint8 {
+		q := l + s - l*s
+		if l < 0.5 {
+			q = l * (1 + s)
+		}
+		p := 2*l - q
+		t = math.Mod(t+1, 1)
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(math.Round(v * 255))
+	}
+	return channel(h + 1.0/3), channel(h), channel(h - 1.0/3)
+}
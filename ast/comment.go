@@ -0,0 +1,101 @@
+package ast
+
+import (
+	"strings"
+
+	"lpml/tokens"
+)
+
+// Comment is a // line or /* block */ comment, as written
+type Comment struct {
+	Token tokens.Token
+	Text  string // With its slashes and stars
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) Pos() Position        { return pos(c.Token) }
+func (c *Comment) Start() Position      { return pos(c.Token) }
+func (c *Comment) End() Position        { return end(c.Token) }
+
+// CommentMap holds a document's comments, attached to the nodes beside
+// them: the comments on the lines just above a node, with no blank line
+// between, lead it, and one after a node on the line it ends on, or after
+// an element's opening tag, trails it. A comment beside no node, like one
+// before a closing tag, is only in List. A node Rewrite replaces loses
+// its comments; Clone keeps them.
+type CommentMap struct {
+	List     []*Comment          // Every comment in the document's own file, in source order
+	Leading  map[Node][]*Comment // By the node they lead, in source order
+	Trailing map[Node]*Comment   // By the node it trails
+}
+
+// Doc returns the comments leading node as text, for documentation: each
+// line without its //, or the /* and */ around it, and the leading * of a
+// block comment's lines. It's "" if node has none, or cm is nil.
+func (cm *CommentMap) Doc(node Node) string {
+	if cm == nil {
+		return ""
+	}
+	var lines []string
+	for _, c := range cm.Leading[node] {
+		if text, ok := strings.CutPrefix(c.Text, "//"); ok {
+			lines = append(lines, strings.TrimSpace(text))
+			continue
+		}
+		text := strings.TrimSuffix(strings.TrimPrefix(c.Text, "/*"), "*/")
+		for _, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+			line = strings.TrimSpace(line)
+			if rest, ok := strings.CutPrefix(line, "*"); ok {
+				line = strings.TrimSpace(rest)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// remap returns a copy of cm for a clone of the document it belongs to,
+// its nodes swapped for the clone's: both trees have the same shape, so
+// Walk visits their nodes in the same order
+func (cm *CommentMap) remap(from, to *Document) *CommentMap {
+	if cm == nil {
+		return nil
+	}
+	var before, after []Node
+	Inspect(from, func(n Node) bool {
+		if n != nil {
+			before = append(before, n)
+		}
+		return true
+	})
+	Inspect(to, func(n Node) bool {
+		if n != nil {
+			after = append(after, n)
+		}
+		return true
+	})
+
+	copies := make(map[*Comment]*Comment, len(cm.List))
+	clone := func(c *Comment) *Comment {
+		if copies[c] == nil {
+			cc := *c
+			copies[c] = &cc
+		}
+		return copies[c]
+	}
+	out := &CommentMap{Leading: make(map[Node][]*Comment), Trailing: make(map[Node]*Comment)}
+	for _, c := range cm.List {
+		out.List = append(out.List, clone(c))
+	}
+	for i, n := range before {
+		if leading, ok := cm.Leading[n]; ok {
+			for _, c := range leading {
+				out.Leading[after[i]] = append(out.Leading[after[i]], clone(c))
+			}
+		}
+		if c, ok := cm.Trailing[n]; ok {
+			out.Trailing[after[i]] = clone(c)
+		}
+	}
+	return out
+}
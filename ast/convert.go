@@ -0,0 +1,120 @@
+package ast
+
+import (
+	"strconv"
+	"time"
+
+	"lpml/tokens"
+)
+
+// StringOf returns the text of a string literal
+func StringOf(val Value) (string, bool) {
+	if sv, ok := val.(*StringValue); ok {
+		return sv.Value, true
+	}
+	return "", false
+}
+
+// NumberOf returns the value of a number literal
+func NumberOf(val Value) (float64, bool) {
+	nv, ok := val.(*NumberValue)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(nv.Value, 64)
+	return n, err == nil
+}
+
+// DimensionOf returns the number and unit of a dimension like 16px
+func DimensionOf(val Value) (float64, string, bool) {
+	dv, ok := val.(*DimensionValue)
+	if !ok {
+		return 0, "", false
+	}
+	n, err := strconv.ParseFloat(dv.Value, 64)
+	return n, dv.Unit, err == nil
+}
+
+// ColorOf returns a color literal as written
+func ColorOf(val Value) (string, bool) {
+	if cv, ok := val.(*ColorValue); ok {
+		return cv.Value, true
+	}
+	return "", false
+}
+
+// DateOf returns a date literal as a time, see DateValue.Time
+func DateOf(val Value) (time.Time, bool) {
+	if dv, ok := val.(*DateValue); ok {
+		return dv.Time()
+	}
+	return time.Time{}, false
+}
+
+// BoolOf returns the value of a true or false literal
+func BoolOf(val Value) (bool, bool) {
+	if bv, ok := val.(*BoolValue); ok {
+		return bv.Value, true
+	}
+	return false, false
+}
+
+// RefName returns the name a $reference refers to, without the $
+func RefName(val Value) (string, bool) {
+	if vr, ok := val.(*VariableRef); ok {
+		return vr.Name, true
+	}
+	return "", false
+}
+
+// ItemsOf returns the values of an array
+func ItemsOf(val Value) ([]Value, bool) {
+	if av, ok := val.(*ArrayValue); ok {
+		return av.Values, true
+	}
+	return nil, false
+}
+
+// NewString returns a string literal value, positioned nowhere, for
+// programs that build or rewrite documents
+func NewString(s string) *StringValue {
+	return &StringValue{Token: tokens.Token{Type: tokens.STRING, Literal: s}, Value: s}
+}
+
+// NewNumber returns a number literal value
+func NewNumber(n float64) *NumberValue {
+	s := strconv.FormatFloat(n, 'f', -1, 64)
+	return &NumberValue{Token: tokens.Token{Type: tokens.NUMBER, Literal: s}, Value: s}
+}
+
+// NewDimension returns a number with a unit, like NewDimension(16, "px")
+func NewDimension(n float64, unit string) *DimensionValue {
+	s := strconv.FormatFloat(n, 'f', -1, 64)
+	return &DimensionValue{Token: tokens.Token{Type: tokens.DIMENSION, Literal: s + unit}, Value: s, Unit: unit}
+}
+
+// NewColor returns a color literal value, written like #ff6600
+func NewColor(color string) *ColorValue {
+	return &ColorValue{Token: tokens.Token{Type: tokens.COLOR, Literal: color}, Value: color}
+}
+
+// NewDate returns a date literal value for t, written as a date alone at
+// midnight UTC and as an RFC 3339 date and time otherwise
+func NewDate(t time.Time) *DateValue {
+	s := t.Format(time.RFC3339)
+	if t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)) {
+		s = t.Format(time.DateOnly)
+	}
+	return &DateValue{Token: tokens.Token{Type: tokens.DATE, Literal: s}, Value: s}
+}
+
+// NewBool returns a true or false literal value
+func NewBool(b bool) *BoolValue {
+	s := strconv.FormatBool(b)
+	return &BoolValue{Token: tokens.Token{Type: tokens.BOOL, Literal: s}, Value: b}
+}
+
+// NewRef returns a $reference to name, given without the $
+func NewRef(name string) *VariableRef {
+	return &VariableRef{Token: tokens.Token{Type: tokens.DOLLAR, Literal: name}, Name: name}
+}
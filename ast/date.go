@@ -0,0 +1,70 @@
+package ast
+
+import (
+	"strings"
+	"time"
+)
+
+// dateLayouts are the ways a date literal may be written, from most to
+// least specific
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	time.DateOnly,
+}
+
+// Time returns the date as a time. A date without a time is midnight UTC,
+// and a time without a UTC offset is read as UTC. ok is false for a date
+// that isn't one, like 2024-02-30.
+func (dv *DateValue) Time() (t time.Time, ok bool) {
+	for _, layout := range dateLayouts {
+		if parsed, err := time.Parse(layout, dv.Value); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// HasClock reports whether the date has a time of day, like
+// 2024-06-01T18:00, rather than being a day alone
+func (dv *DateValue) HasClock() bool {
+	return strings.Contains(dv.Value, "T")
+}
+
+// DateFormats are the named layouts a date_format property can take; any
+// other date_format is a Go time layout, like "January 2, 2006"
+var DateFormats = map[string]string{
+	"long":    "2 January 2006",
+	"short":   "2 Jan 2006",
+	"iso":     time.DateOnly,
+	"rfc3339": time.RFC3339,
+}
+
+// Format writes the date in a date_format: one of DateFormats, a Go time
+// layout, or "" for long. A long or short date with a time of day has the
+// time added, as in "1 June 2024, 18:00".
+func (dv *DateValue) Format(format string) string {
+	t, ok := dv.Time()
+	if !ok {
+		return dv.Value
+	}
+	return FormatTime(t, dv.HasClock(), format)
+}
+
+// FormatTime writes t in a date_format the way DateValue.Format does,
+// with clock saying whether it has a time of day to show
+func FormatTime(t time.Time, clock bool, format string) string {
+	if format == "" {
+		format = "long"
+	}
+	layout, named := DateFormats[format]
+	if !named {
+		return t.Format(format)
+	}
+	if clock && (format == "long" || format == "short") {
+		layout += ", 15:04"
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,188 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lpml/tokens"
+)
+
+// String returns the document as an indented tree, see Dump
+func (d *Document) String() string {
+	return Dump(d)
+}
+
+// Dump returns node and everything under it as an indented tree for
+// debugging: one line per section, element, block, and property, with
+// where each starts: line:column for tags, the line for properties.
+// Properties are listed in name order.
+func Dump(node Node) string {
+	var sb strings.Builder
+	dumpNode(&sb, node, 0)
+	return sb.String()
+}
+
+// dumpNode writes one node and its contents at depth
+func dumpNode(sb *strings.Builder, node Node, depth int) {
+	line := func(tok tokens.Token, text string) {
+		sb.WriteString(strings.Repeat("  ", depth) + text)
+		if tok.Line > 0 {
+			sb.WriteString(fmt.Sprintf(" @%d:%d", tok.Line, tok.Column))
+		}
+		sb.WriteString("\n")
+	}
+
+	switch n := node.(type) {
+	case *Document:
+		sb.WriteString("document\n")
+		if n.Meta != nil {
+			sb.WriteString("  meta\n")
+			dumpProperties(sb, n.Meta, 2)
+		}
+		if len(n.Defines) > 0 {
+			sb.WriteString("  define\n")
+			dumpProperties(sb, n.Defines, 2)
+		}
+		for _, name := range sortedNames(n.Presets) {
+			sb.WriteString("  preset " + name + "\n")
+			dumpProperties(sb, n.Presets[name], 2)
+		}
+		for _, section := range n.Sections {
+			dumpNode(sb, section, depth+1)
+		}
+	case *PageSection:
+		line(n.Token, "section "+n.Type)
+		dumpProperties(sb, n.Properties, depth+1)
+		dumpNodes(sb, n.Children, depth+1)
+	case *Element:
+		line(n.Token, n.TagType)
+		dumpProperties(sb, n.Properties, depth+1)
+		dumpNodes(sb, n.Children, depth+1)
+	case *TextNode:
+		line(n.Token, "text "+strconv.Quote(n.Value))
+	case *Conditional:
+		line(n.Token, "if cond="+strconv.Quote(n.Token.Literal))
+		sb.WriteString(strings.Repeat("  ", depth+1) + "then\n")
+		dumpNodes(sb, n.Then, depth+2)
+		if len(n.Else) > 0 {
+			sb.WriteString(strings.Repeat("  ", depth+1) + "else\n")
+			dumpNodes(sb, n.Else, depth+2)
+		}
+	case *Repeat:
+		line(n.Token, fmt.Sprintf("repeat over=%s as=%s", ValueString(n.Over), n.As))
+		dumpNodes(sb, n.Children, depth+1)
+	default:
+		line(tokens.Token{}, fmt.Sprintf("%T %q", node, node.TokenLiteral()))
+	}
+}
+
+// dumpNodes writes each of nodes at depth
+func dumpNodes(sb *strings.Builder, nodes []Node, depth int) {
+	for _, child := range nodes {
+		dumpNode(sb, child, depth)
+	}
+}
+
+// dumpProperties writes a property set at depth, in name order, each with
+// the line its value starts on. Code blocks are summarized to keep the tree
+// one line per property.
+func dumpProperties(sb *strings.Builder, props map[string]Value, depth int) {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		val := props[name]
+		text := ValueString(val)
+		if code, ok := val.(*CodeBlockValue); ok {
+			text = fmt.Sprintf("{ code, %d lines }", strings.Count(strings.Trim(code.Content, "\n"), "\n")+1)
+		}
+		sb.WriteString(fmt.Sprintf("%s%s = %s", strings.Repeat("  ", depth), name, text))
+		if line := val.Pos().Line; line > 0 {
+			sb.WriteString(fmt.Sprintf(" @%d", line))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// sortedNames returns the names of presets in order
+func sortedNames(presets map[string]map[string]Value) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValueString writes a value as LPML source, so values that are equal
+// however they were laid out give the same string. Code blocks are written
+// whole.
+func ValueString(val Value) string {
+	switch v := val.(type) {
+	case nil:
+		return "<nil>"
+	case *StringValue:
+		return strconv.Quote(v.Value)
+	case *NumberValue:
+		return v.Value
+	case *DimensionValue:
+		return v.Value + v.Unit
+	case *ColorValue:
+		return v.Value
+	case *DateValue:
+		return v.Value
+	case *BoolValue:
+		return strconv.FormatBool(v.Value)
+	case *VariableRef:
+		if v.Default != nil {
+			return "$" + v.Name + " ?? " + ValueString(v.Default)
+		}
+		return "$" + v.Name
+	case *TemplateValue:
+		var sb strings.Builder
+		for _, part := range v.Parts {
+			if ref, ok := part.(*VariableRef); ok {
+				sb.WriteString("${" + ref.Name + "}")
+			} else if sv, ok := part.(*StringValue); ok {
+				sb.WriteString(sv.Value)
+			}
+		}
+		return strconv.Quote(sb.String())
+	case *ArrayValue:
+		parts := make([]string, len(v.Values))
+		for i, item := range v.Values {
+			parts[i] = ValueString(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *MapValue:
+		if len(v.Entries) == 0 {
+			return "{}"
+		}
+		parts := make([]string, len(v.Entries))
+		for i, e := range v.Entries {
+			parts[i] = e.Name + " = " + ValueString(e.Value)
+		}
+		return "{ " + strings.Join(parts, ", ") + " }"
+	case *CallValue:
+		parts := make([]string, len(v.Args))
+		for i, arg := range v.Args {
+			parts[i] = ValueString(arg)
+		}
+		return v.Name + "(" + strings.Join(parts, ", ") + ")"
+	case *PipeValue:
+		var sb strings.Builder
+		sb.WriteString(ValueString(v.Value))
+		for _, filter := range v.Filters {
+			sb.WriteString(" | " + filter.String())
+		}
+		return sb.String()
+	case *CodeBlockValue:
+		return "{" + v.Content + "}"
+	}
+	return val.TokenLiteral()
+}
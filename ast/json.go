@@ -0,0 +1,206 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonNode is a node as JSON: its type, then whichever of the other
+// fields that type has
+type jsonNode struct {
+	Type       string                          `json:"type"`
+	Version    int                             `json:"version,omitempty"` // Documents
+	Section    string                          `json:"section,omitempty"` // "top", "mid", or "bottom"
+	Tag        string                          `json:"tag,omitempty"`
+	File       string                          `json:"file,omitempty"`
+	Name       string                          `json:"name,omitempty"` // References and calls
+	Value      any                             `json:"value,omitempty"`
+	Unit       string                          `json:"unit,omitempty"`
+	Not        bool                            `json:"not,omitempty"`
+	Left       *jsonNode                       `json:"left,omitempty"`
+	Op         string                          `json:"op,omitempty"`
+	Right      *jsonNode                       `json:"right,omitempty"`
+	Over       *jsonNode                       `json:"over,omitempty"`
+	As         string                          `json:"as,omitempty"`
+	Default    *jsonNode                       `json:"default,omitempty"`
+	Start      *jsonPosition                   `json:"start,omitempty"` // Omitted for nodes that weren't parsed
+	End        *jsonPosition                   `json:"end,omitempty"`
+	Meta       map[string]*jsonNode            `json:"meta,omitempty"`
+	Defines    map[string]*jsonNode            `json:"defines,omitempty"`
+	Presets    map[string]map[string]*jsonNode `json:"presets,omitempty"`
+	Properties map[string]*jsonNode            `json:"properties,omitempty"`
+	Items      []*jsonNode                     `json:"items,omitempty"` // Arrays, the parts of a template, a call's or filter's arguments, and a pipe's filters
+	Entries    []jsonEntry                     `json:"entries,omitempty"`
+	Sections   []*jsonNode                     `json:"sections,omitempty"`
+	Children   []*jsonNode                     `json:"children,omitempty"`
+	Then       []*jsonNode                     `json:"then,omitempty"`
+	Else       []*jsonNode                     `json:"else,omitempty"`
+	Leading    []*jsonNode                     `json:"leading,omitempty"` // Comments just above the node
+	Trailing   *jsonNode                       `json:"trailing,omitempty"`
+	Comments   []*jsonNode                     `json:"comments,omitempty"` // A document's comments, in source order
+}
+
+// jsonPosition is a Position as JSON
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// jsonEntry is one key of a map value, kept in source order
+type jsonEntry struct {
+	Name  string    `json:"name"`
+	Value *jsonNode `json:"value"`
+}
+
+// JSON returns node and everything under it as indented JSON, for tools
+// outside Go and golden-file tests: every node with its type, properties,
+// and span. Properties are objects keyed by name; the entries of a map
+// value, whose order matters, are a list. A document's comments are listed
+// on it, and again on the nodes they lead or trail.
+func JSON(node Node) ([]byte, error) {
+	c := &jsonConverter{}
+	if doc, ok := node.(*Document); ok {
+		c.comments = doc.Comments
+	}
+	out, err := json.MarshalIndent(c.toJSON(node), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// jsonConverter converts nodes with the comments beside them
+type jsonConverter struct {
+	comments *CommentMap // nil if there are none
+}
+
+// toJSON converts one node and its contents
+func (c *jsonConverter) toJSON(node Node) *jsonNode {
+	if node == nil {
+		return nil
+	}
+	j := &jsonNode{}
+	if start, end := node.Start(), node.End(); start.Line > 0 {
+		j.Start = &jsonPosition{Line: start.Line, Column: start.Column}
+		j.End = &jsonPosition{Line: end.Line, Column: end.Column}
+	}
+
+	switch n := node.(type) {
+	case *Document:
+		j.Type, j.Version = "document", n.Version
+		j.Meta = c.propertiesJSON(n.Meta)
+		j.Defines = c.propertiesJSON(n.Defines)
+		if len(n.Presets) > 0 {
+			j.Presets = make(map[string]map[string]*jsonNode, len(n.Presets))
+			for name, props := range n.Presets {
+				j.Presets[name] = c.propertiesJSON(props)
+			}
+		}
+		for _, section := range n.Sections {
+			j.Sections = append(j.Sections, c.toJSON(section))
+		}
+		if c.comments != nil {
+			for _, comment := range c.comments.List {
+				j.Comments = append(j.Comments, c.toJSON(comment))
+			}
+		}
+	case *PageSection:
+		j.Type, j.Section = "section", n.Type
+		j.Properties = c.propertiesJSON(n.Properties)
+		j.Children = c.nodesJSON(n.Children)
+	case *Element:
+		j.Type, j.Tag, j.File = "element", n.TagType, n.File
+		j.Properties = c.propertiesJSON(n.Properties)
+		j.Children = c.nodesJSON(n.Children)
+	case *TextNode:
+		j.Type, j.Value = "text", n.Value
+	case *Conditional:
+		j.Type, j.Not, j.Op = "if", n.Not, n.Op
+		j.Left, j.Right = c.toJSON(n.Left), c.toJSON(n.Right)
+		j.Then, j.Else = c.nodesJSON(n.Then), c.nodesJSON(n.Else)
+	case *Repeat:
+		j.Type, j.Over, j.As = "repeat", c.toJSON(n.Over), n.As
+		j.Children = c.nodesJSON(n.Children)
+	case *StringValue:
+		j.Type, j.Value = "string", n.Value
+	case *NumberValue:
+		j.Type, j.Value = "number", n.Value
+	case *DimensionValue:
+		j.Type, j.Value, j.Unit = "dimension", n.Value, n.Unit
+	case *ColorValue:
+		j.Type, j.Value = "color", n.Value
+	case *DateValue:
+		j.Type, j.Value = "date", n.Value
+	case *BoolValue:
+		j.Type, j.Value = "bool", n.Value
+	case *VariableRef:
+		j.Type, j.Name, j.Default = "ref", n.Name, c.toJSON(n.Default)
+	case *TemplateValue:
+		j.Type = "template"
+		for _, part := range n.Parts {
+			j.Items = append(j.Items, c.toJSON(part))
+		}
+	case *ArrayValue:
+		j.Type = "array"
+		for _, item := range n.Values {
+			j.Items = append(j.Items, c.toJSON(item))
+		}
+	case *MapValue:
+		j.Type = "map"
+		for _, e := range n.Entries {
+			j.Entries = append(j.Entries, jsonEntry{Name: e.Name, Value: c.toJSON(e.Value)})
+		}
+	case *CallValue:
+		j.Type, j.Name = "call", n.Name
+		for _, arg := range n.Args {
+			j.Items = append(j.Items, c.toJSON(arg))
+		}
+	case *PipeValue:
+		j.Type, j.Value = "pipe", c.toJSON(n.Value)
+		for _, filter := range n.Filters {
+			f := &jsonNode{Type: "filter", Name: filter.Name}
+			for _, arg := range filter.Args {
+				f.Items = append(f.Items, c.toJSON(arg))
+			}
+			j.Items = append(j.Items, f)
+		}
+	case *CodeBlockValue:
+		j.Type, j.Value = "code", n.Content
+	case *Comment:
+		j.Type, j.Value = "comment", n.Text
+	default:
+		j.Type, j.Value = strings.TrimPrefix(fmt.Sprintf("%T", node), "*"), node.TokenLiteral()
+	}
+
+	if c.comments != nil {
+		for _, comment := range c.comments.Leading[node] {
+			j.Leading = append(j.Leading, c.toJSON(comment))
+		}
+		if comment := c.comments.Trailing[node]; comment != nil {
+			j.Trailing = c.toJSON(comment)
+		}
+	}
+	return j
+}
+
+// nodesJSON converts a list of nodes
+func (c *jsonConverter) nodesJSON(nodes []Node) []*jsonNode {
+	var out []*jsonNode
+	for _, node := range nodes {
+		out = append(out, c.toJSON(node))
+	}
+	return out
+}
+
+// propertiesJSON converts a property set
+func (c *jsonConverter) propertiesJSON(props map[string]Value) map[string]*jsonNode {
+	if len(props) == 0 {
+		return nil
+	}
+	out := make(map[string]*jsonNode, len(props))
+	for name, val := range props {
+		out[name] = c.toJSON(val)
+	}
+	return out
+}
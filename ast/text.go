@@ -0,0 +1,230 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+
+	"lpml/tokens"
+)
+
+// TextBlock is a run of visible text from a document
+type TextBlock struct {
+	Level int    // Heading level 1-6, or 0 for body text
+	Text  string // Plain text without markup
+}
+
+// IsHeading reports whether the block came from a heading
+func (tb TextBlock) IsHeading() bool {
+	return tb.Level > 0
+}
+
+// ExtractText returns the document's visible text in reading order, one
+// block per heading, paragraph, list item, cell, button, link, FAQ
+// question and answer, event title, location and description, and contact
+// name and note. Only
+// literal values are included; $references depend on the generator, as
+// does what an [if] or [repeat] shows, so their contents are included
+// once.
+func ExtractText(doc *Document) []TextBlock {
+	var blocks []TextBlock
+	for _, section := range doc.Sections {
+		for _, child := range section.Children {
+			blocks = appendText(blocks, child)
+		}
+	}
+	return blocks
+}
+
+// appendText adds the text blocks under node to blocks
+func appendText(blocks []TextBlock, node Node) []TextBlock {
+	if block, ok := node.(Block); ok {
+		for _, child := range block.Contents() {
+			blocks = appendText(blocks, child)
+		}
+		return blocks
+	}
+	elem, ok := node.(*Element)
+	if !ok {
+		return blocks
+	}
+
+	switch elem.TagType {
+	case "h":
+		return appendBlock(blocks, HeadingLevel(literalProp(elem, "level")), inlineText(elem))
+	case "p", "item", "cell", "btn", "link", "bold", "italic", "question", "answer":
+		return appendBlock(blocks, 0, inlineText(elem))
+	case "event":
+		blocks = appendBlock(blocks, 0, literalProp(elem, "title"))
+		blocks = appendBlock(blocks, 0, literalProp(elem, "location"))
+		return appendBlock(blocks, 0, inlineText(elem))
+	case "contact":
+		blocks = appendBlock(blocks, 0, literalProp(elem, "name"))
+		return appendBlock(blocks, 0, inlineText(elem))
+	case "code", "img", "input":
+		return blocks
+	}
+
+	// Custom tags hold text like paragraphs do
+	if _, ok := tokens.CustomTagName(elem.Token.Type); ok {
+		return appendBlock(blocks, 0, inlineText(elem))
+	}
+
+	// Containers: lists with items arrays, then nested elements
+	if arr, ok := elem.Properties["items"].(*ArrayValue); ok {
+		for _, item := range arr.Values {
+			blocks = appendBlock(blocks, 0, literalText(item))
+		}
+	}
+	for _, child := range elem.Children {
+		blocks = appendText(blocks, child)
+	}
+	return blocks
+}
+
+// appendBlock adds a block unless its text is empty
+func appendBlock(blocks []TextBlock, level int, text string) []TextBlock {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return blocks
+	}
+	return append(blocks, TextBlock{Level: level, Text: text})
+}
+
+// inlineText returns an element's contains text and inline children
+func inlineText(elem *Element) string {
+	var sb strings.Builder
+
+	sb.WriteString(literalProp(elem, "contains"))
+	for _, child := range elem.Children {
+		switch c := child.(type) {
+		case *TextNode:
+			sb.WriteString(c.Value)
+		case *Element:
+			sb.WriteString(inlineText(c))
+		case Block:
+			sb.WriteString(inlineText(&Element{Children: c.Contents()}))
+		}
+	}
+
+	return sb.String()
+}
+
+// literalProp returns a property's literal text, if it has one
+func literalProp(elem *Element, name string) string {
+	if val, ok := elem.Properties[name]; ok {
+		return literalText(val)
+	}
+	return ""
+}
+
+// literalText returns the text of a string or number value
+func literalText(val Value) string {
+	switch v := val.(type) {
+	case *StringValue:
+		return v.Value
+	case *NumberValue:
+		return v.Value
+	case *DimensionValue:
+		return v.Value + v.Unit
+	case *ColorValue:
+		return v.Value
+	case *DateValue:
+		return v.Value
+	case *BoolValue:
+		return strconv.FormatBool(v.Value)
+	case *TemplateValue:
+		var sb strings.Builder
+		for _, part := range v.Parts {
+			sb.WriteString(literalText(part))
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+// HeadingLevel converts a heading's level property to 1-6. It accepts
+// digits and the friendly names "title" (1) and "subtitle" (2); anything
+// else is level 1.
+func HeadingLevel(level string) int {
+	switch level {
+	case "title":
+		return 1
+	case "subtitle":
+		return 2
+	}
+	if n, err := strconv.Atoi(level); err == nil && n >= 1 && n <= 6 {
+		return n
+	}
+	return 1
+}
+
+// ExcerptWords is how many words of body text an automatic excerpt keeps
+const ExcerptWords = 30
+
+// Excerpt returns the document's summary for listings and meta
+// descriptions: the excerpt property of its [meta] block if it has one,
+// else its description, else the first ExcerptWords words of its paragraphs, with an ellipsis
+// when cut short. Headings, buttons and links are left out, since they
+// repeat the title or are navigation. It reads the source as written, so
+// variables are left unresolved and both branches of an [if] are read;
+// Generator.Excerpt gives the text as the page renders.
+func Excerpt(doc *Document) string {
+	for _, key := range []string{"excerpt", "description"} {
+		if val, ok := doc.Meta[key]; ok {
+			return strings.Join(strings.Fields(literalText(val)), " ")
+		}
+	}
+
+	var words []string
+	var visit func(node Node) bool
+	visit = func(node Node) bool {
+		if block, ok := node.(Block); ok {
+			for _, child := range block.Contents() {
+				if visit(child) {
+					return true
+				}
+			}
+			return false
+		}
+		elem, ok := node.(*Element)
+		if !ok {
+			return false
+		}
+		if elem.TagType == "p" {
+			words = append(words, strings.Fields(inlineText(elem))...)
+			return len(words) > ExcerptWords
+		}
+		for _, child := range elem.Children {
+			if visit(child) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, section := range doc.Sections {
+		for _, child := range section.Children {
+			if visit(child) {
+				return strings.TrimRight(strings.Join(words[:ExcerptWords], " "), ",;:.") + "..."
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// WordsPerMinute is the reading speed used for reading-time estimates
+const WordsPerMinute = 200
+
+// WordCount counts the words in a set of text blocks
+func WordCount(blocks []TextBlock) int {
+	count := 0
+	for _, block := range blocks {
+		count += len(strings.Fields(block.Text))
+	}
+	return count
+}
+
+// ReadingMinutes estimates reading time in whole minutes, rounding up so
+// any non-empty text takes at least a minute
+func ReadingMinutes(words int) int {
+	return (words + WordsPerMinute - 1) / WordsPerMinute
+}
@@ -0,0 +1,254 @@
+package ast
+
+import "sort"
+
+// Visitor is called by Walk for each node. If Visit returns a non-nil
+// visitor w, Walk visits the node's children with w, then calls
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree under node depth first, in source order,
+// starting with node itself: a document's front matter, constants,
+// presets, and sections; a section's or element's properties, in name
+// order, then its children; both branches of an [if] with their
+// condition; a [repeat] with the array it repeats over; and the values
+// inside arrays, maps, templates, fallbacks, and calls. Node types it
+// doesn't know are visited, and if they're Blocks, so are their Contents.
+func Walk(node Node, v Visitor) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Document:
+		walkProperties(n.Meta, v)
+		walkProperties(n.Defines, v)
+		for _, name := range sortedNames(n.Presets) {
+			walkProperties(n.Presets[name], v)
+		}
+		for _, section := range n.Sections {
+			Walk(section, v)
+		}
+	case *PageSection:
+		walkProperties(n.Properties, v)
+		walkNodes(n.Children, v)
+	case *Element:
+		walkProperties(n.Properties, v)
+		walkNodes(n.Children, v)
+	case *Conditional:
+		walkValue(n.Left, v)
+		walkValue(n.Right, v)
+		walkNodes(n.Then, v)
+		walkNodes(n.Else, v)
+	case *Repeat:
+		walkValue(n.Over, v)
+		walkNodes(n.Children, v)
+	case *VariableRef:
+		walkValue(n.Default, v)
+	case *TemplateValue:
+		for _, part := range n.Parts {
+			walkValue(part, v)
+		}
+	case *ArrayValue:
+		for _, item := range n.Values {
+			walkValue(item, v)
+		}
+	case *MapValue:
+		for _, e := range n.Entries {
+			walkValue(e.Value, v)
+		}
+	case *CallValue:
+		for _, arg := range n.Args {
+			walkValue(arg, v)
+		}
+	case *PipeValue:
+		walkValue(n.Value, v)
+		for _, filter := range n.Filters {
+			for _, arg := range filter.Args {
+				walkValue(arg, v)
+			}
+		}
+	case Block:
+		walkNodes(n.Contents(), v)
+	}
+
+	v.Visit(nil)
+}
+
+// walkNodes walks each of nodes
+func walkNodes(nodes []Node, v Visitor) {
+	for _, node := range nodes {
+		Walk(node, v)
+	}
+}
+
+// walkValue walks a value that may be missing, like a fallback
+func walkValue(val Value, v Visitor) {
+	if val != nil {
+		Walk(val, v)
+	}
+}
+
+// walkProperties walks a property set in name order
+func walkProperties(props map[string]Value, v Visitor) {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		walkValue(props[name], v)
+	}
+}
+
+// inspector adapts a function to Visitor, for Inspect
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect walks the tree under node like Walk, calling f for each node
+// and descending into its children only if f returns true. f is called
+// with nil after a node's children.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(node, inspector(f))
+}
+
+// Transform is a pass that rewrites a document, like expanding blocks or
+// dropping drafts, for the generator, linters, and optimizers to chain
+type Transform interface {
+	Transform(doc *Document) *Document
+}
+
+// TransformFunc adapts a function to Transform
+type TransformFunc func(doc *Document) *Document
+
+func (f TransformFunc) Transform(doc *Document) *Document { return f(doc) }
+
+// Apply runs passes over doc in order, each on what the one before
+// returned. Passes may change the document they're given; Clone it first
+// to keep the original.
+func Apply(doc *Document, passes ...Transform) *Document {
+	for _, pass := range passes {
+		doc = pass.Transform(doc)
+	}
+	return doc
+}
+
+// Rewrite replaces each node under node, bottom up, with what f returns
+// for it, then returns f(node). Returning the node keeps it. Returning
+// nil removes it: from its list of children, or its property. A property
+// replaced by a node that isn't a Value, or a section by one that isn't a
+// *PageSection, is removed too. The tree is changed in place; Clone it
+// first to keep the original.
+func Rewrite(node Node, f func(Node) Node) Node {
+	switch n := node.(type) {
+	case *Document:
+		rewriteProperties(n.Meta, f)
+		rewriteProperties(n.Defines, f)
+		for _, props := range n.Presets {
+			rewriteProperties(props, f)
+		}
+		sections := n.Sections[:0]
+		for _, section := range n.Sections {
+			if s, ok := Rewrite(section, f).(*PageSection); ok && s != nil {
+				sections = append(sections, s)
+			}
+		}
+		n.Sections = sections
+	case *PageSection:
+		rewriteProperties(n.Properties, f)
+		n.Children = rewriteNodes(n.Children, f)
+	case *Element:
+		rewriteProperties(n.Properties, f)
+		n.Children = rewriteNodes(n.Children, f)
+	case *Conditional:
+		n.Left, n.Right = rewriteValue(n.Left, f), rewriteValue(n.Right, f)
+		n.Then, n.Else = rewriteNodes(n.Then, f), rewriteNodes(n.Else, f)
+	case *Repeat:
+		n.Over = rewriteValue(n.Over, f)
+		n.Children = rewriteNodes(n.Children, f)
+	case *VariableRef:
+		n.Default = rewriteValue(n.Default, f)
+	case *TemplateValue:
+		n.Parts = rewriteValues(n.Parts, f)
+	case *ArrayValue:
+		n.Values = rewriteValues(n.Values, f)
+	case *CallValue:
+		n.Args = rewriteValues(n.Args, f)
+	case *PipeValue:
+		// A pipe with nothing to filter is removed with its value
+		if n.Value = rewriteValue(n.Value, f); n.Value == nil {
+			return nil
+		}
+		for i := range n.Filters {
+			n.Filters[i].Args = rewriteValues(n.Filters[i].Args, f)
+		}
+	case *MapValue:
+		entries := n.Entries[:0]
+		for _, e := range n.Entries {
+			if val := rewriteValue(e.Value, f); val != nil {
+				entries = append(entries, Property{Name: e.Name, Value: val})
+			}
+		}
+		n.Entries = entries
+	}
+	return f(node)
+}
+
+// rewriteNodes rewrites a list of nodes, leaving out those removed
+func rewriteNodes(nodes []Node, f func(Node) Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	out := nodes[:0]
+	for _, node := range nodes {
+		if node = Rewrite(node, f); node != nil {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// rewriteValues rewrites a list of values, leaving out those removed
+func rewriteValues(vals []Value, f func(Node) Node) []Value {
+	if vals == nil {
+		return nil
+	}
+	out := vals[:0]
+	for _, val := range vals {
+		if val = rewriteValue(val, f); val != nil {
+			out = append(out, val)
+		}
+	}
+	return out
+}
+
+// rewriteValue rewrites a value, returning nil if it was removed or
+// replaced by something that isn't a value. A missing value stays
+// missing.
+func rewriteValue(val Value, f func(Node) Node) Value {
+	if val == nil {
+		return nil
+	}
+	out, _ := Rewrite(val, f).(Value)
+	return out
+}
+
+// rewriteProperties rewrites each value of a property set, deleting the
+// properties removed
+func rewriteProperties(props map[string]Value, f func(Node) Node) {
+	for name, val := range props {
+		if val = rewriteValue(val, f); val != nil {
+			props[name] = val
+		} else {
+			delete(props, name)
+		}
+	}
+}
@@ -0,0 +1,842 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"lpml/ast"
+	"lpml/cache"
+	"lpml/config"
+	"lpml/generator"
+	"lpml/project"
+)
+
+// buildConfig holds the settings shared by every page in a build
+type buildConfig struct {
+	opts     generator.Options // Base generator options, before per-page fields
+	stamp    bool              // Stamp build metadata into each page
+	emit     string            // Output kind, see emitHTML
+	validate bool              // Refuse to write HTML that fails validation
+	minify   bool              // Strip whitespace from HTML output
+	verbose  bool              // Report each step
+	useCache bool              // Skip pages whose inputs haven't changed
+	manifest bool              // Write manifest.json listing every file built, with its hash
+	strict   bool              // Fail pages that have warnings
+	shareCSS bool              // Link stylesheets from files in sharedDir instead of inlining them
+	outDir   string            // Directory pages are written to, "" for next to their sources
+	assets   []assetCopy       // Asset directories copied into outDir
+	plugins  map[string]string // Custom tag names and the programs rendering them
+	versions []string          // With --versions, every version of the site, oldest first
+	version  string            // The version being built, one of versions
+}
+
+// assetCopy is an asset directory and where it's copied in the output
+type assetCopy struct {
+	from, to string
+}
+
+// logf prints a progress line when the build is verbose
+func (cfg *buildConfig) logf(format string, args ...any) {
+	if cfg.verbose {
+		fmt.Printf(format+"\n", args...)
+	}
+}
+
+// runBuild compiles a single file or every page in a directory. It
+// returns the exit status.
+func runBuild(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	stamp := fs.Bool("stamp", false, "stamp the page with build time, source and commit")
+	title := fs.String("title", "", "page title (default: first heading, then file name)")
+	noInferTitle := fs.Bool("no-infer-title", false, "use a generic title instead of inferring one")
+	baseCSS := fs.String("base-css", generator.BaseCSSDefault, "base stylesheet: default, none, reset, or a CSS file path")
+	emit := fs.String("emit", emitHTML, "what to write: html, textindex for the visible text as JSON, or ast-text for the parsed tree")
+	validateHTML := fs.Bool("validate-output", false, "check the generated HTML for unclosed tags and invalid nesting")
+	noCache := fs.Bool("no-cache", false, "rebuild every page of a directory, ignoring the build cache")
+	output := fs.String("output", "", "output file for a single input (default: input name with .html)")
+	fs.StringVar(output, "o", "", "shorthand for -output")
+	outDir := fs.String("out-dir", "", "write output under this directory, keeping paths relative to the input")
+	minifyHTML := fs.Bool("minify", false, "strip indentation and line breaks from generated HTML")
+	target := fs.String("target", generator.TargetWeb, "output target: web, or print-pdf for paged-media CSS to print to PDF")
+	permalinks := fs.Bool("permalinks", false, "add a ¶ link to each heading with a label, shown on hover")
+	divSections := fs.Bool("div-sections", false, "write page sections as <div>s instead of <header>, <main>, and <footer>")
+	selfContained := fs.Bool("self-contained", false, "inline local images, scripts, and linked files so each page is a single file")
+	verbose := fs.Bool("verbose", false, "report each step of the build")
+	strict := fs.Bool("strict", false, "treat warnings as errors: a page with any fails to build")
+	shareCSS := fs.Bool("shared-css", false, "write each stylesheet once into "+sharedDir+"/ for every page using it to link to, instead of inline in each page")
+	writeManifest := fs.Bool("manifest", false, "write "+manifestName+" listing each generated file with its SHA-256 and source")
+	versionList := fs.String("versions", "", "build each `v1,v2,...` subdirectory of the input as a version of the site, oldest first")
+	configPath := fs.String("config", "", "project file (default: "+config.FileName+" in the input directory, if any)")
+	set := setValues{}
+	fs.Var(set, "set", "set `name=value`: $name is value, replacing a [define] constant or front matter property of that name; repeatable")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml build [flags] <input.lpml> [output.html]")
+		fmt.Println("       lpml build [flags] <dir>")
+		fmt.Println("       lpml build [flags]          (with an " + config.FileName + " in the current directory)")
+		fmt.Println("  If output file is not specified, it will use the input filename with .html extension")
+		fmt.Println("  A directory builds every .lpml file in it, sharing labels between pages")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+
+	if len(positional) > 2 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	projectFile, err := findConfig(*configPath, positional)
+	if err != nil {
+		fmt.Printf("Failed to read project file: %v\n", err)
+		return exitForError(err)
+	}
+	if projectFile == nil && len(positional) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	// A project file found in the directory being built points at its sources
+	if projectFile != nil && (len(positional) == 0 || *configPath == "") {
+		positional = []string{projectFile.Input}
+	}
+	inputFile := positional[0]
+
+	// Settings from the project file apply unless overridden on the command line
+	if projectFile != nil && projectFile.Theme != "" && !flagsSet(fs)["base-css"] {
+		*baseCSS = projectFile.Theme
+	}
+
+	if *target != generator.TargetWeb && *target != generator.TargetPrintPDF {
+		fmt.Printf("Unknown -target value %q (want %s or %s)\n", *target, generator.TargetWeb, generator.TargetPrintPDF)
+		return exitUsage
+	}
+	if *emit != emitHTML && *emit != emitTextIndex && *emit != emitASTText {
+		fmt.Printf("Unknown -emit value %q (want %s, %s, or %s)\n", *emit, emitHTML, emitTextIndex, emitASTText)
+		return exitUsage
+	}
+	if *validateHTML && htmlValidator == nil {
+		fmt.Println("-validate-output isn't built in: this lpml was built with the lpml_novalidate tag")
+		return exitUsage
+	}
+	if *minifyHTML && htmlMinifier == nil {
+		fmt.Println("-minify isn't built in: this lpml was built with the lpml_nominify tag")
+		return exitUsage
+	}
+
+	cfg := &buildConfig{
+		opts: generator.Options{
+			Title:         *title,
+			NoInferTitle:  *noInferTitle,
+			SelfContained: *selfContained,
+			Target:        *target,
+			Permalinks:    *permalinks,
+			DivSections:   *divSections,
+			Set:           set,
+		},
+		stamp:    *stamp,
+		emit:     *emit,
+		validate: *validateHTML,
+		minify:   *minifyHTML,
+		verbose:  *verbose,
+		useCache: !*noCache,
+		manifest: *writeManifest,
+		strict:   *strict,
+		shareCSS: *shareCSS,
+	}
+	if err := applyBaseCSS(&cfg.opts, *baseCSS); err != nil {
+		fmt.Printf("Failed to read base CSS: %v\n", err)
+		return exitIO
+	}
+	if projectFile != nil {
+		cfg.logf("Using %s", projectFile.Path)
+		cfg.opts.SiteTitle = projectFile.Title
+		cfg.opts.Permalinks = cfg.opts.Permalinks || projectFile.Permalinks
+		cfg.opts.DivSections = cfg.opts.DivSections || projectFile.DivSections
+		cfg.opts.Palette = projectFile.Palette
+		cfg.opts.Severity = projectFile.Severity
+		cfg.shareCSS = cfg.shareCSS || projectFile.SharedCSS
+		cfg.plugins = projectFile.Plugins
+		cfg.opts.CustomTags, err = loadPlugins(projectFile)
+		if err != nil {
+			fmt.Printf("Failed to load plugins: %v\n", err)
+			return exitUsage
+		}
+		if *outDir != "" {
+			projectFile.Output = *outDir
+		}
+		cfg.outDir = projectFile.Output
+		if projectFile.Output != "" {
+			for _, asset := range projectFile.Assets {
+				cfg.assets = append(cfg.assets, assetCopy{from: asset, to: projectFile.AssetTarget(asset)})
+			}
+		}
+	}
+
+	if *outDir != "" {
+		if *output != "" || len(positional) > 1 {
+			fmt.Println("-out-dir and an output file can't be used together")
+			return exitUsage
+		}
+		cfg.outDir = *outDir
+	}
+
+	// A directory builds every page in it
+	if info, err := os.Stat(inputFile); err == nil && info.IsDir() {
+		if *output != "" || len(positional) > 1 {
+			fmt.Println("An output file can't be given when building a directory")
+			return exitUsage
+		}
+		if *versionList == "" && projectFile != nil && len(projectFile.Versions) > 0 {
+			*versionList = strings.Join(projectFile.Versions, ",")
+		}
+		if *versionList != "" {
+			versions, err := parseVersions(*versionList)
+			if err != nil {
+				fmt.Printf("Bad -versions: %v\n", err)
+				return exitUsage
+			}
+			return buildVersions(inputFile, versions, cfg)
+		}
+		return buildDir(inputFile, cfg)
+	}
+	if *versionList != "" {
+		fmt.Println("-versions builds a directory of version subdirectories, not a single file")
+		return exitUsage
+	}
+
+	// Validate file extension
+	if !checkFileType(inputFile) {
+		fmt.Println("Invalid file type: needs to end in suffix .lpml")
+		return exitUsage
+	}
+
+	// Determine output file; a single file keeps its path relative to the
+	// working directory under -out-dir
+	outputFile := cfg.outputPath(".", inputFile)
+	if len(positional) > 1 {
+		outputFile = positional[1]
+	}
+	if *output != "" {
+		outputFile = *output
+	}
+
+	return buildFile(inputFile, outputFile, cfg)
+}
+
+// buildFile compiles one source file to outputFile. It returns the exit
+// status.
+func buildFile(inputFile, outputFile string, cfg *buildConfig) int {
+	page, err := project.LoadPage(inputFile)
+	if err != nil {
+		fmt.Printf("Failed to read file: %v\n", err)
+		return exitIO
+	}
+	cfg.logf("Parsed %s (%d sections)", inputFile, len(page.Doc.Sections))
+
+	// Check for parsing errors
+	if len(page.Errors) > 0 {
+		fmt.Println("Parsing errors:")
+		for _, e := range withSnippets(page.Diagnostics, "  - ") {
+			fmt.Printf("  - %s\n", e)
+		}
+		return exitParse
+	}
+
+	opts := cfg.opts
+	opts.SourceFile = inputFile
+	opts.Now = pageNow(page)
+	if cfg.shareCSS {
+		opts.SharedDir = sharedDir + "/"
+	}
+	if cfg.stamp {
+		opts.BuildInfo = buildInfo(inputFile)
+	}
+
+	result, ok := cfg.produce(page, opts)
+	if !ok {
+		return exitGenerate
+	}
+
+	// Write output file
+	if err := writeRendered(outputFile, result); err != nil {
+		fmt.Printf("Failed to write output file: %v\n", err)
+		return exitIO
+	}
+	fmt.Printf("Successfully generated: %s\n", outputFile)
+
+	files, err := writeFiles(outputFile, result.files, nil)
+	if err != nil {
+		fmt.Printf("Failed to write output file: %v\n", err)
+		return exitIO
+	}
+
+	if cfg.manifest {
+		m := newManifest(filepath.Dir(outputFile), filepath.Dir(inputFile))
+		for _, path := range append([]string{outputFile}, files...) {
+			if err := m.add(path, inputFile); err != nil {
+				fmt.Printf("Failed to write manifest: %v\n", err)
+				return exitIO
+			}
+		}
+		if err := m.save(); err != nil {
+			fmt.Printf("Failed to write manifest: %v\n", err)
+			return exitIO
+		}
+	}
+	return exitOK
+}
+
+// buildDir compiles every page under dir next to its source. A $reference
+// that a page doesn't define itself resolves through the project-wide
+// symbol index. It returns the exit status, which for pages failing in
+// different ways is the status of the first failure.
+func buildDir(dir string, cfg *buildConfig) int {
+	proj, err := project.Load(dir)
+	if err != nil {
+		fmt.Printf("Failed to load project: %v\n", err)
+		return exitIO
+	}
+	cfg.logf("Loaded %s (%d pages)", dir, len(proj.Pages))
+	if cfg.verbose {
+		if orphans := proj.Orphans(proj.Links()); len(orphans) > 0 {
+			cfg.logf("Orphan pages, which no other page links to: %s", strings.Join(orphans, ", "))
+		}
+	}
+
+	symbols := proj.Symbols()
+	failed, unchanged := 0, 0
+	status := exitOK
+	fail := func(code int) {
+		failed++
+		status = firstFailure(status, code)
+	}
+
+	// The cache lives with the output, so separate output directories
+	// each track their own builds. It's kept up to date even when it isn't
+	// used to skip pages, since it records every file the build wrote.
+	cacheDir := dir
+	if cfg.outDir != "" {
+		cacheDir = cfg.outDir
+	}
+	buildCache := cache.Load(cacheDir)
+	writtenBy := make(map[string]string) // Extra file paths and the page that wrote them
+	contents := make(map[string][]byte)  // What each extra file was written with
+	var stale []string                   // Files earlier builds wrote that this one didn't
+
+	for _, page := range proj.Pages {
+		external, refErrors := symbols.External(page)
+
+		errs := append(withSnippets(page.Diagnostics, "  - "), refErrors...)
+		if len(errs) > 0 {
+			fmt.Printf("Errors in %s:\n", page.Source)
+			for _, e := range errs {
+				fmt.Printf("  - %s\n", e)
+			}
+			fail(exitParse)
+			continue
+		}
+		cfg.logf("Resolved %s (%d labels from other pages)", page.Source, len(external))
+
+		opts := cfg.opts
+		opts.SourceFile = page.Source
+		opts.RootDir = dir
+		opts.ExternalLabels = external
+		opts.Prev, opts.Next = pageLinks(proj, page)
+		opts.Versions = cfg.versionLinks(dir, page)
+		opts.Collection = collection(proj, dir, page, opts)
+		opts.Now = pageNow(page)
+		if cfg.shareCSS {
+			opts.SharedDir = sharedPath(dir, page.Source)
+		}
+		if cfg.stamp {
+			opts.BuildInfo = buildInfo(page.Source)
+		}
+
+		// Skip the page if nothing it reads has changed since the last build
+		var key string
+		if cfg.useCache {
+			deps := proj.Dependencies(page, symbols)
+			if opts.SelfContained {
+				deps = append(deps, proj.Inlined(page)...)
+			}
+			key, err = cfg.cacheKey(opts, deps)
+			if err != nil {
+				cfg.logf("Not caching %s: %v", page.Source, err)
+			} else if entry, ok := buildCache.Fresh(page.Source, key); ok {
+				for _, w := range entry.Warnings {
+					fmt.Printf("Warning: %s: %s\n", page.Source, w)
+				}
+				if cfg.strict && len(entry.Warnings) > 0 {
+					fmt.Printf("%s has warnings, which are errors with -strict\n", page.Source)
+					fail(exitGenerate)
+					continue
+				}
+				cfg.logf("Unchanged %s", page.Source)
+				unchanged++
+				continue
+			}
+		}
+
+		result, ok := cfg.produce(page, opts)
+		if !ok {
+			fail(exitGenerate)
+			continue
+		}
+
+		output := cfg.outputPath(dir, page.Source)
+		if err := writeRendered(output, result); err != nil {
+			fmt.Printf("Failed to write output file: %v\n", err)
+			fail(exitIO)
+			continue
+		}
+		fmt.Printf("Successfully generated: %s\n", output)
+
+		files, err := writeFiles(output, result.files, contents)
+		if err != nil {
+			fmt.Printf("Failed to write output file: %v\n", err)
+			fail(exitIO)
+			continue
+		}
+
+		// Pages can share a file, like copies of an image they both resize,
+		// as long as they agree on what's in it
+		for i, path := range files {
+			data := result.files[i].Data
+			if other, ok := writtenBy[path]; ok {
+				if bytes.Equal(contents[path], data) {
+					continue // It stays the first writer's
+				}
+				fmt.Printf("Warning: %s: overwrote %s written for %s\n", page.Source, path, other)
+			}
+			writtenBy[path] = page.Source
+			contents[path] = data
+		}
+
+		entry := cache.Entry{Key: key, Output: output, Files: files, Warnings: result.warnings}
+		if previous, ok := buildCache.Previous(page.Source); ok {
+			stale = append(stale, staleFiles(previous, entry)...)
+		}
+		buildCache.Put(page.Source, entry)
+	}
+
+	// Pages whose sources are gone take their output with them. Files
+	// another page still writes are kept.
+	for source, entry := range buildCache.Dropped() {
+		if _, err := os.Stat(source); errors.Is(err, fs.ErrNotExist) {
+			stale = append(stale, entry.Paths()...)
+		}
+	}
+	written := buildCache.Written()
+	for _, path := range stale {
+		if written[path] {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			fmt.Printf("Removed: %s\n", path)
+		}
+	}
+	if err := buildCache.Save(); err != nil {
+		fmt.Printf("Failed to write build cache: %v\n", err)
+	}
+	if unchanged > 0 {
+		fmt.Printf("%d of %d pages unchanged\n", unchanged, len(proj.Pages))
+	}
+
+	if err := cfg.copyAssets(); err != nil {
+		fmt.Printf("Failed to copy assets: %v\n", err)
+		return exitIO
+	}
+
+	if cfg.manifest {
+		if err := cfg.saveManifest(cacheDir, dir, buildCache); err != nil {
+			fmt.Printf("Failed to write manifest: %v\n", err)
+			return exitIO
+		}
+		cfg.logf("Wrote %s", filepath.Join(cacheDir, manifestName))
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d pages failed\n", failed, len(proj.Pages))
+	}
+	return status
+}
+
+// copyAssets copies the project's asset directories into the output
+func (cfg *buildConfig) copyAssets() error {
+	for _, asset := range cfg.assets {
+		n, err := copyDir(asset.from, asset.to)
+		if err != nil {
+			return err
+		}
+		cfg.logf("Copied %s to %s (%d files)", asset.from, asset.to, n)
+	}
+	return nil
+}
+
+// saveManifest writes the manifest of a directory build into outDir: every
+// page and extra file in the build's cache entries, fresh or rebuilt, and
+// every copied asset. Pages that failed aren't listed. A file pages share,
+// like a stylesheet under _lpml/, is credited to the first of them, in the
+// order the build goes through them.
+func (cfg *buildConfig) saveManifest(outDir, dir string, buildCache *cache.Cache) error {
+	m := newManifest(outDir, dir)
+	current := buildCache.Current()
+	sources := make([]string, 0, len(current))
+	for source := range current {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		for _, path := range current[source].Paths() {
+			if m.has(path) {
+				continue
+			}
+			if err := m.add(path, source); err != nil {
+				return err
+			}
+		}
+	}
+	for _, asset := range cfg.assets {
+		if err := m.addDir(asset.from, asset.to); err != nil {
+			return err
+		}
+	}
+	return m.save()
+}
+
+// findConfig loads the project file named by -config, or else the one in
+// the directory being built. It returns nil if there is none.
+func findConfig(path string, positional []string) (*config.Config, error) {
+	if path != "" {
+		return config.Load(path)
+	}
+
+	dir := "."
+	if len(positional) > 0 {
+		dir = positional[0]
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	return config.Find(dir)
+}
+
+// outputPath returns where a page of the project in dir is written. With
+// an output directory the page keeps its path relative to dir; sources
+// outside dir land at the top of the output directory.
+func (cfg *buildConfig) outputPath(dir, source string) string {
+	if cfg.outDir == "" {
+		return outputFor(source, cfg.emit)
+	}
+
+	rel, err := filepath.Rel(dir, source)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(source)
+	}
+	return outputFor(filepath.Join(cfg.outDir, rel), cfg.emit)
+}
+
+// pageLinks returns what a page's [pagenav] links to: the pages before
+// and after it in its directory. Pages without one get nil for both, so
+// their cache keys don't change with their neighbours' titles.
+func pageLinks(proj *project.Project, page *project.Page) (prev, next *generator.PageLink) {
+	uses := false
+	for _, elem := range project.Elements(page.Doc) {
+		uses = uses || elem.TagType == "pagenav"
+	}
+	if !uses {
+		return nil, nil
+	}
+
+	link := func(p *project.Page) *generator.PageLink {
+		if p == nil {
+			return nil
+		}
+		return &generator.PageLink{Title: p.Title(), Href: filepath.Base(project.OutputPath(p.Source))}
+	}
+	before, after := proj.Adjacent(page)
+	return link(before), link(after)
+}
+
+// collection returns the pages a page's [query-start] elements pick from:
+// every other page of the project, with its URL relative to page. It's
+// nil unless the page has a [query-start]. Excerpts are rendered with opts.
+func collection(proj *project.Project, dir string, page *project.Page, opts generator.Options) []generator.CollectionPage {
+	uses := false
+	for _, elem := range project.Elements(page.Doc) {
+		uses = uses || elem.TagType == "query"
+	}
+	if !uses {
+		return nil
+	}
+
+	var pages []generator.CollectionPage
+	gen := generator.NewWithOptions(opts)
+	for _, p := range proj.Pages {
+		if p == page || p.Doc == nil {
+			continue
+		}
+		href, err := filepath.Rel(filepath.Dir(page.Source), project.OutputPath(p.Source))
+		if err != nil {
+			continue
+		}
+		pageDir, err := filepath.Rel(dir, filepath.Dir(p.Source))
+		if err != nil || pageDir == "." {
+			pageDir = ""
+		}
+		pages = append(pages, generator.CollectionPage{
+			Href:    filepath.ToSlash(href),
+			Dir:     filepath.ToSlash(pageDir),
+			Title:   p.Title(),
+			Excerpt: gen.Excerpt(p.Doc),
+			Meta:    p.Doc.Meta,
+		})
+	}
+	return pages
+}
+
+// pageNow returns the time a page's now() calls give, the buildTime.
+// It's zero unless the page calls now(), so other pages' cache keys don't
+// change from one build to the next.
+func pageNow(page *project.Page) time.Time {
+	calls := false
+	if page.Doc != nil {
+		ast.Inspect(page.Doc, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallValue); ok && call.Name == "now" {
+				calls = true
+			}
+			return !calls
+		})
+	}
+	if !calls {
+		return time.Time{}
+	}
+	return buildTime()
+}
+
+// sharedDir is where --shared-css writes stylesheets, at the top of the
+// output
+const sharedDir = "_lpml"
+
+// sharedPath returns the path from a page of the project in dir to
+// sharedDir, for Options.SharedDir
+func sharedPath(dir, source string) string {
+	rel, err := filepath.Rel(dir, source)
+	if err != nil {
+		return sharedDir + "/"
+	}
+	return strings.Repeat("../", strings.Count(filepath.ToSlash(rel), "/")) + sharedDir + "/"
+}
+
+// writeOutput writes a generated file, creating its directory if needed
+func writeOutput(path string, out []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+// writeRendered writes a page's output to path, creating its directory if
+// needed. A page that fails partway, like on a linked file that can't be
+// read, leaves no file behind.
+func writeRendered(path string, result *rendered) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := result.writeTo(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// writeFiles writes the extra files a page links to next to its output,
+// returning their paths. written holds the contents of the files other
+// pages of the build wrote, by path; a file already written with the same
+// contents isn't written again.
+func writeFiles(output string, files []generator.File, written map[string][]byte) ([]string, error) {
+	var paths []string
+	for _, f := range files {
+		path := filepath.Join(filepath.Dir(output), filepath.FromSlash(f.Name))
+		if data, ok := written[path]; ok && bytes.Equal(data, f.Data) {
+			paths = append(paths, path)
+			continue
+		}
+		if err := writeOutput(path, f.Data); err != nil {
+			return paths, err
+		}
+		fmt.Printf("Successfully generated: %s\n", path)
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// staleFiles returns the extra files a page's last build wrote that its
+// current build didn't, like the .ics of an event since removed
+func staleFiles(previous, current cache.Entry) []string {
+	keep := make(map[string]bool)
+	for _, path := range current.Files {
+		keep[path] = true
+	}
+	var stale []string
+	for _, path := range previous.Files {
+		if !keep[path] {
+			stale = append(stale, path)
+		}
+	}
+	return stale
+}
+
+// copyDir copies every file under from to the same relative path under
+// to, returning the number of files copied
+func copyDir(from, to string) (int, error) {
+	n := 0
+	err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if err := copyFile(path, target); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// copyFile copies a single file
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// cacheKey identifies a page build: the lpml version, every setting that
+// affects the output, and the contents of the files the page depends on,
+// including plugin programs
+func (cfg *buildConfig) cacheKey(opts generator.Options, deps []string) (string, error) {
+	// External labels are covered by the contents of the pages defining them
+	opts.ExternalLabels = nil
+	settings, err := json.Marshal(struct {
+		Version  string
+		Options  generator.Options
+		Emit     string
+		Validate bool
+		Minify   bool
+		Plugins  map[string]string
+	}{version, opts, cfg.emit, cfg.validate, cfg.minify, cfg.plugins})
+	if err != nil {
+		return "", err
+	}
+	for _, program := range cfg.plugins {
+		path, err := exec.LookPath(program)
+		if err != nil {
+			return "", err
+		}
+		deps = append(deps, path)
+	}
+	return cache.Key(settings, deps)
+}
+
+// produce renders a parsed page and applies validation and minification,
+// printing any warnings and problems. It reports false if the page must
+// not be written.
+func (cfg *buildConfig) produce(page *project.Page, opts generator.Options) (*rendered, bool) {
+	result, err := render(page.Doc, opts, cfg.emit)
+	if err != nil {
+		fmt.Println(err)
+		return nil, false
+	}
+	warnings, errs := parseWarnings(page, opts.Severity)
+	result.warnings = append(warnings, result.warnings...)
+	result.errors = append(errs, result.errors...)
+	for _, w := range result.warnings {
+		fmt.Printf("Warning: %s: %s\n", page.Source, w)
+	}
+	if cfg.strict && len(result.warnings) > 0 {
+		fmt.Printf("%s has warnings, which are errors with -strict\n", page.Source)
+		return nil, false
+	}
+	if len(result.errors) > 0 {
+		fmt.Printf("Errors in %s:\n", page.Source)
+		for _, e := range result.errors {
+			fmt.Printf("  - %s\n", e)
+		}
+		return nil, false
+	}
+	cfg.logf("Rendered %s", page.Source)
+
+	// Validating and minifying need the whole page; otherwise it's
+	// streamed to its file
+	if cfg.validate || cfg.minify {
+		if err := result.load(); err != nil {
+			fmt.Printf("Failed to render %s: %v\n", page.Source, err)
+			return nil, false
+		}
+	}
+
+	// Refuse to write a page the browser would have to repair
+	if cfg.validate {
+		problems, err := validateOutput(result.out, cfg.emit)
+		if err != nil {
+			fmt.Printf("Failed to validate %s: %v\n", page.Source, err)
+			return nil, false
+		}
+		if len(problems) > 0 {
+			fmt.Printf("Invalid output for %s:\n", page.Source)
+			for _, p := range problems {
+				fmt.Printf("  - %s\n", p)
+			}
+			return nil, false
+		}
+		cfg.logf("Validated %s", page.Source)
+	}
+
+	if cfg.minify && cfg.emit == emitHTML {
+		min, err := htmlMinifier(result.out)
+		if err != nil {
+			fmt.Printf("Failed to minify %s: %v\n", page.Source, err)
+			return nil, false
+		}
+		cfg.logf("Minified %s (%d -> %d bytes)", page.Source, len(result.out), len(min))
+		result.out = min
+	}
+
+	return result, true
+}
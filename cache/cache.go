@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileName is the cache file kept in a build's output directory. It is
+// also the build's manifest, recording every file the build wrote.
+const FileName = ".lpml-cache.json"
+
+// formatVersion changes whenever the file layout does, discarding old caches
+const formatVersion = 1
+
+// Entry records how a page was last built
+type Entry struct {
+	Key      string   `json:"key"`                // Hash of everything the output depends on
+	Output   string   `json:"output"`             // Path the page was written to
+	Files    []string `json:"files,omitempty"`    // Extra files written next to it, like .ics downloads
+	Warnings []string `json:"warnings,omitempty"` // Repeated when the page is skipped
+}
+
+// Cache maps each source file to its last build. Entries not looked up or
+// stored during a build are dropped when it's saved, so deleted pages
+// don't linger.
+type Cache struct {
+	path string
+	old  map[string]Entry
+	next map[string]Entry
+}
+
+// file is the on-disk form of a Cache
+type file struct {
+	Version int              `json:"version"`
+	Pages   map[string]Entry `json:"pages"`
+}
+
+// Load reads the cache in dir. A missing, unreadable, or outdated cache
+// is treated as empty, so every page builds.
+func Load(dir string) *Cache {
+	c := &Cache{
+		path: filepath.Join(dir, FileName),
+		old:  make(map[string]Entry),
+		next: make(map[string]Entry),
+	}
+
+	content, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	var f file
+	if json.Unmarshal(content, &f) == nil && f.Version == formatVersion && f.Pages != nil {
+		c.old = f.Pages
+	}
+	return c
+}
+
+// Fresh returns the entry for source if it was built with the same key
+// and everything it wrote still exists. A fresh entry is kept for the
+// next save.
+func (c *Cache) Fresh(source, key string) (Entry, bool) {
+	entry, ok := c.old[source]
+	if !ok || key == "" || entry.Key != key {
+		return Entry{}, false
+	}
+	for _, path := range entry.Paths() {
+		if _, err := os.Stat(path); err != nil {
+			return Entry{}, false
+		}
+	}
+	c.next[source] = entry
+	return entry, true
+}
+
+// Previous returns the entry for source from the last build, if any
+func (c *Cache) Previous(source string) (Entry, bool) {
+	entry, ok := c.old[source]
+	return entry, ok
+}
+
+// Dropped returns the entries from the last build that this one has
+// neither reused nor replaced: pages that were deleted or failed to build
+func (c *Cache) Dropped() map[string]Entry {
+	dropped := make(map[string]Entry)
+	for source, entry := range c.old {
+		if _, ok := c.next[source]; !ok {
+			dropped[source] = entry
+		}
+	}
+	return dropped
+}
+
+// Written reports the paths recorded by this build's entries so far
+func (c *Cache) Written() map[string]bool {
+	written := make(map[string]bool)
+	for _, entry := range c.next {
+		for _, path := range entry.Paths() {
+			written[path] = true
+		}
+	}
+	return written
+}
+
+// Entries returns the entries from the last build, by source
+func (c *Cache) Entries() map[string]Entry {
+	return c.old
+}
+
+// Current returns the entries this build has reused or stored so far, by
+// source
+func (c *Cache) Current() map[string]Entry {
+	return c.next
+}
+
+// Path returns where the cache file is kept
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// Paths returns every file the entry's page build wrote
+func (e Entry) Paths() []string {
+	return append([]string{e.Output}, e.Files...)
+}
+
+// Put records a page that was just built
+func (c *Cache) Put(source string, entry Entry) {
+	c.next[source] = entry
+}
+
+// Save writes the entries used or stored during this build
+func (c *Cache) Save() error {
+	content, err := json.MarshalIndent(file{Version: formatVersion, Pages: c.next}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(content, '\n'), 0644)
+}
+
+// Key hashes the settings of a build together with the contents of the
+// files it reads. A file that doesn't exist hashes differently from any
+// that does, so creating it later invalidates the key.
+func Key(settings []byte, files []string) (string, error) {
+	h := sha256.New()
+	h.Write(settings)
+
+	for _, path := range files {
+		h.Write([]byte{0})
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			h.Write([]byte("missing"))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(content)
+		h.Write(sum[:])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
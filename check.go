@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"lpml/ast"
+	"lpml/config"
+	"lpml/generator"
+	"lpml/lexer"
+	"lpml/parser"
+	"lpml/project"
+	"lpml/tokens"
+)
+
+// runCheck lexes and parses files, or every page in directories, and
+// resolves their references without writing anything. Every diagnostic is
+// printed; errors make the exit status 1, warnings don't.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	strict := fs.Bool("strict", false, "treat warnings as errors")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml check [flags] [file.lpml | dir]...")
+		fmt.Println("  Reports lexing, parse, and reference problems without writing output")
+		fmt.Println("  (default: current directory)")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	targets := parseInterspersed(fs, args)
+	if len(targets) == 0 {
+		targets = []string{"."}
+	}
+
+	pages, errorCount, warningCount := 0, 0, 0
+	status := exitOK
+	for _, target := range targets {
+		proj, opts, err := loadCheckTarget(target)
+		if err != nil {
+			fmt.Printf("%s: %v\n", target, err)
+			errorCount++
+			status = firstFailure(status, exitForError(err))
+			continue
+		}
+
+		symbols := proj.Symbols()
+		for _, page := range proj.Pages {
+			errs, warnings := checkPage(page, proj.Dir, symbols, opts)
+			if *strict {
+				errs, warnings = append(errs, warnings...), nil
+			}
+			pages++
+			errorCount += len(errs)
+			warningCount += len(warnings)
+			if len(errs) > 0 {
+				status = firstFailure(status, exitParse)
+			}
+			if len(errs) == 0 && len(warnings) == 0 {
+				continue
+			}
+
+			fmt.Printf("%s:\n", page.Source)
+			for _, e := range errs {
+				fmt.Printf("  error: %s\n", e)
+			}
+			for _, w := range warnings {
+				fmt.Printf("  warning: %s\n", w)
+			}
+		}
+	}
+
+	if errorCount > 0 {
+		fmt.Printf("%d error(s), %d warning(s) in %d pages\n", errorCount, warningCount, pages)
+		return status
+	}
+	if warningCount > 0 {
+		fmt.Printf("ok  %d pages, %d warning(s)\n", pages, warningCount)
+		return exitOK
+	}
+	fmt.Printf("ok  %d pages\n", pages)
+	return exitOK
+}
+
+// loadCheckTarget loads a directory as a project, honouring its lpml.toml
+// and plugins, or a single file as a project of one page. It returns the
+// project with the generator options its lpml.toml gives, like the
+// renderers for its custom tags.
+func loadCheckTarget(target string) (*project.Project, generator.Options, error) {
+	var opts generator.Options
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		projectFile, err := config.Find(target)
+		if err != nil {
+			return nil, opts, err
+		}
+		opts.CustomTags, err = loadPlugins(projectFile)
+		if err != nil {
+			return nil, opts, err
+		}
+		dir := target
+		if projectFile != nil {
+			dir = projectFile.Input
+			opts.Palette = projectFile.Palette
+			opts.Severity = projectFile.Severity
+		}
+		proj, err := project.Load(dir)
+		return proj, opts, err
+	}
+
+	if !checkFileType(target) {
+		return nil, opts, errors.New("invalid file type: needs to end in suffix .lpml")
+	}
+	page, err := project.LoadPage(target)
+	if err != nil {
+		return nil, opts, err
+	}
+	return &project.Project{Pages: []*project.Page{page}}, opts, nil
+}
+
+// checkPage collects a page's errors and warnings. The page is rendered in
+// memory so generator warnings are included, but nothing is written.
+// root is the project directory, or "" for a lone file.
+func checkPage(page *project.Page, root string, symbols project.SymbolIndex, opts generator.Options) (errs, warnings []string) {
+	errs = append(errs, withSnippets(lexErrors(page.Source), "  error: ")...)
+	errs = append(errs, withSnippets(page.Diagnostics, "  error: ")...)
+
+	external, refErrors := symbols.External(page)
+	errs = append(errs, refErrors...)
+	parseWarns, parseErrs := parseWarnings(page, opts.Severity)
+	errs = append(errs, parseErrs...)
+	warnings = append(warnings, parseWarns...)
+	warnings = append(warnings, undefinedReferences(page, external)...)
+
+	// A partial document would only produce misleading generator warnings
+	if len(errs) == 0 {
+		opts.SourceFile, opts.RootDir, opts.ExternalLabels = page.Source, root, external
+		generated := generator.NewWithOptions(opts).GeneratePage(page.Doc)
+		warnings = append(warnings, generated.Warnings()...)
+		errs = append(errs, generated.Errors()...)
+	}
+
+	return errs, warnings
+}
+
+// parseWarnings sorts a page's parse warnings by how severity treats
+// their rules, as Options.Severity does generator warnings: those ignored
+// are left out and those made errors are returned apart
+func parseWarnings(page *project.Page, severity map[string]generator.Severity) (warnings, errs []string) {
+	for i, d := range page.WarningDiagnostics {
+		switch severity[d.Rule] {
+		case generator.SeverityIgnore:
+		case generator.SeverityError:
+			errs = append(errs, page.Warnings[i])
+		default:
+			warnings = append(warnings, page.Warnings[i])
+		}
+	}
+	return warnings, errs
+}
+
+// lexErrors reports characters the lexer doesn't recognise. The parser
+// skips them silently, so they'd otherwise vanish from the page unnoticed.
+func lexErrors(source string) []parser.Diagnostic {
+	f, err := os.Open(source)
+	if err != nil {
+		return []parser.Diagnostic{{File: source, Message: err.Error()}}
+	}
+	defer f.Close()
+
+	var errs []parser.Diagnostic
+	l := lexer.NewFromReader(f)
+	at := func(tok tokens.Token, msg string) {
+		errs = append(errs, parser.Diagnostic{File: source, Line: tok.Line, Column: tok.Column, Message: msg, Text: l.SourceLine(tok.Line)})
+	}
+	for tok := range l.Tokens() {
+		switch {
+		case tok.Type == tokens.ILLEGAL && tok.Literal == "/*":
+			at(tok, "/* comment is never closed with */")
+		case tok.Type == tokens.ILLEGAL && tok.Literal == "dedent":
+			// Misaligned indentation, which the parser reports
+		case tok.Type == tokens.ILLEGAL:
+			at(tok, fmt.Sprintf("unexpected character %q", tok.Literal))
+		}
+	}
+	if err := l.Err(); err != nil {
+		errs = append(errs, parser.Diagnostic{File: source, Message: err.Error()})
+	}
+	return errs
+}
+
+// withSnippets formats diagnostics for printing after prefix: each one's
+// file:line:column and message, then the line of source it's on with a
+// caret under the column, indented to line up under the message
+func withSnippets(diags []parser.Diagnostic, prefix string) []string {
+	indent := strings.Repeat(" ", len(prefix))
+	msgs := make([]string, len(diags))
+	for i, d := range diags {
+		msgs[i] = d.String()
+		if snippet := strings.TrimSuffix(d.Snippet(), "\n"); snippet != "" {
+			msgs[i] += "\n" + indent + strings.ReplaceAll(snippet, "\n", "\n"+indent)
+		}
+	}
+	return msgs
+}
+
+// undefinedReferences reports $references that no page defines, which
+// end up in the output as literal text. Built-in $build.* and $page.*
+// variables are always defined, and a reference with a ?? fallback
+// can go undefined.
+func undefinedReferences(page *project.Page, external map[string]*ast.Element) []string {
+	local := project.LocalNames(page.Doc)
+
+	var warnings []string
+	reported := make(map[string]bool)
+	for _, ref := range project.References(page.Doc) {
+		name := ref.Name
+		if local[name] || external[name] != nil || reported[name] || ref.Default != nil ||
+			strings.HasPrefix(name, "build.") || strings.HasPrefix(name, "page.") {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("line %d: reference $%s is not defined", ref.Token.Line, name))
+		reported[name] = true
+	}
+	return warnings
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"lpml/cache"
+	"lpml/config"
+)
+
+// runClean deletes everything the last directory build wrote, as listed
+// in its cache, and then the cache itself and any manifest. It returns the
+// exit status.
+func runClean(args []string) int {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	outDir := fs.String("out-dir", "", "output directory the build wrote to (default: build.output, or dir itself)")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml clean [flags] [dir]")
+		fmt.Println("  Removes the pages and extra files the last build of dir wrote (default: current directory)")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	if len(positional) > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	dir := "."
+	if len(positional) > 0 {
+		dir = positional[0]
+	}
+
+	// The cache is wherever the build kept it: the output directory, or
+	// the sources when pages are written next to them
+	projectFile, err := config.Find(dir)
+	if err != nil {
+		fmt.Printf("Failed to read project file: %v\n", err)
+		return exitForError(err)
+	}
+	cacheDir := dir
+	if projectFile != nil {
+		cacheDir = projectFile.Input
+		if projectFile.Output != "" {
+			cacheDir = projectFile.Output
+		}
+	}
+	if *outDir != "" {
+		cacheDir = *outDir
+	}
+
+	buildCache := cache.Load(cacheDir)
+	if _, err := os.Stat(buildCache.Path()); os.IsNotExist(err) {
+		fmt.Printf("Nothing to clean: no %s in %s\n", cache.FileName, cacheDir)
+		return exitOK
+	}
+
+	entries := buildCache.Entries()
+	sources := make([]string, 0, len(entries))
+	for source := range entries {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		for _, path := range entries[source].Paths() {
+			if err := os.Remove(path); err == nil {
+				fmt.Printf("Removed: %s\n", path)
+			}
+		}
+	}
+
+	manifestPath := filepath.Join(cacheDir, manifestName)
+	if err := os.Remove(manifestPath); err == nil {
+		fmt.Printf("Removed: %s\n", manifestPath)
+	}
+
+	if err := os.Remove(buildCache.Path()); err != nil {
+		fmt.Printf("Failed to remove build cache: %v\n", err)
+		return exitIO
+	}
+	fmt.Printf("Removed: %s\n", buildCache.Path())
+	return exitOK
+}
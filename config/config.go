@@ -0,0 +1,231 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lpml/ast"
+	"lpml/generator"
+)
+
+// FileName is the project file looked for in a project's root directory
+const FileName = "lpml.toml"
+
+// Config is a project's lpml.toml. Paths in the file are relative to the
+// directory containing it and are stored resolved.
+type Config struct {
+	Path   string   // Path to the lpml.toml itself
+	Title  string   // site.title: appended to every inferred page title
+	Theme  string   // site.theme: base stylesheet, as for -base-css
+	Input  string   // build.input: directory holding the .lpml sources, default the file's own
+	Output string   // build.output: directory pages are written to, "" for next to their sources
+	Assets []string // build.assets: directories copied into the output directory
+
+	// Plugins maps custom tag names to the programs rendering them, from
+	// the [plugins] table. Programs given as a bare name are found on PATH.
+	Plugins map[string]string
+
+	// Permalinks is site.permalinks: a ¶ link on every heading with an id
+	Permalinks bool
+
+	// DivSections is site.div_sections: page sections written as <div>s,
+	// as with --div-sections
+	DivSections bool
+
+	// SharedCSS is build.shared_css: stylesheets written once for the
+	// pages using them to link to, as with --shared-css
+	SharedCSS bool
+
+	// Versions is build.versions: subdirectories of the input built side
+	// by side as versions of the site, oldest first, as with --versions
+	Versions []string
+
+	// Palette maps names to the base colors of the [palette] table, for
+	// pages to name shades of, like "primary-300"
+	Palette map[string]string
+
+	// Severity maps generator rules, like "color", to how their warnings
+	// are treated, from the [warnings] table
+	Severity map[string]generator.Severity
+}
+
+// Find loads the lpml.toml in dir. It returns nil without an error if
+// the directory has none.
+func Find(dir string) (*Config, error) {
+	path := filepath.Join(dir, FileName)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+// Load reads and validates a project file
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parseTOML(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	cfg := &Config{Path: path, Input: dir}
+
+	// Report unknown settings in a stable order
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+		var err error
+		switch key {
+		case "site.title":
+			cfg.Title, err = asString(value)
+		case "site.theme":
+			cfg.Theme, err = asString(value)
+			if err == nil && !isBuiltinTheme(cfg.Theme) {
+				cfg.Theme = filepath.Join(dir, cfg.Theme)
+			}
+		case "site.permalinks":
+			cfg.Permalinks, err = asBool(value)
+		case "site.div_sections":
+			cfg.DivSections, err = asBool(value)
+		case "build.input":
+			var input string
+			input, err = asString(value)
+			cfg.Input = filepath.Join(dir, input)
+		case "build.output":
+			var output string
+			output, err = asString(value)
+			if output != "" {
+				cfg.Output = filepath.Join(dir, output)
+			}
+		case "build.shared_css":
+			cfg.SharedCSS, err = asBool(value)
+		case "build.versions":
+			cfg.Versions, err = asStrings(value)
+		case "build.assets":
+			var assets []string
+			assets, err = asStrings(value)
+			for _, asset := range assets {
+				cfg.Assets = append(cfg.Assets, filepath.Join(dir, asset))
+			}
+		default:
+			if name, ok := strings.CutPrefix(key, "palette."); ok {
+				var color string
+				if color, err = asString(value); err == nil {
+					if _, _, _, _, ok := ast.NewColor(color).RGBA(); !ok {
+						err = fmt.Errorf("expected a hex, rgb(), or hsl() color, like \"#3366ff\"")
+					}
+				}
+				if cfg.Palette == nil {
+					cfg.Palette = make(map[string]string)
+				}
+				cfg.Palette[name] = color
+				break
+			}
+			if rule, ok := strings.CutPrefix(key, "warnings."); ok {
+				var sev string
+				if sev, err = asString(value); err != nil {
+					break
+				}
+				if !generator.IsRule(rule) {
+					err = fmt.Errorf("unknown rule (want one of %s)", strings.Join(generator.Rules, ", "))
+					break
+				}
+				if cfg.Severity == nil {
+					cfg.Severity = make(map[string]generator.Severity)
+				}
+				cfg.Severity[rule], err = generator.ParseSeverity(sev)
+				break
+			}
+			name, ok := strings.CutPrefix(key, "plugins.")
+			if !ok {
+				err = fmt.Errorf("unknown setting")
+				break
+			}
+			var program string
+			program, err = asString(value)
+			if strings.ContainsRune(program, '/') || strings.ContainsRune(program, filepath.Separator) {
+				program = filepath.Join(dir, program)
+			}
+			if cfg.Plugins == nil {
+				cfg.Plugins = make(map[string]string)
+			}
+			cfg.Plugins[name] = program
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, key, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// AssetTarget returns where an asset directory is copied in the output
+// directory: at its path relative to the input directory, or at the top
+// level for directories outside it
+func (cfg *Config) AssetTarget(asset string) string {
+	rel, err := filepath.Rel(cfg.Input, asset)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(asset)
+	}
+	return filepath.Join(cfg.Output, rel)
+}
+
+// isBuiltinTheme reports whether a theme names a bundled stylesheet
+// rather than a file
+func isBuiltinTheme(theme string) bool {
+	switch theme {
+	case "", generator.BaseCSSDefault, generator.BaseCSSNone, generator.BaseCSSReset:
+		return true
+	}
+	return false
+}
+
+// asBool checks that a setting is a boolean
+func asBool(value any) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected true or false")
+	}
+	return b, nil
+}
+
+// asString checks that a setting is a string
+func asString(value any) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string")
+	}
+	return s, nil
+}
+
+// asStrings checks that a setting is an array of strings
+func asStrings(value any) ([]string, error) {
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected an array of strings")
+	}
+
+	var out []string
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected an array of strings")
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"lpml/schema"
+)
+
+// runDescribe prints a tag's properties and an example from the schema,
+// or the whole schema with -all. It returns the exit status.
+func runDescribe(args []string) int {
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+	all := fs.Bool("all", false, "describe every tag")
+	format := fs.String("format", "text", "output format: text or json")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml describe [flags] <tag>")
+		fmt.Println("       lpml describe -all [-format json]")
+		fmt.Println("  Tags can be named like p, p-start, or [p-start]")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	names := parseInterspersed(fs, args)
+
+	var selected []schema.Tag
+	if *all {
+		selected = schema.Tags()
+	} else {
+		if len(names) == 0 {
+			fs.Usage()
+			return exitUsage
+		}
+		for _, name := range names {
+			tag, ok := schema.Lookup(name)
+			if !ok {
+				fmt.Printf("Unknown tag %q, run `lpml describe -all` for the list\n", name)
+				return exitUsage
+			}
+			selected = append(selected, tag)
+		}
+	}
+
+	switch *format {
+	case "json":
+		out := struct {
+			Common []schema.Property `json:"common"`
+			Tags   []schema.Tag      `json:"tags"`
+		}{schema.Common, selected}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Println(err)
+			return exitIO
+		}
+	case "text":
+		for i, tag := range selected {
+			if i > 0 {
+				fmt.Println()
+			}
+			describeTag(tag)
+		}
+	default:
+		fmt.Printf("Unknown -format %q (want text or json)\n", *format)
+		return exitUsage
+	}
+	return exitOK
+}
+
+// describeTag prints one tag as text
+func describeTag(tag schema.Tag) {
+	switch {
+	case tag.Close == "":
+		fmt.Printf("[%s]  ->  <%s>\n", tag.Open, tag.HTML)
+	case tag.Void:
+		fmt.Printf("[%s] ... [%s], or [%s name=value ...]  ->  <%s>\n", tag.Open, tag.Close, tag.Name, tag.HTML)
+	default:
+		fmt.Printf("[%s] ... [%s]  ->  <%s>\n", tag.Open, tag.Close, tag.HTML)
+	}
+	fmt.Printf("  %s\n", tag.Description)
+
+	if len(tag.Properties) > 0 {
+		fmt.Println("\nProperties:")
+		for _, p := range tag.Properties {
+			describeProperty(p)
+		}
+	}
+
+	var common []string
+	for _, p := range tag.AllProperties()[len(tag.Properties):] {
+		common = append(common, p.Name)
+	}
+	fmt.Printf("\nAlso accepts the common properties: %s\n", strings.Join(common, ", "))
+
+	fmt.Println("\nExample:")
+	for _, line := range strings.Split(tag.Example, "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+}
+
+// describeProperty prints one property line with its friendly values
+func describeProperty(p schema.Property) {
+	fmt.Printf("  %-16s %-10s %s\n", p.Name, p.Type, p.Description)
+	if len(p.Values) > 0 {
+		fmt.Printf("  %-16s %-10s values: %s\n", "", "", strings.Join(p.Values, ", "))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"lpml/ast"
+	"lpml/diff"
+	"lpml/lexer"
+	"lpml/parser"
+)
+
+// runDiff reports the structural differences between two versions of a
+// page: two files, or a file and its copy at a git revision. It returns
+// the exit status, exitFailure if the versions differ.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	against := fs.String("against", "", "compare the file with its version at a git revision, like git:HEAD~1")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml diff old.lpml new.lpml")
+		fmt.Println("       lpml diff --against git:<rev> file.lpml")
+		fmt.Println("  Lists elements added and removed and properties changed between two versions")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	files := parseInterspersed(fs, args)
+
+	var oldFile, newFile string
+	readOld := os.ReadFile
+	switch {
+	case *against != "" && len(files) == 1:
+		rev, ok := strings.CutPrefix(*against, "git:")
+		if !ok || rev == "" {
+			fmt.Println("--against takes a git revision, like git:HEAD~1")
+			return exitUsage
+		}
+		oldFile, newFile = files[0], files[0]
+		readOld = gitReader(rev)
+	case *against == "" && len(files) == 2:
+		oldFile, newFile = files[0], files[1]
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+
+	before, status := parseForDiff(oldFile, readOld)
+	if status != exitOK {
+		return status
+	}
+	after, status := parseForDiff(newFile, os.ReadFile)
+	if status != exitOK {
+		return status
+	}
+
+	changes := diff.Documents(before, after)
+	if len(changes) == 0 {
+		fmt.Println("No structural changes")
+		return exitOK
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	return exitFailure
+}
+
+// parseForDiff parses one side of a diff, reading it and its includes
+// with read. Errors are printed and returned as an exit status.
+func parseForDiff(file string, read func(path string) ([]byte, error)) (*ast.Document, int) {
+	content, err := read(file)
+	if err != nil {
+		fmt.Printf("Failed to read file: %v\n", err)
+		return nil, exitIO
+	}
+
+	p := parser.NewForFile(lexer.New(string(content)), file, read)
+	doc := p.ParseDocument()
+	if len(p.Errors()) > 0 {
+		fmt.Printf("Errors in %s:\n", file)
+		for _, msg := range withSnippets(p.Diagnostics(), "  ") {
+			fmt.Printf("  %s\n", msg)
+		}
+		return nil, exitParse
+	}
+	return doc, exitOK
+}
+
+// gitReader returns a read function that reads files as they were at a
+// git revision, using the repository each file is in
+func gitReader(rev string) func(path string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		var stderr bytes.Buffer
+		cmd := exec.Command("git", "show", rev+":./"+filepath.Base(path))
+		cmd.Dir = filepath.Dir(path)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("%s at %s: %s", path, rev, msg)
+			}
+			return nil, fmt.Errorf("%s at %s: %v", path, rev, err)
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,386 @@
+// Package diff compares two parsed pages structurally: which elements were
+// added or removed and which of their properties changed, rather than
+// which lines of source did
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lpml/ast"
+)
+
+// Change kinds
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is one difference between two documents
+type Change struct {
+	Kind   string // Added, Removed, or Changed
+	Path   string // Where it is, like "mid > divide#hero > p[2]"
+	Line   int    // Line in the new document, or in the old one for removals; 0 for [meta], [define], and [preset]
+	Detail string // What changed, like `color "red" -> "blue"`
+}
+
+// String formats a change as one line: a +, -, or ~ marker, then the path,
+// line, and detail
+func (c Change) String() string {
+	marker := "~"
+	switch c.Kind {
+	case Added:
+		marker = "+"
+	case Removed:
+		marker = "-"
+	}
+
+	s := marker + " " + c.Path
+	if c.Line > 0 {
+		s += fmt.Sprintf(" (line %d)", c.Line)
+	}
+	if c.Detail != "" {
+		s += ": " + c.Detail
+	}
+	return s
+}
+
+// Documents returns the changes that turn before into after, in document
+// order. Sibling elements are matched by tag and label, so inserting one
+// paragraph reports one addition rather than every paragraph after it
+// changing. Sections and labelled elements are named by their key in
+// paths, so paths to them survive unrelated edits.
+func Documents(before, after *ast.Document) []Change {
+	d := &differ{}
+	d.properties("[meta]", 0, before.Meta, after.Meta)
+	d.properties("[define]", 0, before.Defines, after.Defines)
+	d.presets(before.Presets, after.Presets)
+	d.nodes("", sectionNodes(before), sectionNodes(after))
+	return d.changes
+}
+
+// differ collects changes as the two trees are walked together
+type differ struct {
+	changes []Change
+}
+
+func (d *differ) add(kind, path string, line int, detail string) {
+	d.changes = append(d.changes, Change{Kind: kind, Path: path, Line: line, Detail: detail})
+}
+
+// nodes diffs two lists of sibling nodes under parent
+func (d *differ) nodes(parent string, before, after []ast.Node) {
+	beforeNames, afterNames := names(before), names(after)
+
+	for _, op := range match(before, after) {
+		switch {
+		case op.before < 0:
+			d.add(Added, join(parent, afterNames[op.after]), after[op.after].Pos().Line, "")
+		case op.after < 0:
+			d.add(Removed, join(parent, beforeNames[op.before]), before[op.before].Pos().Line, "")
+		default:
+			d.node(join(parent, afterNames[op.after]), before[op.before], after[op.after])
+		}
+	}
+}
+
+// node diffs two nodes with the same key
+func (d *differ) node(path string, before, after ast.Node) {
+	switch b := before.(type) {
+	case *ast.PageSection:
+		a := after.(*ast.PageSection)
+		d.properties(path, a.Token.Line, b.Properties, a.Properties)
+		d.nodes(path, b.Children, a.Children)
+	case *ast.Element:
+		a := after.(*ast.Element)
+		d.properties(path, a.Token.Line, b.Properties, a.Properties)
+		d.nodes(path, b.Children, a.Children)
+	case *ast.TextNode:
+		a := after.(*ast.TextNode)
+		if b.Value != a.Value {
+			d.add(Changed, path, a.Token.Line, fmt.Sprintf("text %s -> %s", strconv.Quote(b.Value), strconv.Quote(a.Value)))
+		}
+	case *ast.Conditional:
+		a := after.(*ast.Conditional)
+		if b.Token.Literal != a.Token.Literal {
+			d.add(Changed, path, a.Token.Line, fmt.Sprintf("cond %s -> %s", strconv.Quote(b.Token.Literal), strconv.Quote(a.Token.Literal)))
+		}
+		d.nodes(path, b.Then, a.Then)
+		d.nodes(join(path, "else"), b.Else, a.Else)
+	case *ast.Repeat:
+		a := after.(*ast.Repeat)
+		if b.Token.Literal != a.Token.Literal {
+			d.add(Changed, path, a.Token.Line, fmt.Sprintf("%s -> %s", strconv.Quote(b.Token.Literal), strconv.Quote(a.Token.Literal)))
+		}
+		d.nodes(path, b.Children, a.Children)
+	}
+}
+
+// properties diffs two property sets, one change per property added,
+// removed, or given a new value, in name order
+func (d *differ) properties(path string, line int, before, after map[string]ast.Value) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, props := range []map[string]ast.Value{before, after} {
+		for name := range props {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+		switch {
+		case !inBefore:
+			d.add(Changed, path, line, fmt.Sprintf("+%s = %s", name, summary(a)))
+		case !inAfter:
+			d.add(Changed, path, line, fmt.Sprintf("-%s = %s", name, summary(b)))
+		case ast.ValueString(b) != ast.ValueString(a):
+			d.add(Changed, path, line, fmt.Sprintf("%s %s -> %s", name, summary(b), summary(a)))
+		}
+	}
+}
+
+// presets diffs the [preset] blocks of two documents, in name order. A
+// preset added or removed is reported once rather than property by property.
+func (d *differ) presets(before, after map[string]map[string]ast.Value) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, presets := range []map[string]map[string]ast.Value{before, after} {
+		for name := range presets {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+		path := fmt.Sprintf("[preset %s]", name)
+		switch {
+		case !inBefore:
+			d.add(Added, path, 0, "")
+		case !inAfter:
+			d.add(Removed, path, 0, "")
+		default:
+			d.properties(path, 0, b, a)
+		}
+	}
+}
+
+// match pairs up sibling nodes. Identical nodes are matched first, so an
+// inserted paragraph doesn't shift every paragraph after it; the nodes
+// left between them are then matched by key, as edits of each other.
+func match(before, after []ast.Node) []step {
+	var steps []step
+	var gapBefore, gapAfter []int
+
+	flush := func() {
+		for _, s := range align(keysAt(before, gapBefore), keysAt(after, gapAfter)) {
+			if s.before >= 0 {
+				s.before = gapBefore[s.before]
+			}
+			if s.after >= 0 {
+				s.after = gapAfter[s.after]
+			}
+			steps = append(steps, s)
+		}
+		gapBefore, gapAfter = nil, nil
+	}
+
+	for _, s := range align(fingerprints(before), fingerprints(after)) {
+		switch {
+		case s.after < 0:
+			gapBefore = append(gapBefore, s.before)
+		case s.before < 0:
+			gapAfter = append(gapAfter, s.after)
+		default:
+			flush()
+			steps = append(steps, s)
+		}
+	}
+	flush()
+	return steps
+}
+
+// step is one entry of an alignment: indexes into both lists, or -1 on
+// the side a node is missing from
+type step struct {
+	before, after int
+}
+
+// align pairs up equal keys along the longest common subsequence, leaving
+// the rest as removals and additions. Removals come before the additions
+// that replace them.
+func align(before, after []string) []step {
+	// lcs[i][j] is the LCS length of before[i:] and after[j:]
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var steps []step
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			steps = append(steps, step{i, j})
+			i++
+			j++
+		case i < len(before) && (j == len(after) || lcs[i+1][j] >= lcs[i][j+1]):
+			steps = append(steps, step{i, -1})
+			i++
+		default:
+			steps = append(steps, step{-1, j})
+			j++
+		}
+	}
+	return steps
+}
+
+// sectionNodes returns a document's sections as nodes
+func sectionNodes(doc *ast.Document) []ast.Node {
+	nodes := make([]ast.Node, len(doc.Sections))
+	for i, section := range doc.Sections {
+		nodes[i] = section
+	}
+	return nodes
+}
+
+// key identifies a node for matching: its kind or tag, plus the label of
+// a labelled element
+func key(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.PageSection:
+		return n.Type
+	case *ast.Element:
+		if label, ok := n.Properties["label"].(*ast.StringValue); ok {
+			return n.TagType + "#" + label.Value
+		}
+		return n.TagType
+	case *ast.TextNode:
+		return "text"
+	case *ast.Conditional:
+		return "if"
+	case *ast.Repeat:
+		return "repeat"
+	}
+	return node.TokenLiteral()
+}
+
+// keysAt returns the keys of the nodes at the given indexes
+func keysAt(nodes []ast.Node, indexes []int) []string {
+	ks := make([]string, len(indexes))
+	for i, index := range indexes {
+		ks[i] = key(nodes[index])
+	}
+	return ks
+}
+
+// fingerprints returns each node's fingerprint
+func fingerprints(nodes []ast.Node) []string {
+	fps := make([]string, len(nodes))
+	for i, node := range nodes {
+		fps[i] = fingerprint(node)
+	}
+	return fps
+}
+
+// fingerprint writes out a node and everything in it, so two nodes have
+// the same fingerprint exactly when diffing them finds no changes
+func fingerprint(node ast.Node) string {
+	var sb strings.Builder
+	sb.WriteString(key(node))
+
+	writeProps := func(props map[string]ast.Value) {
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sb.WriteString(" " + name + "=" + ast.ValueString(props[name]))
+		}
+	}
+	writeNodes := func(nodes []ast.Node) {
+		sb.WriteString(" (")
+		for _, child := range nodes {
+			sb.WriteString(fingerprint(child) + ";")
+		}
+		sb.WriteString(")")
+	}
+
+	switch n := node.(type) {
+	case *ast.PageSection:
+		writeProps(n.Properties)
+		writeNodes(n.Children)
+	case *ast.Element:
+		writeProps(n.Properties)
+		writeNodes(n.Children)
+	case *ast.TextNode:
+		sb.WriteString(" " + strconv.Quote(n.Value))
+	case *ast.Conditional:
+		sb.WriteString(" " + strconv.Quote(n.Token.Literal))
+		writeNodes(n.Then)
+		writeNodes(n.Else)
+	case *ast.Repeat:
+		sb.WriteString(" " + strconv.Quote(n.Token.Literal))
+		writeNodes(n.Children)
+	}
+	return sb.String()
+}
+
+// names returns each node's path segment: sections and labelled elements
+// by key alone, anything else numbered among its siblings with that key,
+// like p[2]
+func names(nodes []ast.Node) []string {
+	ns := make([]string, len(nodes))
+	count := make(map[string]int)
+	for i, node := range nodes {
+		k := key(node)
+		if _, section := node.(*ast.PageSection); section || strings.Contains(k, "#") {
+			ns[i] = k
+			continue
+		}
+		count[k]++
+		ns[i] = fmt.Sprintf("%s[%d]", k, count[k])
+	}
+	return ns
+}
+
+// join appends a segment to a path
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + " > " + name
+}
+
+// summary writes a value for a change report: as source, except code
+// blocks, which are described by their length
+func summary(val ast.Value) string {
+	if code, ok := val.(*ast.CodeBlockValue); ok {
+		lines := strings.Count(strings.Trim(code.Content, "\n"), "\n") + 1
+		return fmt.Sprintf("{ code, %d lines }", lines)
+	}
+	return ast.ValueString(val)
+}
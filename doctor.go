@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lpml/ast"
+	"lpml/config"
+	"lpml/project"
+)
+
+// finding is one problem reported by lpml doctor
+type finding struct {
+	where   string // file, optionally with :line
+	problem string
+	fix     string
+}
+
+// runDoctor checks a project directory for problems that would break or
+// degrade a build, printing a fix for each. It returns the exit status.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml doctor [dir]")
+		fmt.Println("  Checks the project in dir (default: current directory)")
+	}
+	fs.Parse(args)
+
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+
+	// A broken project file is reported as a finding; the pages are
+	// still checked from dir
+	cfg, cfgErr := config.Find(dir)
+	sources := dir
+	if cfg != nil {
+		sources = cfg.Input
+		if _, err := loadPlugins(cfg); err != nil {
+			cfgErr = err
+		}
+	}
+
+	proj, err := project.Load(sources)
+	if err != nil {
+		fmt.Printf("Failed to load project: %v\n", err)
+		return exitIO
+	}
+
+	fmt.Printf("Checking %s (%d pages)\n", dir, len(proj.Pages))
+
+	checks := []struct {
+		name string
+		run  func(*project.Project) []finding
+	}{
+		{"environment", checkEnvironment},
+		{"config", func(*project.Project) []finding { return checkConfig(dir, cfg, cfgErr) }},
+		{"syntax", checkSyntax},
+		{"assets", checkAssets},
+		{"labels", checkDuplicateLabels},
+		{"partials", checkOrphanedPartials},
+		{"outputs", checkOutputs},
+	}
+
+	total := 0
+	for _, check := range checks {
+		findings := check.run(proj)
+		if len(findings) == 0 {
+			fmt.Printf("  ok    %s\n", check.name)
+			continue
+		}
+		fmt.Printf("  FAIL  %s\n", check.name)
+		for _, f := range findings {
+			fmt.Printf("        %s: %s\n", f.where, f.problem)
+			fmt.Printf("          fix: %s\n", f.fix)
+		}
+		total += len(findings)
+	}
+
+	if total > 0 {
+		fmt.Printf("%d problem(s) found\n", total)
+		return exitFailure
+	}
+	fmt.Println("No problems found")
+	return exitOK
+}
+
+// checkEnvironment verifies external tools used by optional features
+func checkEnvironment(proj *project.Project) []finding {
+	if _, err := exec.LookPath("git"); err != nil {
+		return []finding{{
+			where:   "PATH",
+			problem: "git not found, -stamp builds will omit the commit",
+			fix:     "install git or ignore if you don't use -stamp",
+		}}
+	}
+	return nil
+}
+
+// checkConfig reports an unreadable lpml.toml, and directories and plugin
+// programs it names that don't exist
+func checkConfig(dir string, cfg *config.Config, err error) []finding {
+	if err != nil {
+		path := filepath.Join(dir, config.FileName)
+		return []finding{{
+			where:   path,
+			problem: strings.TrimPrefix(err.Error(), path+": "),
+			fix:     "correct the setting; see the Project File section of DOCS.md",
+		}}
+	}
+	if cfg == nil {
+		return nil
+	}
+
+	var findings []finding
+	dirs := append([]string{cfg.Input}, cfg.Assets...)
+	for i, d := range dirs {
+		if info, err := os.Stat(d); err == nil && info.IsDir() {
+			continue
+		}
+		setting := "build.assets"
+		if i == 0 {
+			setting = "build.input"
+		}
+		findings = append(findings, finding{
+			where:   cfg.Path,
+			problem: fmt.Sprintf("%s directory %s does not exist", setting, d),
+			fix:     fmt.Sprintf("create %s or correct %s", d, setting),
+		})
+	}
+	for _, version := range cfg.Versions {
+		d := filepath.Join(cfg.Input, version)
+		if info, err := os.Stat(d); err == nil && info.IsDir() {
+			continue
+		}
+		findings = append(findings, finding{
+			where:   cfg.Path,
+			problem: fmt.Sprintf("build.versions directory %s does not exist", d),
+			fix:     fmt.Sprintf("create %s or remove %s from build.versions", d, version),
+		})
+	}
+	names := make([]string, 0, len(cfg.Plugins))
+	for name := range cfg.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		program := cfg.Plugins[name]
+		if _, err := exec.LookPath(program); err != nil {
+			findings = append(findings, finding{
+				where:   cfg.Path,
+				problem: fmt.Sprintf("plugin %s: %s is not an executable program", name, program),
+				fix:     fmt.Sprintf("install %s, make it executable, or correct plugins.%s", program, name),
+			})
+		}
+	}
+	if len(cfg.Assets) > 0 && cfg.Output == "" {
+		findings = append(findings, finding{
+			where:   cfg.Path,
+			problem: "build.assets is set without build.output, so assets are never copied",
+			fix:     "set build.output or remove build.assets",
+		})
+	}
+	return findings
+}
+
+// checkSyntax reports parse errors in every page
+func checkSyntax(proj *project.Project) []finding {
+	var findings []finding
+	for _, page := range proj.Pages {
+		for _, e := range page.Errors {
+			findings = append(findings, finding{
+				where:   page.Source,
+				problem: e,
+				fix:     "correct the syntax, check that every -start tag has its -end tag",
+			})
+		}
+	}
+	return findings
+}
+
+// checkAssets reports images, linked code files, and local links that
+// point at files which don't exist
+func checkAssets(proj *project.Project) []finding {
+	var findings []finding
+
+	for _, page := range proj.Pages {
+		for _, elem := range project.Elements(page.Doc) {
+			for _, prop := range []string{"src", "linked_file", "link_url", "href"} {
+				sv, ok := elem.Properties[prop].(*ast.StringValue)
+				if !ok || !project.IsLocalPath(sv.Value) {
+					continue
+				}
+
+				path := proj.ResolvePath(page, sv.Value)
+				if assetExists(path) {
+					continue
+				}
+				findings = append(findings, finding{
+					where:   fmt.Sprintf("%s:%d", page.Source, sv.Token.Line),
+					problem: fmt.Sprintf("%s %s = %q not found", elem.TagType, prop, sv.Value),
+					fix:     fmt.Sprintf("create %s or correct the path", path),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// assetExists checks for a file, treating a link to page.html as present
+// when page.lpml exists to generate it
+func assetExists(path string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	if strings.HasSuffix(path, ".html") {
+		if _, err := os.Stat(strings.TrimSuffix(path, ".html") + ".lpml"); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDuplicateLabels reports labels defined in more than one file, which
+// make $references ambiguous once pages share content. A partial's
+// labels are defined once, however many pages include it.
+func checkDuplicateLabels(proj *project.Project) []finding {
+	pagesByLabel := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	for _, page := range proj.Pages {
+		for _, elem := range project.Elements(page.Doc) {
+			label := project.Label(elem)
+			file := elem.File
+			if file == "" {
+				file = page.Source
+			}
+			if label == "" || seen[label+"\x00"+file] {
+				continue
+			}
+			seen[label+"\x00"+file] = true
+			pagesByLabel[label] = append(pagesByLabel[label], file)
+		}
+	}
+
+	var labels []string
+	for label, pages := range pagesByLabel {
+		if len(pages) > 1 {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+
+	var findings []finding
+	for _, label := range labels {
+		findings = append(findings, finding{
+			where:   strings.Join(pagesByLabel[label], ", "),
+			problem: fmt.Sprintf("label %q is defined in %d files", label, len(pagesByLabel[label])),
+			fix:     "rename the label in all but one file",
+		})
+	}
+	return findings
+}
+
+// checkOrphanedPartials reports files in a partials directory that no
+// page includes. Nothing includes them, so they're built as pages of
+// their own.
+func checkOrphanedPartials(proj *project.Project) []finding {
+	var findings []finding
+	for _, page := range proj.Pages {
+		dir := "/" + filepath.ToSlash(filepath.Dir(page.Source)) + "/"
+		if !strings.Contains(dir, "/partials/") {
+			continue
+		}
+		findings = append(findings, finding{
+			where:   page.Source,
+			problem: fmt.Sprintf("no page includes this partial, so it's built on its own as %s", page.Output),
+			fix:     fmt.Sprintf("[include file=%q] it from a page, or delete it if nothing needs it", page.Source),
+		})
+	}
+	return findings
+}
+
+// checkOutputs reports pages whose output would collide with another
+// page's output or with an existing directory
+func checkOutputs(proj *project.Project) []finding {
+	var findings []finding
+	owners := make(map[string]string)
+
+	for _, page := range proj.Pages {
+		if info, err := os.Stat(page.Output); err == nil && info.IsDir() {
+			findings = append(findings, finding{
+				where:   page.Source,
+				problem: fmt.Sprintf("output %s is a directory", page.Output),
+				fix:     "rename the source file or the directory",
+			})
+		}
+
+		// Case-insensitive file systems (macOS, Windows) merge these
+		key := strings.ToLower(page.Output)
+		if other, exists := owners[key]; exists {
+			findings = append(findings, finding{
+				where:   page.Source,
+				problem: fmt.Sprintf("output %s collides with the output of %s", page.Output, other),
+				fix:     "rename one of the source files",
+			})
+			continue
+		}
+		owners[key] = page.Source
+	}
+
+	return findings
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"lpml/ast"
+	"lpml/generator"
+)
+
+// Output kinds accepted by -emit
+const (
+	emitHTML      = "html"      // The generated page
+	emitTextIndex = "textindex" // Visible text as JSON, for search and excerpts
+	emitASTText   = "ast-text"  // The parsed document as an indented tree, for debugging
+)
+
+// textIndex is the JSON written by -emit textindex
+type textIndex struct {
+	Source  string          `json:"source"`
+	Title   string          `json:"title,omitempty"`
+	Excerpt string          `json:"excerpt,omitempty"`
+	Blocks  []textIndexItem `json:"blocks"`
+}
+
+// textIndexItem is one heading or run of body text
+type textIndexItem struct {
+	Heading int    `json:"heading,omitempty"` // Heading level, omitted for body text
+	Text    string `json:"text"`
+}
+
+// rendered is the output for one page
+type rendered struct {
+	out      []byte
+	page     *generator.Page  // An HTML page written straight to its file instead of out, see load
+	warnings []string         // Generator warnings
+	errors   []string         // Warnings Options.Severity makes errors
+	files    []generator.File // Extra files the page links to, written next to it
+}
+
+// render produces the output for one page in the requested emit mode.
+// A panic rendering it is returned as an error, so one page can't stop a
+// build or the server.
+func render(doc *ast.Document, opts generator.Options, emit string) (result *rendered, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("rendering failed: %v; this is a bug in lpml, please report it with the source", r)
+		}
+	}()
+
+	switch emit {
+	case emitHTML:
+		gen := generator.NewWithOptions(opts)
+		page := gen.GeneratePage(doc)
+		return &rendered{page: page, warnings: page.Warnings(), errors: page.Errors(), files: page.Files()}, nil
+	case emitTextIndex:
+		out, err := buildTextIndex(doc, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &rendered{out: out}, nil
+	case emitASTText:
+		return &rendered{out: []byte(doc.String())}, nil
+	}
+	return nil, fmt.Errorf("unknown -emit value %q (want %s, %s, or %s)", emit, emitHTML, emitTextIndex, emitASTText)
+}
+
+// validateOutput reports structural problems in generated HTML. Other
+// emit modes aren't HTML and are never checked.
+func validateOutput(out []byte, emit string) ([]string, error) {
+	if emit != emitHTML {
+		return nil, nil
+	}
+
+	return htmlValidator(out)
+}
+
+// outputFor returns the default output path for a source in an emit mode
+func outputFor(source, emit string) string {
+	base := strings.TrimSuffix(source, ".lpml")
+	switch emit {
+	case emitTextIndex:
+		return base + ".textindex.json"
+	case emitASTText:
+		return base + ".ast.txt"
+	}
+	return base + ".html"
+}
+
+// load writes an HTML page into out, for steps that need all of it at
+// once. Pages are otherwise streamed to their files, so linked files are
+// never read into memory whole.
+func (r *rendered) load() error {
+	if r.page == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if _, err := r.page.WriteTo(&buf); err != nil {
+		return err
+	}
+	r.out, r.page = buf.Bytes(), nil
+	return nil
+}
+
+// writeTo writes the output to w
+func (r *rendered) writeTo(w io.Writer) error {
+	if r.page != nil {
+		_, err := r.page.WriteTo(w)
+		return err
+	}
+	_, err := w.Write(r.out)
+	return err
+}
+
+// buildTextIndex serializes the document's visible text with its headings
+func buildTextIndex(doc *ast.Document, opts generator.Options) ([]byte, error) {
+	index := textIndex{Source: opts.SourceFile, Excerpt: generator.NewWithOptions(opts).Excerpt(doc), Blocks: []textIndexItem{}}
+	index.Title, _ = ast.StringOf(doc.Meta["title"])
+
+	for _, block := range ast.ExtractText(doc) {
+		if block.IsHeading() && index.Title == "" {
+			index.Title = block.Text
+		}
+		index.Blocks = append(index.Blocks, textIndexItem{Heading: block.Level, Text: block.Text})
+	}
+
+	out, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
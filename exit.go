@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Exit statuses, so scripts can tell failures apart without parsing the
+// output. Commands that only report findings, like doctor or fmt -l, use
+// exitFailure when they find something.
+const (
+	exitOK       = 0 // Success
+	exitFailure  = 1 // The command ran and found problems
+	exitUsage    = 2 // Bad flags, arguments, or project file settings
+	exitParse    = 3 // Lexing, parse, or reference errors in a source file
+	exitGenerate = 4 // Rendering, validating, or minifying output failed
+	exitIO       = 5 // A file couldn't be read or written
+)
+
+// exitForError classifies an error from loading input: problems reaching
+// a file are I/O errors, anything else is a usage error
+func exitForError(err error) int {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return exitIO
+	}
+	return exitUsage
+}
+
+// firstFailure keeps the status of the first failure when a command
+// carries on past several
+func firstFailure(status, code int) int {
+	if status == exitOK {
+		return code
+	}
+	return status
+}
@@ -0,0 +1,29 @@
+package main
+
+// The optional subsystems lpml is built with. Each is built in unless a
+// build tag leaves it out, for a smaller binary:
+//
+//	go build -tags lpml_noimage,lpml_nominify,lpml_novalidate
+//
+// A subsystem's own file, built without its tag, registers it here.
+var (
+	imagesBuiltIn bool                           // Placeholders and srcsets, unless lpml_noimage
+	htmlMinifier  func([]byte) ([]byte, error)   // -minify, unless lpml_nominify
+	htmlValidator func([]byte) ([]string, error) // -validate-output, unless lpml_novalidate
+)
+
+// missingFeatures returns the build tags that left subsystems out of this
+// binary
+func missingFeatures() []string {
+	var tags []string
+	if !imagesBuiltIn {
+		tags = append(tags, "lpml_noimage")
+	}
+	if htmlMinifier == nil {
+		tags = append(tags, "lpml_nominify")
+	}
+	if htmlValidator == nil {
+		tags = append(tags, "lpml_novalidate")
+	}
+	return tags
+}
@@ -0,0 +1,9 @@
+//go:build !lpml_noimage
+
+package main
+
+import _ "lpml/imaging" // register image decoding with the generator
+
+func init() {
+	imagesBuiltIn = true
+}
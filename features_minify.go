@@ -0,0 +1,9 @@
+//go:build !lpml_nominify
+
+package main
+
+import "lpml/minify"
+
+func init() {
+	htmlMinifier = minify.HTML
+}
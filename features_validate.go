@@ -0,0 +1,27 @@
+//go:build !lpml_novalidate
+
+package main
+
+import (
+	"bytes"
+
+	"lpml/validate"
+)
+
+func init() {
+	htmlValidator = validateHTML
+}
+
+// validateHTML reports structural problems in generated HTML
+func validateHTML(out []byte) ([]string, error) {
+	problems, err := validate.HTML(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []string
+	for _, p := range problems {
+		msgs = append(msgs, p.String())
+	}
+	return msgs, nil
+}
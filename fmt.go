@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"lpml/config"
+	"lpml/format"
+	"lpml/project"
+)
+
+// runFmt rewrites source files in canonical layout. With -l it only lists
+// the files that would change. It returns the exit status.
+func runFmt(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := fs.Bool("l", false, "list files whose formatting differs instead of rewriting them")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml fmt [-l] [file.lpml | dir]...")
+		fmt.Println("  Formats sources in place (default: every .lpml under the current directory)")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	sources, status := sourceFiles(parseInterspersed(fs, args))
+	if status != exitOK {
+		return status
+	}
+
+	for _, source := range sources {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			fmt.Printf("Failed to read file: %v\n", err)
+			status = firstFailure(status, exitIO)
+			continue
+		}
+
+		formatted, err := format.Source(string(content))
+		if err != nil {
+			fmt.Printf("%s: %v\n", source, err)
+			status = firstFailure(status, exitParse)
+			continue
+		}
+		if formatted == string(content) {
+			continue
+		}
+
+		if *list {
+			fmt.Println(source)
+			status = firstFailure(status, exitFailure)
+			continue
+		}
+		if err := os.WriteFile(source, []byte(formatted), 0644); err != nil {
+			fmt.Printf("Failed to write file: %v\n", err)
+			status = firstFailure(status, exitIO)
+			continue
+		}
+		fmt.Printf("Formatted: %s\n", source)
+	}
+
+	return status
+}
+
+// sourceFiles returns the files named in targets and the .lpml files under
+// the directories, every .lpml under the current directory if there are
+// none, with the plugins of the directories' project files registered to
+// parse them with. It prints what went wrong and returns a failing exit
+// status if anything did.
+func sourceFiles(targets []string) ([]string, int) {
+	if len(targets) == 0 {
+		targets = []string{"."}
+	}
+
+	var sources []string
+	for _, target := range targets {
+		if info, err := os.Stat(target); err == nil && info.IsDir() {
+			// Plugins' custom tags have to be known to parse the pages
+			projectFile, err := config.Find(target)
+			if err == nil {
+				_, err = loadPlugins(projectFile)
+			}
+			if err != nil {
+				fmt.Printf("Failed to load plugins: %v\n", err)
+				return nil, exitForError(err)
+			}
+			found, err := project.FindSources(target)
+			if err != nil {
+				fmt.Printf("Failed to read directory: %v\n", err)
+				return nil, exitIO
+			}
+			sources = append(sources, found...)
+		} else {
+			sources = append(sources, target)
+		}
+	}
+	return sources, exitOK
+}
@@ -0,0 +1,397 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"lpml/lexer"
+	"lpml/parser"
+	"lpml/tokens"
+)
+
+// indentUnit is the indentation added per nesting level
+const indentUnit = "  "
+
+// Source returns src in canonical layout: one tag or property per line,
+// two-space indentation per nesting level, and at most one blank line
+// between the groups the author separated. Code block contents, strings,
+// and comments are kept verbatim; a comment after a tag or property stays on
+// its line. Sources that don't parse cleanly are returned as an error
+// rather than guessed at.
+func Source(src string) (string, error) {
+	p := parser.New(lexer.New(src))
+	p.ParseDocument()
+	if len(p.Errors()) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(p.Errors(), "; "))
+	}
+
+	f := &formatter{lines: strings.Split(src, "\n"), l: lexer.NewWithComments(src)}
+	f.next()
+	if err := f.run(); err != nil {
+		return "", err
+	}
+	return f.out.String(), nil
+}
+
+// formatter rewrites a token stream with canonical whitespace
+type formatter struct {
+	lines    []string
+	l        *lexer.Lexer
+	cur      tokens.Token
+	out      strings.Builder
+	depth    int
+	lastLine int            // Source line of the last token that started an output line
+	block    bool           // Inside a [meta] or [define] block, which has no closing tag
+	indented bool           // An [indented] file, nested by INDENT and DEDENT rather than tags
+	held     []tokens.Token // In an indented file, comments waiting for the depth of the line after them
+	prev     tokens.Token   // The token before cur
+	inline   int            // In an indented file, levels added for tags with more after them on their line
+	tagLine  int            // The source line those tags end on
+}
+
+// next advances to the next token
+func (f *formatter) next() {
+	f.prev = f.cur
+	f.cur = f.l.NextToken()
+}
+
+// run writes every token in the stream
+func (f *formatter) run() error {
+	for f.cur.Type != tokens.EOF {
+		// What follows a tag on its line in an indented file belongs to it,
+		// so it goes on lines of its own indented under the tag
+		if f.inline > 0 && (f.cur.Line != f.tagLine || f.cur.Type == tokens.INDENT || f.cur.Type == tokens.DEDENT) {
+			f.depth -= f.inline
+			f.inline = 0
+		}
+
+		switch {
+		case f.cur.Type == tokens.VOID_START:
+			if f.block {
+				f.depth = 0
+				f.block = false
+			}
+			if err := f.voidTag(); err != nil {
+				return err
+			}
+
+		case tokens.IsClosingTag(f.cur.Type):
+			f.depth--
+			f.line("[" + f.cur.Literal + "]")
+			f.next()
+
+		case f.cur.Type == tokens.INDENTED:
+			f.line("[indented]")
+			f.indented = true
+			f.next()
+
+		case f.cur.Type == tokens.INDENT:
+			f.depth++
+			f.next()
+
+		case f.cur.Type == tokens.DEDENT:
+			f.depth--
+			f.next()
+
+		case f.cur.Type == tokens.INCLUDE:
+			if f.block {
+				f.depth = 0
+				f.block = false
+			}
+			f.line(`[include file="` + f.cur.Literal + `"]`)
+			f.next()
+
+		case f.cur.Type == tokens.META || f.cur.Type == tokens.DEFINE || f.cur.Type == tokens.PRESET:
+			if f.block {
+				f.depth = 0
+			}
+			if f.cur.Type == tokens.PRESET {
+				f.line(`[preset name="` + f.cur.Literal + `"]`)
+			} else {
+				f.line("[" + f.cur.Literal + "]")
+			}
+			if !f.indented {
+				f.depth = 1 // its properties, until the next tag
+				f.block = true
+			}
+			f.next()
+
+		case f.cur.Type == tokens.IF_START:
+			f.line("[if cond=" + f.cur.Literal + "]")
+			f.next()
+			f.nest()
+
+		case f.cur.Type == tokens.ELSE:
+			if f.indented {
+				f.line("[else]")
+			} else {
+				f.depth-- // level with its [if]
+				f.line("[else]")
+				f.depth++
+			}
+			f.next()
+
+		case f.cur.Type == tokens.IF_END:
+			f.depth--
+			f.line("[if-end]")
+			f.next()
+
+		case f.cur.Type == tokens.REPEAT_START:
+			f.line(strings.TrimSpace("[repeat "+f.cur.Literal) + "]")
+			f.next()
+			f.nest()
+
+		case f.cur.Type == tokens.REPEAT_END:
+			f.depth--
+			f.line("[repeat-end]")
+			f.next()
+
+		case tokens.IsOpeningTag(f.cur.Type):
+			if f.block {
+				f.depth = 0
+				f.block = false
+			}
+			tag := f.cur
+			text := "[" + tag.Literal
+			f.next()
+			if f.cur.Type == tokens.ATTRS_START {
+				f.next()
+				attrs, err := f.attrs(tokens.ATTRS_END, tag.Literal)
+				if err != nil {
+					return err
+				}
+				text += attrs
+			}
+			f.lineAt(tag, text+"]")
+			f.nest()
+
+		case f.cur.Type == tokens.IDENT:
+			name := f.cur
+			f.next() // the parser already checked for '='
+			f.next()
+			value, err := f.value()
+			if err != nil {
+				return err
+			}
+			f.lineAt(name, name.Literal+" = "+value)
+
+		case f.cur.Type == tokens.STRING:
+			f.line(f.cur.Literal)
+			f.next()
+
+		case f.cur.Type == tokens.COMMENT:
+			f.comment()
+			f.next()
+
+		default:
+			return fmt.Errorf("line %d: unexpected %q", f.cur.Line, f.cur.Literal)
+		}
+	}
+	f.writeHeld()
+	return nil
+}
+
+// nest indents what follows an opening tag, up to its end tag. In an
+// indented file the INDENT after the tag does that instead, or for the
+// rest of the tag's line, the tag itself.
+func (f *formatter) nest() {
+	if !f.indented {
+		f.depth++
+		return
+	}
+	if line := f.prev.EndLine; f.cur.Line == line && f.cur.Type != tokens.EOF && f.cur.Type != tokens.COMMENT {
+		f.depth++
+		f.inline++
+		f.tagLine = line
+	}
+}
+
+// voidTag writes a void tag like [img src="x.png" alt="Logo"] on one
+// line
+func (f *formatter) voidTag() error {
+	tag := f.cur
+	f.next()
+	attrs, err := f.attrs(tokens.VOID_END, tag.Literal)
+	if err != nil {
+		return err
+	}
+	f.lineAt(tag, "["+tag.Literal+attrs+"]")
+	return nil
+}
+
+// attrs formats the properties written inside a tag, up to and including
+// end, as " name=value" each in the order they were written
+func (f *formatter) attrs(end tokens.TokenType, tag string) (string, error) {
+	var sb strings.Builder
+	for f.cur.Type != end && f.cur.Type != tokens.EOF {
+		if f.cur.Type != tokens.IDENT {
+			return "", fmt.Errorf("line %d: only properties can be formatted inside [%s], not %q", f.cur.Line, tag, f.cur.Literal)
+		}
+		name := f.cur.Literal
+		f.next() // the parser already checked for '='
+		f.next()
+		value, err := f.value()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(" " + name + "=" + value)
+	}
+	f.next() // consume the end of the tag
+	return sb.String(), nil
+}
+
+// value formats the property value at the current token
+func (f *formatter) value() (string, error) {
+	tok := f.cur
+	f.next()
+
+	switch tok.Type {
+	case tokens.STRING:
+		return tok.Literal, nil
+	case tokens.NUMBER, tokens.DIMENSION, tokens.COLOR, tokens.DATE, tokens.BOOL:
+		return tok.Literal, nil
+	case tokens.DOLLAR:
+		ref := "$" + tok.Literal
+		if f.cur.Type == tokens.FALLBACK {
+			f.next() // consume '??'
+			fallback, err := f.value()
+			if err != nil {
+				return "", err
+			}
+			ref += " ?? " + fallback
+		}
+		for f.cur.Type == tokens.PIPE {
+			f.next() // consume '|'
+			filter := f.cur.Literal
+			switch f.cur.Type {
+			case tokens.IDENT:
+				f.next()
+			case tokens.CALL:
+				var err error
+				if filter, err = f.value(); err != nil {
+					return "", err
+				}
+			default:
+				return "", fmt.Errorf("line %d: unexpected %q after |", f.cur.Line, f.cur.Literal)
+			}
+			ref += " | " + filter
+		}
+		return ref, nil
+	case tokens.CODEBLOCK:
+		return "{\n" + tok.Literal + "\n}", nil
+	case tokens.LBRACKET:
+		var items []string
+		for f.cur.Type != tokens.RBRACKET && f.cur.Type != tokens.EOF {
+			if f.cur.Type == tokens.COMMENT {
+				return "", fmt.Errorf("line %d: comments inside arrays can't be formatted", f.cur.Line)
+			}
+			if f.cur.Type == tokens.COMMA {
+				f.next()
+				continue
+			}
+			item, err := f.value()
+			if err != nil {
+				return "", err
+			}
+			items = append(items, item)
+		}
+		f.next() // consume ']'
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case tokens.CALL:
+		var args []string
+		for f.cur.Type != tokens.RPAREN && f.cur.Type != tokens.EOF {
+			if f.cur.Type == tokens.COMMENT {
+				return "", fmt.Errorf("line %d: comments inside calls can't be formatted", f.cur.Line)
+			}
+			if f.cur.Type == tokens.COMMA {
+				f.next()
+				continue
+			}
+			arg, err := f.value()
+			if err != nil {
+				return "", err
+			}
+			args = append(args, arg)
+		}
+		f.next() // consume ')'
+		return tok.Literal + "(" + strings.Join(args, ", ") + ")", nil
+	case tokens.LBRACE:
+		var entries []string
+		for f.cur.Type != tokens.RBRACE && f.cur.Type != tokens.EOF {
+			if f.cur.Type == tokens.COMMENT {
+				return "", fmt.Errorf("line %d: comments inside maps can't be formatted", f.cur.Line)
+			}
+			if f.cur.Type == tokens.COMMA {
+				f.next()
+				continue
+			}
+			key := f.cur.Literal
+			f.next() // the parser already checked for '='
+			f.next()
+			value, err := f.value()
+			if err != nil {
+				return "", err
+			}
+			entries = append(entries, key+" = "+value)
+		}
+		f.next() // consume '}'
+		if len(entries) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(entries, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("line %d: unexpected %q in value", tok.Line, tok.Literal)
+}
+
+// line writes text on its own line for the current token
+func (f *formatter) line(text string) {
+	f.lineAt(f.cur, text)
+}
+
+// lineAt writes text on its own line at the current depth, keeping a
+// blank line before it if the author left one before tok
+func (f *formatter) lineAt(tok tokens.Token, text string) {
+	f.writeHeld()
+	if f.out.Len() > 0 && tok.Line > f.lastLine && f.blankBefore(tok.Line) {
+		f.out.WriteString("\n")
+	}
+	f.lastLine = tok.Line
+
+	f.out.WriteString(strings.Repeat(indentUnit, max(f.depth, 0)))
+	f.out.WriteString(text)
+	f.out.WriteString("\n")
+}
+
+// writeHeld writes the comments held for the next line at the current
+// depth
+func (f *formatter) writeHeld() {
+	held := f.held
+	f.held = nil
+	for _, c := range held {
+		f.lineAt(c, c.Literal)
+	}
+}
+
+// comment writes the comment at the current token, after the last line
+// written if it started on the same source line. In an indented file a
+// comment on its own line is held until the next line is written, since
+// the DEDENT that sets its depth comes after it.
+func (f *formatter) comment() {
+	out := f.out.String()
+	if f.out.Len() > 0 && f.cur.Line == f.lastLine && !strings.HasSuffix(out, "\n\n") {
+		f.out.Reset()
+		f.out.WriteString(strings.TrimSuffix(out, "\n") + " " + f.cur.Literal + "\n")
+		return
+	}
+	if f.indented {
+		f.held = append(f.held, f.cur)
+		return
+	}
+	f.line(f.cur.Literal)
+}
+
+// blankBefore reports whether the source line before line n is blank
+func (f *formatter) blankBefore(n int) bool {
+	i := n - 2 // lines is zero-based
+	return i >= 0 && i < len(f.lines) && strings.TrimSpace(f.lines[i]) == ""
+}
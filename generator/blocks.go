@@ -0,0 +1,202 @@
+package generator
+
+import (
+	"strconv"
+	"strings"
+
+	"lpml/ast"
+)
+
+// resolveBlocks returns doc with each [if] replaced by the branch its
+// condition picks, each [repeat] by a copy of its children per item, and
+// each [query-start]'s children by a copy per page it finds.
+// Elements holding blocks are copied, so the original document is left as
+// parsed.
+func (g *Generator) resolveBlocks(doc *ast.Document) *ast.Document {
+	out := *doc
+	out.Sections = make([]*ast.PageSection, len(doc.Sections))
+	for i, section := range doc.Sections {
+		s := *section
+		s.Children = g.resolveNodes(section.Children)
+		out.Sections[i] = &s
+	}
+	return &out
+}
+
+// resolveNodes returns nodes with blocks expanded, resolved in turn
+func (g *Generator) resolveNodes(nodes []ast.Node) []ast.Node {
+	var out []ast.Node
+	for _, node := range nodes {
+		if g.elements > g.maxElements() {
+			return out // The rest of the page is left out
+		}
+		switch n := node.(type) {
+		case *ast.Conditional:
+			if g.holds(n) {
+				out = append(out, g.resolveNodes(n.Then)...)
+			} else {
+				out = append(out, g.resolveNodes(n.Else)...)
+			}
+		case *ast.Repeat:
+			for i, item := range g.repeatItems(n) {
+				if g.elements > g.maxElements() {
+					break
+				}
+				bound := map[string]ast.Value{
+					n.As:            item,
+					n.As + ".index": &ast.NumberValue{Token: n.Token, Value: strconv.Itoa(i + 1)},
+				}
+				out = append(out, g.resolveNodes(substituteNodes(n.Children, bound))...)
+			}
+		case *ast.Element:
+			if g.elements++; g.elements > g.maxElements() {
+				g.warnf(RuleLimit, n.Token.Line, "the page has more than %d elements once its blocks are expanded, so the rest of it is left out", g.maxElements())
+				return out
+			}
+			elem := *n
+			if n.TagType == "query" {
+				elem.Children = g.resolveNodes(g.expandQuery(n))
+			} else {
+				elem.Children = g.resolveNodes(n.Children)
+			}
+			out = append(out, &elem)
+		default:
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// repeatItems returns the values a [repeat] goes over, following $names
+// through [define] constants to the array
+func (g *Generator) repeatItems(repeat *ast.Repeat) []ast.Value {
+	val := repeat.Over
+	seen := make(map[string]bool)
+	for {
+		ref, ok := val.(*ast.VariableRef)
+		if !ok || seen[ref.Name] {
+			break
+		}
+		seen[ref.Name] = true
+		constant, ok := g.defines[ref.Name]
+		if !ok && ref.Default != nil {
+			constant, ok = ref.Default, true
+		}
+		if !ok {
+			g.warnf(RuleReference, repeat.Token.Line, "[repeat] $%s isn't a [define] constant, repeating nothing", ref.Name)
+			return nil
+		}
+		val = constant
+	}
+
+	arr, ok := val.(*ast.ArrayValue)
+	if !ok {
+		g.warnf(RuleProperty, repeat.Token.Line, "[repeat] needs an array to go over, like [\"a.jpg\", \"b.jpg\"]")
+		return nil
+	}
+	return arr.Values
+}
+
+// substituteNodes returns a copy of nodes with the references named in
+// bound replaced by their values. A nested [repeat] or [query-start]
+// binding one of the names hides it from its children.
+func substituteNodes(nodes []ast.Node, bound map[string]ast.Value) []ast.Node {
+	out := make([]ast.Node, 0, len(nodes))
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *ast.Element:
+			elem := *n
+			elem.Properties = make(map[string]ast.Value, len(n.Properties))
+			for name, val := range n.Properties {
+				elem.Properties[name] = substitute(val, bound)
+			}
+			inner := bound
+			if n.TagType == "query" {
+				prefix := queryAs(n) + "."
+				inner = make(map[string]ast.Value, len(bound))
+				for name, val := range bound {
+					if !strings.HasPrefix(name, prefix) {
+						inner[name] = val
+					}
+				}
+			}
+			elem.Children = substituteNodes(n.Children, inner)
+			out = append(out, &elem)
+		case *ast.Conditional:
+			cond := *n
+			cond.Left, cond.Right = substitute(n.Left, bound), substitute(n.Right, bound)
+			cond.Then, cond.Else = substituteNodes(n.Then, bound), substituteNodes(n.Else, bound)
+			out = append(out, &cond)
+		case *ast.Repeat:
+			repeat := *n
+			repeat.Over = substitute(n.Over, bound)
+			inner := make(map[string]ast.Value, len(bound))
+			for name, val := range bound {
+				if name != n.As && name != n.As+".index" {
+					inner[name] = val
+				}
+			}
+			repeat.Children = substituteNodes(n.Children, inner)
+			out = append(out, &repeat)
+		default:
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// substitute returns val with the references named in bound replaced
+func substitute(val ast.Value, bound map[string]ast.Value) ast.Value {
+	switch v := val.(type) {
+	case *ast.VariableRef:
+		if item, ok := bound[v.Name]; ok {
+			return item
+		}
+		if v.Default != nil {
+			ref := *v
+			ref.Default = substitute(v.Default, bound)
+			return &ref
+		}
+	case *ast.ArrayValue:
+		arr := *v
+		arr.Values = make([]ast.Value, len(v.Values))
+		for i, item := range v.Values {
+			arr.Values[i] = substitute(item, bound)
+		}
+		return &arr
+	case *ast.TemplateValue:
+		tv := *v
+		tv.Parts = make([]ast.Value, len(v.Parts))
+		for i, part := range v.Parts {
+			tv.Parts[i] = substitute(part, bound)
+		}
+		return &tv
+	case *ast.MapValue:
+		m := *v
+		m.Entries = make([]ast.Property, len(v.Entries))
+		for i, e := range v.Entries {
+			m.Entries[i] = ast.Property{Name: e.Name, Value: substitute(e.Value, bound)}
+		}
+		return &m
+	case *ast.CallValue:
+		call := *v
+		call.Args = make([]ast.Value, len(v.Args))
+		for i, arg := range v.Args {
+			call.Args[i] = substitute(arg, bound)
+		}
+		return &call
+	case *ast.PipeValue:
+		pipe := *v
+		pipe.Value = substitute(v.Value, bound)
+		pipe.Filters = make([]ast.Filter, len(v.Filters))
+		for i, filter := range v.Filters {
+			filter.Args = make([]ast.Value, len(filter.Args))
+			for j, arg := range v.Filters[i].Args {
+				filter.Args[j] = substitute(arg, bound)
+			}
+			pipe.Filters[i] = filter
+		}
+		return &pipe
+	}
+	return val
+}
@@ -0,0 +1,20 @@
+package generator
+
+import "lpml/ast"
+
+// call works out a build-time function call, once per call, so a call's
+// warnings are given once and now() is the same wherever it's read
+func (g *Generator) call(call *ast.CallValue) ast.Value {
+	if val, done := g.calls[call]; done {
+		return val
+	}
+	var val ast.Value
+	switch call.Name {
+	case "number", "currency", "percent":
+		val = g.numberCall(call)
+	default:
+		val = g.dateCall(call)
+	}
+	g.calls[call] = val
+	return val
+}
@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"strconv"
+
+	"lpml/ast"
+)
+
+// holds evaluates an [if] condition. Only built-in variables, [define]
+// constants, and [meta] fields exist at this point; any other $name is
+// false. A value alone
+// holds unless it's empty, false, or 0. Values that are both numbers
+// compare as numbers.
+func (g *Generator) holds(cond *ast.Conditional) bool {
+	if cond.Left == nil || (cond.Op != "" && cond.Right == nil) {
+		return false // already reported by the parser
+	}
+
+	left, ok := g.conditionValue(cond, cond.Left)
+	var result bool
+	switch cond.Op {
+	case "":
+		result = ok && left != "" && left != "false" && left != "0"
+	case "==", "!=":
+		right, _ := g.conditionValue(cond, cond.Right)
+		result = left == right
+		if a, err := strconv.ParseFloat(left, 64); err == nil {
+			if b, err := strconv.ParseFloat(right, 64); err == nil {
+				result = a == b
+			}
+		}
+		if cond.Op == "!=" {
+			result = !result
+		}
+	}
+
+	if cond.Not {
+		return !result
+	}
+	return result
+}
+
+// conditionValue resolves one side of a condition, reporting false for a
+// $name that isn't a built-in variable, constant, or [meta] field
+func (g *Generator) conditionValue(cond *ast.Conditional, val ast.Value) (string, bool) {
+	ref, ok := val.(*ast.VariableRef)
+	if !ok {
+		return g.resolveValue(val), true
+	}
+	_, builtin := g.vars[ref.Name]
+	_, constant := g.defines[ref.Name]
+	if builtin || constant {
+		return g.resolveValue(ref), true
+	}
+	if field, ok := g.meta[ref.Name]; ok {
+		return g.resolveValue(field), true
+	}
+	g.warnf(RuleReference, cond.Token.Line, "[if] $%s isn't a [define] constant or [meta] field, taking it as unset", ref.Name)
+	return "", false
+}
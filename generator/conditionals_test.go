@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"lpml/lexer"
+	"lpml/parser"
+)
+
+// render parses and generates src, failing the test on parse errors
+func render(t *testing.T, src string) string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	doc := p.ParseDocument()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse errors: %v", errs)
+	}
+	return New().Generate(doc)
+}
+
+func TestConditionOperators(t *testing.T) {
+	const defines = "[define]\n  draft = false\n  env = \"prod\"\n[top-of-page-start]\n"
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`$draft`, false},
+		{`!$draft`, true},
+		{`$env == "prod"`, true},
+		{`$env != "prod"`, false},
+		{`$draft == false`, true},
+		{`$draft != false`, false},
+	}
+	for _, tt := range tests {
+		src := defines + "[if cond=" + tt.cond + "]\n  [p-start contains=\"shown\"][p-end]\n[else]\n  [p-start contains=\"hidden\"][p-end]\n[if-end]\n[top-of-page-end]\n"
+		html := render(t, src)
+		if got := strings.Contains(html, "<p>shown</p>"); got != tt.want {
+			t.Errorf("[if cond=%s] rendered the then branch: %v, want %v", tt.cond, got, tt.want)
+		}
+		if got := strings.Contains(html, "<p>hidden</p>"); got == tt.want {
+			t.Errorf("[if cond=%s] rendered the else branch: %v, want %v", tt.cond, got, !tt.want)
+		}
+	}
+}
+
+// The examples of DOCS.md's Conditionals section
+func TestConditionalsDocs(t *testing.T) {
+	html := render(t, `[define]
+  draft = false
+  env = "prod"
+
+[top-of-page-start]
+  [if cond=$draft]
+    [p-start]
+      contains = "DRAFT - not for circulation"
+    [p-end]
+  [else]
+    [p-start]
+      contains = "Published edition"
+    [p-end]
+  [if-end]
+
+  [if cond=$env != "prod"]
+    [p-start]
+      contains = "Staging build"
+    [p-end]
+  [if-end]
+[top-of-page-end]
+`)
+	if !strings.Contains(html, "Published edition") || strings.Contains(html, "DRAFT") || strings.Contains(html, "Staging build") {
+		t.Errorf("the draft and env example rendered the wrong branches:\n%s", html)
+	}
+
+	tests := []struct {
+		name, src string
+		want      bool
+	}{
+		{"front matter field", "[meta]\n  draft = true\n[top-of-page-start]\n[if cond=$draft][p-start contains=\"shown\"][p-end][if-end]\n[top-of-page-end]\n", true},
+		{"constant over field", "[meta]\n  draft = true\n[define]\n  draft = false\n[top-of-page-start]\n[if cond=$draft][p-start contains=\"shown\"][p-end][if-end]\n[top-of-page-end]\n", false},
+		{"numbers compare as numbers", "[define]\n  n = 3\n[top-of-page-start]\n[if cond=$n == 3.0][p-start contains=\"shown\"][p-end][if-end]\n[top-of-page-end]\n", true},
+		{"empty string", "[define]\n  s = \"\"\n[top-of-page-start]\n[if cond=$s][p-start contains=\"shown\"][p-end][if-end]\n[top-of-page-end]\n", false},
+		{"zero", "[define]\n  n = 0\n[top-of-page-start]\n[if cond=$n][p-start contains=\"shown\"][p-end][if-end]\n[top-of-page-end]\n", false},
+		{"in an element, nested", "[define]\n  a = true\n  b = true\n[top-of-page-start]\n[p-start]\n  [if cond=$a]\n    [if cond=$b]\n      \"shown\"\n    [if-end]\n  [if-end]\n[p-end]\n[top-of-page-end]\n", true},
+	}
+	for _, tt := range tests {
+		if got := strings.Contains(render(t, tt.src), "shown"); got != tt.want {
+			t.Errorf("%s: rendered %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConditionUnset(t *testing.T) {
+	doc := parser.New(lexer.New("[top-of-page-start]\n[if cond=$nothing][p-start contains=\"shown\"][p-end][if-end]\n[top-of-page-end]\n")).ParseDocument()
+	g := New()
+	if html := g.Generate(doc); strings.Contains(html, "shown") {
+		t.Errorf("an unknown $name should be unset:\n%s", html)
+	}
+	if len(g.Warnings()) != 1 {
+		t.Errorf("want one warning for an unknown $name, got %v", g.Warnings())
+	}
+}
+
+func TestConditionBareWord(t *testing.T) {
+	p := parser.New(lexer.New("[top-of-page-start]\n[if cond=draft][p-start contains=\"shown\"][p-end][if-end]\n[top-of-page-end]\n"))
+	p.ParseDocument()
+	if len(p.Errors()) != 1 || !strings.Contains(p.Errors()[0], "$draft") {
+		t.Errorf("want one error suggesting $draft, got %v", p.Errors())
+	}
+}
@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"lpml/ast"
+)
+
+// generateContact generates a contact card and a link to its .vcf file
+func (g *Generator) generateContact(elem *ast.Element, indent string) string {
+	var sb strings.Builder
+
+	name := g.getStringProp(elem, "name")
+	role := g.getStringProp(elem, "role")
+	org := g.getStringProp(elem, "org")
+	email := g.getStringProp(elem, "email")
+	phone := g.getStringProp(elem, "phone")
+	url := g.getStringProp(elem, "url")
+	address := g.getStringProp(elem, "address")
+	inner := indent + "  "
+
+	if name == "" && org == "" {
+		g.warnf(RuleProperty, elem.Token.Line, "[contact-start] needs a name or org")
+	}
+
+	sb.WriteString(fmt.Sprintf("%s<div%s%s%s>\n", indent, g.buildIDAttr(elem, elem.Properties),
+		g.buildClassAttr(elem.Properties, "contact"), g.buildStyleAttr(elem.Properties)))
+	if name != "" {
+		sb.WriteString(fmt.Sprintf("%s<p class=\"contact-name\">%s</p>\n", inner, escapeHTML(name)))
+	}
+	if work := strings.Trim(role+", "+org, ", "); work != "" {
+		sb.WriteString(fmt.Sprintf("%s<p class=\"contact-role\">%s</p>\n", inner, escapeHTML(work)))
+	}
+	if email != "" {
+		sb.WriteString(fmt.Sprintf("%s<p class=\"contact-email\"><a%s>%s</a></p>\n", inner,
+			attr("href", "mailto:"+email), escapeHTML(email)))
+	}
+	if phone != "" {
+		tel := strings.Join(strings.Fields(phone), "")
+		sb.WriteString(fmt.Sprintf("%s<p class=\"contact-phone\"><a%s>%s</a></p>\n", inner,
+			attr("href", "tel:"+tel), escapeHTML(phone)))
+	}
+	if url != "" {
+		sb.WriteString(fmt.Sprintf("%s<p class=\"contact-url\"><a%s>%s</a></p>\n", inner,
+			attr("href", url), escapeHTML(url)))
+	}
+	if address != "" {
+		sb.WriteString(fmt.Sprintf("%s<p class=\"contact-address\">%s</p>\n", inner, escapeHTML(address)))
+	}
+	if content := g.inlineContent(elem); content != "" {
+		sb.WriteString(fmt.Sprintf("%s<p class=\"contact-note\">%s</p>\n", inner, content))
+	}
+
+	if name != "" || org != "" {
+		title := name
+		if title == "" {
+			title = org
+		}
+		base := g.fileBase(elem, title, "contact")
+		fileName := g.fileName(base, ".vcf")
+		linkText := g.getStringProp(elem, "download_text")
+		if linkText == "" {
+			linkText = "Download contact"
+		}
+		if linkText != "none" {
+			sb.WriteString(fmt.Sprintf("%s<a class=\"contact-download\"%s download>%s</a>\n", inner,
+				attr("href", fileName), escapeHTML(linkText)))
+		}
+
+		lines := []string{"BEGIN:VCARD", "VERSION:3.0"}
+		if name != "" {
+			lines = append(lines, "FN:"+escapeContentText(name), "N:"+vcardName(name))
+		} else {
+			// Cards for an organisation are named after it
+			lines = append(lines, "FN:"+escapeContentText(org), "N:;;;;")
+		}
+		for _, field := range []struct{ key, value string }{
+			{"ORG", org},
+			{"TITLE", role},
+			{"EMAIL;TYPE=INTERNET", email},
+			{"TEL", phone},
+			{"URL", url},
+			{"ADR", address},
+			{"NOTE", strings.TrimSpace(g.plainText(elem))},
+		} {
+			if field.value == "" {
+				continue
+			}
+			value := escapeContentText(field.value)
+			if field.key == "ADR" {
+				// A one-line address goes in the street component
+				value = ";;" + value + ";;;;"
+			}
+			lines = append(lines, field.key+":"+value)
+		}
+		lines = append(lines, "END:VCARD")
+		card := contentLines(lines)
+		g.addFile(fileName, card)
+
+		// Scanning the code adds the card to the phone's contacts
+		if g.getBoolProp(elem.Properties, "qr") {
+			if img := g.qrImage(elem, "contact-start", card, base, "QR code to add "+title+" to your contacts"); img != "" {
+				sb.WriteString(fmt.Sprintf("%s<img class=\"contact-qr\"%s>\n", inner, img))
+			}
+		}
+	}
+
+	sb.WriteString(indent + "</div>\n")
+	return sb.String()
+}
+
+// vcardName splits a full name into the vCard N value, taking the last
+// word as the family name
+func vcardName(name string) string {
+	words := strings.Fields(name)
+	if len(words) < 2 {
+		return escapeContentText(name) + ";;;;"
+	}
+	family := words[len(words)-1]
+	given := strings.Join(words[:len(words)-1], " ")
+	return escapeContentText(family) + ";" + escapeContentText(given) + ";;;"
+}
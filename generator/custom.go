@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"strings"
+
+	"lpml/ast"
+)
+
+// TagRenderer renders elements of a custom tag registered with
+// tokens.RegisterTag, returning the HTML to put in their place
+type TagRenderer interface {
+	RenderTag(tag CustomTag) (string, error)
+}
+
+// CustomTag is one custom element as a TagRenderer sees it
+type CustomTag struct {
+	Name       string            `json:"name"`             // Tag name, e.g. "callout" for [callout-start]
+	ID         string            `json:"id,omitempty"`     // HTML id from the element's label
+	Properties map[string]string `json:"properties"`       // Values with references resolved; arrays are joined with ", "
+	Content    string            `json:"content"`          // contains and nested content, as HTML
+	Line       int               `json:"line"`             // Line of the opening tag in the source
+	Source     string            `json:"source,omitempty"` // Source file, when known
+}
+
+// generateCustom renders a custom element through its TagRenderer,
+// indenting the HTML it returns. A failing renderer leaves the element
+// out with a warning.
+func (g *Generator) generateCustom(elem *ast.Element, indent string, r TagRenderer) string {
+	tag := CustomTag{
+		Name:       elem.TagType,
+		ID:         g.ids[elem],
+		Properties: make(map[string]string),
+		Content:    g.inlineContent(elem),
+		Line:       elem.Token.Line,
+		Source:     g.opts.SourceFile,
+	}
+	for name, val := range elem.Properties {
+		tag.Properties[name] = g.resolveValue(val)
+	}
+
+	html, err := r.RenderTag(tag)
+	if err != nil {
+		g.warnf(RulePlugin, elem.Token.Line, "%s: %v", tagName(elem), err)
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(html, "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			sb.WriteString("\n")
+			continue
+		}
+		sb.WriteString(indent + line + "\n")
+	}
+	return sb.String()
+}
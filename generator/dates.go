@@ -0,0 +1,115 @@
+package generator
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // Zone names work where the system has no zone database
+
+	"lpml/ast"
+)
+
+// dateCall works out a now() or date() call: now() is when the page is
+// built, and date() the date it's given, an unquoted date or a string
+// holding one. A layout argument, one of ast.DateFormats or a Go time
+// layout, makes the result that text; without one it's a date, written
+// the way date_format says. A zone, like "Europe/London", moves a time of
+// day there.
+func (g *Generator) dateCall(call *ast.CallValue) ast.Value {
+	args := call.Args
+	var t time.Time
+	clock := true
+	switch call.Name {
+	case "now":
+		if t = g.opts.Now; t.IsZero() {
+			t = time.Now()
+		}
+	case "date":
+		if len(args) == 0 {
+			return ast.NewString("") // The parser reports the missing date
+		}
+		var ok bool
+		if t, clock, ok = g.dateArg(args[0]); !ok {
+			g.warnf(RuleDate, call.Token.Line, "date() needs a date like 2024-06-01 or \"2024-06-01T18:00Z\", got %q", g.resolveValue(args[0]))
+			return ast.NewString(g.resolveValue(args[0]))
+		}
+		args = args[1:]
+	}
+
+	layout, zone := "", ""
+	if len(args) > 0 {
+		layout = g.resolveValue(args[0])
+	}
+	if len(args) > 1 {
+		zone = g.resolveValue(args[1])
+	}
+	if zone != "" && clock {
+		t = g.inZone(t, zone, call.Token.Line, call.Name+"()")
+	}
+
+	if layout != "" {
+		return ast.NewString(ast.FormatTime(t, clock, layout))
+	}
+	return dateValue(t, clock)
+}
+
+// dateArg reads a date from a value: an unquoted date, a string holding
+// one, or a call giving one. clock reports whether it has a time of day.
+func (g *Generator) dateArg(val ast.Value) (t time.Time, clock bool, ok bool) {
+	val = g.constant(val)
+	date, isDate := val.(*ast.DateValue)
+	if !isDate {
+		s, isString := ast.StringOf(val)
+		if !isString {
+			return time.Time{}, false, false
+		}
+		date = &ast.DateValue{Value: s}
+	}
+	t, ok = date.Time()
+	return t, date.HasClock(), ok
+}
+
+// inZone returns t in the named time zone, warning about names that
+// aren't one and leaving t as it was
+func (g *Generator) inZone(t time.Time, zone string, line int, what string) time.Time {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		g.warnf(RuleDate, line, "%s zone %q isn't a time zone, like \"Europe/London\" or \"UTC\"", what, zone)
+		return t
+	}
+	return t.In(loc)
+}
+
+// dateValue returns t as a date literal: a day alone, like 2024-06-01,
+// without a clock, and an RFC 3339 time with its UTC offset otherwise
+func dateValue(t time.Time, clock bool) *ast.DateValue {
+	s := t.Format(time.DateOnly)
+	if clock {
+		s = t.Format(time.RFC3339)
+	}
+	return &ast.DateValue{Value: s}
+}
+
+// generateTime generates a [time] as a <time> element: its datetime in
+// full for machines, and for readers as its date_format says, or as its
+// contains if it has one. A zone moves a time of day there first.
+func (g *Generator) generateTime(elem *ast.Element, indent string) string {
+	t, clock, ok := g.dateArg(elem.Properties["datetime"])
+	if !ok {
+		g.warnf(RuleDate, elem.Token.Line, "[time] needs a datetime like 2024-06-01 or 2024-06-01T18:00Z, got %q", g.getProp(elem.Properties, "datetime"))
+		return ""
+	}
+	if zone := g.getProp(elem.Properties, "zone"); zone != "" && clock {
+		t = g.inZone(t, zone, elem.Token.Line, "[time]")
+	}
+
+	date := dateValue(t, clock)
+	format := g.dateFmt
+	if elem.Properties["date_format"] != nil {
+		format = g.getProp(elem.Properties, "date_format")
+	}
+	text := ast.FormatTime(t, clock, format)
+	if contains := g.getStringProp(elem, "contains"); contains != "" {
+		text = contains
+	}
+	return fmt.Sprintf("%s<time%s%s>%s</time>\n", indent, attr("datetime", date.Value), g.buildCommonAttrs(elem), escapeHTML(text))
+}
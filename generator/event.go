@@ -0,0 +1,206 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"lpml/ast"
+)
+
+// eventTime is a parsed start or end property
+type eventTime struct {
+	raw      string    // As written, which is also a valid HTML datetime
+	t        time.Time // The time, with its written UTC offset if any
+	allDay   bool      // A date without a time
+	floating bool      // A time without a UTC offset, local to the event
+}
+
+// Accepted start and end layouts, from most to least specific
+var eventLayouts = []struct {
+	layout           string
+	allDay, floating bool
+}{
+	{time.RFC3339, false, false},
+	{"2006-01-02T15:04Z07:00", false, false},
+	{"2006-01-02T15:04:05", false, true},
+	{"2006-01-02T15:04", false, true},
+	{"2006-01-02", true, false},
+}
+
+// parseEventTime parses an event start or end
+func parseEventTime(s string) (eventTime, bool) {
+	for _, l := range eventLayouts {
+		if t, err := time.Parse(l.layout, s); err == nil {
+			return eventTime{raw: s, t: t, allDay: l.allDay, floating: l.floating}, true
+		}
+	}
+	return eventTime{}, false
+}
+
+// display is the time as shown on the page, e.g. "1 June 2025, 18:00"
+func (et eventTime) display() string {
+	switch {
+	case et.allDay:
+		return et.t.Format("2 January 2006")
+	case et.floating:
+		return et.t.Format("2 January 2006, 15:04")
+	}
+	return et.t.Format("2 January 2006, 15:04 Z07:00")
+}
+
+// ics is the time as an iCalendar DATE or DATE-TIME property. Times with
+// an offset are written in UTC, floating times as local to the event.
+func (et eventTime) ics(name string) string {
+	switch {
+	case et.allDay:
+		return name + ";VALUE=DATE:" + et.t.Format("20060102")
+	case et.floating:
+		return name + ":" + et.t.Format("20060102T150405")
+	}
+	return name + ":" + et.t.UTC().Format("20060102T150405Z")
+}
+
+// timeProp returns an event's start or end as written, whether it's an
+// unquoted date or a string
+func (g *Generator) timeProp(elem *ast.Element, name string) string {
+	if date, ok := g.constant(elem.Properties[name]).(*ast.DateValue); ok {
+		return date.Value
+	}
+	return g.getStringProp(elem, name)
+}
+
+// generateEvent generates an event's details and a link to its .ics
+// file, and adds schema.org Event JSON-LD to the head. An event without a
+// readable start is rendered without the calendar file or JSON-LD.
+func (g *Generator) generateEvent(elem *ast.Element, indent string) string {
+	var sb strings.Builder
+
+	title := g.getStringProp(elem, "title")
+	location := g.getStringProp(elem, "location")
+	inner := indent + "  "
+
+	start, hasStart := parseEventTime(g.timeProp(elem, "start"))
+	if !hasStart {
+		g.warnf(RuleDate, elem.Token.Line, "[event-start] needs a start like \"2025-06-01\" or \"2025-06-01T18:00\", got %q",
+			g.timeProp(elem, "start"))
+	}
+	var end eventTime
+	hasEnd := false
+	if raw := g.timeProp(elem, "end"); raw != "" {
+		if end, hasEnd = parseEventTime(raw); !hasEnd {
+			g.warnf(RuleDate, elem.Token.Line, "[event-start] end %q isn't a date or time, ignoring it", raw)
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("%s<div%s%s%s>\n", indent, g.buildIDAttr(elem, elem.Properties),
+		g.buildClassAttr(elem.Properties, "event"), g.buildStyleAttr(elem.Properties)))
+	if title != "" {
+		sb.WriteString(fmt.Sprintf("%s<h3 class=\"event-title\">%s</h3>\n", inner, escapeHTML(title)))
+	}
+	if hasStart {
+		when := fmt.Sprintf("<time datetime=\"%s\">%s</time>", escapeHTML(start.raw), start.display())
+		if hasEnd {
+			when += fmt.Sprintf(" &ndash; <time datetime=\"%s\">%s</time>", escapeHTML(end.raw), end.display())
+		}
+		sb.WriteString(fmt.Sprintf("%s<p class=\"event-time\">%s</p>\n", inner, when))
+	}
+	if location != "" {
+		sb.WriteString(fmt.Sprintf("%s<p class=\"event-location\">%s</p>\n", inner, escapeHTML(location)))
+	}
+	if content := g.inlineContent(elem); content != "" {
+		sb.WriteString(fmt.Sprintf("%s<p class=\"event-description\">%s</p>\n", inner, content))
+	}
+
+	if hasStart {
+		name := g.fileName(g.fileBase(elem, title, "event"), ".ics")
+		linkText := g.getStringProp(elem, "calendar_text")
+		if linkText == "" {
+			linkText = "Add to calendar"
+		}
+		if linkText != "none" {
+			sb.WriteString(fmt.Sprintf("%s<a class=\"event-calendar\"%s download>%s</a>\n", inner,
+				attr("href", name), escapeHTML(linkText)))
+		}
+		description := strings.TrimSpace(g.plainText(elem))
+		g.addFile(name, g.eventICS(name, title, location, description, start, end, hasEnd))
+		g.addEventStructuredData(title, location, description, start, end, hasEnd)
+	}
+
+	sb.WriteString(indent + "</div>\n")
+	return sb.String()
+}
+
+// eventICS builds an iCalendar file holding one event. DTSTAMP is the
+// build time when the page is stamped or Options.Now is set, and the
+// event's start otherwise, so the file only changes when the event does.
+func (g *Generator) eventICS(name, title, location, description string, start, end eventTime, hasEnd bool) []byte {
+	stamp := start.t
+	switch {
+	case g.opts.BuildInfo != nil:
+		stamp = g.opts.BuildInfo.Time
+	case !g.opts.Now.IsZero():
+		stamp = g.opts.Now
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//lpml//lpml//EN",
+		"BEGIN:VEVENT",
+		"UID:" + strings.TrimSuffix(name, ".ics") + "-" + start.t.Format("20060102T150405") + "@lpml",
+		"DTSTAMP:" + stamp.UTC().Format("20060102T150405Z"),
+		start.ics("DTSTART"),
+	}
+	if hasEnd {
+		// All-day ends are exclusive in iCalendar, so the last day is included
+		if end.allDay {
+			end.t = end.t.AddDate(0, 0, 1)
+		}
+		lines = append(lines, end.ics("DTEND"))
+	}
+	if title != "" {
+		lines = append(lines, "SUMMARY:"+escapeContentText(title))
+	}
+	if location != "" {
+		lines = append(lines, "LOCATION:"+escapeContentText(location))
+	}
+	if description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeContentText(description))
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+
+	return contentLines(lines)
+}
+
+// addEventStructuredData adds schema.org Event JSON-LD to the head
+func (g *Generator) addEventStructuredData(title, location, description string, start, end eventTime, hasEnd bool) {
+	type place struct {
+		Type string `json:"@type"`
+		Name string `json:"name"`
+	}
+	event := struct {
+		Context     string `json:"@context"`
+		Type        string `json:"@type"`
+		Name        string `json:"name,omitempty"`
+		StartDate   string `json:"startDate"`
+		EndDate     string `json:"endDate,omitempty"`
+		Location    *place `json:"location,omitempty"`
+		Description string `json:"description,omitempty"`
+	}{Context: "https://schema.org", Type: "Event", Name: title, StartDate: start.raw, Description: description}
+	if hasEnd {
+		event.EndDate = end.raw
+	}
+	if location != "" {
+		event.Location = &place{Type: "Place", Name: location}
+	}
+
+	// json.Marshal escapes <, > and &, so the text can't close the script
+	data, err := json.Marshal(event)
+	if err != nil {
+		g.warnf(RuleStructuredData, 0, "event structured data: %v", err)
+		return
+	}
+	g.head = append(g.head, `<script type="application/ld+json">`+string(data)+`</script>`)
+}
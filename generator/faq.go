@@ -0,0 +1,121 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"lpml/ast"
+)
+
+// faqEntry is one question with the answers that follow it
+type faqEntry struct {
+	question *ast.Element
+	answers  []*ast.Element
+}
+
+// generateFAQ generates a FAQ as one collapsible <details> per question.
+// With structured_data = true it also adds schema.org FAQPage JSON-LD
+// to the head.
+func (g *Generator) generateFAQ(elem *ast.Element, indent string) string {
+	var sb strings.Builder
+
+	entries := g.faqEntries(elem)
+	inner := indent + "  "
+
+	sb.WriteString(fmt.Sprintf("%s<div%s%s%s>\n", indent, g.buildIDAttr(elem, elem.Properties),
+		g.buildClassAttr(elem.Properties, "faq"), g.buildStyleAttr(elem.Properties)))
+
+	for _, entry := range entries {
+		q := entry.question
+		sb.WriteString(fmt.Sprintf("%s<details%s>\n", inner, g.buildIDAttr(q, q.Properties)))
+		sb.WriteString(fmt.Sprintf("%s  <summary%s%s>%s</summary>\n", inner,
+			g.buildClassAttr(q.Properties, ""), g.buildStyleAttr(q.Properties), g.inlineContent(q)))
+		for _, a := range entry.answers {
+			sb.WriteString(fmt.Sprintf("%s  <div%s%s%s>%s</div>\n", inner, g.buildIDAttr(a, a.Properties),
+				g.buildClassAttr(a.Properties, "faq-answer"), g.buildStyleAttr(a.Properties), g.inlineContent(a)))
+		}
+		sb.WriteString(inner + "</details>\n")
+	}
+
+	sb.WriteString(indent + "</div>\n")
+
+	if g.getBoolProp(elem.Properties, "structured_data") {
+		g.addFAQStructuredData(entries)
+	}
+
+	return sb.String()
+}
+
+// faqEntries pairs each question with the answers after it. Answers
+// before the first question and other children are reported and skipped.
+func (g *Generator) faqEntries(elem *ast.Element) []faqEntry {
+	var entries []faqEntry
+
+	for _, child := range elem.Children {
+		c, ok := child.(*ast.Element)
+		if !ok {
+			continue
+		}
+		switch c.TagType {
+		case "question":
+			entries = append(entries, faqEntry{question: c})
+		case "answer":
+			if len(entries) == 0 {
+				g.warnf(RuleStructure, c.Token.Line, "[answer-start] before any [question-start] is ignored")
+				continue
+			}
+			last := &entries[len(entries)-1]
+			last.answers = append(last.answers, c)
+		default:
+			g.warnf(RuleStructure, c.Token.Line, "[faq-start] only holds questions and answers, ignoring [%s]", c.TagType)
+		}
+	}
+
+	return entries
+}
+
+// addFAQStructuredData adds FAQPage JSON-LD for the entries to the head.
+// Questions without an answer are left out, as search engines reject them.
+func (g *Generator) addFAQStructuredData(entries []faqEntry) {
+	type answer struct {
+		Type string `json:"@type"`
+		Text string `json:"text"`
+	}
+	type question struct {
+		Type           string `json:"@type"`
+		Name           string `json:"name"`
+		AcceptedAnswer answer `json:"acceptedAnswer"`
+	}
+	page := struct {
+		Context    string     `json:"@context"`
+		Type       string     `json:"@type"`
+		MainEntity []question `json:"mainEntity"`
+	}{Context: "https://schema.org", Type: "FAQPage"}
+
+	for _, entry := range entries {
+		if len(entry.answers) == 0 {
+			continue
+		}
+		var texts []string
+		for _, a := range entry.answers {
+			texts = append(texts, strings.TrimSpace(g.plainText(a)))
+		}
+		page.MainEntity = append(page.MainEntity, question{
+			Type:           "Question",
+			Name:           strings.TrimSpace(g.plainText(entry.question)),
+			AcceptedAnswer: answer{Type: "Answer", Text: strings.Join(texts, " ")},
+		})
+	}
+	if len(page.MainEntity) == 0 {
+		return
+	}
+
+	// json.Marshal escapes <, > and &, so the text can't close the script
+	data, err := json.Marshal(page)
+	if err != nil {
+		g.warnf(RuleStructuredData, 0, "FAQ structured data: %v", err)
+		return
+	}
+	g.head = append(g.head, `<script type="application/ld+json">`+string(data)+`</script>`)
+}
@@ -0,0 +1,106 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"lpml/ast"
+)
+
+// File is an extra output file a page links to, like an event's .ics
+type File struct {
+	Name string // Path relative to the page, e.g. "launch-party.ics"
+	Data []byte
+}
+
+// Files returns the extra files the page links to. They belong next to
+// its output.
+func (p *Page) Files() []File {
+	return p.files
+}
+
+// Files returns the extra files the page generated last links to, as
+// Page.Files does
+func (g *Generator) Files() []File {
+	return g.lastPage().files
+}
+
+// addFile adds an extra file for the page, named with fileName
+func (g *Generator) addFile(name string, data []byte) {
+	g.files = append(g.files, File{Name: name, Data: data})
+}
+
+// sharedFile adds data as an extra file in Options.SharedDir, named by a
+// hash of its contents so that every page generating the same data links
+// to one copy, and returns the file's name
+func (g *Generator) sharedFile(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	name := g.opts.SharedDir + hex.EncodeToString(sum[:8]) + ext
+	if !g.hasFile(name) {
+		g.addFile(name, data)
+	}
+	return name
+}
+
+// hasFile reports whether the page already has an extra file named name
+func (g *Generator) hasFile(name string) bool {
+	for _, f := range g.files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fileBase picks the name an element's extra file is based on: its id,
+// else a slug of its title, else fallback
+func (g *Generator) fileBase(elem *ast.Element, title, fallback string) string {
+	if id := g.ids[elem]; id != "" {
+		return id
+	}
+	if strings.TrimSpace(title) != "" {
+		return slugify(title)
+	}
+	return fallback
+}
+
+// fileName returns base+ext, with a numeric suffix if an earlier file of
+// the page took the name
+func (g *Generator) fileName(base, ext string) string {
+	name := base + ext
+	for n := 2; g.hasFile(name); n++ {
+		name = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	return name
+}
+
+// contentLines joins iCalendar or vCard content lines, each ended with
+// CRLF and folded to at most 75 bytes without splitting a UTF-8 character
+func contentLines(lines []string) []byte {
+	var sb strings.Builder
+	for _, line := range lines {
+		width := 0
+		for _, r := range line {
+			n := len(string(r))
+			if width+n > 75 {
+				sb.WriteString("\r\n ")
+				width = 1
+			}
+			sb.WriteRune(r)
+			width += n
+		}
+		sb.WriteString("\r\n")
+	}
+	return []byte(sb.String())
+}
+
+// escapeContentText escapes an iCalendar or vCard TEXT value
+func escapeContentText(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return s
+}
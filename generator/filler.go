@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"lpml/ast"
+)
+
+// maxLoremWords is the most words a [lorem] writes, all its paragraphs
+// together
+const maxLoremWords = 10000
+
+// loremWords is the filler [lorem] writes, repeated as often as it takes
+var loremWords = strings.Fields(`Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod
+tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud
+exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in
+reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint
+occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum.`)
+
+// generateLorem generates the paragraphs of filler text a [lorem] asks
+// for, each its words long. The text is the same on every build, so
+// pages laid out with it don't change until real content replaces it.
+// One paragraph takes the tag's attributes; several are wrapped in a
+// <div> that takes them, so an id isn't repeated.
+func (g *Generator) generateLorem(elem *ast.Element, indent string) string {
+	words := g.wholeNumber(elem, "lorem", "words", 50)
+	paragraphs := g.wholeNumber(elem, "lorem", "paragraphs", 1)
+	if words*paragraphs > maxLoremWords {
+		g.warnf(RuleProperty, elem.Token.Line, "[lorem] writes at most %d words, got %d paragraphs of %d", maxLoremWords, paragraphs, words)
+		paragraphs = max(1, maxLoremWords/words)
+		words = min(words, maxLoremWords)
+	}
+
+	attrs := g.buildCommonAttrs(elem)
+	if paragraphs == 1 {
+		return fmt.Sprintf("%s<p%s>%s</p>\n", indent, attrs, lorem(0, words))
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s<div%s>\n", indent, attrs))
+	for i := 0; i < paragraphs; i++ {
+		sb.WriteString(fmt.Sprintf("%s  <p>%s</p>\n", indent, lorem(i*words, words)))
+	}
+	sb.WriteString(indent + "</div>\n")
+	return sb.String()
+}
+
+// lorem returns count words of the filler from the one at start on, as
+// sentences: capitalized first, with a full stop last
+func lorem(start, count int) string {
+	words := make([]string, count)
+	for i := range words {
+		words[i] = loremWords[(start+i)%len(loremWords)]
+	}
+	words[0] = strings.ToUpper(words[0][:1]) + words[0][1:]
+	last := strings.TrimRight(words[count-1], ",.")
+	words[count-1] = last + "."
+	return strings.Join(words, " ")
+}
+
+// generatePlaceholderImage generates a [placeholder-img]: an SVG image of
+// its size, filled with a flat color and labeled with the size unless it
+// gives its own text, to stand in for a picture not taken yet
+func (g *Generator) generatePlaceholderImage(elem *ast.Element, indent string) string {
+	width := g.wholeNumber(elem, "placeholder-img", "width", 400)
+	height := g.wholeNumber(elem, "placeholder-img", "height", 300)
+	text := fmt.Sprintf("%d×%d", width, height)
+	if elem.Properties["text"] != nil {
+		text = g.resolveValue(elem.Properties["text"])
+	}
+	alt := text
+	if elem.Properties["alt"] != nil {
+		alt = g.resolveValue(elem.Properties["alt"])
+	}
+	fill := "#cccccc"
+	if v := g.getProp(elem.Properties, "fill"); v != "" {
+		fill = g.resolveColor(elem.Properties, "fill", v)
+	}
+
+	// The label is dark on light fills and light on dark ones
+	ink := "#000000"
+	if r, gr, b, _, ok := ast.NewColor(fill).RGBA(); ok && 299*int(r)+587*int(gr)+114*int(b) < 128000 {
+		ink = "#ffffff"
+	}
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+
+		`<rect width="100%%" height="100%%" fill="%s"/>`+
+		`<text x="50%%" y="50%%" fill="%s" fill-opacity="0.6" font-family="sans-serif" font-size="%d" text-anchor="middle" dominant-baseline="central">%s</text>`+
+		`</svg>`,
+		width, height, width, height, escapeHTML(fill), ink, max(10, min(width, height)/8), escapeHTML(text))
+	src := "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg))
+
+	return fmt.Sprintf("%s<img%s%s%s%s%s>\n", indent, attr("src", src), attr("width", strconv.Itoa(width)), attr("height", strconv.Itoa(height)),
+		attr("alt", alt), g.buildCommonAttrs(elem))
+}
+
+// wholeNumber returns a property of a tag that must be a whole number of
+// at least 1, or def if it's unset or isn't one
+func (g *Generator) wholeNumber(elem *ast.Element, tag, name string, def int) int {
+	if elem.Properties[name] == nil {
+		return def
+	}
+	n, err := strconv.Atoi(g.getProp(elem.Properties, name))
+	if err != nil || n < 1 {
+		g.warnf(RuleProperty, elem.Token.Line, "[%s] %s must be a whole number above 0, like %s = %d", tag, name, name, def)
+		return def
+	}
+	return n
+}
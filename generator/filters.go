@@ -0,0 +1,343 @@
+package generator
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"lpml/ast"
+)
+
+// pipe resolves a PipeValue: its reference's text passed through each
+// filter in turn. Filters work on the text alone, leaving the tags and
+// entities of its HTML as they are.
+func (g *Generator) pipe(pipe *ast.PipeValue) string {
+	text := g.resolveValue(pipe.Value)
+	for _, filter := range pipe.Filters {
+		text = g.filter(filter, text)
+		if g.tooLong(len(text), pipe.Token.Line) {
+			return ""
+		}
+	}
+	return text
+}
+
+// filter applies one filter to text
+func (g *Generator) filter(filter ast.Filter, text string) string {
+	switch filter.Name {
+	case "upper":
+		return mapText(text, strings.ToUpper)
+	case "lower":
+		return mapText(text, strings.ToLower)
+	case "title":
+		return titleCase(text)
+	case "trim":
+		return strings.TrimSpace(text)
+	case "slug":
+		plain := stripTags(text)
+		if strings.TrimSpace(plain) == "" {
+			return ""
+		}
+		return slugify(plain)
+	case "truncate":
+		if n, ok := g.filterCount(filter, "length"); ok {
+			return truncate(text, n)
+		}
+	case "words":
+		if n, ok := g.filterCount(filter, "count"); ok {
+			return firstWords(text, n)
+		}
+	case "replace":
+		if len(filter.Args) == 2 {
+			from, to := escapeHTML(g.resolveValue(filter.Args[0])), escapeHTML(g.resolveValue(filter.Args[1]))
+			return replaceText(text, from, to)
+		}
+	}
+	return text
+}
+
+// filterCount returns a filter's one argument, which must be a whole
+// number of at least 1
+func (g *Generator) filterCount(filter ast.Filter, what string) (int, bool) {
+	if len(filter.Args) != 1 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(g.resolveValue(filter.Args[0])))
+	if err != nil || n < 1 {
+		g.warnf(RuleProperty, filter.Token.Line, "%s: the %s must be a whole number above 0, like %s(80)", filter, what, filter.Name)
+		return 0, false
+	}
+	return n, true
+}
+
+// pieceKind is what a piece of HTML is
+type pieceKind int
+
+const (
+	textPiece   pieceKind = iota // Text, between a tag or entity and the next
+	entityPiece                  // A character written as an entity, like &amp;
+	tagPiece                     // A tag, like <strong> or </a>
+)
+
+// htmlPiece is a tag, an entity, or a run of text of the HTML filters
+// work on
+type htmlPiece struct {
+	s    string
+	kind pieceKind
+}
+
+// htmlPieces splits HTML into its tags, entities, and the text between
+// them. A < or & that doesn't start one is text.
+func htmlPieces(s string) []htmlPiece {
+	var pieces []htmlPiece
+	for s != "" {
+		n, kind := strings.IndexAny(s, "<&"), textPiece
+		switch {
+		case n < 0:
+			n = len(s)
+		case n > 0:
+		case s[0] == '<':
+			if end := strings.IndexByte(s, '>'); end > 1 {
+				n, kind = end+1, tagPiece
+			} else {
+				n = 1
+			}
+		default:
+			if end := strings.IndexByte(s, ';'); end > 1 && end <= 32 && isEntityName(s[1:end]) {
+				n, kind = end+1, entityPiece
+			} else {
+				n = 1
+			}
+		}
+		pieces = append(pieces, htmlPiece{s[:n], kind})
+		s = s[n:]
+	}
+	return pieces
+}
+
+// isEntityName reports whether name is what's between the & and ; of an
+// entity, like amp or #39
+func isEntityName(name string) bool {
+	for _, r := range name {
+		if !isLetter(r) && !unicode.IsDigit(r) && r != '#' {
+			return false
+		}
+	}
+	return true
+}
+
+// isLetter reports whether r is an ASCII letter
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// htmlChars splits HTML into its tags and characters, each entity one
+// character
+func htmlChars(s string) []htmlPiece {
+	var chars []htmlPiece
+	for _, p := range htmlPieces(s) {
+		if p.kind != textPiece {
+			chars = append(chars, p)
+			continue
+		}
+		for _, r := range p.s {
+			chars = append(chars, htmlPiece{string(r), textPiece})
+		}
+	}
+	return chars
+}
+
+// mapText returns HTML with f applied to its text, not its tags and
+// entities
+func mapText(s string, f func(string) string) string {
+	var sb strings.Builder
+	for _, p := range htmlPieces(s) {
+		if p.kind == textPiece {
+			p.s = f(p.s)
+		}
+		sb.WriteString(p.s)
+	}
+	return sb.String()
+}
+
+// replaceText replaces from with to, both escaped, in the text between
+// the tags of HTML
+func replaceText(s, from, to string) string {
+	var sb, text strings.Builder
+	for _, p := range htmlPieces(s) {
+		if p.kind == tagPiece {
+			sb.WriteString(strings.ReplaceAll(text.String(), from, to))
+			text.Reset()
+			sb.WriteString(p.s)
+			continue
+		}
+		text.WriteString(p.s)
+	}
+	sb.WriteString(strings.ReplaceAll(text.String(), from, to))
+	return sb.String()
+}
+
+// stripTags returns the text of HTML, tags left out and entities decoded
+func stripTags(s string) string {
+	var sb strings.Builder
+	for _, p := range htmlPieces(s) {
+		if p.kind != tagPiece {
+			sb.WriteString(p.s)
+		}
+	}
+	return html.UnescapeString(sb.String())
+}
+
+// ellipsis ends text truncate and firstWords cut short
+const ellipsis = "…"
+
+// truncate shortens HTML to at most n characters of text, ellipsis
+// included, cutting at the last space if there's one in its second half
+func truncate(text string, n int) string {
+	chars := htmlChars(text)
+	length := 0
+	for _, c := range chars {
+		if c.kind != tagPiece {
+			length++
+		}
+	}
+	if length <= n {
+		return text
+	}
+
+	var kept []htmlPiece
+	count, space, spaceCount := 0, -1, 0
+	for _, c := range chars {
+		if c.kind != tagPiece {
+			if count == n-1 {
+				break
+			}
+			if c.kind == textPiece && strings.TrimSpace(c.s) == "" {
+				space, spaceCount = len(kept), count
+			}
+			count++
+		}
+		kept = append(kept, c)
+	}
+	if space >= 0 && spaceCount >= count/2 {
+		kept = kept[:space]
+	}
+	return cutHTML(kept)
+}
+
+// firstWords returns the first n words of HTML's text, with an ellipsis
+// if there were more
+func firstWords(text string, n int) string {
+	chars := htmlChars(text)
+	words, inWord := 0, false
+	for i, c := range chars {
+		if c.kind == tagPiece {
+			continue
+		}
+		space := c.kind == textPiece && strings.TrimSpace(c.s) == ""
+		if !space && !inWord {
+			if words++; words > n {
+				return cutHTML(chars[:i])
+			}
+		}
+		inWord = !space
+	}
+	return text
+}
+
+// cutHTML ends HTML cut short: the spaces and punctuation left hanging at
+// the end of its text are dropped, an ellipsis is added, and the tags left
+// open are closed
+func cutHTML(pieces []htmlPiece) string {
+	for {
+		i := len(pieces) - 1
+		for i >= 0 && pieces[i].kind == tagPiece && strings.HasPrefix(pieces[i].s, "</") {
+			i--
+		}
+		if r, _ := utf8.DecodeRuneInString(pieceText(pieces, i)); i < 0 || pieces[i].kind != textPiece || !isCutEnd(r) {
+			break
+		}
+		pieces = append(pieces[:i], pieces[i+1:]...)
+	}
+
+	var sb strings.Builder
+	var open []string
+	for _, p := range pieces {
+		sb.WriteString(p.s)
+		if p.kind == tagPiece {
+			open = nestTag(open, p.s)
+		}
+	}
+	sb.WriteString(ellipsis)
+	for i := len(open) - 1; i >= 0; i-- {
+		sb.WriteString("</" + open[i] + ">")
+	}
+	return sb.String()
+}
+
+// pieceText returns the text of the piece at i, or "" if there's none
+func pieceText(pieces []htmlPiece, i int) string {
+	if i < 0 {
+		return ""
+	}
+	return pieces[i].s
+}
+
+// nestTag returns the elements open, outermost first, after tag
+func nestTag(open []string, tag string) []string {
+	name, closing := strings.CutPrefix(strings.TrimPrefix(tag, "<"), "/")
+	if end := strings.IndexAny(name, " \t\n/>"); end >= 0 {
+		name = name[:end]
+	}
+	name = strings.ToLower(name)
+	switch {
+	case closing:
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i] == name {
+				return open[:i]
+			}
+		}
+	case name != "" && isLetter(rune(name[0])) && !voidElements[name] && !strings.HasSuffix(tag, "/>"):
+		open = append(open, name)
+	}
+	return open
+}
+
+// voidElements are the HTML elements with no end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// isCutEnd reports whether r is a space or punctuation left hanging at
+// the end of shortened text, like the comma in "one, two,…"
+func isCutEnd(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(",;:-", r)
+}
+
+// titleCase capitalizes the first letter of each word in HTML's text
+func titleCase(text string) string {
+	var sb strings.Builder
+	start := true
+	for _, p := range htmlPieces(text) {
+		switch p.kind {
+		case tagPiece:
+			sb.WriteString(p.s)
+		case entityPiece:
+			sb.WriteString(p.s)
+			start = p.s == "&nbsp;"
+		default:
+			for _, r := range p.s {
+				if start {
+					r = unicode.ToUpper(r)
+				}
+				start = unicode.IsSpace(r)
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return sb.String()
+}
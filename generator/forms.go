@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"fmt"
+	"net/url"
+
+	"lpml/ast"
+)
+
+// Form backends accepted by a form's provider property
+const (
+	ProviderFormspree = "formspree" // https://formspree.io, needs provider_id
+	ProviderNetlify   = "netlify"   // Netlify Forms, detected at deploy time
+	ProviderMailto    = "mailto"    // Opens the visitor's mail client, needs email
+)
+
+// formBackend returns the attributes after <form and the hidden inputs a
+// form's provider needs. Without a provider the form only gets its action.
+func (g *Generator) formBackend(elem *ast.Element) (attrs string, hidden []string) {
+	action := g.getStringProp(elem, "action")
+	method := g.getStringProp(elem, "method")
+	subject := g.getStringProp(elem, "subject")
+	provider := g.getStringProp(elem, "provider")
+
+	switch provider {
+	case "":
+		attrs = attr("action", action)
+		if method != "" {
+			attrs += attr("method", method)
+		}
+		return attrs, nil
+
+	case ProviderFormspree:
+		if action == "" {
+			id := g.getStringProp(elem, "provider_id")
+			if id == "" {
+				g.warnf(RuleForm, elem.Token.Line, "formspree form needs provider_id, the id from your form's endpoint")
+			}
+			action = "https://formspree.io/f/" + url.PathEscape(id)
+		}
+		if subject != "" {
+			hidden = append(hidden, hiddenInput("_subject", subject))
+		}
+
+	case ProviderNetlify:
+		// Netlify finds forms by name in the deployed HTML and needs the
+		// name posted back in form-name
+		name := g.getStringProp(elem, "name")
+		if name == "" {
+			name = g.getStringProp(elem, "label")
+		}
+		if name == "" {
+			name = "contact"
+		}
+		attrs = attr("name", name) + attr("method", "POST") + ` data-netlify="true"`
+		if action != "" {
+			attrs += attr("action", action)
+		}
+		return attrs, append(hidden, hiddenInput("form-name", name))
+
+	case ProviderMailto:
+		email := g.getStringProp(elem, "email")
+		if email == "" {
+			g.warnf(RuleForm, elem.Token.Line, "mailto form needs email, the address submissions go to")
+		}
+		action = "mailto:" + email
+		if subject != "" {
+			action += "?subject=" + url.PathEscape(subject)
+		}
+		return attr("action", action) + attr("method", "POST") + attr("enctype", "text/plain"), nil
+
+	default:
+		g.warnf(RuleForm, elem.Token.Line, "unknown form provider %q (want %s, %s, or %s)", provider,
+			ProviderFormspree, ProviderNetlify, ProviderMailto)
+		return attr("action", action), nil
+	}
+
+	if method == "" {
+		method = "POST"
+	}
+	return attr("action", action) + attr("method", method), hidden
+}
+
+// hiddenInput builds a hidden form field
+func hiddenInput(name, value string) string {
+	return fmt.Sprintf("<input%s%s%s>", attr("type", "hidden"), attr("name", name), attr("value", value))
+}
@@ -3,82 +3,655 @@ package generator
 import (
 	"fmt"
 	"lpml/ast"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
-// Generator converts AST to HTML
+// Generator converts AST to HTML. Each page is generated afresh, with
+// nothing kept from the last but its results, so one Generator can be
+// shared by goroutines generating pages with the same options.
 type Generator struct {
-	labels map[string]*ast.Element // Store labeled elements for variable resolution
-	indent int
+	labels    map[string]*ast.Element            // Store labeled elements for variable resolution
+	modules   map[string]map[string]*ast.Element // Labeled elements by the module of the file they're in, for $module.label
+	ids       map[ast.Node]string                // Valid, unique HTML id for each labeled node
+	vars      map[string]ast.Value               // Built-in variables like $build.time and $page.word_count
+	defines   map[string]ast.Value               // The document's [define] constants
+	meta      map[string]ast.Value               // The document's [meta] front matter, for [if] conditions
+	presets   map[string]map[string]ast.Value    // The document's [preset] style bundles, for use_preset
+	dateFmt   string                             // The [meta] date_format, for dates where no element sets one
+	lang      string                             // The [meta] lang, for numbers written where no call gives a locale
+	palette   map[string]string                  // Base colors by name, for palette shades like "primary-300"
+	resolving []string                           // $names being resolved, innermost last, to catch cycles
+	cycles    map[string]bool                    // Cycles already warned about, by the names in them
+	calls     map[*ast.CallValue]ast.Value       // What each build-time call gave, worked out once
+	opts      Options
+	indent    int
+	depth     int // How many elements enclose the one being generated
+	diags     []Diagnostic
+	head      []string // Extra <head> lines requested by elements, like JSON-LD
+	tail      []string // <script>s [script] places at the end of the body
+	files     []File   // Extra files the page links to, like .ics and .vcf downloads
+	embeds    []embed  // Files code blocks copy in with linked_file, read as the page is written
+	hasMain   bool     // A mid-page section was written as the page's one <main>
+
+	size     int  // Bytes of the sections' HTML generated so far
+	elements int  // Elements the page has, its blocks expanded
+	over     bool // A limit was reached, so the rest of the page is left out
+
+	mu   sync.Mutex // Guards last
+	last *Page      // The page generated last, for Warnings, Errors, Diagnostics, and Files
+}
+
+// Options configures optional generator behaviour
+type Options struct {
+	BuildInfo     *BuildInfo // Stamp the page with build metadata when set
+	Title         string     // Explicit page title; inferred when empty
+	SiteTitle     string     // Site name appended to inferred titles, as "Page | Site"
+	SourceFile    string     // Path of the source file, the last-resort title
+	RootDir       string     // Project root, for local paths starting with "/"; the source's directory if empty
+	NoInferTitle  bool       // Use the generic title instead of inferring one
+	BaseCSS       string     // Base stylesheet: "" (default), "none", "reset", or "custom"
+	CustomCSS     string     // Stylesheet contents used when BaseCSS is "custom"
+	SelfContained bool       // Inline local images and extra files as data URIs, for a page that stands alone
+	Target        string     // Output target: TargetWeb (also "") or TargetPrintPDF
+	Permalinks    bool       // Add a ¶ link to each heading with an id, shown on hover
+	DivSections   bool       // Write page sections as <div>s, as before, rather than <header>, <main>, and <footer>
+	Prev          *PageLink  // The page before this one in its directory, for [pagenav]; nil if none
+	Next          *PageLink  // The page after it, like Prev
+
+	// Versions are the versions of a --versions build, oldest first, for
+	// [versions]; nil otherwise
+	Versions []VersionLink
+
+	// SharedDir moves the page's stylesheets out of its <head> into extra
+	// files in this directory, relative to the page and ending in /, each
+	// named by a hash of what's in it, so pages with the same styles link
+	// to one file. Ignored for SelfContained pages.
+	SharedDir string
+
+	// Now is the time now() gives, like the build's start or
+	// SOURCE_DATE_EPOCH; the time each call is made if zero
+	Now time.Time
+
+	// Collection holds the project's other pages, for [query-start] to
+	// pick from; nil if the page doesn't query them
+	Collection []CollectionPage
+
+	// ExternalLabels are labeled elements from other pages of the project,
+	// consulted when a $reference isn't defined in the page itself
+	ExternalLabels map[string]*ast.Element
+
+	// Set holds build-time values from --set name=value. Each defines
+	// $name as a string, replacing a [define] constant of that name and
+	// any [meta] property the page already has by it.
+	Set map[string]string
+
+	// MaxDepth is how deeply elements can nest; those deeper are left out
+	// with a warning. The parser has a limit of its own, so this guards
+	// documents built or rewritten in code. DefaultMaxDepth if 0.
+	MaxDepth int
+
+	// MaxOutput is how many bytes of HTML a page's sections can hold, and
+	// MaxElements how many elements it can have once each [repeat] and
+	// [query-start] is expanded, so an untrusted document repeating a
+	// repeat, or building a constant out of doubled copies of another,
+	// can't exhaust memory. Past either the rest of the page is left out
+	// with a warning. DefaultMaxOutput and DefaultMaxElements if 0.
+	MaxOutput   int
+	MaxElements int
+
+	// Palette holds the project's base colors by name, like "primary",
+	// for pages to name shades of; a page's [meta] palette wins over it
+	Palette map[string]string
+
+	// Severity is how the warnings of each rule, like RuleColor, are
+	// treated, by name; those of rules it doesn't name are SeverityWarn
+	Severity map[string]Severity
+
+	// CustomTags renders the tags added with tokens.RegisterTag, by name
+	CustomTags map[string]TagRenderer `json:"-"`
+}
+
+// Base stylesheet modes for Options.BaseCSS
+const (
+	BaseCSSDefault = "default" // Empty rules for the section classes
+	BaseCSSNone    = "none"    // No <style> element at all
+	BaseCSSReset   = "reset"   // A small bundled reset
+	BaseCSSCustom  = "custom"  // Options.CustomCSS
+)
+
+// DefaultMaxDepth is how deeply elements can nest when Options.MaxDepth
+// is 0, as deep as the parser reads by default
+const DefaultMaxDepth = 256
+
+// The limits of Options.MaxOutput and Options.MaxElements when they're 0,
+// far beyond any page written by hand
+const (
+	DefaultMaxOutput   = 64 << 20
+	DefaultMaxElements = 100000
+)
+
+// defaultCSS is the historical boilerplate, handy as hooks for overrides
+const defaultCSS = `.top-of-page { }
+.mid-page { }
+.bottom-of-page { }
+`
+
+// resetCSS is a minimal modern reset applied before any inline styles
+const resetCSS = `*, *::before, *::after { box-sizing: border-box; }
+* { margin: 0; }
+html { -webkit-text-size-adjust: 100%; }
+body { line-height: 1.5; -webkit-font-smoothing: antialiased; }
+img, picture, video, canvas, svg { display: block; max-width: 100%; }
+input, button, textarea, select { font: inherit; }
+p, h1, h2, h3, h4, h5, h6 { overflow-wrap: break-word; }
+`
+
+// BuildInfo describes the build that produced a page
+type BuildInfo struct {
+	Time   time.Time // When the build ran
+	Source string    // Source file name, e.g. "page.lpml"
+	Commit string    // Short VCS revision, empty if unknown
 }
 
 // New creates a new Generator
 func New() *Generator {
-	return &Generator{
-		labels: make(map[string]*ast.Element),
-		indent: 0,
+	return NewWithOptions(Options{})
+}
+
+// NewWithOptions creates a new Generator with the given options
+func NewWithOptions(opts Options) *Generator {
+	g := &Generator{
+		labels:  make(map[string]*ast.Element),
+		modules: make(map[string]map[string]*ast.Element),
+		ids:     make(map[ast.Node]string),
+		vars:    make(map[string]ast.Value),
+		cycles:  make(map[string]bool),
+		calls:   make(map[*ast.CallValue]ast.Value),
+		opts:    opts,
+		indent:  0,
 	}
+
+	if bi := opts.BuildInfo; bi != nil {
+		g.vars["build.time"] = &ast.StringValue{Value: bi.formattedTime()}
+		g.vars["build.commit"] = &ast.StringValue{Value: bi.Commit}
+	}
+
+	return g
+}
+
+// maxDepth returns how deeply elements can nest
+func (g *Generator) maxDepth() int {
+	if g.opts.MaxDepth > 0 {
+		return g.opts.MaxDepth
+	}
+	return DefaultMaxDepth
 }
 
-// Generate produces HTML from the AST
+// maxOutput returns how many bytes of HTML a page can have
+func (g *Generator) maxOutput() int {
+	if g.opts.MaxOutput > 0 {
+		return g.opts.MaxOutput
+	}
+	return DefaultMaxOutput
+}
+
+// maxElements returns how many elements a page can have
+func (g *Generator) maxElements() int {
+	if g.opts.MaxElements > 0 {
+		return g.opts.MaxElements
+	}
+	return DefaultMaxElements
+}
+
+// tooLong reports whether a value n bytes long, at line, is more than a
+// page can hold, reporting the limit if it is
+func (g *Generator) tooLong(n, line int) bool {
+	if n <= g.maxOutput() {
+		return false
+	}
+	g.overLimit(line, "a value is more than %d bytes", g.maxOutput())
+	return true
+}
+
+// overLimit reports the first limit a page reaches, at line, and has the
+// rest of the page left out
+func (g *Generator) overLimit(line int, format string, args ...any) {
+	if g.over {
+		return
+	}
+	g.over = true
+	g.warnf(RuleLimit, line, format+", so the rest of the page is left out", args...)
+}
+
+// formattedTime returns the build time in UTC, e.g. 2024-06-01T12:00Z
+func (bi *BuildInfo) formattedTime() string {
+	return bi.Time.UTC().Format("2006-01-02T15:04Z")
+}
+
+// comment returns the HTML comment stamped at the top of generated pages
+func (bi *BuildInfo) comment() string {
+	var sb strings.Builder
+	sb.WriteString("<!-- generated by lpml at " + bi.formattedTime())
+	if bi.Source != "" {
+		sb.WriteString(" from " + commentText(bi.Source))
+	}
+	if bi.Commit != "" {
+		sb.WriteString(" (" + commentText(bi.Commit) + ")")
+	}
+	sb.WriteString(" -->\n")
+	return sb.String()
+}
+
+// commentText returns s with every "--" broken up, so a file named like
+// a--b.lpml or --> can't end the comment it's written in early
+func commentText(s string) string {
+	for strings.Contains(s, "--") {
+		s = strings.ReplaceAll(s, "--", "- -")
+	}
+	return s
+}
+
+// Generate produces HTML from the AST. A linked file that can't be read
+// as it's copied in is left out with a warning; use GeneratePage to write
+// pages with large linked files without holding them in memory.
 func (g *Generator) Generate(doc *ast.Document) string {
+	run := NewWithOptions(g.opts)
+	page := run.generatePage(doc)
 	var sb strings.Builder
+	if _, err := page.WriteTo(&sb); err != nil {
+		run.warnf(RuleFile, 0, "%v", err)
+	}
+	g.finish(run, page)
+	return sb.String()
+}
 
-	// First pass: collect all labeled elements
-	g.collectLabels(doc)
+// GeneratePage produces a page from the AST, to be written with WriteTo.
+// The files code blocks name with linked_file are read as it's written.
+func (g *Generator) GeneratePage(doc *ast.Document) *Page {
+	run := NewWithOptions(g.opts)
+	return g.finish(run, run.generatePage(doc))
+}
+
+// finish gives page the warnings and files run found generating it, and
+// keeps it as the page generated last
+func (g *Generator) finish(run *Generator, page *Page) *Page {
+	page.diags, page.files = run.diags, run.files
+	g.mu.Lock()
+	g.last = page
+	g.mu.Unlock()
+	return page
+}
+
+// lastPage returns the page generated last, or an empty one before any
+func (g *Generator) lastPage() *Page {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.last == nil {
+		return &Page{}
+	}
+	return g.last
+}
+
+// Excerpt returns the summary GeneratePage would give the page as
+// $page.excerpt, for listing it from other pages
+func (g *Generator) Excerpt(doc *ast.Document) string {
+	run := NewWithOptions(g.opts)
+	return run.excerpt(run.prepare(doc))
+}
+
+// generatePage generates the page for GeneratePage, with g's state fresh
+func (g *Generator) generatePage(doc *ast.Document) *Page {
+	var sb strings.Builder
+
+	doc = g.prepare(doc)
+	g.setPageVars(doc)
+
+	// Generate the body first, since elements can add to the head
+	var body strings.Builder
+	for _, section := range doc.Sections {
+		body.WriteString(g.generateSection(section))
+	}
 
 	// Write HTML document structure
 	sb.WriteString("<!DOCTYPE html>\n")
-	sb.WriteString("<html>\n")
+	if g.opts.BuildInfo != nil {
+		sb.WriteString(g.opts.BuildInfo.comment())
+	}
+	var htmlAttrs string
+	if lang := g.metaString(doc, "lang"); lang != "" {
+		htmlAttrs = attr("lang", lang)
+	}
+	htmlAttrs += g.documentAttrs(doc, "html_attrs", map[string]string{"lang": "lang"})
+	sb.WriteString(fmt.Sprintf("<html%s>\n", htmlAttrs))
 	sb.WriteString("<head>\n")
-	sb.WriteString("  <title>LPML Document</title>\n")
-	sb.WriteString("  <style>\n")
-	sb.WriteString("    .top-of-page { }\n")
-	sb.WriteString("    .mid-page { }\n")
-	sb.WriteString("    .bottom-of-page { }\n")
-	sb.WriteString("  </style>\n")
+	if charset := g.metaString(doc, "charset"); charset != "" {
+		sb.WriteString(fmt.Sprintf("  <meta%s>\n", attr("charset", charset)))
+	}
+	sb.WriteString(fmt.Sprintf("  <title>%s</title>\n", escapeHTML(g.pageTitle(doc))))
+	if description := g.description(doc); description != "" {
+		sb.WriteString(fmt.Sprintf("  <meta name=\"description\"%s>\n", attr("content", description)))
+	}
+	if author := g.metaString(doc, "author"); author != "" {
+		sb.WriteString(fmt.Sprintf("  <meta name=\"author\"%s>\n", attr("content", author)))
+	}
+	for _, css := range []string{g.baseCSS(), g.permalinkStyles(), g.printCSS(doc)} {
+		if css == "" {
+			continue
+		}
+		if g.opts.SharedDir != "" && !g.opts.SelfContained {
+			sb.WriteString(fmt.Sprintf("  <link rel=\"stylesheet\"%s>\n", attr("href", g.sharedFile([]byte(css), ".css"))))
+			continue
+		}
+		sb.WriteString("  <style>\n")
+		for _, line := range strings.Split(strings.TrimRight(css, "\n"), "\n") {
+			sb.WriteString("    " + line + "\n")
+		}
+		sb.WriteString("  </style>\n")
+	}
+	for _, line := range g.head {
+		sb.WriteString("  " + line + "\n")
+	}
 	sb.WriteString("</head>\n")
-	sb.WriteString("<body>\n")
+	var bodyAttrs string
+	if class := strings.Join(strings.Fields(g.metaString(doc, "body_class")), " "); class != "" {
+		bodyAttrs = attr("class", class)
+	}
+	bodyAttrs += g.documentAttrs(doc, "body_attrs", map[string]string{"class": "body_class"})
+	sb.WriteString(fmt.Sprintf("<body%s>\n", bodyAttrs))
+	sb.WriteString(body.String())
+	for _, line := range g.tail {
+		sb.WriteString("  " + line + "\n")
+	}
+	sb.WriteString("</body>\n")
+	sb.WriteString("</html>\n")
+
+	html := sb.String()
+	if g.opts.SelfContained {
+		html = g.inlineFiles(html)
+	}
+	return &Page{html: html, embeds: g.embeds}
+}
 
-	// Generate each section
+// applySet returns doc with the Options.Set values in its constants and
+// front matter, leaving doc itself as it was
+func (g *Generator) applySet(doc *ast.Document) *ast.Document {
+	if len(g.opts.Set) == 0 {
+		return doc
+	}
+	set := *doc
+	set.Defines = make(map[string]ast.Value, len(doc.Defines)+len(g.opts.Set))
+	for name, val := range doc.Defines {
+		set.Defines[name] = val
+	}
+	if doc.Meta != nil {
+		set.Meta = make(map[string]ast.Value, len(doc.Meta))
+		for name, val := range doc.Meta {
+			set.Meta[name] = val
+		}
+	}
+	for name, value := range g.opts.Set {
+		set.Defines[name] = ast.NewString(value)
+		if _, ok := set.Meta[name]; ok {
+			set.Meta[name] = ast.NewString(value)
+		}
+	}
+	return &set
+}
+
+// prepare readies g to generate doc and returns it as it renders: each
+// [if] and [repeat] expanded, and its labeled elements collected and given
+// their ids
+func (g *Generator) prepare(doc *ast.Document) *ast.Document {
+	doc = g.applySet(doc)
+	g.defines = doc.Defines
+	g.meta = doc.Meta
+	g.presets = doc.Presets
+	g.dateFmt = g.getProp(doc.Meta, "date_format")
+	g.lang = g.getProp(doc.Meta, "lang")
+	g.setPalette(doc)
+	doc = g.resolveBlocks(doc)
+	g.collectLabels(doc)
+	g.assignIDs(doc)
+	return doc
+}
+
+// setPageVars defines the $page.* variables describing the document
+func (g *Generator) setPageVars(doc *ast.Document) {
+	words := ast.WordCount(ast.ExtractText(doc))
+	g.vars["page.word_count"] = &ast.NumberValue{Value: strconv.Itoa(words)}
+	g.vars["page.reading_time"] = &ast.StringValue{Value: fmt.Sprintf("%d min read", ast.ReadingMinutes(words))}
+	g.vars["page.excerpt"] = &ast.StringValue{Value: g.excerpt(doc)}
+	if date, ok := doc.Meta["date"].(*ast.DateValue); ok {
+		g.vars["page.date"] = date
+	}
+}
+
+// excerpt returns the page summary as ast.Excerpt picks it, but from the
+// text as it renders: with references resolved, tags left out, and only
+// the branches of conditionals that render. Warnings resolving it are
+// left to generating the page, so none are given twice.
+func (g *Generator) excerpt(doc *ast.Document) string {
+	diags := len(g.diags)
+	defer func() { g.diags = g.diags[:diags] }()
+
+	for _, key := range []string{"excerpt", "description"} {
+		if val, ok := doc.Meta[key]; ok {
+			return strings.Join(strings.Fields(stripTags(g.resolveValue(val))), " ")
+		}
+	}
+
+	var words []string
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		var children []ast.Node
+		switch n := node.(type) {
+		case ast.Block:
+			children = n.Contents()
+		case *ast.Element:
+			if n.TagType == "p" {
+				words = append(words, strings.Fields(stripTags(g.plainText(n)))...)
+				return len(words) > ast.ExcerptWords
+			}
+			children = n.Children
+		}
+		for _, child := range children {
+			if visit(child) {
+				return true
+			}
+		}
+		return false
+	}
 	for _, section := range doc.Sections {
-		sb.WriteString(g.generateSection(section))
+		for _, child := range section.Children {
+			if visit(child) {
+				return strings.TrimRight(strings.Join(words[:ast.ExcerptWords], " "), ",;:.") + "..."
+			}
+		}
 	}
+	return strings.Join(words, " ")
+}
 
-	sb.WriteString("</body>\n")
-	sb.WriteString("</html>\n")
+// description returns the page's meta description: the [meta]
+// description, else the excerpt
+func (g *Generator) description(doc *ast.Document) string {
+	if val, ok := doc.Meta["description"]; ok {
+		return strings.Join(strings.Fields(g.resolveValue(val)), " ")
+	}
+	return g.excerpt(doc)
+}
 
-	return sb.String()
+// metaString returns a [meta] property resolved to text, or "" if the
+// page doesn't set it
+func (g *Generator) metaString(doc *ast.Document, key string) string {
+	val, ok := doc.Meta[key]
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(g.resolveValue(val))
 }
 
-// collectLabels finds all elements with labels for variable resolution
-func (g *Generator) collectLabels(doc *ast.Document) {
+// documentAttrs returns the attributes a [meta] map, like html_attrs, gives
+// the <html> or <body> tag, in the order they're written. Underscores in
+// their names are written as hyphens, so data_theme sets data-theme; true
+// gives an attribute with no value, and false leaves it out. written maps
+// the attributes the tag gets from other [meta] properties, which the map
+// can't set, to those properties.
+func (g *Generator) documentAttrs(doc *ast.Document, key string, written map[string]string) string {
+	val, ok := doc.Meta[key]
+	if !ok {
+		return ""
+	}
+	m, ok := g.mapProp(doc.Meta, key)
+	if !ok {
+		g.warnf(RuleProperty, val.Pos().Line, "%s must be a map of attributes, like { data_theme = \"dark\" }", key)
+		return ""
+	}
+	var attrs string
+	for _, e := range m.Entries {
+		name := strings.ToLower(strings.ReplaceAll(e.Name, "_", "-"))
+		if prop, ok := written[name]; ok {
+			g.warnf(RuleProperty, e.Value.Pos().Line, "%s can't set %s; use [meta] %s", key, name, prop)
+			continue
+		}
+		switch v := g.constant(e.Value).(type) {
+		case *ast.BoolValue:
+			if v.Value {
+				attrs += " " + name
+			}
+		case *ast.MapValue, *ast.ArrayValue:
+			g.warnf(RuleProperty, e.Value.Pos().Line, "%s %s must be text, a number, or true or false", key, e.Name)
+		default:
+			attrs += attr(name, g.resolveValue(e.Value))
+		}
+	}
+	return attrs
+}
+
+// baseCSS returns the stylesheet written into the head, if any
+func (g *Generator) baseCSS() string {
+	switch g.opts.BaseCSS {
+	case BaseCSSNone:
+		return ""
+	case BaseCSSReset:
+		return resetCSS
+	case BaseCSSCustom:
+		return g.opts.CustomCSS
+	default:
+		return defaultCSS
+	}
+}
+
+// pageTitle picks the <title>: the explicit option, else the first heading,
+// else the source file name, followed by the site title if there is one
+func (g *Generator) pageTitle(doc *ast.Document) string {
+	if g.opts.Title != "" {
+		return g.opts.Title
+	}
+
+	title := g.metaString(doc, "title")
+	if title == "" {
+		title = g.inferTitle(doc)
+	}
+	switch {
+	case title == "" && g.opts.SiteTitle == "":
+		return "LPML Document"
+	case title == "":
+		return g.opts.SiteTitle
+	case g.opts.SiteTitle == "" || title == g.opts.SiteTitle:
+		return title
+	}
+	return title + " | " + g.opts.SiteTitle
+}
+
+// inferTitle picks a title from the first heading, then the source file
+// name. It returns "" if neither is available or inference is off.
+func (g *Generator) inferTitle(doc *ast.Document) string {
+	if g.opts.NoInferTitle {
+		return ""
+	}
+
 	for _, section := range doc.Sections {
 		for _, child := range section.Children {
-			g.collectElementLabels(child)
+			if h := findHeading(child); h != nil {
+				if title := strings.TrimSpace(g.plainText(h)); title != "" {
+					return title
+				}
+			}
 		}
 	}
+
+	if g.opts.SourceFile != "" {
+		base := filepath.Base(g.opts.SourceFile)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return ""
 }
 
-// collectElementLabels recursively collects labels from elements
-func (g *Generator) collectElementLabels(node ast.Node) {
+// findHeading returns the first heading at or below node
+func findHeading(node ast.Node) *ast.Element {
 	elem, ok := node.(*ast.Element)
 	if !ok {
-		return
+		return nil
 	}
-
-	if labelVal, exists := elem.Properties["label"]; exists {
-		if sv, ok := labelVal.(*ast.StringValue); ok {
-			g.labels[sv.Value] = elem
+	if elem.TagType == "h" {
+		return elem
+	}
+	for _, child := range elem.Children {
+		if h := findHeading(child); h != nil {
+			return h
 		}
 	}
+	return nil
+}
+
+// plainText returns an element's text without any markup
+func (g *Generator) plainText(elem *ast.Element) string {
+	var sb strings.Builder
 
+	sb.WriteString(g.getStringProp(elem, "contains"))
 	for _, child := range elem.Children {
-		g.collectElementLabels(child)
+		switch c := child.(type) {
+		case *ast.TextNode:
+			sb.WriteString(c.Value)
+		case *ast.Element:
+			sb.WriteString(g.plainText(c))
+		}
 	}
+
+	return sb.String()
+}
+
+// collectLabels finds all elements with labels for variable resolution
+func (g *Generator) collectLabels(doc *ast.Document) {
+	ast.Inspect(doc, func(node ast.Node) bool {
+		if _, ok := node.(ast.Value); ok {
+			return false // No elements in there
+		}
+		elem, ok := node.(*ast.Element)
+		if !ok {
+			return true
+		}
+		if sv, ok := elem.Properties["label"].(*ast.StringValue); ok {
+			g.labels[sv.Value] = elem
+			if module := elem.Module(); module != "" {
+				if g.modules[module] == nil {
+					g.modules[module] = make(map[string]*ast.Element)
+				}
+				g.modules[module][sv.Value] = elem
+			}
+		}
+		return true
+	})
 }
 
-// generateSection generates HTML for a page section
+// generateSection generates HTML for a page section, as a <header>,
+// <main>, or <footer> with the section's class
 func (g *Generator) generateSection(section *ast.PageSection) string {
 	var sb strings.Builder
 	className := section.Type + "-of-page"
@@ -86,18 +659,37 @@ func (g *Generator) generateSection(section *ast.PageSection) string {
 		className = "mid-page"
 	}
 
-	sb.WriteString(fmt.Sprintf("  <div class=\"%s\">\n", className))
+	tag := "div"
+	if t, ok := sectionTags[section.Type]; ok && !g.opts.DivSections {
+		tag = t
+	}
+	if tag == "main" {
+		if g.hasMain {
+			tag = "div" // A page has only one <main>
+		}
+		g.hasMain = true
+	}
+
+	sb.WriteString("  <" + tag)
+	sb.WriteString(g.buildIDAttr(section, section.Properties))
+	sb.WriteString(g.buildClassAttr(section.Properties, className))
+	sb.WriteString(g.buildStyleAttr(section.Properties))
+	sb.WriteString(">\n")
 
 	g.indent = 2
 	for _, child := range section.Children {
 		sb.WriteString(g.generateNode(child))
 	}
 
-	sb.WriteString("  </div>\n")
+	sb.WriteString("  </" + tag + ">\n")
 
 	return sb.String()
 }
 
+// sectionTags are the elements page sections are written as, unless
+// Options.DivSections keeps them <div>s
+var sectionTags = map[string]string{"top": "header", "mid": "main", "bottom": "footer"}
+
 // generateNode generates HTML for any AST node
 func (g *Generator) generateNode(node ast.Node) string {
 	elem, ok := node.(*ast.Element)
@@ -110,12 +702,38 @@ func (g *Generator) generateNode(node ast.Node) string {
 
 // generateElement generates HTML for an element
 func (g *Generator) generateElement(elem *ast.Element) string {
+	if g.over {
+		return ""
+	}
+	if max := g.maxDepth(); g.depth >= max {
+		g.warnf(RuleLimit, elem.Token.Line, "[%s] is nested more than %d deep, so it's left out", elem.TagType, max)
+		return ""
+	}
+	g.depth++
+	size := g.size
+	html := g.generateTag(elem)
+	g.depth--
+
+	// What the element's children added to size is counted again in its
+	// own HTML, which holds theirs
+	if g.size = size + len(html); g.size > g.maxOutput() {
+		g.overLimit(elem.Token.Line, "the page is more than %d bytes", g.maxOutput())
+		g.size = size
+		return ""
+	}
+	return html
+}
+
+// generateTag generates the HTML for an element, whatever its tag
+func (g *Generator) generateTag(elem *ast.Element) string {
 	var sb strings.Builder
 	indent := strings.Repeat("  ", g.indent)
 
 	switch elem.TagType {
 	case "divide":
-		sb.WriteString(g.generateDiv(elem, indent))
+		sb.WriteString(g.generateContainer(elem, indent, "div"))
+	case "nav", "article", "section", "aside":
+		sb.WriteString(g.generateContainer(elem, indent, elem.TagType))
 	case "p":
 		sb.WriteString(g.generateParagraph(elem, indent))
 	case "h":
@@ -146,33 +764,56 @@ func (g *Generator) generateElement(elem *ast.Element) string {
 		sb.WriteString(g.generateInput(elem, indent))
 	case "btn":
 		sb.WriteString(g.generateButton(elem, indent))
+	case "hr":
+		sb.WriteString(fmt.Sprintf("%s<hr%s>\n", indent, g.buildCommonAttrs(elem)))
+	case "br":
+		sb.WriteString(fmt.Sprintf("%s<br%s>\n", indent, g.buildCommonAttrs(elem)))
+	case "script":
+		g.generateScript(elem)
+	case "pagenav":
+		sb.WriteString(g.generatePageNav(elem, indent))
+	case "versions":
+		sb.WriteString(g.generateVersions(elem, indent))
+	case "time":
+		sb.WriteString(g.generateTime(elem, indent))
+	case "lorem":
+		sb.WriteString(g.generateLorem(elem, indent))
+	case "placeholder-img":
+		sb.WriteString(g.generatePlaceholderImage(elem, indent))
+	case "qr":
+		sb.WriteString(g.generateQR(elem, indent))
 	case "bold":
 		sb.WriteString(g.generateBold(elem, indent))
 	case "italic":
 		sb.WriteString(g.generateItalic(elem, indent))
 	case "code":
 		sb.WriteString(g.generateCode(elem, indent))
+	case "faq":
+		sb.WriteString(g.generateFAQ(elem, indent))
+	case "question", "answer":
+		g.warnf(RuleStructure, elem.Token.Line, "%s outside [faq-start] is ignored", tagName(elem))
+	case "event":
+		sb.WriteString(g.generateEvent(elem, indent))
+	case "contact":
+		sb.WriteString(g.generateContact(elem, indent))
+	case "query":
+		sb.WriteString(g.generateQuery(elem, indent))
+	default:
+		if r, ok := g.opts.CustomTags[elem.TagType]; ok {
+			sb.WriteString(g.generateCustom(elem, indent, r))
+		}
 	}
 
 	return sb.String()
 }
 
-// generateDiv generates a <div> element
-func (g *Generator) generateDiv(elem *ast.Element, indent string) string {
+// generateContainer generates an element holding others: a <div>, or
+// the <nav>, <article>, <section>, or <aside> saying what it holds
+func (g *Generator) generateContainer(elem *ast.Element, indent, tag string) string {
 	var sb strings.Builder
 
-	id := g.getStringProp(elem, "label")
-	class := g.getStringProp(elem, "class")
-	styleAttr := g.buildStyleAttr(elem)
-
-	sb.WriteString(indent + "<div")
-	if id != "" {
-		sb.WriteString(fmt.Sprintf(" id=\"%s\"", id))
-	}
-	if class != "" {
-		sb.WriteString(fmt.Sprintf(" class=\"%s\"", class))
-	}
-	sb.WriteString(styleAttr)
+	sb.WriteString(indent + "<" + tag)
+	sb.WriteString(g.buildCommonAttrs(elem))
 	sb.WriteString(">\n")
 
 	g.indent++
@@ -181,26 +822,54 @@ func (g *Generator) generateDiv(elem *ast.Element, indent string) string {
 	}
 	g.indent--
 
-	sb.WriteString(indent + "</div>\n")
+	sb.WriteString(indent + "</" + tag + ">\n")
 	return sb.String()
 }
 
 // generateParagraph generates a <p> element
 func (g *Generator) generateParagraph(elem *ast.Element, indent string) string {
-	content := g.getStringProp(elem, "contains")
-	id := g.getStringProp(elem, "label")
+	// Text and inline children, with format_with applied
+	content := g.inlineContent(elem)
 
-	// Apply formatting from format_with property
-	content = g.applyFormatting(elem, content)
+	return fmt.Sprintf("%s<p%s>%s</p>\n", indent, g.buildCommonAttrs(elem), content)
+}
+
+// inlineContent renders an element's contains text followed by its inline
+// children (text runs, bold, italic, links), then applies format_with
+func (g *Generator) inlineContent(elem *ast.Element) string {
+	var sb strings.Builder
 
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
+	sb.WriteString(g.getStringProp(elem, "contains"))
+	for _, child := range elem.Children {
+		sb.WriteString(g.generateInline(child))
 	}
 
-	styleAttr := g.buildStyleAttr(elem)
+	return g.applyFormatting(elem, sb.String())
+}
 
-	return fmt.Sprintf("%s<p%s%s>%s</p>\n", indent, idAttr, styleAttr, content)
+// generateInline generates HTML for a node inside running text
+func (g *Generator) generateInline(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.TextNode:
+		return n.Value
+	case *ast.Element:
+		attrs := g.buildCommonAttrs(n)
+		switch n.TagType {
+		case "bold":
+			return fmt.Sprintf("<strong%s>%s</strong>", attrs, g.inlineContent(n))
+		case "italic":
+			return fmt.Sprintf("<em%s>%s</em>", attrs, g.inlineContent(n))
+		case "link":
+			return fmt.Sprintf("<a%s%s>%s</a>", attr("href", g.getLinkURL(n)), attrs, g.inlineContent(n))
+		case "lorem":
+			// Filler words in running text, without paragraphs of their own
+			return lorem(0, min(g.wholeNumber(n, "lorem", "words", 50), maxLoremWords))
+		default:
+			// Block elements keep their own markup, minus the surrounding line
+			return strings.TrimSpace(g.generateElement(n))
+		}
+	}
+	return ""
 }
 
 // applyFormatting wraps content with formatting tags based on format_with property
@@ -222,6 +891,15 @@ func (g *Generator) applyFormatting(elem *ast.Element, content string) string {
 					content = "<code>" + content + "</code>"
 				case "mark":
 					content = "<mark>" + content + "</mark>"
+				case "link":
+					if href := g.getLinkURL(elem); href != "" {
+						content = fmt.Sprintf("<a%s>%s</a>", attr("href", href), content)
+					}
+				default:
+					// color:<value> colors just the text, e.g. "color:#e74c3c"
+					if color, ok := strings.CutPrefix(format, "color:"); ok {
+						content = fmt.Sprintf("<span%s>%s</span>", attr("style", "color: "+g.paletteColor(strings.TrimSpace(color))+";"), content)
+					}
 				}
 			}
 		}
@@ -229,100 +907,251 @@ func (g *Generator) applyFormatting(elem *ast.Element, content string) string {
 	return content
 }
 
+// buildCommonAttrs builds the id, class, and style attributes shared by all elements
+func (g *Generator) buildCommonAttrs(elem *ast.Element) string {
+	return g.buildIDAttr(elem, elem.Properties) + g.buildClassAttr(elem.Properties, "") + g.buildStyleAttr(elem.Properties)
+}
+
+// buildIDAttr builds the id attribute from a node's label
+func (g *Generator) buildIDAttr(node ast.Node, props map[string]ast.Value) string {
+	if id := g.nodeID(node, props); id != "" {
+		return attr("id", id)
+	}
+	return ""
+}
+
+// nodeID returns the HTML id of a labeled node, or "" if it has none
+func (g *Generator) nodeID(node ast.Node, props map[string]ast.Value) string {
+	if id, ok := g.ids[node]; ok {
+		return id
+	}
+	if id := g.getProp(props, "label"); id != "" {
+		// Labels built from references are only known at render time
+		return slugify(id)
+	}
+	return ""
+}
+
+// buildClassAttr builds the class attribute, prefixed by any built-in class
+func (g *Generator) buildClassAttr(props map[string]ast.Value, builtin string) string {
+	class := strings.TrimSpace(builtin + " " + g.getProp(props, "class"))
+	if class == "" {
+		return ""
+	}
+	return attr("class", class)
+}
+
 // buildStyleAttr builds inline CSS from friendly property names
-func (g *Generator) buildStyleAttr(elem *ast.Element) string {
+func (g *Generator) buildStyleAttr(props map[string]ast.Value) string {
+	return styleAttr(g.buildStyles(props))
+}
+
+// styleAttr joins CSS declarations into a style attribute, or "" if there
+// are none
+func styleAttr(styles []string) string {
+	if len(styles) == 0 {
+		return ""
+	}
+	return attr("style", strings.Join(styles, "; ")+";")
+}
+
+// underlay returns props with base's properties added under them: ones
+// in props win
+func underlay(base, props map[string]ast.Value) map[string]ast.Value {
+	merged := make(map[string]ast.Value, len(base)+len(props))
+	for name, val := range base {
+		merged[name] = val
+	}
+	for name, val := range props {
+		merged[name] = val
+	}
+	return merged
+}
+
+// buildStyles converts friendly property names to CSS declarations
+func (g *Generator) buildStyles(props map[string]ast.Value) []string {
 	var styles []string
 
+	// A style map groups the styling properties; ones set directly win
+	if style, ok := g.mapProp(props, "style"); ok {
+		entries := make(map[string]ast.Value, len(style.Entries))
+		for _, e := range style.Entries {
+			entries[e.Name] = e.Value
+		}
+		props = underlay(entries, props)
+	}
+
+	// A preset is styling shared by name, under the style map and the
+	// properties set directly
+	if name := g.getProp(props, "use_preset"); name != "" {
+		if preset, ok := g.presets[name]; ok {
+			props = underlay(preset, props)
+		} else {
+			g.warnf(RuleReference, props["use_preset"].Pos().Line, "use_preset %q isn't a [preset] in this page", name)
+		}
+	}
+	g.checkColors(props)
+
 	// Text color
-	if v := g.getStringProp(elem, "text_color"); v != "" {
-		styles = append(styles, fmt.Sprintf("color: %s", v))
+	if v := g.getProp(props, "text_color"); v != "" {
+		styles = append(styles, fmt.Sprintf("color: %s", g.resolveColor(props, "text_color", v)))
 	}
-	if v := g.getStringProp(elem, "color"); v != "" {
-		styles = append(styles, fmt.Sprintf("color: %s", v))
+	if v := g.getProp(props, "color"); v != "" {
+		styles = append(styles, fmt.Sprintf("color: %s", g.resolveColor(props, "color", v)))
 	}
 
 	// Background
-	if v := g.getStringProp(elem, "bg_color"); v != "" {
-		styles = append(styles, fmt.Sprintf("background-color: %s", v))
+	if v := g.getProp(props, "bg_color"); v != "" {
+		styles = append(styles, fmt.Sprintf("background-color: %s", g.resolveColor(props, "bg_color", v)))
 	}
-	if v := g.getStringProp(elem, "background"); v != "" {
+	if v := g.getProp(props, "background"); v != "" {
 		// Use 'background' for gradients, 'background-color' for solid colors
 		if strings.Contains(v, "gradient") || strings.Contains(v, "url(") {
-			styles = append(styles, fmt.Sprintf("background: %s", v))
+			styles = append(styles, fmt.Sprintf("background: %s", g.resolveShades(v)))
 		} else {
-			styles = append(styles, fmt.Sprintf("background-color: %s", v))
+			styles = append(styles, fmt.Sprintf("background-color: %s", g.resolveColor(props, "background", v)))
 		}
 	}
 
 	// Font size - support friendly names
-	if v := g.getStringProp(elem, "text_size"); v != "" {
+	if v := g.getProp(props, "text_size"); v != "" {
 		styles = append(styles, fmt.Sprintf("font-size: %s", g.resolveFontSize(v)))
 	}
 
 	// Font family
-	if v := g.getStringProp(elem, "font"); v != "" {
+	if v := g.getProp(props, "font"); v != "" {
 		styles = append(styles, fmt.Sprintf("font-family: %s", v))
 	}
 
 	// Text alignment
-	if v := g.getStringProp(elem, "align"); v != "" {
+	if v := g.getProp(props, "align"); v != "" {
 		styles = append(styles, fmt.Sprintf("text-align: %s", v))
 	}
 
 	// Padding - support friendly names
-	if v := g.getStringProp(elem, "padding"); v != "" {
+	if v := g.getProp(props, "padding"); v != "" {
 		styles = append(styles, fmt.Sprintf("padding: %s", g.resolveSpacing(v)))
 	}
 
 	// Margin
-	if v := g.getStringProp(elem, "margin"); v != "" {
+	if v := g.getProp(props, "margin"); v != "" {
 		styles = append(styles, fmt.Sprintf("margin: %s", g.resolveSpacing(v)))
 	}
 
 	// Border - friendly syntax
-	if v := g.getStringProp(elem, "border"); v != "" {
-		styles = append(styles, fmt.Sprintf("border: %s", g.resolveBorder(v)))
+	if v := g.getProp(props, "border"); v != "" {
+		styles = append(styles, fmt.Sprintf("border: %s", g.resolveShades(g.resolveBorder(v))))
 	}
 
 	// Border radius (rounded corners)
-	if v := g.getStringProp(elem, "rounded"); v != "" {
+	if v := g.getProp(props, "rounded"); v != "" {
 		styles = append(styles, fmt.Sprintf("border-radius: %s", g.resolveRounded(v)))
 	}
 
 	// Box shadow
-	if v := g.getStringProp(elem, "shadow"); v != "" {
+	if v := g.getProp(props, "shadow"); v != "" {
 		styles = append(styles, fmt.Sprintf("box-shadow: %s", g.resolveShadow(v)))
 	}
 
 	// Width
-	if v := g.getStringProp(elem, "width"); v != "" {
+	if v := g.getProp(props, "width"); v != "" {
 		styles = append(styles, fmt.Sprintf("width: %s", v))
 	}
 
+	// Max width - centered unless a margin is given
+	if v := g.getProp(props, "max_width"); v != "" {
+		styles = append(styles, fmt.Sprintf("max-width: %s", v))
+		if g.getProp(props, "margin") == "" {
+			styles = append(styles, "margin-left: auto", "margin-right: auto")
+		}
+	}
+
 	// Height
-	if v := g.getStringProp(elem, "height"); v != "" {
+	if v := g.getProp(props, "height"); v != "" {
 		styles = append(styles, fmt.Sprintf("height: %s", v))
 	}
 
 	// Line height / spacing
-	if v := g.getStringProp(elem, "line_spacing"); v != "" {
+	if v := g.getProp(props, "line_spacing"); v != "" {
 		styles = append(styles, fmt.Sprintf("line-height: %s", v))
 	}
 
 	// Display
-	if v := g.getStringProp(elem, "display"); v != "" {
+	if v := g.getProp(props, "display"); v != "" {
 		styles = append(styles, fmt.Sprintf("display: %s", v))
 	}
 
+	// Page breaks when printing
+	if v := g.getProp(props, "break_before"); v != "" {
+		styles = append(styles, fmt.Sprintf("break-before: %s", v))
+	}
+	if v := g.getProp(props, "break_after"); v != "" {
+		styles = append(styles, fmt.Sprintf("break-after: %s", v))
+	}
+
 	// Flex centering shortcut
-	if v := g.getStringProp(elem, "center_content"); v == "true" {
+	if g.getBoolProp(props, "center_content") {
 		styles = append(styles, "display: flex", "justify-content: center", "align-items: center")
 	}
 
-	if len(styles) == 0 {
-		return ""
+	// Raw CSS for what the friendly names don't cover, last so it wins
+	return append(styles, g.rawCSS(props)...)
+}
+
+// rawCSS returns the declarations of a css = { ... } property, or a css
+// string, as written
+func (g *Generator) rawCSS(props map[string]ast.Value) []string {
+	css := g.getProp(props, "css")
+	if code, ok := g.constant(props["css"]).(*ast.CodeBlockValue); ok {
+		css = code.Content
 	}
-	return fmt.Sprintf(" style=\"%s;\"", strings.Join(styles, "; "))
+	return cssDeclarations(css)
+}
+
+// cssDeclarations splits CSS into its declarations at the semicolons
+// between them, not those in quotes or parentheses, like the one in
+// url(data:image/png;base64,...). Runs of whitespace outside quotes
+// become one space.
+func cssDeclarations(css string) []string {
+	var decls []string
+	var decl strings.Builder
+	end := func() {
+		if d := strings.TrimSpace(decl.String()); d != "" {
+			decls = append(decls, d)
+		}
+		decl.Reset()
+	}
+	var quote rune
+	depth, escaped, space := 0, false, false
+	for _, r := range css {
+		switch {
+		case quote != 0:
+			if r == quote && !escaped {
+				quote = 0
+			}
+			escaped = !escaped && r == '\\'
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case r == ';' && depth == 0:
+			end()
+			space = false
+			continue
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		}
+		if space && decl.Len() > 0 {
+			decl.WriteByte(' ')
+		}
+		space = false
+		decl.WriteRune(r)
+	}
+	end()
+	return decls
 }
 
 // resolveFontSize converts friendly size names to CSS
@@ -423,67 +1252,67 @@ func (g *Generator) resolveShadow(shadow string) string {
 
 // generateHeading generates <h1>-<h6> based on size
 func (g *Generator) generateHeading(elem *ast.Element, indent string) string {
-	content := g.getStringProp(elem, "contains")
-	id := g.getStringProp(elem, "label")
+	content := g.inlineContent(elem) + g.permalink(g.nodeID(elem, elem.Properties))
 	size := g.getStringProp(elem, "size")
 	level := g.getStringProp(elem, "level")
 
-	// Apply formatting
-	content = g.applyFormatting(elem, content)
-
 	// Determine heading level - default to h1
-	if level == "" {
-		level = "1"
-	}
+	level = g.resolveHeadingLevel(level)
 
 	// Build style - include size if specified
-	styleAttr := g.buildStyleAttr(elem)
+	styleAttr := g.buildStyleAttr(elem.Properties)
+	if size != "" {
+		size = g.resolveFontSize(size)
+	}
 	if size != "" && styleAttr == "" {
-		styleAttr = fmt.Sprintf(" style=\"font-size: %s;\"", size)
+		styleAttr = attr("style", "font-size: "+size+";")
 	} else if size != "" {
 		// Append size to existing styles
 		styleAttr = strings.TrimSuffix(styleAttr, "\"")
-		styleAttr = styleAttr + fmt.Sprintf("; font-size: %s;\"", size)
+		styleAttr = styleAttr + " font-size: " + escapeHTML(size) + ";\""
 	}
 
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
-	}
+	return fmt.Sprintf("%s<h%s%s%s>%s</h%s>\n", indent, level, g.buildIDAttr(elem, elem.Properties)+g.buildClassAttr(elem.Properties, ""), styleAttr, content, level)
+}
 
-	return fmt.Sprintf("%s<h%s%s%s>%s</h%s>\n", indent, level, idAttr, styleAttr, content, level)
+// resolveHeadingLevel converts friendly level names to a heading number
+func (g *Generator) resolveHeadingLevel(level string) string {
+	return strconv.Itoa(ast.HeadingLevel(level))
 }
 
 // generateLink generates an <a> element
 func (g *Generator) generateLink(elem *ast.Element, indent string) string {
-	content := g.getStringProp(elem, "contains")
+	content := g.inlineContent(elem)
+	href := g.getLinkURL(elem)
+
+	return fmt.Sprintf("%s<a%s%s>%s</a>\n", indent, attr("href", href), g.buildCommonAttrs(elem), content)
+}
+
+// getLinkURL returns an element's link target
+func (g *Generator) getLinkURL(elem *ast.Element) string {
 	// Support both link_url (LPML way) and href (legacy)
 	href := g.getStringProp(elem, "link_url")
 	if href == "" {
 		href = g.getStringProp(elem, "href")
 	}
-	id := g.getStringProp(elem, "label")
-
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
-	}
-
-	return fmt.Sprintf("%s<a href=\"%s\"%s>%s</a>\n", indent, href, idAttr, content)
+	return href
 }
 
 // generateImage generates an <img> element
 func (g *Generator) generateImage(elem *ast.Element, indent string) string {
 	src := g.getStringProp(elem, "src")
 	alt := g.getStringProp(elem, "alt")
-	id := g.getStringProp(elem, "label")
 
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
+	size, reserved := g.imageLayout(elem, src)
+	if g.opts.SelfContained {
+		// Resized copies would be files of their own
+		src = g.inlineImage(elem, src)
+	} else if srcset := g.imageSrcset(elem, src); srcset != "" {
+		size = attr("srcset", srcset) + size
 	}
-
-	return fmt.Sprintf("%s<img src=\"%s\" alt=\"%s\"%s>\n", indent, src, alt, idAttr)
+	attrs := g.buildIDAttr(elem, elem.Properties) + g.buildClassAttr(elem.Properties, "") +
+		styleAttr(append(g.buildStyles(elem.Properties), reserved...))
+	return fmt.Sprintf("%s<img%s%s%s%s>\n", indent, attr("src", src), attr("alt", alt), size, attrs)
 }
 
 // generateList generates <ul> or <ol>
@@ -503,13 +1332,7 @@ func (g *Generator) generateList(elem *ast.Element, indent string, ordered bool)
 		tag = "ul"
 	}
 
-	id := g.getStringProp(elem, "label")
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
-	}
-
-	sb.WriteString(fmt.Sprintf("%s<%s%s>\n", indent, tag, idAttr))
+	sb.WriteString(fmt.Sprintf("%s<%s%s>\n", indent, tag, g.buildCommonAttrs(elem)))
 
 	g.indent++
 	childIndent := strings.Repeat("  ", g.indent)
@@ -536,21 +1359,15 @@ func (g *Generator) generateList(elem *ast.Element, indent string, ordered bool)
 
 // generateListItem generates <li>
 func (g *Generator) generateListItem(elem *ast.Element, indent string) string {
-	content := g.getStringProp(elem, "contains")
-	return fmt.Sprintf("%s<li>%s</li>\n", indent, content)
+	content := g.inlineContent(elem)
+	return fmt.Sprintf("%s<li%s>%s</li>\n", indent, g.buildCommonAttrs(elem), content)
 }
 
 // generateTable generates <table>
 func (g *Generator) generateTable(elem *ast.Element, indent string) string {
 	var sb strings.Builder
 
-	id := g.getStringProp(elem, "label")
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
-	}
-
-	sb.WriteString(fmt.Sprintf("%s<table%s>\n", indent, idAttr))
+	sb.WriteString(fmt.Sprintf("%s<table%s>\n", indent, g.buildCommonAttrs(elem)))
 
 	g.indent++
 	for _, child := range elem.Children {
@@ -566,7 +1383,7 @@ func (g *Generator) generateTable(elem *ast.Element, indent string) string {
 func (g *Generator) generateRow(elem *ast.Element, indent string) string {
 	var sb strings.Builder
 
-	sb.WriteString(fmt.Sprintf("%s<tr>\n", indent))
+	sb.WriteString(fmt.Sprintf("%s<tr%s>\n", indent, g.buildCommonAttrs(elem)))
 
 	g.indent++
 	for _, child := range elem.Children {
@@ -580,25 +1397,22 @@ func (g *Generator) generateRow(elem *ast.Element, indent string) string {
 
 // generateCell generates <td>
 func (g *Generator) generateCell(elem *ast.Element, indent string) string {
-	content := g.getStringProp(elem, "contains")
-	return fmt.Sprintf("%s<td>%s</td>\n", indent, content)
+	content := g.inlineContent(elem)
+	return fmt.Sprintf("%s<td%s>%s</td>\n", indent, g.buildCommonAttrs(elem), content)
 }
 
 // generateForm generates <form>
 func (g *Generator) generateForm(elem *ast.Element, indent string) string {
 	var sb strings.Builder
 
-	action := g.getStringProp(elem, "action")
-	id := g.getStringProp(elem, "label")
+	backend, hidden := g.formBackend(elem)
 
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
-	}
-
-	sb.WriteString(fmt.Sprintf("%s<form action=\"%s\"%s>\n", indent, action, idAttr))
+	sb.WriteString(fmt.Sprintf("%s<form%s%s>\n", indent, backend, g.buildCommonAttrs(elem)))
 
 	g.indent++
+	for _, field := range hidden {
+		sb.WriteString(strings.Repeat("  ", g.indent) + field + "\n")
+	}
 	for _, child := range elem.Children {
 		sb.WriteString(g.generateNode(child))
 	}
@@ -612,43 +1426,48 @@ func (g *Generator) generateForm(elem *ast.Element, indent string) string {
 func (g *Generator) generateInput(elem *ast.Element, indent string) string {
 	inputType := g.getStringProp(elem, "type")
 	name := g.getStringProp(elem, "name")
-	id := g.getStringProp(elem, "label")
-
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
-	}
 
 	if inputType == "" {
 		inputType = "text"
 	}
 
-	return fmt.Sprintf("%s<input type=\"%s\" name=\"%s\"%s>\n", indent, inputType, name, idAttr)
+	var flags string
+	for _, flag := range []string{"required", "disabled", "checked"} {
+		if g.getBoolProp(elem.Properties, flag) {
+			flags += " " + flag
+		}
+	}
+
+	var placeholder string
+	if text := g.getStringProp(elem, "placeholder"); text != "" {
+		placeholder = attr("placeholder", text)
+	}
+
+	return fmt.Sprintf("%s<input%s%s%s%s%s>\n", indent, attr("type", inputType), attr("name", name), placeholder, g.buildCommonAttrs(elem), flags)
 }
 
 // generateButton generates <button>
 func (g *Generator) generateButton(elem *ast.Element, indent string) string {
-	content := g.getStringProp(elem, "contains")
-	id := g.getStringProp(elem, "label")
+	content := g.inlineContent(elem)
 
-	idAttr := ""
-	if id != "" {
-		idAttr = fmt.Sprintf(" id=\"%s\"", id)
+	var flags string
+	if g.getBoolProp(elem.Properties, "disabled") {
+		flags = " disabled"
 	}
 
-	return fmt.Sprintf("%s<button%s>%s</button>\n", indent, idAttr, content)
+	return fmt.Sprintf("%s<button%s%s>%s</button>\n", indent, g.buildCommonAttrs(elem), flags, content)
 }
 
 // generateBold generates <strong>
 func (g *Generator) generateBold(elem *ast.Element, indent string) string {
-	content := g.getStringProp(elem, "contains")
-	return fmt.Sprintf("%s<strong>%s</strong>\n", indent, content)
+	content := g.inlineContent(elem)
+	return fmt.Sprintf("%s<strong%s>%s</strong>\n", indent, g.buildCommonAttrs(elem), content)
 }
 
 // generateItalic generates <em>
 func (g *Generator) generateItalic(elem *ast.Element, indent string) string {
-	content := g.getStringProp(elem, "contains")
-	return fmt.Sprintf("%s<em>%s</em>\n", indent, content)
+	content := g.inlineContent(elem)
+	return fmt.Sprintf("%s<em%s>%s</em>\n", indent, g.buildCommonAttrs(elem), content)
 }
 
 // generateCode generates <pre><code> block
@@ -670,15 +1489,13 @@ func (g *Generator) generateCode(elem *ast.Element, indent string) string {
 	// Determine language class for syntax highlighting
 	langClass := ""
 	if fileType != "" {
-		langClass = fmt.Sprintf(" class=\"language-%s\"", fileType)
+		langClass = attr("class", "language-"+fileType)
 	}
 
-	sb.WriteString(fmt.Sprintf("%s<pre><code%s>", indent, langClass))
+	sb.WriteString(fmt.Sprintf("%s<pre%s><code%s>", indent, g.buildCommonAttrs(elem), langClass))
 
 	if linkedFile != "" {
-		// If it's a linked file, add a comment showing the file path
-		sb.WriteString(fmt.Sprintf("/* File: %s */\n", linkedFile))
-		// Note: In a real implementation, you might read the file contents here
+		sb.WriteString(g.embedFile(linkedFile, elem.Token.Line))
 	}
 
 	if codeContent != "" {
@@ -692,6 +1509,11 @@ func (g *Generator) generateCode(elem *ast.Element, indent string) string {
 	return sb.String()
 }
 
+// attr builds a ` name="value"` attribute with the value escaped
+func attr(name, value string) string {
+	return fmt.Sprintf(" %s=\"%s\"", name, escapeHTML(value))
+}
+
 // escapeHTML escapes HTML special characters
 func escapeHTML(s string) string {
 	s = strings.ReplaceAll(s, "&", "&amp;")
@@ -703,31 +1525,202 @@ func escapeHTML(s string) string {
 
 // getStringProp gets a string property value from an element
 func (g *Generator) getStringProp(elem *ast.Element, name string) string {
-	if val, exists := elem.Properties[name]; exists {
-		return g.resolveValue(val)
+	return g.getProp(elem.Properties, name)
+}
+
+// getBoolProp reports whether a flag property is set: true, or the
+// string "true" that older sources use
+func (g *Generator) getBoolProp(props map[string]ast.Value, name string) bool {
+	if bv, ok := props[name].(*ast.BoolValue); ok {
+		return bv.Value
 	}
-	return ""
+	return g.getProp(props, name) == "true"
+}
+
+// getProp gets a string property value from a property map
+func (g *Generator) getProp(props map[string]ast.Value, name string) string {
+	val, exists := props[name]
+	if !exists {
+		return ""
+	}
+	// A date is written in the date_format beside it, if there is one, and
+	// a date given as the date_format itself as it's written
+	if date, ok := g.constant(val).(*ast.DateValue); ok && props["date_format"] != nil && name != "date_format" {
+		return date.Format(g.getProp(props, "date_format"))
+	}
+	return g.resolveValue(val)
+}
+
+// noColorProps are the styling properties a color literal makes no sense in
+var noColorProps = []string{"align", "display", "font", "height", "line_spacing", "margin", "max_width", "padding", "rounded", "shadow", "text_size", "width"}
+
+// checkColors warns about unquoted color literals, like #ff8800, given to
+// styling properties that don't take a color
+func (g *Generator) checkColors(props map[string]ast.Value) {
+	for _, name := range noColorProps {
+		if c, ok := g.constant(props[name]).(*ast.ColorValue); ok {
+			g.warnf(RuleColor, props[name].Pos().Line, "%s doesn't take a color, got %s", name, c.Value)
+		}
+	}
+}
+
+// mapProp returns a map property, following $references to [define]
+// constants holding the map
+func (g *Generator) mapProp(props map[string]ast.Value, name string) (*ast.MapValue, bool) {
+	m, ok := g.constant(props[name]).(*ast.MapValue)
+	return m, ok
+}
+
+// constant follows $references to the built-in variables or [define]
+// constants they name, or to their fallbacks, and returns the value they
+// end at, or what the now() or date() call there gives
+func (g *Generator) constant(val ast.Value) ast.Value {
+	seen := make(map[string]bool)
+	for {
+		ref, ok := val.(*ast.VariableRef)
+		if !ok || seen[ref.Name] {
+			break
+		}
+		seen[ref.Name] = true
+		constant, ok := g.vars[ref.Name]
+		if !ok {
+			constant, ok = g.defines[ref.Name]
+		}
+		if !ok {
+			constant = ref.Default
+		}
+		val = constant
+	}
+	if call, ok := val.(*ast.CallValue); ok {
+		return g.call(call)
+	}
+	return val
+}
+
+// labelled returns the element a $name labels: on the page, on another
+// page, or as $module.label in a particular included file
+func (g *Generator) labelled(name string) *ast.Element {
+	if elem, exists := g.labels[name]; exists {
+		return elem
+	}
+	if elem, exists := g.opts.ExternalLabels[name]; exists {
+		return elem
+	}
+	if i := strings.LastIndex(name, "."); i > 0 {
+		if elem, exists := g.modules[name[:i]][name[i+1:]]; exists {
+			return elem
+		}
+	}
+	return nil
+}
+
+// enter marks the constant or label a reference names as being resolved,
+// for leave to unmark. If it already is, the reference is part of a cycle
+// that would never finish resolving: enter warns, once per cycle, and
+// reports false.
+func (g *Generator) enter(ref *ast.VariableRef) bool {
+	for i, name := range g.resolving {
+		if name != ref.Name {
+			continue
+		}
+		cycle := append([]string{}, g.resolving[i:]...)
+		key := append([]string{}, cycle...)
+		sort.Strings(key)
+		if !g.cycles[strings.Join(key, " ")] {
+			g.cycles[strings.Join(key, " ")] = true
+			if len(cycle) == 1 {
+				g.warnf(RuleReference, ref.Token.Line, "$%s is defined in terms of itself", ref.Name)
+			} else {
+				g.warnf(RuleReference, ref.Token.Line, "$%s is defined in terms of itself, through $%s", ref.Name, strings.Join(cycle[1:], ", $"))
+			}
+		}
+		return false
+	}
+	g.resolving = append(g.resolving, ref.Name)
+	return true
+}
+
+// leave unmarks the name enter marked last
+func (g *Generator) leave() {
+	g.resolving = g.resolving[:len(g.resolving)-1]
 }
 
-// resolveValue converts any Value to a string
+// resolveValue converts any Value to a string. Past a limit it gives "",
+// and a string that would be longer than a page can be, like a constant
+// of doubled copies of another, is reported as one.
 func (g *Generator) resolveValue(val ast.Value) string {
+	if g.over {
+		return ""
+	}
 	switch v := val.(type) {
 	case *ast.StringValue:
 		return v.Value
 	case *ast.NumberValue:
 		return v.Value
+	case *ast.DimensionValue:
+		return v.Value + v.Unit
+	case *ast.ColorValue:
+		return v.Value
+	case *ast.DateValue:
+		return v.Format(g.dateFmt)
+	case *ast.BoolValue:
+		return strconv.FormatBool(v.Value)
 	case *ast.VariableRef:
-		// Resolve variable reference
-		if refElem, exists := g.labels[v.Name]; exists {
-			// Get the contains of the referenced element
+		// Built-in variables take precedence over constants, and constants
+		// over labels
+		if builtin, exists := g.vars[v.Name]; exists {
+			return g.resolveValue(builtin)
+		}
+		if constant, exists := g.defines[v.Name]; exists {
+			if !g.enter(v) {
+				return ""
+			}
+			defer g.leave()
+			return g.resolveValue(constant)
+		}
+		// A label stands for the contains of its element
+		if refElem := g.labelled(v.Name); refElem != nil {
+			if !g.enter(v) {
+				return ""
+			}
+			defer g.leave()
 			return g.getStringProp(refElem, "contains")
 		}
+		if v.Default != nil {
+			return g.resolveValue(v.Default)
+		}
 		return "$" + v.Name // Return as-is if not found
+	case *ast.TemplateValue:
+		var sb strings.Builder
+		for _, part := range v.Parts {
+			if sb.WriteString(g.resolveValue(part)); g.tooLong(sb.Len(), v.Token.Line) {
+				return ""
+			}
+		}
+		return sb.String()
+	case *ast.CallValue:
+		return g.resolveValue(g.call(v))
+	case *ast.PipeValue:
+		return g.pipe(v)
 	case *ast.ArrayValue:
 		// For arrays, join values with comma (for display purposes)
 		var parts []string
+		length := 0
 		for _, item := range v.Values {
 			parts = append(parts, g.resolveValue(item))
+			if length += len(parts[len(parts)-1]) + 2; g.tooLong(length, v.Token.Line) {
+				return ""
+			}
+		}
+		return strings.Join(parts, ", ")
+	case *ast.MapValue:
+		var parts []string
+		length := 0
+		for _, e := range v.Entries {
+			parts = append(parts, e.Name+": "+g.resolveValue(e.Value))
+			if length += len(parts[len(parts)-1]) + 2; g.tooLong(length, v.Token.Line) {
+				return ""
+			}
 		}
 		return strings.Join(parts, ", ")
 	}
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"fmt"
+	"lpml/ast"
+	"strings"
+)
+
+// assignIDs gives every labeled element and section a valid, unique HTML id.
+// Labels that aren't legal ids are slugified and repeats get a numeric
+// suffix in document order, so output is the same on every run.
+func (g *Generator) assignIDs(doc *ast.Document) {
+	used := make(map[string]bool)
+
+	assign := func(node ast.Node, props map[string]ast.Value) {
+		if label, ok := props["label"].(*ast.StringValue); ok {
+			id := label.Value
+			if !isValidID(id) {
+				id = slugify(id)
+				g.warnf(RuleID, label.Token.Line, "label %q is not a valid HTML id, using %q", label.Value, id)
+			}
+			if used[id] {
+				base := id
+				for n := 2; used[id]; n++ {
+					id = fmt.Sprintf("%s-%d", base, n)
+				}
+				g.warnf(RuleID, label.Token.Line, "duplicate label %q, using id %q", label.Value, id)
+			}
+			used[id] = true
+			g.ids[node] = id
+		}
+	}
+
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		elem, ok := node.(*ast.Element)
+		if !ok {
+			return
+		}
+
+		assign(elem, elem.Properties)
+		for _, child := range elem.Children {
+			visit(child)
+		}
+	}
+
+	for _, section := range doc.Sections {
+		assign(section, section.Properties)
+		for _, child := range section.Children {
+			visit(child)
+		}
+	}
+}
+
+// isValidID reports whether s can be used verbatim as an HTML id.
+// HTML only forbids whitespace, but we also keep ids free of characters
+// that need escaping in attributes, URLs, and CSS selectors.
+func isValidID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isIDChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// slugify lowercases s and collapses runs of invalid characters into "-"
+func slugify(s string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if isIDChar(r) {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+
+	slug := strings.TrimRight(sb.String(), "-")
+	if slug == "" {
+		return "id"
+	}
+	return slug
+}
+
+// isIDChar checks if r is allowed in a generated id
+func isIDChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		r == '-' || r == '_'
+}
@@ -0,0 +1,257 @@
+package generator
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lpml/ast"
+)
+
+// Image placeholders accepted by an image's placeholder property
+const (
+	PlaceholderColor = "color" // The image's average color
+	PlaceholderBlur  = "blur"  // A tiny copy of the image, scaled up blurry
+)
+
+// placeholderSize is the longest side of a blur placeholder, in pixels
+const placeholderSize = 16
+
+// ImageProcessor decodes the local images pages want placeholders or a
+// srcset of. The generator has none built in, so a program embedding it
+// doesn't carry image decoders it never uses; importing lpml/imaging
+// registers one for PNG, JPEG, and GIF.
+type ImageProcessor interface {
+	Decode(file string) (Image, error)
+}
+
+// Image is a local image an ImageProcessor decoded
+type Image interface {
+	// Size returns the image's width and height in pixels
+	Size() (width, height int)
+	// Color returns the image's average color as #rrggbb, ignoring
+	// transparency
+	Color() string
+	// Encode scales the image to width by height pixels, averaging the
+	// pixels each one covers, and encodes it as "png" or "jpeg"
+	Encode(width, height int, format string) ([]byte, error)
+}
+
+// imageProcessor decodes images for every generator, once registered
+var imageProcessor ImageProcessor
+
+// RegisterImageProcessor sets the ImageProcessor every generator decodes
+// images with, replacing any registered before. It's meant to be called
+// from the init function of the package providing it.
+func RegisterImageProcessor(p ImageProcessor) {
+	imageProcessor = p
+}
+
+// errNoImageProcessor is why images can't be read without an ImageProcessor
+var errNoImageProcessor = errors.New("image processing isn't built in")
+
+// imageLayout returns the width and height attributes and the CSS that
+// reserve an image's space before it loads, per its aspect and
+// placeholder properties. The image file is only read for a placeholder;
+// its own size is used when no aspect is given.
+func (g *Generator) imageLayout(elem *ast.Element, src string) (string, []string) {
+	aspect := g.getStringProp(elem, "aspect")
+	placeholder := g.getStringProp(elem, "placeholder")
+
+	var styles []string
+	if aspect != "" {
+		w, h, ok := parseAspect(aspect)
+		if !ok {
+			g.warnf(RuleImage, elem.Token.Line, "%s aspect %q isn't a ratio like \"16:9\", ignoring it", tagName(elem), aspect)
+		} else {
+			styles = append(styles, fmt.Sprintf("aspect-ratio: %s / %s", formatFloat(w), formatFloat(h)), "object-fit: cover")
+			if g.getProp(elem.Properties, "width") == "" && g.getProp(elem.Properties, "height") == "" {
+				styles = append(styles, "width: 100%", "height: auto")
+			}
+		}
+	}
+
+	if placeholder == "" {
+		return "", styles
+	}
+	if placeholder != PlaceholderColor && placeholder != PlaceholderBlur {
+		g.warnf(RuleImage, elem.Token.Line, "%s placeholder must be %q or %q, got %q", tagName(elem), PlaceholderColor, PlaceholderBlur, placeholder)
+		return "", styles
+	}
+
+	img, err := g.loadImage(src)
+	if err != nil {
+		g.warnf(RuleImage, elem.Token.Line, "%s no placeholder: %v", tagName(elem), err)
+		return "", styles
+	}
+
+	// Without an aspect, the image's own size reserves the space
+	var size string
+	w, h := img.Size()
+	if aspect == "" {
+		size = attr("width", strconv.Itoa(w)) + attr("height", strconv.Itoa(h))
+	}
+
+	switch placeholder {
+	case PlaceholderColor:
+		styles = append(styles, "background-color: "+img.Color())
+	case PlaceholderBlur:
+		blurW, blurH := shrink(w, h, placeholderSize)
+		data, err := img.Encode(blurW, blurH, "png")
+		if err != nil {
+			g.warnf(RuleImage, elem.Token.Line, "%s no placeholder: %v", tagName(elem), err)
+			return size, styles
+		}
+		uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+		styles = append(styles, fmt.Sprintf("background-image: url('%s')", uri), "background-size: cover")
+	}
+	return size, styles
+}
+
+// imageSrcset writes a resized copy of a local image for each width in
+// its sizes property and returns the srcset listing them with the
+// original. Copies are never wider than the original, and sit next to it
+// named like photo-480w.jpg. It returns "" without a sizes property.
+func (g *Generator) imageSrcset(elem *ast.Element, src string) string {
+	val, ok := elem.Properties["sizes"]
+	if !ok {
+		return ""
+	}
+	arr, ok := val.(*ast.ArrayValue)
+	if !ok {
+		g.warnf(RuleImage, elem.Token.Line, "%s sizes must be an array of widths like [480, 960]", tagName(elem))
+		return ""
+	}
+
+	img, err := g.loadImage(src)
+	if err != nil {
+		g.warnf(RuleImage, elem.Token.Line, "%s no srcset: %v", tagName(elem), err)
+		return ""
+	}
+	imgW, imgH := img.Size()
+
+	// Copies go next to the original, as a page-relative file and a URL
+	// written the way src is
+	url := src
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	ext := strings.ToLower(path.Ext(url))
+	stem := strings.TrimSuffix(url, path.Ext(url))
+	format := "jpeg"
+	if ext != ".jpg" && ext != ".jpeg" {
+		ext, format = ".png", "png" // GIFs are resized to PNG
+	}
+	fileStem, err := filepath.Rel(filepath.Dir(g.opts.SourceFile), strings.TrimSuffix(g.localPath(url), filepath.Ext(url)))
+	if err != nil {
+		g.warnf(RuleImage, elem.Token.Line, "%s no srcset: %v", tagName(elem), err)
+		return ""
+	}
+
+	var entries []string
+	for _, item := range arr.Values {
+		width, err := strconv.Atoi(g.resolveValue(item))
+		if err != nil || width <= 0 {
+			g.warnf(RuleImage, elem.Token.Line, "%s sizes: %q isn't a width in pixels", tagName(elem), g.resolveValue(item))
+			continue
+		}
+		if width >= imgW {
+			continue
+		}
+
+		suffix := fmt.Sprintf("-%dw%s", width, ext)
+		name := filepath.ToSlash(fileStem) + suffix
+		entries = append(entries, fmt.Sprintf("%s%s %dw", stem, suffix, width))
+		if g.hasFile(name) {
+			continue
+		}
+
+		data, err := img.Encode(width, max(1, imgH*width/imgW), format)
+		if err != nil {
+			g.warnf(RuleImage, elem.Token.Line, "%s resizing to %dpx: %v", tagName(elem), width, err)
+			continue
+		}
+		g.addFile(name, data)
+	}
+
+	if len(entries) == 0 {
+		return ""
+	}
+	return strings.Join(append(entries, fmt.Sprintf("%s %dw", src, imgW)), ", ")
+}
+
+// localPath returns the file a local src, like an image's, refers to:
+// relative to the page, or to Options.RootDir if it starts with "/". It
+// returns "" for URLs and inline data.
+func (g *Generator) localPath(src string) string {
+	if src == "" || strings.HasPrefix(src, "//") || strings.Contains(src, "://") || strings.HasPrefix(src, "data:") {
+		return ""
+	}
+	if i := strings.IndexAny(src, "?#"); i >= 0 {
+		src = src[:i]
+	}
+
+	pageDir := filepath.Dir(g.opts.SourceFile)
+	if strings.HasPrefix(src, "/") {
+		root := g.opts.RootDir
+		if root == "" {
+			root = pageDir
+		}
+		return filepath.Join(root, filepath.FromSlash(src))
+	}
+	return filepath.Join(pageDir, filepath.FromSlash(src))
+}
+
+// loadImage decodes a local image with the registered ImageProcessor
+func (g *Generator) loadImage(src string) (Image, error) {
+	file := g.localPath(src)
+	if file == "" {
+		return nil, fmt.Errorf("%q isn't a local image", src)
+	}
+	if imageProcessor == nil {
+		return nil, errNoImageProcessor
+	}
+	return imageProcessor.Decode(file)
+}
+
+// shrink returns the size of a w by h image scaled down so its longest
+// side is at most maxSide pixels
+func shrink(w, h, maxSide int) (int, int) {
+	if w == 0 || h == 0 {
+		return 1, 1
+	}
+	outW, outH := w, h
+	if w >= h && w > maxSide {
+		outW, outH = maxSide, max(1, h*maxSide/w)
+	} else if h > w && h > maxSide {
+		outW, outH = max(1, w*maxSide/h), maxSide
+	}
+	return outW, outH
+}
+
+// parseAspect reads an aspect ratio written as "16:9", "16/9", or "1.5"
+func parseAspect(s string) (w, h float64, ok bool) {
+	wText, hText, found := strings.Cut(s, ":")
+	if !found {
+		wText, hText, found = strings.Cut(s, "/")
+	}
+	if !found {
+		hText = "1"
+	}
+
+	w, errW := strconv.ParseFloat(strings.TrimSpace(wText), 64)
+	h, errH := strconv.ParseFloat(strings.TrimSpace(hText), 64)
+	if errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return 0, 0, false
+	}
+	return w, h, true
+}
+
+// formatFloat formats a number without trailing zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
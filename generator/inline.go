@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"lpml/ast"
+)
+
+// inlineImage returns a local image's src as a data URI when the page is
+// self-contained, and src unchanged otherwise
+func (g *Generator) inlineImage(elem *ast.Element, src string) string {
+	if !g.opts.SelfContained {
+		return src
+	}
+	file := g.localPath(src)
+	if file == "" {
+		return src
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		g.warnf(RuleImage, elem.Token.Line, "%s not inlined: %v", tagName(elem), err)
+		return src
+	}
+	return dataURI(file, data)
+}
+
+// inlineFiles rewrites links to the page's extra files into data URIs and
+// drops the files, so a self-contained page needs nothing written next to
+// it. Download links keep the file's name.
+func (g *Generator) inlineFiles(html string) string {
+	for _, f := range g.files {
+		uri := attr("href", dataURI(f.Name, f.Data))
+		html = strings.ReplaceAll(html, attr("href", f.Name)+" download>", uri+attr("download", path.Base(f.Name))+">")
+		html = strings.ReplaceAll(html, attr("href", f.Name), uri)
+	}
+	g.files = nil
+	return html
+}
+
+// dataURI encodes data as a base64 data URI, typed by name's extension or
+// else by sniffing the data
+func dataURI(name string, data []byte) string {
+	mediaType := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	switch {
+	case strings.EqualFold(path.Ext(name), ".ics"):
+		mediaType = "text/calendar"
+	case strings.EqualFold(path.Ext(name), ".vcf"):
+		mediaType = "text/vcard"
+	case mediaType == "":
+		mediaType = http.DetectContentType(data)
+	}
+	return "data:" + strings.ReplaceAll(mediaType, " ", "") + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// embedMarker stands in for a linked file's contents in a generated page
+// until the page is written
+const embedMarker = "\x00lpml-linked-file\x00"
+
+// chunkSize is how much of a linked file is read and escaped at a time
+const chunkSize = 32 * 1024
+
+// embed is a file a code block copies in with linked_file
+type embed struct {
+	path string // The file, resolved like an image src
+	line int    // The code block's line, for errors
+}
+
+// Page is a generated page. The files code blocks name with linked_file
+// are only read as the page is written, a chunk at a time, so a page
+// embedding a multi-megabyte file takes no more memory than a small one.
+type Page struct {
+	html   string  // The page, with embedMarker where each linked file goes
+	embeds []embed // The linked files, in the order of their markers
+	diags  []Diagnostic
+	files  []File
+}
+
+// WriteTo writes the page to w with each linked file copied in, HTML
+// escaped
+func (p *Page) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	rest := p.html
+	for _, e := range p.embeds {
+		i := strings.Index(rest, embedMarker)
+		if i < 0 {
+			break
+		}
+		n, err := io.WriteString(w, rest[:i])
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		copied, err := copyEscaped(w, e.path)
+		total += copied
+		if err != nil {
+			return total, fmt.Errorf("line %d: linked_file: %w", e.line, err)
+		}
+		rest = rest[i+len(embedMarker):]
+	}
+	n, err := io.WriteString(w, rest)
+	return total + int64(n), err
+}
+
+// embedFile returns the marker for a code block's linked_file, which
+// WriteTo replaces with the file's contents. A file that can't be read is
+// left out with a warning.
+func (g *Generator) embedFile(name string, line int) string {
+	path := g.localPath(name)
+	if path == "" {
+		g.warnf(RuleFile, line, "linked_file %q isn't a local file", name)
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		g.warnf(RuleFile, line, "linked_file not included: %v", err)
+		return ""
+	}
+	g.embeds = append(g.embeds, embed{path: path, line: line})
+	return embedMarker
+}
+
+// copyEscaped copies the file at path to w with HTML special characters
+// escaped, a chunk at a time. They're all single bytes, so escaping each
+// chunk on its own gives the same result as escaping the whole file.
+func copyEscaped(w io.Writer, path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var total int64
+	buf := make([]byte, chunkSize)
+	for {
+		read, err := f.Read(buf)
+		if read > 0 {
+			n, werr := io.WriteString(w, escapeHTML(string(buf[:read])))
+			total += int64(n)
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package generator
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"lpml/ast"
+)
+
+// numberLocale is how a locale writes numbers
+type numberLocale struct {
+	decimal  string // Between the whole number and its fraction
+	group    string // Between groups of digits
+	indian   bool   // Groups digits in twos above the thousands, as in 12,34,567
+	currency string // Where the amount, n, and the currency's symbol, ¤, go
+	percent  string // Where the number, n, and the %, go
+}
+
+// numberLocales are the locales number(), currency(), and percent() know,
+// by language tag or language alone, in lower case
+var numberLocales = map[string]numberLocale{
+	"en":    {".", ",", false, "¤n", "n%"},
+	"en-in": {".", ",", true, "¤n", "n%"},
+	"hi":    {".", ",", true, "¤n", "n%"},
+	"de":    {",", ".", false, "n\u00a0¤", "n\u00a0%"},
+	"de-ch": {".", "’", false, "¤\u00a0n", "n%"},
+	"fr":    {",", "\u202f", false, "n\u00a0¤", "n\u202f%"},
+	"es":    {",", ".", false, "n\u00a0¤", "n\u00a0%"},
+	"it":    {",", ".", false, "n\u00a0¤", "n%"},
+	"nl":    {",", ".", false, "¤\u00a0n", "n%"},
+	"pt":    {",", ".", false, "¤\u00a0n", "n%"},
+	"pl":    {",", "\u00a0", false, "n\u00a0¤", "n%"},
+	"ru":    {",", "\u00a0", false, "n\u00a0¤", "n\u00a0%"},
+	"sv":    {",", "\u00a0", false, "n\u00a0¤", "n\u00a0%"},
+	"ja":    {".", ",", false, "¤n", "n%"},
+	"zh":    {".", ",", false, "¤n", "n%"},
+}
+
+// currency is how currency() writes amounts of a currency
+type currency struct {
+	symbol   string
+	decimals int
+}
+
+// currencies are the currencies currency() knows, by ISO 4217 code. Any
+// other code is written as it is, with two decimal places.
+var currencies = map[string]currency{
+	"AUD": {"A$", 2},
+	"BRL": {"R$", 2},
+	"CAD": {"CA$", 2},
+	"CHF": {"CHF", 2},
+	"CNY": {"¥", 2},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"INR": {"₹", 2},
+	"JPY": {"¥", 0},
+	"KRW": {"₩", 0},
+	"MXN": {"MX$", 2},
+	"PLN": {"zł", 2},
+	"RUB": {"₽", 2},
+	"SEK": {"kr", 2},
+	"USD": {"$", 2},
+}
+
+// numberCall works out a number(), currency(), or percent() call: the
+// number it's given, unquoted or in a string, written the way its locale
+// argument, or else the page's [meta] lang, writes numbers. number()
+// keeps the decimal places the number is written with unless given how
+// many to round to; currency() writes the symbol and decimal places of a
+// currency code like "EUR"; percent() writes a fraction, like 0.25, as
+// 25%, with no decimal places unless given some.
+func (g *Generator) numberCall(call *ast.CallValue) ast.Value {
+	args := call.Args
+	if len(args) == 0 {
+		return ast.NewString("") // The parser reports the missing number
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return strings.TrimSpace(g.resolveValue(args[i]))
+		}
+		return ""
+	}
+	text := arg(0)
+	// ParseFloat also reads NaN, Inf, and hex floats like 0x1p4, which
+	// aren't numbers to be written out
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) || strings.ContainsAny(text, "xX") {
+		g.warnf(RuleNumber, call.Token.Line, "%s() needs a number, got %q", call.Name, text)
+		return ast.NewString(text)
+	}
+	loc := g.numberLocale(arg(2), call)
+
+	decimals := func(fallback int) int {
+		if arg(1) == "" {
+			return fallback
+		}
+		d, err := strconv.Atoi(arg(1))
+		if err != nil || d < 0 {
+			g.warnf(RuleNumber, call.Token.Line, "%s() decimal places must be a whole number, like 2, got %q", call.Name, arg(1))
+			return fallback
+		}
+		return d
+	}
+
+	var digits, pattern, symbol string
+	var negative bool
+	switch call.Name {
+	case "currency":
+		code := strings.ToUpper(arg(1))
+		cur, known := currencies[code]
+		if !known {
+			cur = currency{code, 2}
+		}
+		digits, negative = loc.digits(n, cur.decimals)
+		pattern, symbol = loc.currency, cur.symbol
+		if r, _ := utf8.DecodeLastRuneInString(symbol); pattern == "¤n" && unicode.IsLetter(r) {
+			pattern = "¤\u00a0n" // CHF 5.00, not CHF5.00
+		}
+	case "percent":
+		digits, negative = loc.digits(n*100, decimals(0))
+		pattern = loc.percent
+	default:
+		places := -1 // As written
+		if _, frac, ok := strings.Cut(text, "."); ok && !strings.ContainsAny(text, "eE") {
+			places = len(frac)
+		}
+		digits, negative = loc.digits(n, decimals(places))
+		pattern = "n"
+	}
+
+	s := strings.Replace(strings.Replace(pattern, "n", digits, 1), "¤", symbol, 1)
+	if negative {
+		s = "-" + s
+	}
+	return ast.NewString(s)
+}
+
+// numberLocale returns how the locale named, or else the page's lang,
+// writes numbers: the way numberLocales gives for its language tag, or
+// its language alone, or the English way if it knows neither
+func (g *Generator) numberLocale(name string, call *ast.CallValue) numberLocale {
+	explicit := name != ""
+	if !explicit {
+		name = g.lang
+	}
+	tag := strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	if loc, ok := numberLocales[tag]; ok {
+		return loc
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	if loc, ok := numberLocales[lang]; ok {
+		return loc
+	}
+	if explicit {
+		g.warnf(RuleNumber, call.Token.Line, "%s() doesn't know locale %q, so writes numbers the English way", call.Name, name)
+	}
+	return numberLocales["en"]
+}
+
+// digits writes n without its sign, rounded to decimals places, or as few
+// as it needs if decimals is -1, with the locale's separators. negative
+// reports whether it was below zero once rounded.
+func (loc numberLocale) digits(n float64, decimals int) (s string, negative bool) {
+	s = strconv.FormatFloat(n, 'f', decimals, 64)
+	s, negative = strings.CutPrefix(s, "-")
+	whole, frac, _ := strings.Cut(s, ".")
+	if strings.Trim(whole+frac, "0") == "" {
+		negative = false // -0.001 rounds to 0.00, not -0.00
+	}
+
+	var groups []string
+	size := 3
+	for len(whole) > size {
+		groups = append([]string{whole[len(whole)-size:]}, groups...)
+		whole = whole[:len(whole)-size]
+		if loc.indian {
+			size = 2
+		}
+	}
+	s = strings.Join(append([]string{whole}, groups...), loc.group)
+	if frac != "" {
+		s += loc.decimal + frac
+	}
+	return s, negative
+}
@@ -0,0 +1,36 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"lpml/ast"
+)
+
+// PageLink is another page of the site, as [pagenav] links to it
+type PageLink struct {
+	Title string // The link text
+	Href  string // The page's URL, relative to the page linking to it
+}
+
+// generatePageNav generates a [pagenav] as a <nav> linking to
+// Options.Prev and Options.Next. A page with neither, like one built on
+// its own, gets nothing.
+func (g *Generator) generatePageNav(elem *ast.Element, indent string) string {
+	if g.opts.Prev == nil && g.opts.Next == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	styles := append([]string{"display: flex", "justify-content: space-between", "gap: 16px"}, g.buildStyles(elem.Properties)...)
+	sb.WriteString(fmt.Sprintf("%s<nav%s%s%s aria-label=\"Previous and next pages\">\n",
+		indent, g.buildIDAttr(elem, elem.Properties), g.buildClassAttr(elem.Properties, "pagenav"), styleAttr(styles)))
+	if prev := g.opts.Prev; prev != nil {
+		sb.WriteString(fmt.Sprintf("%s  <a class=\"pagenav-prev\"%s rel=\"prev\">&larr; %s</a>\n", indent, attr("href", prev.Href), escapeHTML(prev.Title)))
+	}
+	if next := g.opts.Next; next != nil {
+		sb.WriteString(fmt.Sprintf("%s  <a class=\"pagenav-next\"%s rel=\"next\" style=\"margin-left: auto;\">%s &rarr;</a>\n", indent, attr("href", next.Href), escapeHTML(next.Title)))
+	}
+	sb.WriteString(indent + "</nav>\n")
+	return sb.String()
+}
@@ -0,0 +1,197 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"lpml/ast"
+)
+
+// defaultPalette are the base colors every page can name shades of, like
+// "gray-700"; a page's own palette adds to them and wins over them
+var defaultPalette = map[string]string{
+	"gray":   "#6b7280",
+	"red":    "#ef4444",
+	"orange": "#f97316",
+	"amber":  "#f59e0b",
+	"yellow": "#eab308",
+	"green":  "#22c55e",
+	"teal":   "#14b8a6",
+	"blue":   "#3b82f6",
+	"indigo": "#6366f1",
+	"purple": "#a855f7",
+	"pink":   "#ec4899",
+}
+
+// shadeName matches a palette shade like primary-300: a base color's
+// name, and the shade from 50, nearly white, to 950, nearly black
+var shadeName = regexp.MustCompile(`^([a-z][a-z0-9_]*)-([0-9]+)$`)
+
+// shadeWord matches the shades in a longer value, like a gradient
+var shadeWord = regexp.MustCompile(`\b[a-z][a-z0-9_]*-[0-9]+\b`)
+
+// cssLiteral matches the url()s and quoted strings in a value, whose
+// words aren't shades, like the file name in url(icons/blue-500.svg)
+var cssLiteral = regexp.MustCompile(`(?i)url\((?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|[^)])*\)|"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+
+// setPalette gathers the base colors the page can name shades of: the
+// defaults, the project's from Options.Palette, then the page's own from
+// its [meta] palette map, warning about those that aren't colors
+func (g *Generator) setPalette(doc *ast.Document) {
+	g.palette = make(map[string]string, len(defaultPalette))
+	for name, base := range defaultPalette {
+		g.palette[name] = base
+	}
+	for name, base := range g.opts.Palette {
+		g.palette[name] = base
+	}
+	if doc.Meta["palette"] == nil {
+		return
+	}
+	m, ok := g.mapProp(doc.Meta, "palette")
+	if !ok {
+		g.warnf(RuleColor, doc.Meta["palette"].Pos().Line, "palette must be a map of base colors, like { primary = #3366ff }")
+		return
+	}
+	for _, e := range m.Entries {
+		base := strings.TrimSpace(g.resolveValue(e.Value))
+		if _, _, _, _, ok := ast.NewColor(base).RGBA(); !ok {
+			g.warnf(RuleColor, e.Value.Pos().Line, "palette color %s is %q, not a hex, rgb(), or hsl() color", e.Name, base)
+			continue
+		}
+		g.palette[e.Name] = base
+	}
+}
+
+// shade returns the color a palette name gives: a base color alone, like
+// "primary", unless it's a color CSS already names, like "red", or one of
+// its shades, like "primary-300" or "red-300". Shades under 500 are mixed
+// with white, 20% more for each 100 below it, and shades over it with
+// black, 15% more for each 100 above. named is false if name isn't a
+// palette name; err says why a shade of one can't be made.
+func (g *Generator) shade(name string) (color string, named bool, err error) {
+	if base, ok := g.palette[name]; ok && !cssColorNames[name] {
+		return base, true, nil
+	}
+	m := shadeName.FindStringSubmatch(name)
+	if m == nil {
+		return "", false, nil
+	}
+	base, ok := g.palette[m[1]]
+	if !ok {
+		return "", true, fmt.Errorf("the palette has no %s; add it to [meta] palette, or [palette] in lpml.toml", m[1])
+	}
+	n, _ := strconv.Atoi(m[2])
+	if n < 50 || n > 950 || n%50 != 0 {
+		return "", true, fmt.Errorf("shades run from %s-50 to %s-950 in steps of 50", m[1], m[1])
+	}
+
+	r, gr, b, a, _ := ast.NewColor(base).RGBA()
+	mix := func(c uint8) uint8 {
+		if n < 500 {
+			w := float64(500-n) / 100 * 0.2
+			return uint8(math.Round(float64(c) + (255-float64(c))*w))
+		}
+		w := float64(n-500) / 100 * 0.15
+		return uint8(math.Round(float64(c) * (1 - w)))
+	}
+	color = fmt.Sprintf("#%02x%02x%02x", mix(r), mix(gr), mix(b))
+	if a < 1 {
+		color += fmt.Sprintf("%02x", uint8(math.Round(a*255)))
+	}
+	return color, true, nil
+}
+
+// resolveColor returns the CSS for the color property name is set to:
+// a palette shade as the color it is, and anything else as written,
+// warning about values that aren't colors, like "#ff660"
+func (g *Generator) resolveColor(props map[string]ast.Value, name, value string) string {
+	line := props[name].Pos().Line
+	color, named, err := g.shade(value)
+	switch {
+	case err != nil:
+		g.warnf(RuleColor, line, "%s %q isn't a color: %v", name, value, err)
+		return value
+	case named:
+		return color
+	case !isCSSColor(value):
+		g.warnf(RuleColor, line, "%s %q isn't a color; write one like \"navy\", \"#336699\", or a palette shade like \"blue-300\"", name, value)
+	}
+	return value
+}
+
+// resolveShades returns a value that may hold colors among other things,
+// like a gradient or a border, with the palette shades in it replaced by
+// the colors they are. What's in url()s and quotes is left as it is.
+func (g *Generator) resolveShades(value string) string {
+	var sb strings.Builder
+	last := 0
+	for _, span := range cssLiteral.FindAllStringIndex(value, -1) {
+		sb.WriteString(shadeWord.ReplaceAllStringFunc(value[last:span[0]], g.paletteColor))
+		sb.WriteString(value[span[0]:span[1]])
+		last = span[1]
+	}
+	sb.WriteString(shadeWord.ReplaceAllStringFunc(value[last:], g.paletteColor))
+	return sb.String()
+}
+
+// paletteColor returns the color a palette name gives, or value as it is
+// if it isn't one
+func (g *Generator) paletteColor(value string) string {
+	if color, named, err := g.shade(value); named && err == nil {
+		return color
+	}
+	return value
+}
+
+// isCSSColor reports whether s is a color CSS knows: a hex or rgb() or
+// hsl() color that can be read, a named color or keyword, or one of its
+// other color functions, like var() or oklch(), taken on trust
+func isCSSColor(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || cssColorNames[s] {
+		return true
+	}
+	name, _, isFunc := strings.Cut(s, "(")
+	if strings.HasPrefix(s, "#") || isFunc && colorFuncs[name] {
+		_, _, _, _, ok := ast.NewColor(s).RGBA()
+		return ok
+	}
+	return isFunc && strings.HasSuffix(s, ")")
+}
+
+// colorFuncs are the CSS color functions ast.ColorValue.RGBA reads
+var colorFuncs = map[string]bool{"rgb": true, "rgba": true, "hsl": true, "hsla": true}
+
+// cssColorNames are the color keywords and named colors of CSS
+var cssColorNames = map[string]bool{
+	"currentcolor": true, "transparent": true, "inherit": true, "initial": true, "unset": true, "revert": true,
+	"aliceblue": true, "antiquewhite": true, "aqua": true, "aquamarine": true, "azure": true, "beige": true,
+	"bisque": true, "black": true, "blanchedalmond": true, "blue": true, "blueviolet": true, "brown": true,
+	"burlywood": true, "cadetblue": true, "chartreuse": true, "chocolate": true, "coral": true, "cornflowerblue": true,
+	"cornsilk": true, "crimson": true, "cyan": true, "darkblue": true, "darkcyan": true, "darkgoldenrod": true,
+	"darkgray": true, "darkgreen": true, "darkgrey": true, "darkkhaki": true, "darkmagenta": true, "darkolivegreen": true,
+	"darkorange": true, "darkorchid": true, "darkred": true, "darksalmon": true, "darkseagreen": true, "darkslateblue": true,
+	"darkslategray": true, "darkslategrey": true, "darkturquoise": true, "darkviolet": true, "deeppink": true, "deepskyblue": true,
+	"dimgray": true, "dimgrey": true, "dodgerblue": true, "firebrick": true, "floralwhite": true, "forestgreen": true,
+	"fuchsia": true, "gainsboro": true, "ghostwhite": true, "gold": true, "goldenrod": true, "gray": true,
+	"green": true, "greenyellow": true, "grey": true, "honeydew": true, "hotpink": true, "indianred": true,
+	"indigo": true, "ivory": true, "khaki": true, "lavender": true, "lavenderblush": true, "lawngreen": true,
+	"lemonchiffon": true, "lightblue": true, "lightcoral": true, "lightcyan": true, "lightgoldenrodyellow": true, "lightgray": true,
+	"lightgreen": true, "lightgrey": true, "lightpink": true, "lightsalmon": true, "lightseagreen": true, "lightskyblue": true,
+	"lightslategray": true, "lightslategrey": true, "lightsteelblue": true, "lightyellow": true, "lime": true, "limegreen": true,
+	"linen": true, "magenta": true, "maroon": true, "mediumaquamarine": true, "mediumblue": true, "mediumorchid": true,
+	"mediumpurple": true, "mediumseagreen": true, "mediumslateblue": true, "mediumspringgreen": true, "mediumturquoise": true, "mediumvioletred": true,
+	"midnightblue": true, "mintcream": true, "mistyrose": true, "moccasin": true, "navajowhite": true, "navy": true,
+	"oldlace": true, "olive": true, "olivedrab": true, "orange": true, "orangered": true, "orchid": true,
+	"palegoldenrod": true, "palegreen": true, "paleturquoise": true, "palevioletred": true, "papayawhip": true, "peachpuff": true,
+	"peru": true, "pink": true, "plum": true, "powderblue": true, "purple": true, "rebeccapurple": true,
+	"red": true, "rosybrown": true, "royalblue": true, "saddlebrown": true, "salmon": true, "sandybrown": true,
+	"seagreen": true, "seashell": true, "sienna": true, "silver": true, "skyblue": true, "slateblue": true,
+	"slategray": true, "slategrey": true, "snow": true, "springgreen": true, "steelblue": true, "tan": true,
+	"teal": true, "thistle": true, "tomato": true, "turquoise": true, "violet": true, "wheat": true,
+	"white": true, "whitesmoke": true, "yellow": true, "yellowgreen": true,
+}
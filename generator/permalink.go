@@ -0,0 +1,29 @@
+package generator
+
+import "fmt"
+
+// permalinkCSS shows a heading's permalink only while the heading is
+// hovered or the link has focus, and leaves it out of print
+const permalinkCSS = `.permalink { margin-left: 0.3em; color: inherit; text-decoration: none; opacity: 0; }
+:is(h1, h2, h3, h4, h5, h6):hover > .permalink, .permalink:focus { opacity: 0.5; }
+@media print { .permalink { display: none; } }
+`
+
+// permalink returns the ¶ link added to a heading with an id when
+// Options.Permalinks is set, or ""
+func (g *Generator) permalink(id string) string {
+	if !g.opts.Permalinks || id == "" {
+		return ""
+	}
+	return fmt.Sprintf("<a class=\"permalink\"%s aria-label=\"Link to this heading\">¶</a>", attr("href", "#"+id))
+}
+
+// permalinkStyles returns the stylesheet for heading permalinks. A custom
+// theme styles .permalink itself, and with no base stylesheet there's
+// nothing to add to.
+func (g *Generator) permalinkStyles() string {
+	if !g.opts.Permalinks || g.opts.BaseCSS == BaseCSSCustom || g.opts.BaseCSS == BaseCSSNone {
+		return ""
+	}
+	return permalinkCSS
+}
@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"lpml/ast"
+)
+
+// Output targets for Options.Target
+const (
+	TargetWeb      = "web"       // A page for the screen
+	TargetPrintPDF = "print-pdf" // Paged media for printing to PDF from the browser
+)
+
+// Page defaults for the print-pdf target, overridden by page_size and
+// page_margin in [meta]
+const (
+	defaultPageSize   = "A4"
+	defaultPageMargin = "2cm"
+)
+
+// printRules keep headings with what follows them and figures whole
+// across page breaks
+const printRules = `h1, h2, h3, h4, h5, h6 { break-after: avoid; }
+img, table, pre, figure { break-inside: avoid; }
+p, li { orphans: 3; widows: 3; }
+`
+
+// printCSS returns the paged-media stylesheet for the print-pdf target:
+// the page size and margins, page numbers in the footer unless [meta] sets
+// page_numbers = false, and break rules. It returns "" for other targets.
+func (g *Generator) printCSS(doc *ast.Document) string {
+	if g.opts.Target != TargetPrintPDF {
+		return ""
+	}
+
+	size, margin := defaultPageSize, defaultPageMargin
+	if val, ok := doc.Meta["page_size"]; ok {
+		size = g.resolveValue(val)
+	}
+	if val, ok := doc.Meta["page_margin"]; ok {
+		margin = g.resolveValue(val)
+	}
+	numbers := true
+	if val, ok := doc.Meta["page_numbers"]; ok {
+		numbers = g.resolveValue(val) != "false"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("@page {\n")
+	sb.WriteString(fmt.Sprintf("  size: %s;\n", size))
+	sb.WriteString(fmt.Sprintf("  margin: %s;\n", margin))
+	if numbers {
+		sb.WriteString("  @bottom-center {\n")
+		sb.WriteString("    content: counter(page) \" / \" counter(pages);\n")
+		sb.WriteString("  }\n")
+	}
+	sb.WriteString("}\n")
+	sb.WriteString(printRules)
+	return sb.String()
+}
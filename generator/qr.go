@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+
+	"lpml/ast"
+	"lpml/qr"
+)
+
+// maxQRScale is the most pixels a side of each module of a QR code takes
+const maxQRScale = 20
+
+// generateQR generates a [qr]: a QR code image of its data, written as a
+// PNG next to the page
+func (g *Generator) generateQR(elem *ast.Element, indent string) string {
+	data := g.getStringProp(elem, "data")
+	if data == "" {
+		g.warnf(RuleProperty, elem.Token.Line, "[qr] needs data to encode, like data = \"https://example.com\"")
+		return ""
+	}
+	alt := g.getStringProp(elem, "alt")
+	if alt == "" {
+		alt = "QR code for " + data
+	}
+	img := g.qrImage(elem, "qr", []byte(data), g.fileBase(elem, "", "qr"), alt)
+	if img == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s<img%s%s>\n", indent, img, g.buildCommonAttrs(elem))
+}
+
+// qrImage encodes data as a QR code and returns the src, size, and alt
+// attributes of an image of it. The PNG is an extra file named after
+// base, or a data URI on a self-contained page. It returns "" and warns
+// if data is too long for a QR code.
+func (g *Generator) qrImage(elem *ast.Element, tag string, data []byte, base, alt string) string {
+	code, err := qr.Encode(data)
+	if err != nil {
+		g.warnf(RuleProperty, elem.Token.Line, "[%s] has too much to fit in a QR code: %d bytes", tag, len(data))
+		return ""
+	}
+	scale := g.wholeNumber(elem, tag, "scale", 4)
+	if scale > maxQRScale {
+		g.warnf(RuleProperty, elem.Token.Line, "[%s] scale is at most %d, got %d", tag, maxQRScale, scale)
+		scale = maxQRScale
+	}
+
+	png := code.PNG(scale)
+	name := g.fileName(base, ".png")
+	src := name
+	if g.opts.SelfContained {
+		src = dataURI(name, png)
+	} else {
+		g.addFile(name, png)
+	}
+	side := strconv.Itoa(code.Width(scale))
+	return attr("src", src) + attr("width", side) + attr("height", side) + attr("alt", alt)
+}
@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lpml/ast"
+)
+
+// CollectionPage is a page of the project as [query-start] finds it
+type CollectionPage struct {
+	Href    string               // The page's URL, relative to the page querying it
+	Dir     string               // Its source directory from the project root, slash separated; "" at the root
+	Title   string               // What links to it call it
+	Excerpt string               // Its summary
+	Meta    map[string]ast.Value // Its [meta] properties
+}
+
+// queryAs returns the name a [query-start] binds each page to: its as
+// property, "item" by default
+func queryAs(elem *ast.Element) string {
+	if as, ok := ast.StringOf(elem.Properties["as"]); ok && as != "" {
+		return as
+	}
+	return "item"
+}
+
+// expandQuery returns a copy of a [query-start]'s children for each page
+// it finds. In each copy $as.title, $as.url, $as.excerpt, and $as.index,
+// and $as.name for each of the page's [meta] properties, are that page's.
+func (g *Generator) expandQuery(elem *ast.Element) []ast.Node {
+	as := queryAs(elem)
+	var out []ast.Node
+	for i, page := range g.queryResults(elem) {
+		bound := make(map[string]ast.Value, len(page.Meta)+4)
+		for name, val := range page.Meta {
+			bound[as+"."+name] = val
+		}
+		bound[as+".title"] = &ast.StringValue{Token: elem.Token, Value: page.Title}
+		bound[as+".url"] = &ast.StringValue{Token: elem.Token, Value: page.Href}
+		bound[as+".excerpt"] = &ast.StringValue{Token: elem.Token, Value: page.Excerpt}
+		bound[as+".index"] = &ast.NumberValue{Token: elem.Token, Value: strconv.Itoa(i + 1)}
+		out = append(out, substituteNodes(elem.Children, bound)...)
+	}
+	return out
+}
+
+// queryResults returns the Options.Collection pages a [query-start]
+// finds: those in its from directory or below it, carrying its tagged tag
+// in their [meta] tags, in the order of the [meta] property its sort
+// names, reversed if that starts with -, and at most limit of them. Pages
+// without the sort property come last.
+func (g *Generator) queryResults(elem *ast.Element) []CollectionPage {
+	from := path.Clean(strings.Trim(g.getProp(elem.Properties, "from"), "/"))
+	tag := strings.TrimSpace(g.getProp(elem.Properties, "tagged"))
+
+	var pages []CollectionPage
+	for _, page := range g.opts.Collection {
+		if from != "." && page.Dir != from && !strings.HasPrefix(page.Dir, from+"/") {
+			continue
+		}
+		if tag != "" && !hasTag(page.Meta["tags"], tag) {
+			continue
+		}
+		pages = append(pages, page)
+	}
+
+	if key := g.getProp(elem.Properties, "sort"); key != "" {
+		key, desc := strings.CutPrefix(key, "-")
+		sortKey := func(page CollectionPage) ast.Value {
+			if key == "title" {
+				return ast.NewString(page.Title)
+			}
+			return page.Meta[key]
+		}
+		sort.SliceStable(pages, func(i, j int) bool {
+			a, b := sortKey(pages[i]), sortKey(pages[j])
+			if a == nil || b == nil {
+				return a != nil
+			}
+			if desc {
+				return compareValues(b, a) < 0
+			}
+			return compareValues(a, b) < 0
+		})
+	}
+
+	if _, ok := elem.Properties["limit"]; ok {
+		limit, err := strconv.Atoi(g.getProp(elem.Properties, "limit"))
+		switch {
+		case err != nil || limit < 0:
+			g.warnf(RuleProperty, elem.Token.Line, "[query-start] limit must be a whole number, like limit = 5")
+		case limit < len(pages):
+			pages = pages[:limit]
+		}
+	}
+	return pages
+}
+
+// hasTag reports whether a [meta] tags property, an array of strings or
+// one comma-separated string, includes tag, ignoring case
+func hasTag(val ast.Value, tag string) bool {
+	var tags []string
+	if items, ok := ast.ItemsOf(val); ok {
+		for _, item := range items {
+			if s, ok := ast.StringOf(item); ok {
+				tags = append(tags, s)
+			}
+		}
+	} else if s, ok := ast.StringOf(val); ok {
+		tags = strings.Split(s, ",")
+	}
+	for _, t := range tags {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues orders two [meta] values for sorting: dates by time,
+// numbers by size, and anything else by its text
+func compareValues(a, b ast.Value) int {
+	if da, ok := a.(*ast.DateValue); ok {
+		if db, ok := b.(*ast.DateValue); ok {
+			ta, okA := da.Time()
+			tb, okB := db.Time()
+			if okA && okB {
+				return ta.Compare(tb)
+			}
+		}
+	}
+	if na, ok := ast.NumberOf(a); ok {
+		if nb, ok := ast.NumberOf(b); ok {
+			switch {
+			case na < nb:
+				return -1
+			case na > nb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(valueText(a), valueText(b))
+}
+
+// valueText returns a string's text, or any other value as written
+func valueText(val ast.Value) string {
+	if s, ok := ast.StringOf(val); ok {
+		return s
+	}
+	return val.TokenLiteral()
+}
+
+// generateQuery generates a [query-start] as a <div> of its children,
+// already repeated for each page it found
+func (g *Generator) generateQuery(elem *ast.Element, indent string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s<div%s%s%s>\n", indent, g.buildIDAttr(elem, elem.Properties), g.buildClassAttr(elem.Properties, "query"), g.buildStyleAttr(elem.Properties)))
+	g.indent++
+	for _, child := range elem.Children {
+		sb.WriteString(g.generateNode(child))
+	}
+	g.indent--
+	sb.WriteString(indent + "</div>\n")
+	return sb.String()
+}
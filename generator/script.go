@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"lpml/ast"
+)
+
+// Script placements accepted by [script]'s placement property
+const (
+	PlacementHead = "head" // In the <head>, run before the page is shown unless deferred
+	PlacementEnd  = "end"  // Just before </body>, once the page above it is read
+)
+
+// scriptClose matches what would end a <script> early, in any case
+var scriptClose = regexp.MustCompile(`(?i)</(script)`)
+
+// generateScript adds a [script]'s <script> to the head or the end of the
+// body, as its placement says, leaving nothing where it's written.
+// Without a placement, deferred, async, and module scripts go in the head,
+// which they don't hold up, and the rest at the end. A script placed
+// twice, like one in a file included twice, is written once.
+func (g *Generator) generateScript(elem *ast.Element) {
+	src := g.getStringProp(elem, "src")
+	code, hasCode := g.scriptCode(elem)
+	switch {
+	case src == "" && !hasCode:
+		g.warnf(RuleProperty, elem.Token.Line, "[script] needs a src or the code to run, like syntax = { ... }")
+		return
+	case src != "" && hasCode:
+		g.warnf(RuleProperty, elem.Token.Line, "[script] has both a src and code; browsers ignore code with a src, so it's left out")
+		hasCode = false
+	}
+
+	// A self-contained page carries its local scripts in it
+	if src != "" && g.opts.SelfContained {
+		if file := g.localPath(src); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				g.warnf(RuleFile, elem.Token.Line, "[script] not inlined: %v", err)
+			} else {
+				src, code, hasCode = "", string(data), true
+			}
+		}
+	}
+
+	// Only scripts loaded from a src, and modules, can wait or load
+	// alongside the page
+	module := g.getBoolProp(elem.Properties, "module")
+	deferred := src != "" && g.getBoolProp(elem.Properties, "defer")
+	async := (src != "" || module) && g.getBoolProp(elem.Properties, "async")
+	var attrs string
+	if module {
+		attrs += ` type="module"`
+	}
+	if src != "" {
+		attrs += attr("src", src)
+	}
+	if deferred {
+		attrs += " defer"
+	}
+	if async {
+		attrs += " async"
+	}
+
+	placement := g.getStringProp(elem, "placement")
+	switch placement {
+	case "":
+		placement = PlacementEnd
+		if deferred || async || module {
+			placement = PlacementHead
+		}
+	case PlacementHead, PlacementEnd:
+	default:
+		g.warnf(RuleProperty, elem.Token.Line, "[script] placement must be %q or %q, got %q; placing it at the end", PlacementHead, PlacementEnd, placement)
+		placement = PlacementEnd
+	}
+
+	tag := fmt.Sprintf("<script%s></script>", attrs)
+	if hasCode {
+		// The code is written as it is but for a </script> in it, which
+		// would end the script early; <\/script means the same to JavaScript
+		code = scriptClose.ReplaceAllString(strings.Trim(code, "\n"), `<\/$1`)
+		tag = fmt.Sprintf("<script%s>\n%s\n</script>", attrs, code)
+	}
+
+	lines := &g.tail
+	if placement == PlacementHead {
+		lines = &g.head
+	}
+	for _, line := range *lines {
+		if line == tag {
+			return
+		}
+	}
+	*lines = append(*lines, tag)
+}
+
+// scriptCode returns the code of a [script], given in braces or as a
+// string, and whether it has any
+func (g *Generator) scriptCode(elem *ast.Element) (string, bool) {
+	val, ok := elem.Properties["syntax"]
+	if !ok {
+		return "", false
+	}
+	if code, ok := g.constant(val).(*ast.CodeBlockValue); ok {
+		return code.Content, strings.TrimSpace(code.Content) != ""
+	}
+	code := g.resolveValue(val)
+	return code, strings.TrimSpace(code) != ""
+}
@@ -0,0 +1,51 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"lpml/ast"
+)
+
+// VersionLink is one version of a site built with --versions, as
+// [versions] links to it
+type VersionLink struct {
+	Name    string // Like "v2"
+	Href    string // The same page in that version, or its index page if it has none, relative to the page linking to it
+	Current bool   // The version being built
+}
+
+// generateVersions generates a [versions] switcher linking to the page in
+// each of Options.Versions. On any version but the latest, the last, it
+// starts with a banner pointing readers there, unless banner = false. A
+// site built without versions gets nothing.
+func (g *Generator) generateVersions(elem *ast.Element, indent string) string {
+	versions := g.opts.Versions
+	if len(versions) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s<div%s%s%s>\n", indent, g.buildIDAttr(elem, elem.Properties), g.buildClassAttr(elem.Properties, "versions"), g.buildStyleAttr(elem.Properties)))
+	if latest := versions[len(versions)-1]; !latest.Current && g.getProp(elem.Properties, "banner") != "false" {
+		current := ""
+		for _, v := range versions {
+			if v.Current {
+				current = v.Name
+			}
+		}
+		sb.WriteString(fmt.Sprintf("%s  <p class=\"version-banner\" role=\"note\" style=\"padding: 8px 12px; background-color: #fff3cd; border-radius: 4px;\">You're reading the docs for %s. <a%s>See %s, the latest</a>.</p>\n",
+			indent, escapeHTML(current), attr("href", latest.Href), escapeHTML(latest.Name)))
+	}
+	sb.WriteString(fmt.Sprintf("%s  <nav aria-label=\"Versions\" style=\"display: flex; gap: 12px;\">\n", indent))
+	for _, v := range versions {
+		current := ""
+		if v.Current {
+			current = " aria-current=\"page\""
+		}
+		sb.WriteString(fmt.Sprintf("%s    <a%s%s>%s</a>\n", indent, attr("href", v.Href), current, escapeHTML(v.Name)))
+	}
+	sb.WriteString(indent + "  </nav>\n")
+	sb.WriteString(indent + "</div>\n")
+	return sb.String()
+}
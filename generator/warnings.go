@@ -0,0 +1,160 @@
+package generator
+
+import (
+	"fmt"
+
+	"lpml/ast"
+	"lpml/tokens"
+)
+
+// The rules generator warnings come under, so Options.Severity can ignore
+// a kind of problem or make it an error
+const (
+	RuleColor          = "color"           // Colors that aren't ones, and palettes that don't hold them
+	RuleDate           = "date"            // Dates, times, and time zones that can't be read
+	RuleFile           = "file"            // Linked files that can't be found or read
+	RuleForm           = "form"            // Forms missing what their provider needs
+	RuleID             = "id"              // Labels rewritten into valid, unique ids
+	RuleImage          = "image"           // Images that can't be resized, inlined, or given a placeholder
+	RuleLimit          = "limit"           // Pages cut short at a limit of Options, like MaxDepth
+	RuleNumber         = "number"          // number(), currency(), and percent() calls that can't be worked out
+	RulePlugin         = "plugin"          // Custom tags their renderer failed on
+	RuleProperty       = "property"        // Properties missing or set to what the tag can't use
+	RuleReference      = "reference"       // $references to no constant or preset, or to themselves
+	RuleStructure      = "structure"       // Elements left out for where they are, like an answer outside an FAQ
+	RuleStructuredData = "structured-data" // JSON-LD that can't be written
+)
+
+// Rules are the names of the rules generator warnings come under
+var Rules = []string{
+	RuleColor, RuleDate, RuleFile, RuleForm, RuleID, RuleImage, RuleLimit,
+	RuleNumber, RulePlugin, RuleProperty, RuleReference, RuleStructure, RuleStructuredData,
+}
+
+// Severity is how the warnings of a rule are treated
+type Severity int
+
+const (
+	SeverityWarn   Severity = iota // Reported, and the page is written all the same
+	SeverityIgnore                 // Not reported at all
+	SeverityError                  // Reported as an error, which a page mustn't be written with
+)
+
+// severityNames are the severities as lpml.toml writes them
+var severityNames = map[Severity]string{SeverityWarn: "warn", SeverityIgnore: "ignore", SeverityError: "error"}
+
+// String returns the severity as ParseSeverity reads it
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity reads a severity written "ignore", "warn", or "error"
+func ParseSeverity(s string) (Severity, error) {
+	for sev, name := range severityNames {
+		if name == s {
+			return sev, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q (want ignore, warn, or error)", s)
+}
+
+// IsRule reports whether name is one of Rules
+func IsRule(name string) bool {
+	for _, rule := range Rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Diagnostic is a problem found while generating a page that doesn't
+// stop it, kept unless its rule's severity is SeverityIgnore
+type Diagnostic struct {
+	Rule     string   // One of Rules
+	Line     int      // Where in the source it is, or 0 if it isn't in one place
+	Message  string   // What's wrong
+	Severity Severity // SeverityWarn, or SeverityError if Options.Severity makes it one
+}
+
+// String formats the diagnostic as "line 3: message", or the message
+// alone if it isn't at a line
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return d.Message
+	}
+	return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+}
+
+// Diagnostics returns the problems found while generating the page,
+// warnings and errors both, in the order they were found
+func (p *Page) Diagnostics() []Diagnostic {
+	return p.diags
+}
+
+// Warnings returns non-fatal problems found while generating the page,
+// like labels that had to be rewritten into valid ids, formatted as
+// Diagnostic.String does. Those Options.Severity makes errors are left to
+// Errors.
+func (p *Page) Warnings() []string {
+	return p.messages(SeverityWarn)
+}
+
+// Errors returns the warnings Options.Severity makes errors, formatted like
+// Warnings. A page with any is generated all the same; it's for the
+// caller to refuse it.
+func (p *Page) Errors() []string {
+	return p.messages(SeverityError)
+}
+
+// Diagnostics returns the problems found generating the page generated
+// last, as Page.Diagnostics does. A Generator shared by goroutines should
+// take each page's own from the Page instead.
+func (g *Generator) Diagnostics() []Diagnostic {
+	return g.lastPage().Diagnostics()
+}
+
+// Warnings returns the warnings of the page generated last, as
+// Page.Warnings does
+func (g *Generator) Warnings() []string {
+	return g.lastPage().Warnings()
+}
+
+// Errors returns the errors of the page generated last, as Page.Errors
+// does
+func (g *Generator) Errors() []string {
+	return g.lastPage().Errors()
+}
+
+// messages formats the diagnostics of a severity for Warnings and Errors
+func (p *Page) messages(sev Severity) []string {
+	var msgs []string
+	for _, d := range p.diags {
+		if d.Severity == sev {
+			msgs = append(msgs, d.String())
+		}
+	}
+	return msgs
+}
+
+// warnf records a generation warning under rule, at line if it's not 0,
+// as its severity says
+func (g *Generator) warnf(rule string, line int, format string, args ...any) {
+	sev := g.opts.Severity[rule]
+	if sev == SeverityIgnore {
+		return
+	}
+	g.diags = append(g.diags, Diagnostic{Rule: rule, Line: line, Message: fmt.Sprintf(format, args...), Severity: sev})
+}
+
+// tagName returns elem's opening tag as the source writes it, [img] for a
+// void tag and [img-start] otherwise, for naming it in a warning
+func tagName(elem *ast.Element) string {
+	if elem.Token.Type == tokens.VOID_START {
+		return "[" + elem.TagType + "]"
+	}
+	return "[" + elem.TagType + "-start]"
+}
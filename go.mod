@@ -1,3 +1,5 @@
 module lpml
 
 go 1.25.5
+
+require golang.org/x/net v0.58.0
@@ -0,0 +1,111 @@
+// Package imaging reads PNG, JPEG, and GIF images for the placeholders and
+// srcsets of [img-start] elements. Importing it registers it with the
+// generator, which reads no images without it:
+//
+//	import _ "lpml/imaging"
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register GIF decoding
+	"image/jpeg"
+	"image/png"
+	"os"
+
+	"lpml/generator"
+)
+
+func init() {
+	generator.RegisterImageProcessor(Processor{})
+}
+
+// Processor decodes local PNG, JPEG, and GIF images
+type Processor struct{}
+
+// Decode reads the image in file
+func (Processor) Decode(file string) (generator.Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v (want PNG, JPEG, or GIF)", file, err)
+	}
+	return decoded{img}, nil
+}
+
+// decoded is an image Processor read
+type decoded struct {
+	img image.Image
+}
+
+// Size returns the image's width and height in pixels
+func (d decoded) Size() (int, int) {
+	return d.img.Bounds().Dx(), d.img.Bounds().Dy()
+}
+
+// Color returns the image's average color as #rrggbb
+func (d decoded) Color() string {
+	n := color.NRGBAModel.Convert(resize(d.img, 1, 1).At(0, 0)).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+// Encode scales the image to width by height pixels and encodes it as
+// "png", or "jpeg" at quality 85
+func (d decoded) Encode(width, height int, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	resized := resize(d.img, width, height)
+	switch format {
+	case "png":
+		err = png.Encode(&buf, resized)
+	case "jpeg":
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+	default:
+		err = fmt.Errorf("can't encode images as %q (want png or jpeg)", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resize scales img down to outW by outH pixels, averaging the pixels each
+// output pixel covers. An empty image scales to a transparent one.
+func resize(img image.Image, outW, outH int) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	out := image.NewRGBA(image.Rect(0, 0, outW, outH))
+	if w == 0 || h == 0 {
+		return out
+	}
+	for oy := 0; oy < outH; oy++ {
+		y0, y1 := bounds.Min.Y+oy*h/outH, bounds.Min.Y+(oy+1)*h/outH
+		for ox := 0; ox < outW; ox++ {
+			x0, x1 := bounds.Min.X+ox*w/outW, bounds.Min.X+(ox+1)*w/outW
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(x, y).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			if n == 0 {
+				continue // Scaled up past img: left transparent
+			}
+			out.SetRGBA(ox, oy, color.RGBA{
+				R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return out
+}
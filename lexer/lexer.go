@@ -1,35 +1,180 @@
 package lexer
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"lpml/tokens"
 )
 
 // Lexer tokenizes LPML input
 type Lexer struct {
-	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
-	line         int  // current line number
-	column       int  // current column number
+	input        string         // the input, or with NewFromReader the part of it read and not yet dropped
+	src          *bufio.Reader  // with NewFromReader, where the rest of the input comes from; nil once it's all read
+	streaming    bool           // input is read from a reader, so what's been lexed can be dropped
+	firstLine    int            // the line input starts on
+	err          error          // what reading from src failed with, other than io.EOF
+	position     int            // current position in input (points to current char)
+	readPosition int            // current reading position in input (after current char)
+	ch           rune           // current char under examination
+	line         int            // current line number
+	column       int            // current column number
+	endLine      int            // line just past the last char read, where a token read up to it ends
+	endColumn    int            // column just past the last char read
+	keepComments bool           // return comments as COMMENT tokens instead of skipping them
+	comments     []tokens.Token // the comments skipped, for Comments
+	rawStrings   bool           // return strings as written, quotes and escapes included
+	pending      []tokens.Token // tokens already read, returned before reading more
+	lastIdent    string         // the last identifier read, the property a '{' belongs to
+	mapDepth     int            // open '{' of map values
+	arrayDepth   int            // open '[' of array values
+	callDepth    int            // open '(' of function calls
+	callLine     int            // the line the open calls are on
+	started      bool           // a token other than a comment has been read
+	indents      []int          // in an [indented] file, the open indentation levels, outermost first
+	lastLine     int            // in an [indented] file, the line of the last token
+	nesting      int            // in an [indented] file, open '[' and '{' of values, whose lines don't count
+	prev         tokens.Token   // the last token read, to tell a property's value from bare text
+	prevText     bool           // the last token read was bare text
+	inTag        bool           // lexing the properties written inside a tag, which can't hold bare text
+	script       bool           // lexing a [script]'s properties, whose code block is JavaScript
+	failed       bool           // a bug stopped the lexer, so the input seems to end
 }
 
 // New creates a new Lexer for the given input
 func New(input string) *Lexer {
-	l := &Lexer{input: input, line: 1, column: 0}
+	l := &Lexer{input: input, firstLine: 1, line: 1, column: 0}
+	l.readChar()
+	return l
+}
+
+// NewForAttrs creates a Lexer for what's written inside a tag, like the
+// condition of an [if], which holds values and never bare text
+func NewForAttrs(input string) *Lexer {
+	l := New(input)
+	l.inTag = true
+	return l
+}
+
+// How a Lexer from NewFromReader buffers its input
+const (
+	readChunk  = 64 << 10 // bytes read from the reader at a time
+	readAhead  = 64 << 10 // bytes kept past the current character, for looking ahead
+	keepBehind = 4 << 10  // bytes kept before the current token, for SourceLine
+)
+
+// NewFromReader creates a Lexer reading its input from r as it goes, so a
+// large document never has to be held in memory at once. It lexes the
+// same tokens as New would from all of r. SourceLine only has the lines
+// around the token just read; Err reports a failure reading r.
+func NewFromReader(r io.Reader) *Lexer {
+	l := &Lexer{src: bufio.NewReaderSize(r, readChunk), streaming: true, firstLine: 1, line: 1, column: 0}
 	l.readChar()
 	return l
 }
 
+// Err returns the error reading the input stopped at, if it did, or the
+// bug that stopped the lexer. The input then seems to end there.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// Tokens returns the tokens of the input in order, up to but not
+// including EOF, for tools that read the token stream rather than a
+// parsed document:
+//
+//	for tok := range l.Tokens() {
+//		...
+//	}
+func (l *Lexer) Tokens() iter.Seq[tokens.Token] {
+	return func(yield func(tokens.Token) bool) {
+		for tok := l.NextToken(); tok.Type != tokens.EOF; tok = l.NextToken() {
+			if !yield(tok) {
+				return
+			}
+		}
+	}
+}
+
+// fill reads the next chunk of the input from src onto the end of input
+func (l *Lexer) fill() {
+	buf := make([]byte, readChunk)
+	n, err := io.ReadFull(l.src, buf)
+	l.input += string(buf[:n])
+	if err != nil {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			l.err = err
+		}
+		l.src = nil
+	}
+}
+
+// drop forgets the input well before the current token, whole lines at a
+// time, once enough has built up. It's only called between tokens, since
+// reading one keeps positions in input.
+func (l *Lexer) drop() {
+	cut := l.position - keepBehind
+	if !l.streaming || cut < readChunk {
+		return
+	}
+	cut = strings.LastIndexByte(l.input[:cut], '\n') + 1
+	l.firstLine += strings.Count(l.input[:cut], "\n")
+	l.input = strings.Clone(l.input[cut:])
+	l.position -= cut
+	l.readPosition -= cut
+}
+
+// NewWithComments creates a Lexer that returns comments as COMMENT tokens
+// and strings exactly as written, quotes included, for tools like the
+// formatter that need to reproduce the source
+func NewWithComments(input string) *Lexer {
+	l := New(input)
+	l.keepComments = true
+	l.rawStrings = true
+	return l
+}
+
+// Comments returns the comments skipped so far, as COMMENT tokens in
+// source order. A Lexer from NewWithComments returns them as tokens
+// instead, so it has none.
+func (l *Lexer) Comments() []tokens.Token {
+	return l.comments
+}
+
+// SourceLine returns line n of the input, counting from 1, without its
+// line break. It's "" past the end.
+func (l *Lexer) SourceLine(n int) string {
+	lines := strings.Split(l.input, "\n")
+	for l.src != nil && n-l.firstLine >= len(lines)-1 {
+		l.fill() // the line may not all be read yet
+		lines = strings.Split(l.input, "\n")
+	}
+	i := n - l.firstLine
+	if i < 0 || i >= len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[i], "\r")
+}
+
 // readChar reads the next character and advances positions
 func (l *Lexer) readChar() {
+	width := 1
+	l.endLine, l.endColumn = l.line, l.column+1
+	for l.src != nil && l.readPosition+readAhead > len(l.input) {
+		l.fill()
+	}
 	if l.readPosition >= len(l.input) {
-		l.ch = 0 // ASCII code for NUL
+		l.ch, width = 0, 0 // ASCII code for NUL, and no further however often it's read
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += width
 	l.column++
 
 	if l.ch == '\n' {
@@ -39,33 +184,139 @@ func (l *Lexer) readChar() {
 }
 
 // peekChar returns the next character without advancing
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 // NextToken returns the next token from the input
-func (l *Lexer) NextToken() tokens.Token {
+func (l *Lexer) NextToken() (tok tokens.Token) {
+	if l.failed {
+		return tokens.Token{Type: tokens.EOF, Line: l.line, Column: l.column}
+	}
+	defer l.recoverPanic(&tok)
+	if len(l.pending) > 0 {
+		tok := l.pending[0]
+		l.pending = l.pending[1:]
+		return tok
+	}
+
+	l.drop()
+	tok = l.readToken()
+	tok.EndLine, tok.EndColumn = l.endLine, l.endColumn
+	l.prev = tok
+	if l.indents != nil {
+		return l.indentation(tok)
+	}
+	if !l.started && tok.Type != tokens.COMMENT {
+		l.started = true
+		if tok.Type == tokens.INDENTED {
+			l.indents = []int{tok.Column - 1}
+			l.lastLine = tok.Line
+		}
+	}
+	return tok
+}
+
+// recoverPanic stops the lexer if reading a token panicked, so any input
+// gives an error rather than a crash: tok becomes EOF, and Err reports
+// the failure. Call it deferred.
+func (l *Lexer) recoverPanic(tok *tokens.Token) {
+	if r := recover(); r != nil {
+		l.failed = true
+		l.err = fmt.Errorf("the lexer failed at line %d: %v; this is a bug in lpml, please report it with the source", l.line, r)
+		*tok = tokens.Token{Type: tokens.EOF, Line: l.line, Column: l.column}
+	}
+}
+
+// indentation returns the next token of an [indented] file. A token that
+// starts a line indented deeper than the line before comes after an
+// INDENT, and one that starts a line indented less after a DEDENT for each
+// level it closes. Comments and the lines inside a multi-line array or map
+// don't count.
+func (l *Lexer) indentation(tok tokens.Token) tokens.Token {
+	if tok.Type == tokens.COMMENT {
+		return tok
+	}
+	nested := l.nesting > 0
+	switch tok.Type {
+	case tokens.LBRACKET, tokens.LBRACE:
+		l.nesting++
+	case tokens.RBRACKET, tokens.RBRACE:
+		l.nesting = max(l.nesting-1, 0)
+	}
+	newLine := tok.Line > l.lastLine
+	l.lastLine = tok.Line
+	if nested || !newLine && tok.Type != tokens.EOF {
+		return tok
+	}
+
+	indent := max(tok.Column-1, l.indents[0])
+	if tok.Type == tokens.EOF {
+		indent = l.indents[0]
+	}
+	marker := func(t tokens.TokenType) tokens.Token {
+		return tokens.Token{Type: t, Line: tok.Line, Column: tok.Column}
+	}
+
+	var queue []tokens.Token
+	for indent < l.indents[len(l.indents)-1] {
+		l.indents = l.indents[:len(l.indents)-1]
+		queue = append(queue, marker(tokens.DEDENT))
+	}
+	if indent > l.indents[len(l.indents)-1] {
+		if len(queue) > 0 {
+			// Back out to a level no line above was at
+			queue = append(queue, tokens.Token{Type: tokens.ILLEGAL, Literal: "dedent", Line: tok.Line, Column: tok.Column})
+		}
+		l.indents = append(l.indents, indent)
+		queue = append(queue, marker(tokens.INDENT))
+	}
+	if len(queue) == 0 {
+		return tok
+	}
+	l.pending = append(append(queue[1:], tok), l.pending...)
+	return queue[0]
+}
+
+// readToken reads the next token from the input
+func (l *Lexer) readToken() tokens.Token {
 	var tok tokens.Token
+	afterText := l.prevText
+	l.prevText = false
 
 	l.skipWhitespace()
+	if l.callDepth > 0 && l.line != l.callLine {
+		l.callDepth = 0 // Calls are written on one line; one left open never closes
+	}
 
 	tok.Line = l.line
 	tok.Column = l.column
 
+	if l.atText() {
+		tok.Type = tokens.STRING
+		tok.Literal = l.readText(afterText)
+		return tok
+	}
+
 	switch l.ch {
 	case '[':
 		// Check if next char suggests this is an array or a tag
 		if l.isArrayStart() {
 			tok = newToken(tokens.LBRACKET, l.ch, l.line, l.column)
+			l.arrayDepth++
 			l.readChar()
 		} else {
 			tok = l.readTag()
 		}
 	case ']':
 		tok = newToken(tokens.RBRACKET, l.ch, l.line, l.column)
+		if l.arrayDepth > 0 {
+			l.arrayDepth--
+		}
 		l.readChar()
 	case '=':
 		tok = newToken(tokens.EQUALS, l.ch, l.line, l.column)
@@ -74,14 +325,86 @@ func (l *Lexer) NextToken() tokens.Token {
 		tok = newToken(tokens.COMMA, l.ch, l.line, l.column)
 		l.readChar()
 	case '{':
-		tok = l.readCodeBlock()
+		// Only syntax and css hold code; braces anywhere else open a map
+		if l.lastIdent == "syntax" || l.lastIdent == "css" {
+			tok = l.readCodeBlock()
+		} else {
+			tok = newToken(tokens.LBRACE, l.ch, l.line, l.column)
+			l.mapDepth++
+			l.readChar()
+		}
+	case '}':
+		if l.mapDepth > 0 {
+			tok = newToken(tokens.RBRACE, l.ch, l.line, l.column)
+			l.mapDepth--
+		} else {
+			tok = newToken(tokens.ILLEGAL, l.ch, l.line, l.column)
+		}
+		l.readChar()
+	case ')':
+		if l.callDepth > 0 {
+			tok = newToken(tokens.RPAREN, l.ch, l.line, l.column)
+			l.callDepth--
+		} else {
+			tok = newToken(tokens.ILLEGAL, l.ch, l.line, l.column)
+		}
+		l.readChar()
 	case '$':
 		tok = l.readVariableReference()
-	case '"':
+	case '#':
+		tok = tokens.Token{Type: tokens.COLOR, Line: l.line, Column: l.column}
+		position := l.position
+		l.readChar() // consume '#'
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.readChar()
+		}
+		tok.Literal = l.input[position:l.position]
+	case '|':
+		tok = newToken(tokens.PIPE, l.ch, l.line, l.column)
+		l.readChar()
+	case '?':
+		if l.peekChar() == '?' {
+			tok = tokens.Token{Type: tokens.FALLBACK, Literal: "??", Line: l.line, Column: l.column}
+			l.readChar()
+		} else {
+			tok = newToken(tokens.ILLEGAL, l.ch, l.line, l.column)
+		}
+		l.readChar()
+	case '"', '\'':
+		start := l.position
+		var parts []tokens.Token
 		tok.Type = tokens.STRING
-		tok.Literal = l.readString()
-		tok.Line = l.line
-		tok.Column = l.column
+		if l.ch == '"' && strings.HasPrefix(l.input[l.position:], `"""`) {
+			tok.Literal = l.readTextBlock()
+		} else {
+			tok.Literal, parts = l.readString()
+		}
+		if l.rawStrings {
+			tok.Literal = l.input[start:l.position]
+		} else if parts != nil {
+			// An interpolated string is its parts between template tokens
+			for i := range parts {
+				parts[i].Line, parts[i].Column = tok.Line, tok.Column
+				parts[i].EndLine, parts[i].EndColumn = l.endLine, l.endColumn
+			}
+			l.pending = append(parts, tokens.Token{Type: tokens.TEMPLATE_END, Line: tok.Line, Column: tok.Column, EndLine: l.endLine, EndColumn: l.endColumn})
+			tok.Type = tokens.TEMPLATE_START
+		}
+	case '/':
+		switch {
+		case l.atComment():
+			tok = tokens.Token{Type: tokens.COMMENT, Line: l.line, Column: l.column}
+			tok.Literal = l.readComment()
+		case l.peekChar() == '*':
+			// An unclosed block comment would swallow the rest of the file
+			tok = tokens.Token{Type: tokens.ILLEGAL, Literal: "/*", Line: l.line, Column: l.column}
+			for l.ch != 0 {
+				l.readChar()
+			}
+		default:
+			tok = newToken(tokens.ILLEGAL, l.ch, l.line, l.column)
+			l.readChar()
+		}
 	case '\n':
 		tok = newToken(tokens.NEWLINE, l.ch, l.line, l.column)
 		l.readChar()
@@ -91,17 +414,46 @@ func (l *Lexer) NextToken() tokens.Token {
 		tok.Line = l.line
 		tok.Column = l.column
 	default:
-		if isDigit(l.ch) {
+		if isDate(l.input[l.position:]) {
+			tok.Type = tokens.DATE
+			position := l.position
+			for isDigit(l.ch) || strings.ContainsRune("-:.TZ+", l.ch) {
+				l.readChar()
+			}
+			tok.Literal = l.input[position:l.position]
+		} else if isDigit(l.ch) || l.isSignedNumber() {
 			tok.Line = l.line
 			tok.Column = l.column
 			tok.Literal = l.readNumber()
 			tok.Type = tokens.NUMBER
+			if last := rune(tok.Literal[len(tok.Literal)-1]); !isDigit(last) && last != '.' {
+				tok.Type = tokens.DIMENSION
+			}
 			return tok
 		} else if isLetter(l.ch) || l.ch == '_' {
 			tok.Line = l.line
 			tok.Column = l.column
+			position := l.position
 			tok.Literal = l.readIdentifier()
 			tok.Type = tokens.IDENT
+			if colorFunctions[tok.Literal] && l.ch == '(' {
+				l.readColorArgs()
+				tok.Literal = l.input[position:l.position]
+				tok.Type = tokens.COLOR
+				return tok
+			}
+			// Filters after a | take their arguments as calls do
+			if (callFunctions[tok.Literal] || l.prev.Type == tokens.PIPE) && l.ch == '(' {
+				l.readChar() // consume '('
+				l.callDepth++
+				l.callLine = tok.Line
+				tok.Type = tokens.CALL
+				return tok
+			}
+			l.lastIdent = tok.Literal
+			if tok.Literal == "true" || tok.Literal == "false" {
+				tok.Type = tokens.BOOL
+			}
 			return tok
 		} else {
 			tok = newToken(tokens.ILLEGAL, l.ch, l.line, l.column)
@@ -112,19 +464,190 @@ func (l *Lexer) NextToken() tokens.Token {
 	return tok
 }
 
+// atText reports whether bare text starts at the current character, like
+// Hello in [p-start] Hello world [p-end]: anything that isn't a tag, a
+// quoted string, a comment, or a property name followed by '=', and isn't
+// where a value goes
+func (l *Lexer) atText() bool {
+	if l.inTag || l.mapDepth > 0 || l.callDepth > 0 || l.arrayDepth > 0 {
+		return false
+	}
+	switch l.prev.Type {
+	case tokens.EQUALS, tokens.COMMA, tokens.LBRACKET, tokens.FALLBACK, tokens.PIPE:
+		return false
+	}
+	rest := l.input[l.position:]
+	switch {
+	case l.ch == '[':
+		return l.isArrayStart() // [1] isn't a tag, so it's text
+	case strings.ContainsRune("\n\x00\"'=|", l.ch), strings.HasPrefix(rest, "??"), strings.HasPrefix(rest, "/*"), l.atComment():
+		return false
+	case isLetter(l.ch) || l.ch == '_':
+		rest = strings.TrimLeftFunc(rest, func(r rune) bool { return isLetter(r) || isDigit(r) || r == '_' })
+		return !strings.HasPrefix(strings.TrimLeft(rest, " \t"), "=")
+	}
+	return true
+}
+
+// readText reads bare text up to the end of the line, the next tag, or a
+// comment after a space. Text runs on past the tags and lines around it,
+// so it starts with a space after a closing tag or other text and ends
+// with one before an opening tag; only the formatter's raw strings are
+// kept as written.
+func (l *Lexer) readText(afterText bool) string {
+	position, col := l.position, l.column
+	for l.ch != '\n' && l.ch != 0 && !(l.ch == '[' && !l.isArrayStart()) {
+		if l.atComment() && strings.ContainsAny(l.input[l.position-1:l.position], " \t") {
+			break
+		}
+		l.readChar()
+	}
+	text := strings.TrimRight(l.input[position:l.position], " \t\r")
+	if l.rawStrings {
+		return text
+	}
+
+	l.prevText = true
+	// In an [indented] file, text no deeper than the tag before it closes it
+	closed := l.indents != nil && tokens.IsOpeningTag(l.prev.Type) && col <= l.prev.Column
+	first, _ := utf8.DecodeRuneInString(text)
+	if (afterText || closed || l.prev.Type == tokens.VOID_START || tokens.IsClosingTag(l.prev.Type)) && !strings.ContainsRune(closingPunctuation, first) {
+		text = " " + text
+	}
+	last, _ := utf8.DecodeLastRuneInString(text)
+	if opensTag(skipComments(l.input[l.position:])) && !strings.ContainsRune(openingPunctuation, last) {
+		text += " "
+	}
+	return text
+}
+
+// closingPunctuation and openingPunctuation are what text sits right up
+// against a tag with, like the comma in [bold-end], then and the bracket
+// in ([link-start]
+const (
+	closingPunctuation = ",.;:!?)]}%…’”"
+	openingPunctuation = "([{¡¿‘“"
+)
+
+// skipComments returns s after any leading whitespace and comments
+func skipComments(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		switch {
+		case strings.HasPrefix(s, "//"):
+			_, s, _ = strings.Cut(s, "\n")
+		case strings.HasPrefix(s, "/*") && strings.Contains(s, "*/"):
+			_, s, _ = strings.Cut(s, "*/")
+		default:
+			return s
+		}
+	}
+}
+
+// opensTag reports whether s starts with an opening or void tag
+func opensTag(s string) bool {
+	name, ok := strings.CutPrefix(s, "[")
+	if !ok {
+		return false
+	}
+	end := strings.IndexFunc(name, func(r rune) bool { return !isTagChar(r) })
+	if end >= 0 {
+		name = name[:end]
+	}
+	return tokens.IsVoidTag(name) || tokens.IsOpeningTag(tokens.LookUpIdent(name))
+}
+
 // isArrayStart checks if '[' is start of array (not a tag)
-// Arrays start with [ followed by number, $, ", or ]
+// Arrays start with [ followed by number, $, ", ], whitespace, or a boolean
 func (l *Lexer) isArrayStart() bool {
 	next := l.peekChar()
-	return isDigit(next) || next == '$' || next == '"' || next == ']' || next == ' ' || next == '\n' || next == '\t'
+	if isDigit(next) || next == '$' || next == '"' || next == '\'' || next == ']' || next == ' ' || next == '\n' || next == '\t' {
+		return true
+	}
+	if next == '-' && l.readPosition+1 < len(l.input) && isDigit(rune(l.input[l.readPosition+1])) {
+		return true // a negative number
+	}
+	if next == '#' {
+		return true // a color
+	}
+	rest := l.input[l.readPosition:]
+	for _, word := range []string{"true", "false"} {
+		if after, ok := strings.CutPrefix(rest, word); ok && (after == "" || !isTagChar(firstRune(after))) {
+			return true
+		}
+	}
+	for name := range colorFunctions {
+		if strings.HasPrefix(rest, name+"(") {
+			return true
+		}
+	}
+	for name := range callFunctions {
+		if strings.HasPrefix(rest, name+"(") {
+			return true
+		}
+	}
+	return false
+}
+
+// colorFunctions are the CSS functions read as color literals, like
+// rgb(255, 102, 0)
+var colorFunctions = map[string]bool{"rgb": true, "rgba": true, "hsl": true, "hsla": true}
+
+// callFunctions are the functions a value can call at build time, like
+// now(), date($page.date, "2006"), or currency($price, "EUR")
+var callFunctions = map[string]bool{"date": true, "now": true, "number": true, "currency": true, "percent": true}
+
+// readColorArgs reads the parenthesized arguments of a color function, up
+// to the closing ')' or the end of the line
+func (l *Lexer) readColorArgs() {
+	for l.ch != ')' && l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	if l.ch == ')' {
+		l.readChar()
+	}
+}
+
+// isDate reports whether s starts with a date written like 2024-06-01
+func isDate(s string) bool {
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return false
+	}
+	for _, i := range []int{0, 1, 2, 3, 5, 6, 8, 9} {
+		if !isDigit(rune(s[i])) {
+			return false
+		}
+	}
+	return true
 }
 
-// readNumber reads a numeric literal
+// isSignedNumber reports whether a '-' at the current position starts a
+// negative number, like -8 or -.5
+func (l *Lexer) isSignedNumber() bool {
+	if l.ch != '-' {
+		return false
+	}
+	next := l.peekChar()
+	return isDigit(next) || next == '.' && l.readPosition+1 < len(l.input) && isDigit(rune(l.input[l.readPosition+1]))
+}
+
+// readNumber reads a numeric literal: an optional '-', digits with an
+// optional decimal point, and an optional unit like px, rem, or %
 func (l *Lexer) readNumber() string {
 	position := l.position
+	if l.ch == '-' {
+		l.readChar()
+	}
 	for isDigit(l.ch) || l.ch == '.' {
 		l.readChar()
 	}
+	if l.ch == '%' {
+		l.readChar()
+	} else {
+		for isLetter(l.ch) {
+			l.readChar()
+		}
+	}
 	return l.input[position:l.position]
 }
 
@@ -145,6 +668,9 @@ func (l *Lexer) readCodeBlock() tokens.Token {
 
 	// Read until matching closing brace
 	for braceCount > 0 && l.ch != 0 {
+		if l.script && l.skipJSLiteral() {
+			continue
+		}
 		if l.ch == '{' {
 			braceCount++
 		} else if l.ch == '}' {
@@ -173,6 +699,41 @@ func (l *Lexer) readCodeBlock() tokens.Token {
 	}
 }
 
+// skipJSLiteral reads past the JavaScript string, template literal, or
+// comment at the current character, if there's one, so the braces in it
+// don't end a [script]'s code. A string left open ends with its line.
+func (l *Lexer) skipJSLiteral() bool {
+	switch {
+	case l.ch == '"' || l.ch == '\'' || l.ch == '`':
+		quote := l.ch
+		l.readChar() // consume the opening quote
+		for l.ch != quote && l.ch != 0 && (quote == '`' || l.ch != '\n') {
+			if l.ch == '\\' {
+				l.readChar()
+			}
+			l.readChar()
+		}
+		if l.ch == quote {
+			l.readChar()
+		}
+	case l.ch == '/' && l.peekChar() == '/':
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	case l.ch == '/' && l.peekChar() == '*':
+		l.readChar()
+		l.readChar()
+		for l.ch != 0 && !(l.ch == '*' && l.peekChar() == '/') {
+			l.readChar()
+		}
+		l.readChar()
+		l.readChar()
+	default:
+		return false
+	}
+	return true
+}
+
 // trimTrailingWhitespace removes trailing whitespace from a string
 func trimTrailingWhitespace(s string) string {
 	end := len(s)
@@ -182,27 +743,48 @@ func trimTrailingWhitespace(s string) string {
 	return s[:end]
 }
 
-// readTag reads a bracketed tag like [tag-name] or [tag-name]
+// readTag reads a bracketed tag like [tag-name] or [tag-name attrs]. An
+// opening tag's properties, like [p-start align="center"], are queued
+// after it between ATTRS_START and ATTRS_END; a void tag's between
+// VOID_START and VOID_END.
 func (l *Lexer) readTag() tokens.Token {
 	line := l.line
 	col := l.column
 
 	l.readChar() // consume '['
 
-	// Read the tag name
+	// Read the tag name, then everything up to the closing bracket
 	tagName := l.readTagName()
+	attrLine, attrCol := l.line, l.column
+	rest, endLine, endCol := l.readTagRest()
 
-	// Skip to the closing bracket
-	for l.ch != ']' && l.ch != 0 {
-		l.readChar()
-	}
-
-	if l.ch == ']' {
-		l.readChar() // consume ']'
+	if tokens.IsVoidTag(tagName) && (rest == "" || strings.ContainsRune(" \t\r\n", rune(rest[0]))) {
+		l.queueAttrs(tagName, rest, attrLine, attrCol)
+		l.pending = append(l.pending, tokens.Token{Type: tokens.VOID_END, Literal: tagName, Line: endLine, Column: endCol, EndLine: endLine, EndColumn: endCol + 1})
+		return tokens.Token{Type: tokens.VOID_START, Literal: tagName, Line: line, Column: col}
 	}
 
 	// Look up if this is a known tag
 	tokType := tokens.LookUpIdent(tagName)
+	if tokType == tokens.IDENT && tagName != "" {
+		tokType = tokens.UNKNOWN_TAG
+	}
+	switch tokType {
+	case tokens.INCLUDE:
+		tagName = quotedAttr(rest, "file")
+	case tokens.PRESET:
+		tagName = quotedAttr(rest, "name")
+	case tokens.IF_START:
+		tagName = ifCondition(rest)
+	case tokens.REPEAT_START:
+		tagName = strings.TrimSpace(rest)
+	default:
+		if tokens.IsOpeningTag(tokType) && strings.TrimSpace(rest) != "" {
+			l.pending = append(l.pending, tokens.Token{Type: tokens.ATTRS_START, Literal: tagName, Line: attrLine, Column: attrCol})
+			l.queueAttrs(tagName, rest, attrLine, attrCol)
+			l.pending = append(l.pending, tokens.Token{Type: tokens.ATTRS_END, Literal: tagName, Line: endLine, Column: endCol, EndLine: endLine, EndColumn: endCol + 1})
+		}
+	}
 
 	return tokens.Token{
 		Type:    tokType,
@@ -212,6 +794,106 @@ func (l *Lexer) readTag() tokens.Token {
 	}
 }
 
+// readTagRest reads the rest of a tag after its name and consumes the
+// closing ']', returning what was between them and where the ']' was. A
+// ']' inside a string or array doesn't end the tag.
+func (l *Lexer) readTagRest() (string, int, int) {
+	start := l.position
+	var quote rune // the quote of the string being read, or 0
+	depth := 0
+	for l.ch != 0 && (quote != 0 || depth > 0 || l.ch != ']') {
+		switch {
+		case l.ch == '\\' && quote != 0:
+			l.readChar() // skip the escaped character
+		case l.ch == quote:
+			quote = 0
+		case (l.ch == '"' || l.ch == '\'') && quote == 0:
+			quote = l.ch
+		case l.ch == '\n':
+			quote = 0 // an unclosed string ends with its line
+		case l.ch == '[' && quote == 0:
+			depth++
+		case l.ch == ']' && quote == 0:
+			depth--
+		}
+		l.readChar()
+	}
+	rest := l.input[start:l.position]
+	endLine, endCol := l.line, l.column
+	if l.ch == ']' {
+		l.readChar() // consume ']'
+	}
+	return rest, endLine, endCol
+}
+
+// queueAttrs lexes the properties written inside a tag, which start at
+// line:col, and queues their tokens
+func (l *Lexer) queueAttrs(tagName, attrs string, line, col int) {
+	sub := New(attrs)
+	sub.inTag = true
+	sub.script = tagName == "script"
+	sub.keepComments = l.keepComments
+	sub.rawStrings = l.rawStrings
+	for {
+		tok := sub.NextToken()
+		if tok.Type == tokens.EOF {
+			return
+		}
+		if tok.Line == 1 {
+			tok.Column += col - 1
+		}
+		if tok.EndLine == 1 {
+			tok.EndColumn += col - 1
+		}
+		tok.Line += line - 1
+		tok.EndLine += line - 1
+		l.pending = append(l.pending, tok)
+	}
+}
+
+// quotedAttr returns the value of a tag's name="value", like the path in
+// an include tag's file="path", or "" if it has none
+func quotedAttr(attrs, name string) string {
+	_, value, ok := strings.Cut(attrs, name)
+	if !ok {
+		return ""
+	}
+	value, ok = strings.CutPrefix(strings.TrimLeft(value, " \t"), "=")
+	if !ok {
+		return ""
+	}
+	value = strings.TrimLeft(value, " \t")
+	if value == "" || value[0] != '"' && value[0] != '\'' {
+		return ""
+	}
+	value, _, ok = strings.Cut(value[1:], value[:1])
+	if !ok {
+		return ""
+	}
+	return value
+}
+
+// ifCondition returns the condition in an if tag's cond=..., everything
+// after the '=' with any quotes around it removed, or "" if it has none
+func ifCondition(attrs string) string {
+	_, value, ok := strings.Cut(attrs, "cond")
+	if !ok {
+		return ""
+	}
+	value, ok = strings.CutPrefix(strings.TrimLeft(value, " \t"), "=")
+	if !ok {
+		return ""
+	}
+	value = strings.TrimSpace(value)
+	for _, quote := range []string{`"`, "'"} {
+		if inner, ok := strings.CutPrefix(value, quote); ok && strings.Index(inner, quote) == len(inner)-1 {
+			value = strings.TrimSuffix(inner, quote) // quoted as a whole
+			break
+		}
+	}
+	return value
+}
+
 // readTagName reads the name inside brackets
 func (l *Lexer) readTagName() string {
 	position := l.position
@@ -230,18 +912,221 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-// readString reads a quoted string
-func (l *Lexer) readString() string {
-	l.readChar() // consume opening quote
+// readReferenceName reads a variable name, allowing dotted names like build.time
+func (l *Lexer) readReferenceName() string {
 	position := l.position
-	for l.ch != '"' && l.ch != 0 {
+	for isLetter(l.ch) || isDigit(l.ch) || l.ch == '_' ||
+		(l.ch == '.' && (isLetter(l.peekChar()) || l.peekChar() == '_')) {
 		l.readChar()
 	}
-	str := l.input[position:l.position]
-	if l.ch == '"' {
+	return l.input[position:l.position]
+}
+
+// readString reads a string in double or single quotes, decoding the
+// escapes \", \', \\, \n, \t and \$. Any other backslash is kept as
+// written, so paths like "C:\Users" still work. If the string has ${name} references, its text and
+// references are also returned as STRING and DOLLAR tokens, in order;
+// the text then shows the references as written.
+func (l *Lexer) readString() (string, []tokens.Token) {
+	quote := l.ch
+	l.readChar() // consume opening quote
+	var sb, part strings.Builder
+	var parts []tokens.Token
+	for l.ch != quote && l.ch != 0 {
+		if l.ch == '$' && l.peekChar() == '{' {
+			if call, text, ok := l.callInterpolation(quote); ok {
+				if part.Len() > 0 {
+					parts = append(parts, tokens.Token{Type: tokens.STRING, Literal: part.String()})
+					part.Reset()
+				}
+				parts = append(parts, call...)
+				sb.WriteString(text)
+				continue
+			}
+			if name, ok := l.interpolation(); ok {
+				if part.Len() > 0 {
+					parts = append(parts, tokens.Token{Type: tokens.STRING, Literal: part.String()})
+					part.Reset()
+				}
+				parts = append(parts, tokens.Token{Type: tokens.DOLLAR, Literal: name})
+				sb.WriteString("${" + name + "}")
+				continue
+			}
+		}
+		if l.ch == '\\' {
+			if escaped, ok := stringEscapes[l.peekChar()]; ok {
+				sb.WriteByte(escaped)
+				part.WriteByte(escaped)
+				l.readChar()
+				l.readChar()
+				continue
+			}
+		}
+		sb.WriteRune(l.ch)
+		part.WriteRune(l.ch)
+		l.readChar()
+	}
+	if l.ch == quote {
 		l.readChar() // consume closing quote
 	}
-	return str
+
+	if parts != nil && part.Len() > 0 {
+		parts = append(parts, tokens.Token{Type: tokens.STRING, Literal: part.String()})
+	}
+	return sb.String(), parts
+}
+
+// interpolation reads a ${name} reference at the current position. If
+// what follows "${" isn't a reference name and "}", nothing is read and
+// ok is false, leaving the text as it is.
+func (l *Lexer) interpolation() (name string, ok bool) {
+	rest := l.input[l.position+2:]
+	end := strings.IndexByte(rest, '}')
+	if end < 0 {
+		return "", false
+	}
+	name = strings.TrimSpace(rest[:end])
+	if first := firstRune(name); name == "" || !isLetter(first) && first != '_' {
+		return "", false
+	}
+	for _, c := range name {
+		if !isLetter(c) && !isDigit(c) && c != '_' && c != '.' {
+			return "", false
+		}
+	}
+
+	for stop := l.position + end + 3; l.position < stop; {
+		l.readChar() // consume "${", the name, and "}"
+	}
+	return name, true
+}
+
+// callInterpolation reads a ${name(args)} call to a build-time function
+// at the current position, like ${currency($price, 'EUR')}, as the tokens
+// of the call. Strings in it are written in the other quote from the
+// string's. If what follows "${" isn't a call and "}", nothing is read
+// and ok is false.
+func (l *Lexer) callInterpolation(quote rune) (call []tokens.Token, text string, ok bool) {
+	rest := l.input[l.position+2:]
+	inner := strings.TrimLeft(rest, " \t")
+	name := inner[:len(inner)-len(strings.TrimLeftFunc(inner, isLetter))]
+	if !callFunctions[name] || !strings.HasPrefix(inner[len(name):], "(") {
+		return nil, "", false
+	}
+
+	// Find the ')' closing the call, outside the strings in it
+	end, depth, inString := -1, 0, rune(0)
+	for i, c := range inner {
+		if c == quote || c == '\n' {
+			return nil, "", false
+		}
+		switch {
+		case inString != 0:
+			if c == inString {
+				inString = 0
+			}
+		case c == '"' || c == '\'':
+			inString = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		}
+		if depth == 0 && c == ')' {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, "", false
+	}
+	after := strings.TrimLeft(inner[end+1:], " \t")
+	if !strings.HasPrefix(after, "}") {
+		return nil, "", false
+	}
+
+	sub := New(inner[:end+1])
+	sub.prev = tokens.Token{Type: tokens.EQUALS} // What follows is a value, not text
+	for tok := sub.NextToken(); tok.Type != tokens.EOF; tok = sub.NextToken() {
+		if tok.Type == tokens.ILLEGAL {
+			return nil, "", false
+		}
+		call = append(call, tok)
+	}
+	if sub.Err() != nil {
+		return nil, "", false
+	}
+
+	length := len(l.input[l.position:]) - len(after) + 1
+	text = l.input[l.position : l.position+length]
+	for stop := l.position + length; l.position < stop; {
+		l.readChar() // consume "${", the call, and "}"
+	}
+	return call, text, true
+}
+
+// readTextBlock reads a triple-quoted string. Its text is taken as written,
+// without escapes, from the line after the opening quotes to the line
+// before the closing ones, with the indentation its lines share removed.
+func (l *Lexer) readTextBlock() string {
+	for i := 0; i < 3; i++ {
+		l.readChar() // consume opening quotes
+	}
+	position := l.position
+	for l.ch != 0 && !strings.HasPrefix(l.input[l.position:], `"""`) {
+		l.readChar()
+	}
+	text := l.input[position:l.position]
+	for i := 0; i < 3 && l.ch != 0; i++ {
+		l.readChar() // consume closing quotes
+	}
+	return dedent(text)
+}
+
+// dedent lays out a text block's contents: a blank first or last line is
+// dropped, since the quotes sit on lines of their own, and the leading
+// whitespace common to the non-blank lines is removed
+func dedent(text string) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) > 1 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	common, first := "", true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			common, first = indent, false
+		}
+		for !strings.HasPrefix(indent, common) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, common)
+		if strings.TrimSpace(lines[i]) == "" {
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stringEscapes maps the character after a backslash in a string to the
+// character it stands for
+var stringEscapes = map[rune]byte{
+	'"':  '"',
+	'\'': '\'',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+	'$':  '$',
 }
 
 // readVariableReference reads a variable reference like $label_name
@@ -251,7 +1136,7 @@ func (l *Lexer) readVariableReference() tokens.Token {
 
 	l.readChar() // consume '$'
 
-	varName := l.readIdentifier()
+	varName := l.readReferenceName()
 
 	return tokens.Token{
 		Type:    tokens.DOLLAR,
@@ -261,15 +1146,63 @@ func (l *Lexer) readVariableReference() tokens.Token {
 	}
 }
 
-// skipWhitespace skips spaces and tabs (but not newlines)
+// skipWhitespace skips whitespace, and comments unless they're kept
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' || l.ch == '\n' {
+	for {
+		for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' || l.ch == '\n' {
+			l.readChar()
+		}
+		if l.keepComments || !l.atComment() {
+			return
+		}
+		tok := tokens.Token{Type: tokens.COMMENT, Line: l.line, Column: l.column}
+		tok.Literal = l.readComment()
+		tok.EndLine, tok.EndColumn = l.endLine, l.endColumn
+		l.comments = append(l.comments, tok)
+	}
+}
+
+// atComment reports whether a // line comment or a closed /* block
+// comment */ starts at the current character
+func (l *Lexer) atComment() bool {
+	if l.ch != '/' {
+		return false
+	}
+	switch l.peekChar() {
+	case '/':
+		return true
+	case '*':
+		for l.src != nil && !strings.Contains(l.input[l.readPosition+1:], "*/") {
+			l.fill() // the comment may end past what's been read
+		}
+		return strings.Contains(l.input[l.readPosition+1:], "*/")
+	}
+	return false
+}
+
+// readComment reads the comment at the current character, delimiters
+// included. Line comments end before the newline.
+func (l *Lexer) readComment() string {
+	position := l.position
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return strings.TrimRight(l.input[position:l.position], "\r")
+	}
+
+	l.readChar() // consume '/'
+	l.readChar() // consume '*'
+	for !(l.ch == '*' && l.peekChar() == '/') {
 		l.readChar()
 	}
+	l.readChar() // consume '*'
+	l.readChar() // consume '/'
+	return l.input[position:l.position]
 }
 
 // newToken creates a new token
-func newToken(tokenType tokens.TokenType, ch byte, line, col int) tokens.Token {
+func newToken(tokenType tokens.TokenType, ch rune, line, col int) tokens.Token {
 	return tokens.Token{
 		Type:    tokenType,
 		Literal: string(ch),
@@ -278,17 +1211,23 @@ func newToken(tokenType tokens.TokenType, ch byte, line, col int) tokens.Token {
 	}
 }
 
-// isLetter checks if character is a letter
-func isLetter(ch byte) bool {
-	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+// isLetter checks if character is a letter, in any script
+func isLetter(ch rune) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+// firstRune returns the first character of s
+func firstRune(s string) rune {
+	ch, _ := utf8.DecodeRuneInString(s)
+	return ch
 }
 
 // isDigit checks if character is a digit
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
 // isTagChar checks if character can be part of a tag name (letters, digits, hyphen)
-func isTagChar(ch byte) bool {
+func isTagChar(ch rune) bool {
 	return isLetter(ch) || isDigit(ch) || ch == '-' || ch == '_'
 }
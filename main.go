@@ -1,73 +1,222 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"lpml/config"
 	"lpml/generator"
-	"lpml/lexer"
-	"lpml/parser"
+	"lpml/plugins"
 )
 
+// version is set at release time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// commands maps each subcommand to its entry point, which returns the
+// exit status
+var commands = map[string]func(args []string) int{
+	"build":    runBuild,
+	"check":    runCheck,
+	"fmt":      runFmt,
+	"migrate":  runMigrate,
+	"describe": runDescribe,
+	"serve":    runServe,
+	"version":  runVersion,
+	"doctor":   runDoctor,
+	"stats":    runStats,
+	"clean":    runClean,
+	"new":      runNew,
+	"diff":     runDiff,
+	"ast":      runAST,
+}
+
+// plainOutput lists commands whose output is read by other programs, so
+// the banner would get in the way
+var plainOutput = map[string]bool{
+	"describe": true,
+	"version":  true,
+	"ast":      true,
+}
+
 func main() {
-	fmt.Println("LAZY PAGE MAKER LANG")
+	if len(os.Args) < 2 || !plainOutput[os.Args[1]] {
+		fmt.Println("LAZY PAGE MAKER LANG")
+	}
 
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: lpml <input.lpml> [output.html]")
-		fmt.Println("  If output file is not specified, it will use the input filename with .html extension")
-		os.Exit(1)
+		usage()
+		os.Exit(exitUsage)
 	}
 
-	inputFile := os.Args[1]
-
-	// Validate file extension
-	if !checkFileType(inputFile) {
-		log.Fatal("Invalid file type: needs to end in suffix .lpml")
+	switch os.Args[1] {
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
 	}
 
-	// Determine output file
-	outputFile := strings.TrimSuffix(inputFile, ".lpml") + ".html"
-	if len(os.Args) >= 3 {
-		outputFile = os.Args[2]
+	if run, ok := commands[os.Args[1]]; ok {
+		os.Exit(run(os.Args[2:]))
 	}
 
-	// Read input file
-	content, err := os.ReadFile(inputFile)
-	if err != nil {
-		log.Fatalf("Failed to read file: %v", err)
+	// Anything else is the original `lpml [flags] <input>` form of build
+	os.Exit(runBuild(os.Args[1:]))
+}
+
+func usage() {
+	fmt.Println("Usage: lpml <command> [flags] [arguments]")
+	fmt.Println("Commands:")
+	fmt.Println("  build    Compile a .lpml file or every page in a directory")
+	fmt.Println("  check    Parse and resolve references without writing output")
+	fmt.Println("  fmt      Rewrite sources in canonical layout")
+	fmt.Println("  migrate  Rewrite sources written for older versions of LPML")
+	fmt.Println("  serve    Preview a directory over HTTP, rebuilding pages on each request")
+	fmt.Println("  describe Print a tag's properties and an example")
+	fmt.Println("  version  Print the lpml version")
+	fmt.Println("  doctor   Diagnose problems in a project directory")
+	fmt.Println("  stats    Print word counts and reading times")
+	fmt.Println("  clean    Remove the files the last directory build wrote")
+	fmt.Println("  new      Create a starter project from a template")
+	fmt.Println("  diff     Compare two versions of a page element by element")
+	fmt.Println("  ast      Print a file's parsed document as JSON")
+	fmt.Println("Run `lpml <command> -h` for a command's flags.")
+	fmt.Println("`lpml [flags] <input.lpml> [output.html]` is shorthand for build.")
+}
+
+// parseInterspersed parses flags that may appear before, between, or after
+// positional arguments, returning the positional arguments in order
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
+}
+
+// flagsSet returns the names of the flags given on the command line
+func flagsSet(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
 
-	// Lex the input
-	l := lexer.New(string(content))
+// setValues collects repeated --set name=value flags
+type setValues map[string]string
 
-	// Parse into AST
-	p := parser.New(l)
-	doc := p.ParseDocument()
+func (s setValues) String() string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + s[name]
+	}
+	return strings.Join(names, ",")
+}
 
-	// Check for parsing errors
-	if len(p.Errors()) > 0 {
-		fmt.Println("Parsing errors:")
-		for _, e := range p.Errors() {
-			fmt.Printf("  - %s\n", e)
+// Set adds one name=value; a $ before the name is allowed
+func (s setValues) Set(arg string) error {
+	name, value, ok := strings.Cut(arg, "=")
+	name = strings.TrimPrefix(strings.TrimSpace(name), "$")
+	if !ok || name == "" {
+		return fmt.Errorf("want name=value, got %q", arg)
+	}
+	s[name] = value
+	return nil
+}
+
+// runVersion prints the lpml version, and the tags that left subsystems
+// out if any did. Builds without an -ldflags version fall back to the
+// module version or VCS revision Go recorded.
+func runVersion(args []string) int {
+	v := version
+	if info, ok := debug.ReadBuildInfo(); ok && v == "dev" {
+		if info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		} else {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" && len(s.Value) >= 7 {
+					v += " (" + s.Value[:7] + ")"
+				}
+			}
 		}
-		os.Exit(1)
 	}
+	fmt.Printf("lpml %s\n", v)
+	if tags := missingFeatures(); len(tags) > 0 {
+		fmt.Printf("built with -tags %s\n", strings.Join(tags, ","))
+	}
+	return exitOK
+}
+
+func checkFileType(filename string) bool {
+	return strings.HasSuffix(filename, ".lpml")
+}
 
-	// Generate HTML
-	gen := generator.New()
-	html := gen.Generate(doc)
+// applyBaseCSS sets the base stylesheet from a -base-css value, reading
+// anything that isn't a built-in mode as a CSS file
+func applyBaseCSS(opts *generator.Options, spec string) error {
+	switch spec {
+	case "", generator.BaseCSSDefault, generator.BaseCSSNone, generator.BaseCSSReset:
+		opts.BaseCSS = spec
+		return nil
+	}
 
-	// Write output file
-	err = os.WriteFile(outputFile, []byte(html), 0644)
+	css, err := os.ReadFile(spec)
 	if err != nil {
-		log.Fatalf("Failed to write output file: %v", err)
+		return err
+	}
+	opts.BaseCSS = generator.BaseCSSCustom
+	opts.CustomCSS = string(css)
+	return nil
+}
+
+// loadPlugins registers the custom tags of a project file's plugins and
+// returns their renderers. Without a project file there are none.
+func loadPlugins(projectFile *config.Config) (map[string]generator.TagRenderer, error) {
+	if projectFile == nil {
+		return nil, nil
 	}
+	return plugins.Register(projectFile.Plugins, filepath.Dir(projectFile.Path))
+}
 
-	fmt.Printf("Successfully generated: %s\n", outputFile)
+// buildTime returns when the build runs: now, or SOURCE_DATE_EPOCH if
+// it's set, for reproducible builds
+func buildTime() time.Time {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if secs, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(secs, 0)
+		}
+	}
+	return time.Now()
 }
 
-func checkFileType(filename string) bool {
-	return strings.HasSuffix(filename, ".lpml")
+// buildInfo collects build metadata for the given source file, stamped
+// with the buildTime
+func buildInfo(inputFile string) *generator.BuildInfo {
+	bi := &generator.BuildInfo{
+		Time:   buildTime(),
+		Source: filepath.Base(inputFile),
+	}
+
+	// The commit is best-effort: sources outside a git checkout just omit it
+	cmd := exec.Command("git", "rev-parse", "--short", "HEAD")
+	cmd.Dir = filepath.Dir(inputFile)
+	if out, err := cmd.Output(); err == nil {
+		bi.Commit = strings.TrimSpace(string(out))
+	}
+
+	return bi
 }
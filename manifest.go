@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// manifestName is the file -manifest writes in a build's output directory
+const manifestName = "manifest.json"
+
+// manifest lists every file a build produced, so deployment tools can
+// upload only what changed and check what arrived
+type manifest struct {
+	dir  string                  // Directory the manifest is written to; paths are relative to it
+	root string                  // Directory sources are named relative to
+	list map[string]manifestFile // By path relative to dir, with forward slashes
+}
+
+// manifestFile is one generated file
+type manifestFile struct {
+	SHA256 string `json:"sha256"` // Hex digest of its contents
+	Size   int64  `json:"size"`
+	Source string `json:"source"` // The page or asset it came from, relative to the project
+}
+
+// newManifest starts an empty manifest for a build writing into dir from
+// sources under root
+func newManifest(dir, root string) *manifest {
+	return &manifest{dir: dir, root: root, list: make(map[string]manifestFile)}
+}
+
+// add hashes the file at path and records it as generated from source
+func (m *manifest) add(path, source string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	m.list[relSlash(m.dir, path)] = manifestFile{
+		SHA256: hex.EncodeToString(sum[:]),
+		Size:   int64(len(content)),
+		Source: relSlash(m.root, source),
+	}
+	return nil
+}
+
+// has reports whether the file at path is listed already
+func (m *manifest) has(path string) bool {
+	_, ok := m.list[relSlash(m.dir, path)]
+	return ok
+}
+
+// addDir records every file under to, copied from the same path under from
+func (m *manifest) addDir(from, to string) error {
+	return filepath.WalkDir(to, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(to, path)
+		if err != nil {
+			return err
+		}
+		return m.add(path, filepath.Join(from, rel))
+	})
+}
+
+// save writes the manifest, its files in path order
+func (m *manifest) save() error {
+	content, err := json.MarshalIndent(struct {
+		Files map[string]manifestFile `json:"files"`
+	}{m.list}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(filepath.Join(m.dir, manifestName), append(content, '\n'))
+}
+
+// relSlash returns path relative to dir with forward slashes, or path
+// itself if it can't be made relative
+func relSlash(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
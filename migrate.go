@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"lpml/format"
+	"lpml/generator"
+	"lpml/lexer"
+	"lpml/migrate"
+	"lpml/parser"
+)
+
+// runMigrate rewrites source files written for older versions of LPML in
+// the current language. A file is only rewritten if its page comes out the
+// same, so a migration can't change a site by accident. With -l it only
+// lists the changes. It returns the exit status.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	list := fs.Bool("l", false, "list the changes each file needs instead of rewriting it")
+	formatSource := fs.Bool("fmt", false, "also rewrite migrated files in canonical layout, as lpml fmt does")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml migrate [-l] [-fmt] [file.lpml | dir]...")
+		fmt.Println("  Rewrites sources for the current language (default: every .lpml under the current directory)")
+		fmt.Println("Migrations:")
+		for _, m := range migrate.Migrations {
+			fmt.Printf("  %-12s %s\n", m.Name, m.Description)
+		}
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	sources, status := sourceFiles(parseInterspersed(fs, args))
+	if status != exitOK {
+		return status
+	}
+
+	for _, source := range sources {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			fmt.Printf("Failed to read file: %v\n", err)
+			status = firstFailure(status, exitIO)
+			continue
+		}
+
+		migrated, changes, err := migrate.Source(string(content))
+		if err != nil {
+			fmt.Printf("%s: %v\n", source, err)
+			status = firstFailure(status, exitParse)
+			continue
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		if *list {
+			fmt.Printf("%s:\n", source)
+			for _, c := range changes {
+				fmt.Printf("  %s\n", c)
+			}
+			status = firstFailure(status, exitFailure)
+			continue
+		}
+
+		if !samePage(source, string(content), migrated) {
+			fmt.Printf("%s: not migrated, since the page it generates would change\n", source)
+			status = firstFailure(status, exitFailure)
+			continue
+		}
+		if *formatSource {
+			if migrated, err = format.Source(migrated); err != nil {
+				fmt.Printf("%s: %v\n", source, err)
+				status = firstFailure(status, exitParse)
+				continue
+			}
+		}
+		if err := os.WriteFile(source, []byte(migrated), 0644); err != nil {
+			fmt.Printf("Failed to write file: %v\n", err)
+			status = firstFailure(status, exitIO)
+			continue
+		}
+		fmt.Printf("Migrated: %s\n", source)
+		for _, c := range changes {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+
+	return status
+}
+
+// samePage reports whether two versions of a source generate the same
+// page, at the same moment for now(). Includes aren't followed, as
+// migrate.Source doesn't follow them.
+func samePage(source, before, after string) bool {
+	opts := generator.Options{SourceFile: source, Now: time.Now()}
+	page := func(src string) string {
+		doc := parser.New(lexer.New(src)).ParseDocument()
+		return generator.NewWithOptions(opts).Generate(doc)
+	}
+	return page(before) == page(after)
+}
@@ -0,0 +1,221 @@
+// Package migrate rewrites sources written for older versions of LPML in
+// the current language: properties under the names they have now, and
+// values in the types they take. Each rewrite is a Migration, and Migrations
+// lists them all, so a release that changes the language adds one for the
+// sources written before it.
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"lpml/ast"
+	"lpml/lexer"
+	"lpml/parser"
+	"lpml/schema"
+	"lpml/tokens"
+)
+
+// Migration is a change to the language that sources written before it
+// can be rewritten for
+type Migration struct {
+	Name        string // Short name, like "link-url"
+	Description string // What it rewrites
+
+	// rewrite makes the migration's edits to one element of a tag the
+	// schema describes
+	rewrite func(s *source, elem *ast.Element, tag schema.Tag)
+}
+
+// Migrations are every rewrite Source makes, in the order it makes them
+var Migrations = []Migration{
+	{
+		Name:        "link-url",
+		Description: "href, the old name of link_url, is link_url",
+		rewrite:     renameProperty("href", "link_url"),
+	},
+	{
+		Name:        "bool-flags",
+		Description: `Flags written as the strings "true" and "false" are the booleans true and false`,
+		rewrite:     boolFlags,
+	},
+}
+
+// Change is one rewrite Source made
+type Change struct {
+	Line      int    // Where in the source it is
+	Migration string // Name of the Migration that made it
+	Message   string // What was rewritten
+}
+
+// String formats the change as "line 3: message"
+func (c Change) String() string {
+	return fmt.Sprintf("line %d: %s", c.Line, c.Message)
+}
+
+// Source returns src with every Migration made, and the changes, in source
+// order. Only the tokens a migration rewrites change; layout and comments
+// are kept as written. Includes aren't followed, so each file is migrated
+// on its own. Sources that don't parse cleanly are returned as an error
+// rather than guessed at.
+func Source(src string) (string, []Change, error) {
+	p := parser.New(lexer.New(src))
+	doc := p.ParseDocument()
+	if len(p.Errors()) > 0 {
+		return "", nil, fmt.Errorf("%s", strings.Join(p.Errors(), "; "))
+	}
+
+	s := &source{names: propertyNames(src)}
+	for _, m := range Migrations {
+		s.migration = m.Name
+		ast.Walk(doc, visitor(func(elem *ast.Element) {
+			// Custom tags' properties are for their plugins to read
+			if tag, ok := schema.Lookup(elem.TagType); ok {
+				m.rewrite(s, elem, tag)
+			}
+		}))
+	}
+	if len(s.edits) == 0 {
+		return src, nil, nil
+	}
+	sort.SliceStable(s.edits, func(i, j int) bool { return s.edits[i].before(s.edits[j]) })
+	out, err := s.apply(src)
+	if err != nil {
+		return "", nil, err
+	}
+
+	changes := make([]Change, len(s.edits))
+	for i, e := range s.edits {
+		changes[i] = e.change
+	}
+	return out, changes, nil
+}
+
+// visitor is called with each element ast.Walk visits
+type visitor func(elem *ast.Element)
+
+func (v visitor) Visit(node ast.Node) ast.Visitor {
+	if elem, ok := node.(*ast.Element); ok {
+		v(elem)
+	}
+	return v
+}
+
+// renameProperty returns a rewrite giving a property written under an old
+// name its new one. An element that has both keeps them, since the new
+// name's value is the one used.
+func renameProperty(old, name string) func(s *source, elem *ast.Element, tag schema.Tag) {
+	return func(s *source, elem *ast.Element, tag schema.Tag) {
+		val, ok := elem.Properties[old]
+		if !ok || elem.Properties[name] != nil {
+			return
+		}
+		if tok, ok := s.names[val.Pos()]; ok {
+			s.edit(tok.Line, tok.Column, tok.EndLine, tok.EndColumn, name, "%s is now %s", old, name)
+		}
+	}
+}
+
+// boolFlags rewrites "true" and "false" given to a flag as booleans
+func boolFlags(s *source, elem *ast.Element, tag schema.Tag) {
+	for _, prop := range tag.AllProperties() {
+		if prop.Type != schema.TypeBool {
+			continue
+		}
+		str, ok := elem.Properties[prop.Name].(*ast.StringValue)
+		if !ok || str.Value != "true" && str.Value != "false" {
+			continue
+		}
+		start, end := str.Start(), str.End()
+		s.edit(start.Line, start.Column, end.Line, end.Column, str.Value, "%s = %q is now %s = %s", prop.Name, str.Value, prop.Name, str.Value)
+	}
+}
+
+// source is a document being migrated
+type source struct {
+	names     map[ast.Position]tokens.Token // Property names by where their values start
+	migration string                        // The migration making edits
+	edits     []edit
+}
+
+// edit is text replacing a span of the source, from the start line and
+// column up to but not including the end ones
+type edit struct {
+	line, column       int
+	endLine, endColumn int
+	text               string
+	change             Change
+}
+
+// edit replaces a span of the source with text, noting the change
+func (s *source) edit(line, column, endLine, endColumn int, text, format string, args ...any) {
+	s.edits = append(s.edits, edit{
+		line: line, column: column, endLine: endLine, endColumn: endColumn, text: text,
+		change: Change{Line: line, Migration: s.migration, Message: fmt.Sprintf(format, args...)},
+	})
+}
+
+// before reports whether e starts before other
+func (e edit) before(other edit) bool {
+	return e.line < other.line || e.line == other.line && e.column < other.column
+}
+
+// apply returns src with the edits, which are in source order, made
+func (s *source) apply(src string) (string, error) {
+	var sb strings.Builder
+	at := 0
+	for _, e := range s.edits {
+		start, ok := offset(src, e.line, e.column)
+		end, endOK := offset(src, e.endLine, e.endColumn)
+		if !ok || !endOK || start < at || end < start {
+			return "", fmt.Errorf("line %d: can't rewrite %s", e.line, e.change.Message)
+		}
+		sb.WriteString(src[at:start])
+		sb.WriteString(e.text)
+		at = end
+	}
+	sb.WriteString(src[at:])
+	return sb.String(), nil
+}
+
+// offset returns the byte offset of a 1-based line and column, counted in
+// characters as the lexer counts them
+func offset(src string, line, column int) (int, bool) {
+	i := 0
+	for l := 1; l < line; l++ {
+		next := strings.IndexByte(src[i:], '\n')
+		if next < 0 {
+			return 0, false
+		}
+		i += next + 1
+	}
+	for c := 1; c < column; c++ {
+		if i >= len(src) || src[i] == '\n' {
+			return 0, false
+		}
+		_, width := utf8.DecodeRuneInString(src[i:])
+		i += width
+	}
+	return i, true
+}
+
+// propertyNames maps where each property's value starts to the property's
+// name, for rewrites to find the name of a value the parser kept
+func propertyNames(src string) map[ast.Position]tokens.Token {
+	names := make(map[ast.Position]tokens.Token)
+	l := lexer.New(src)
+	var prev, name tokens.Token
+	for tok := l.NextToken(); tok.Type != tokens.EOF; tok = l.NextToken() {
+		if name.Type == tokens.IDENT {
+			names[ast.Position{Line: tok.Line, Column: tok.Column}] = name
+			name = tokens.Token{}
+		}
+		if tok.Type == tokens.EQUALS && prev.Type == tokens.IDENT {
+			name = prev
+		}
+		prev = tok
+	}
+	return names
+}
@@ -0,0 +1,91 @@
+package minify
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// rawTextElements keep their text exactly as written
+var rawTextElements = map[string]bool{
+	"pre": true, "textarea": true, "script": true,
+}
+
+// spaceRun matches a run of collapsible whitespace
+var spaceRun = regexp.MustCompile(`\s+`)
+
+// HTML strips indentation and line breaks from generated HTML. Whitespace
+// that only separates tags across lines is dropped, other runs of
+// whitespace collapse to a single space, and <pre>, <textarea>, and
+// <script> contents are left untouched. Tags are copied as written.
+func HTML(src []byte) ([]byte, error) {
+	var out bytes.Buffer
+	raw := 0 // Depth inside raw text elements
+	inStyle := false
+
+	z := html.NewTokenizer(bytes.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+
+		tok := z.Raw()
+		name, _ := z.TagName()
+		tag := string(name)
+
+		switch tt {
+		case html.StartTagToken:
+			if rawTextElements[tag] {
+				raw++
+			}
+			if tag == "style" {
+				inStyle = true
+			}
+			out.Write(tok)
+		case html.EndTagToken:
+			if rawTextElements[tag] && raw > 0 {
+				raw--
+			}
+			if tag == "style" {
+				inStyle = false
+			}
+			out.Write(tok)
+		case html.TextToken:
+			out.WriteString(minifyText(string(tok), raw > 0, inStyle))
+		case html.DoctypeToken:
+			out.Write(tok)
+			out.WriteString("\n")
+		default:
+			out.Write(tok)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// minifyText shrinks one run of text between tags
+func minifyText(text string, raw, style bool) string {
+	if raw {
+		return text
+	}
+	if style {
+		var lines []string
+		for _, line := range strings.Split(text, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "")
+	}
+	if strings.TrimSpace(text) == "" && strings.Contains(text, "\n") {
+		return ""
+	}
+	return spaceRun.ReplaceAllString(text, " ")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"lpml/templates"
+)
+
+// runNew scaffolds a starter project from one of the embedded templates.
+// It returns the exit status.
+func runNew(args []string) int {
+	fs := flag.NewFlagSet("new", flag.ExitOnError)
+	template := fs.String("template", templates.Default, "starter project: "+strings.Join(templates.Names(), ", "))
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml new [flags] <dir>")
+		fmt.Println("  Creates a working example project in dir, ready for `lpml build <dir>`")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	dir := positional[0]
+
+	written, err := templates.Write(*template, dir)
+	if err != nil {
+		fmt.Printf("Failed to create project: %v\n", err)
+		if len(written) == 0 {
+			return exitUsage
+		}
+		return exitIO
+	}
+	for _, path := range written {
+		fmt.Printf("Created: %s\n", path)
+	}
+	fmt.Printf("Build it with: lpml build %s\n", dir)
+	return exitOK
+}
@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"sort"
+
+	"lpml/ast"
+)
+
+// attachComments makes comments of those the lexer skipped, and adds
+// them to the comment map, each leading or trailing the node under roots
+// beside it. Nodes spliced in from an included file are left out, having
+// comments of their own. It returns the comments in source order.
+func (p *Parser) attachComments(roots []ast.Node) []*ast.Comment {
+	skipped := p.l.Comments()
+	if len(skipped) == 0 {
+		return nil
+	}
+	if p.comments.Leading == nil {
+		p.comments.Leading = make(map[ast.Node][]*ast.Comment)
+		p.comments.Trailing = make(map[ast.Node]*ast.Comment)
+	}
+
+	// The nodes in walk order, outermost first, then sorted stably so the
+	// outermost of those starting or ending at one place comes first
+	var nodes []ast.Node
+	for _, root := range roots {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if n == nil || p.spliced[n] {
+				return false
+			}
+			if _, isDoc := n.(*ast.Document); !isDoc && n.Start().Line > 0 {
+				nodes = append(nodes, n)
+			}
+			return true
+		})
+	}
+	byStart := append([]ast.Node{}, nodes...)
+	sort.SliceStable(byStart, func(i, j int) bool { return before(byStart[i].Start(), byStart[j].Start()) })
+	byEnd := nodes
+	sort.SliceStable(byEnd, func(i, j int) bool { return before(byEnd[i].End(), byEnd[j].End()) })
+
+	comments := make([]*ast.Comment, len(skipped))
+	for i, tok := range skipped {
+		comments[i] = &ast.Comment{Token: tok, Text: tok.Literal}
+	}
+	var group []*ast.Comment // Comments on consecutive lines, leading whatever comes next
+	for i, c := range comments {
+		if len(group) == 0 {
+			if n := trailed(byStart, byEnd, c); n != nil && p.comments.Trailing[n] == nil {
+				p.comments.Trailing[n] = c
+				continue
+			}
+		}
+		group = append(group, c)
+
+		var next *ast.Comment
+		if i+1 < len(comments) {
+			next = comments[i+1]
+		}
+		if n := led(byStart, c); n != nil && (next == nil || before(n.Start(), next.Start())) {
+			p.comments.Leading[n] = append(p.comments.Leading[n], group...)
+			group = nil
+		} else if next == nil || next.Start().Line > c.End().Line+1 {
+			group = nil // A blank line, or nothing, comes after it
+		}
+	}
+	return comments
+}
+
+// trailed returns the node c trails: the outermost of those ending last
+// before c on the line it starts on, or if none ends there, the innermost
+// starting there before it, like an element after its opening tag; nil if
+// there's neither
+func trailed(byStart, byEnd []ast.Node, c *ast.Comment) ast.Node {
+	line := c.Start().Line
+	i := sort.Search(len(byEnd), func(i int) bool { return before(c.Start(), byEnd[i].End()) })
+	if i > 0 && byEnd[i-1].End().Line == line {
+		for i > 1 && byEnd[i-2].End() == byEnd[i-1].End() {
+			i--
+		}
+		return byEnd[i-1]
+	}
+	j := sort.Search(len(byStart), func(j int) bool { return !before(byStart[j].Start(), c.Start()) })
+	if j > 0 && byStart[j-1].Start().Line == line {
+		return byStart[j-1]
+	}
+	return nil
+}
+
+// led returns the node the group of comments ending with c leads: the
+// outermost of those starting first after it, on its last line or the
+// next, or nil
+func led(byStart []ast.Node, c *ast.Comment) ast.Node {
+	i := sort.Search(len(byStart), func(i int) bool { return !before(byStart[i].Start(), c.End()) })
+	if i == len(byStart) || byStart[i].Start().Line > c.End().Line+1 {
+		return nil
+	}
+	return byStart[i]
+}
+
+// before reports whether position a comes before b
+func before(a, b ast.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
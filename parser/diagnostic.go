@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a parse error or warning with where it was found, so it
+// can be shown under the line of source it's about
+type Diagnostic struct {
+	File    string // Source file, "" when parsing text with no file
+	Line    int    // Line number, counting from 1
+	Column  int    // Column in characters, counting from 1; 0 for the whole line
+	Message string // What's wrong, without the position
+	Text    string // The source line, for the snippet
+	Rule    string // For a warning, the generator rule it comes under, like "property"
+}
+
+// String formats the diagnostic as file:line:column: message
+func (d Diagnostic) String() string {
+	pos := strconv.Itoa(d.Line)
+	if d.Column > 0 {
+		pos += ":" + strconv.Itoa(d.Column)
+	}
+	if d.File != "" {
+		pos = d.File + ":" + pos
+	}
+	return pos + ": " + d.Message
+}
+
+// Snippet returns the source line the diagnostic is on with a caret
+// under its column, each line ending in a newline:
+//
+//	12 |     contains "Hello"
+//	   |              ^
+//
+// Tabs before the column are kept so the caret lines up however they're
+// shown. It's "" when the line isn't known.
+func (d Diagnostic) Snippet() string {
+	if d.Line < 1 {
+		return ""
+	}
+	num := strconv.Itoa(d.Line)
+	gutter := strings.Repeat(" ", len(num))
+	snippet := fmt.Sprintf("%s | %s\n", num, d.Text)
+	if d.Column < 1 {
+		return snippet
+	}
+
+	var pad strings.Builder
+	col := 1
+	for _, ch := range d.Text {
+		if col >= d.Column {
+			break
+		}
+		if ch == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+		col++
+	}
+	pad.WriteString(strings.Repeat(" ", max(d.Column-col, 0)))
+	return snippet + fmt.Sprintf("%s | %s^\n", gutter, pad.String())
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lpml/lexer"
+)
+
+// FuzzParse fuzzes the lexer and parser, starting from the examples:
+// however malformed the input is, parsing it must give a document and
+// diagnostics. A failure they recovered from is a bug all the same.
+func FuzzParse(f *testing.F) {
+	examples, err := filepath.Glob(filepath.Join("..", "examples", "*.lpml"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range examples {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(data))
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseDocument()
+		if err := l.Err(); err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range p.Diagnostics() {
+			if strings.HasSuffix(d.Message, bugReport) {
+				t.Fatal(d.String())
+			}
+		}
+	})
+}
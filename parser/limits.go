@@ -0,0 +1,94 @@
+package parser
+
+import "lpml/tokens"
+
+// Limits bound how much of a document a Parser reads, so a pathological
+// source, like thousands of unclosed [divide-start] tags, gives an error
+// instead of exhausting the stack or memory. Past a limit the parser
+// reports it and reads no further.
+type Limits struct {
+	MaxDepth        int // Elements, blocks, maps, and calls nested in one another
+	MaxTokens       int // Tokens in the document, its included files' counted too
+	MaxIncludeDepth int // Files included in included files, in one another
+	MaxItems        int // Items in one array, or entries in one map
+}
+
+// DefaultLimits are the limits of a Parser SetLimits hasn't changed, far
+// beyond what any page written by hand reaches
+var DefaultLimits = Limits{MaxDepth: 256, MaxTokens: 1000000, MaxIncludeDepth: 32, MaxItems: 10000}
+
+// limitState is how much of its limits a document has used, shared with
+// the parsers of its included files
+type limitState struct {
+	Limits
+	depth   int
+	tokens  int
+	stopped bool // A limit was reached, so the rest of the source is skipped
+}
+
+// SetLimits changes the parser's limits. A limit left at 0 keeps its
+// value in DefaultLimits.
+func (p *Parser) SetLimits(limits Limits) {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultLimits.MaxDepth
+	}
+	if limits.MaxTokens <= 0 {
+		limits.MaxTokens = DefaultLimits.MaxTokens
+	}
+	if limits.MaxIncludeDepth <= 0 {
+		limits.MaxIncludeDepth = DefaultLimits.MaxIncludeDepth
+	}
+	if limits.MaxItems <= 0 {
+		limits.MaxItems = DefaultLimits.MaxItems
+	}
+	p.limits.Limits = limits
+}
+
+// descend notes that what's read next, starting at tok, is nested one
+// level deeper, to be undone with ascend. Past the depth limit it reports
+// an error and stops reading, returning false.
+func (p *Parser) descend(tok tokens.Token) bool {
+	if p.limits.depth >= p.limits.MaxDepth {
+		p.stop(tok, "nested more than %d deep, so the rest of the file isn't read", p.limits.MaxDepth)
+		return false
+	}
+	p.limits.depth++
+	return true
+}
+
+// ascend undoes a descend
+func (p *Parser) ascend() {
+	p.limits.depth--
+}
+
+// countToken counts a token read from the source, stopping reading
+// there once there are more than the limit allows
+func (p *Parser) countToken(tok tokens.Token) {
+	if p.limits.tokens++; p.limits.tokens > p.limits.MaxTokens {
+		p.stop(tok, "more than %d tokens, so the rest of the file isn't read", p.limits.MaxTokens)
+	}
+}
+
+// countItem notes that an array or map, what, starting at tok, has n
+// items. Past the limit it reports an error and stops reading, returning
+// false.
+func (p *Parser) countItem(tok tokens.Token, n int, what string) bool {
+	if n <= p.limits.MaxItems {
+		return true
+	}
+	p.stop(tok, "%s has more than %d items, so the rest of the file isn't read", what, p.limits.MaxItems)
+	return false
+}
+
+// stop reports a limit reached at tok and ends the source there: every
+// token read after it is EOF, and the errors of tags left unclosed
+// aren't reported
+func (p *Parser) stop(tok tokens.Token, format string, args ...any) {
+	if p.limits.stopped {
+		return
+	}
+	p.errorf(tok, format, args...)
+	p.limits.stopped = true
+	p.curToken = tokens.Token{Type: tokens.EOF, Line: tok.Line, Column: tok.Column}
+	p.peekToken = p.curToken
+}
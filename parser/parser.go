@@ -4,7 +4,12 @@ import (
 	"fmt"
 	"lpml/ast"
 	"lpml/lexer"
+	"lpml/schema"
 	"lpml/tokens"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
 )
 
 // Parser parses LPML tokens into an AST
@@ -12,75 +17,305 @@ type Parser struct {
 	l         *lexer.Lexer
 	curToken  tokens.Token
 	peekToken tokens.Token
-	errors    []string
+	lastToken tokens.Token // The last token read from the source before curToken, where the node just parsed ends
+	errors    []Diagnostic
+	warnings  []Diagnostic
+	file      string                          // Path of the source being parsed, for [include]
+	includes  *includeState                   // Shared with the parsers of included files; nil skips [include]
+	defines   map[string]ast.Value            // Constants from [define] blocks, shared with included files
+	definedAt map[string]Symbol               // Where each constant's name was last written, shared like defines
+	defining  bool                            // The properties being read are [define] constants
+	presets   map[string]map[string]ast.Value // Style bundles from [preset] blocks, shared like defines
+	indented  bool                            // The file starts with [indented], so indentation closes tags
+	inLine    bool                            // Reading the rest of a tag's line, whose indented lines belong to that tag
+	tag       string                          // The element or section whose properties are being read, for checking their names
+	comments  *ast.CommentMap                 // The document's comments, shared with included files
+	spliced   map[ast.Node]bool               // Nodes spliced in from included files, whose comments their parsers attach
+	limits    *limitState                     // How much of its limits the document has used, shared with included files
+	doc       *ast.Document                   // The document ParseDocument parsed, for Symbols
 }
 
-// New creates a new Parser
+// includeSite is where an [include] appears, which decides what the file
+// it names may hold
+type includeSite int
+
+const (
+	inFragment      includeSite = iota // In an included file: anything
+	betweenSections                    // At the top of a document: page sections
+	inElement                          // In a section or element: elements
+)
+
+// includeState tracks the files spliced in with [include]
+type includeState struct {
+	read  func(path string) ([]byte, error)
+	open  []string // Files being parsed, outermost first, to catch cycles
+	files []string // Every file included, in order
+}
+
+// New creates a new Parser. It skips [include] tags, having no file to
+// resolve their paths against; use NewForFile to splice them in.
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	return newParser(l, "")
+}
+
+// newParser creates a Parser for the source in file, which names it in
+// diagnostics
+func newParser(l *lexer.Lexer, file string) (p *Parser) {
+	p = &Parser{l: l, file: file, defines: make(map[string]ast.Value), definedAt: make(map[string]Symbol), presets: make(map[string]map[string]ast.Value),
+		comments: &ast.CommentMap{}, spliced: make(map[ast.Node]bool), limits: &limitState{Limits: DefaultLimits}}
+	defer p.recoverPanic()
 	// Read two tokens to initialize curToken and peekToken
 	p.nextToken()
 	p.nextToken()
+	if p.curToken.Type == tokens.INDENTED {
+		p.indented = true
+		p.nextToken()
+	}
 	return p
 }
 
-// Errors returns any parsing errors
+// NewForFile creates a Parser for the contents of file that splices in
+// the files its [include] tags name, resolved relative to the including
+// file and read with read
+func NewForFile(l *lexer.Lexer, file string, read func(path string) ([]byte, error)) *Parser {
+	p := newParser(l, file)
+	p.includes = &includeState{read: read, open: []string{filepath.Clean(file)}}
+	return p
+}
+
+// Errors returns any parsing errors as "line 3: message", prefixed with
+// the file's path for errors in an included file
 func (p *Parser) Errors() []string {
+	return p.messages(p.errors)
+}
+
+// Warnings returns problems that don't stop the document parsing, like a
+// property the tag doesn't have, formatted like Errors
+func (p *Parser) Warnings() []string {
+	return p.messages(p.warnings)
+}
+
+// messages formats diagnostics for Errors and Warnings
+func (p *Parser) messages(diags []Diagnostic) []string {
+	msgs := make([]string, len(diags))
+	for i, d := range diags {
+		msgs[i] = fmt.Sprintf("line %d: %s", d.Line, d.Message)
+		if d.File != p.file {
+			msgs[i] = d.File + ": " + msgs[i]
+		}
+	}
+	return msgs
+}
+
+// Diagnostics returns the parsing errors with their positions and source
+// lines, in the same order as Errors
+func (p *Parser) Diagnostics() []Diagnostic {
 	return p.errors
 }
 
-// nextToken advances to the next token
+// WarningDiagnostics returns the parsing warnings with their positions,
+// source lines, and rules, in the same order as Warnings
+func (p *Parser) WarningDiagnostics() []Diagnostic {
+	return p.warnings
+}
+
+// Includes returns every file spliced in with [include], directly or
+// through another included file, in the order they were read
+func (p *Parser) Includes() []string {
+	if p.includes == nil {
+		return nil
+	}
+	return p.includes.files
+}
+
+// nextToken advances to the next token. Unknown tags are reported and
+// skipped, so the rest of the document parses as if they weren't there.
 func (p *Parser) nextToken() {
+	if p.curToken.EndLine > 0 {
+		p.lastToken = p.curToken // INDENT and DEDENT have no end, not being in the source
+	}
 	p.curToken = p.peekToken
+	if p.limits.stopped {
+		// Past a limit, perhaps reached in a file this one includes, the
+		// source ends here
+		p.peekToken = tokens.Token{Type: tokens.EOF, Line: p.curToken.Line, Column: p.curToken.Column}
+		return
+	}
 	p.peekToken = p.l.NextToken()
+	p.countToken(p.peekToken)
+	for p.peekToken.Type == tokens.UNKNOWN_TAG {
+		if suggestion := tokens.SuggestTag(p.peekToken.Literal); suggestion != "" {
+			p.errorf(p.peekToken, "unknown tag [%s]; did you mean [%s]?", p.peekToken.Literal, suggestion)
+		} else {
+			p.errorf(p.peekToken, "unknown tag [%s]", p.peekToken.Literal)
+		}
+		p.peekToken = p.l.NextToken()
+		p.countToken(p.peekToken)
+	}
 }
 
-// ParseDocument parses the entire document
-func (p *Parser) ParseDocument() *ast.Document {
-	doc := &ast.Document{Sections: []*ast.PageSection{}}
+// ParseDocument parses the entire document. Whatever the input, it
+// returns one, with errors for what it couldn't parse: should the parser
+// fail, the document is as far as it got, with an error saying where.
+func (p *Parser) ParseDocument() (doc *ast.Document) {
+	doc = &ast.Document{Version: ast.Version, Sections: []*ast.PageSection{}}
+	p.doc = doc
+	defer p.recoverPanic()
 
 	for p.curToken.Type != tokens.EOF {
-		if ast.IsPageSection(p.curToken.Type) {
+		if p.curToken.Type == tokens.META {
+			p.parseMeta(doc)
+		} else if p.curToken.Type == tokens.DEFINE {
+			p.parseDefine()
+		} else if p.curToken.Type == tokens.PRESET {
+			p.parsePreset()
+		} else if p.curToken.Type == tokens.INCLUDE {
+			sections, _ := p.parseInclude(betweenSections)
+			doc.Sections = append(doc.Sections, sections...)
+		} else if ast.IsPageSection(p.curToken.Type) {
 			section := p.parsePageSection()
 			if section != nil {
 				doc.Sections = append(doc.Sections, section)
 			}
+		} else if p.curToken.Type == tokens.END {
+			p.errorf(p.curToken, "[end] has nothing to close")
+			p.nextToken()
+		} else if p.curToken.Type == tokens.INDENTED {
+			p.errorf(p.curToken, "[indented] must be the first tag in the file")
+			p.nextToken()
 		} else {
 			p.nextToken()
 		}
 	}
 
+	if len(p.defines) > 0 {
+		doc.Defines = p.defines
+	}
+	if len(p.presets) > 0 {
+		doc.Presets = p.presets
+	}
+	if err := p.l.Err(); err != nil {
+		p.errorf(p.curToken, "%v", err)
+	}
+	p.comments.List = p.attachComments([]ast.Node{doc})
+	if len(p.comments.List) > 0 || len(p.comments.Leading) > 0 || len(p.comments.Trailing) > 0 {
+		doc.Comments = p.comments
+	}
 	return doc
 }
 
+// parseMeta parses the [meta] front matter: the properties between [meta]
+// and the first page section
+func (p *Parser) parseMeta(doc *ast.Document) {
+	if len(doc.Sections) > 0 || doc.Meta != nil {
+		p.errorf(p.curToken, "[meta] must come once, before the page sections")
+	}
+	if doc.Meta == nil {
+		doc.Meta = make(map[string]ast.Value)
+	}
+	p.nextToken() // move past [meta]
+	p.parseBlockProperties(doc.Meta)
+}
+
+// parseDefine parses a [define] block: the constants between [define] and
+// the next tag
+func (p *Parser) parseDefine() {
+	p.nextToken() // move past [define]
+	p.defining = true
+	p.parseBlockProperties(p.defines)
+	p.defining = false
+}
+
+// parsePreset parses a [preset name="..."] block: the style properties up
+// to the next tag, which elements take with use_preset. A later preset of
+// the same name replaces an earlier one.
+func (p *Parser) parsePreset() {
+	tok := p.curToken
+	p.nextToken() // move past [preset]
+	props := make(map[string]ast.Value)
+	p.parseBlockProperties(props)
+	if tok.Literal == "" {
+		p.errorf(tok, "[preset] needs a name, like [preset name=\"card\"]")
+		return
+	}
+	p.presets[tok.Literal] = props
+}
+
+// parseBlockProperties parses the properties of [meta], [define], or
+// [preset], which run to the next tag, or in an indented file may be
+// indented under it
+func (p *Parser) parseBlockProperties(props map[string]ast.Value) {
+	if p.indented && p.curToken.Type == tokens.INDENT {
+		p.parseIndented(func() {
+			if p.curToken.Type != tokens.IDENT {
+				p.errorf(p.curToken, "only properties can be indented under [meta], [define], and [preset]")
+				p.nextToken()
+				return
+			}
+			p.parseProperty(props)
+		})
+		return
+	}
+	for p.curToken.Type == tokens.IDENT {
+		p.parseProperty(props)
+	}
+}
+
 // parsePageSection parses a page section (top, mid, bottom)
 func (p *Parser) parsePageSection() *ast.PageSection {
 	section := &ast.PageSection{
-		Token:    p.curToken,
-		Type:     ast.GetSectionType(p.curToken.Type),
-		Children: []ast.Node{},
+		Token:      p.curToken,
+		Type:       ast.GetSectionType(p.curToken.Type),
+		Properties: make(map[string]ast.Value),
+		Children:   []ast.Node{},
 	}
 
 	closingTag := tokens.GetMatchingClose(p.curToken.Type)
 	p.nextToken() // move past opening tag
+	defer p.readingTag(section.Type)()
 
-	// Parse children until we hit the closing tag
-	for p.curToken.Type != closingTag && p.curToken.Type != tokens.EOF {
-		child := p.parseElement()
-		if child != nil {
-			section.Children = append(section.Children, child)
-		}
+	if p.indented {
+		p.parseIndentedBody(section.Properties, func() { p.parseSectionItem(section) })
+		section.Close = p.lastToken
+		return section
+	}
+
+	// Parse section properties and children until we hit the closing tag
+	for p.curToken.Type != closingTag && p.curToken.Type != tokens.END && p.curToken.Type != tokens.EOF {
+		p.parseSectionItem(section)
 	}
 
-	if p.curToken.Type == closingTag {
+	if p.curToken.Type == closingTag || p.curToken.Type == tokens.END {
 		p.nextToken() // consume closing tag
 	} else {
-		p.addError(fmt.Sprintf("expected closing tag for section %s", section.Type))
+		p.errorf(section.Token, "expected closing tag for section %s", section.Type)
 	}
+	section.Close = p.lastToken
 
 	return section
 }
 
+// parseSectionItem parses one property, element, or block of a section
+func (p *Parser) parseSectionItem(section *ast.PageSection) {
+	if p.indented && p.skipMisindented(func() { p.parseSectionItem(section) }) {
+		return
+	}
+	switch {
+	case p.curToken.Type == tokens.IDENT:
+		p.parseProperty(section.Properties)
+	case p.curToken.Type == tokens.INCLUDE:
+		_, nodes := p.parseInclude(inElement)
+		section.Children = append(section.Children, nodes...)
+	case p.curToken.Type == tokens.IF_START || p.curToken.Type == tokens.REPEAT_START || isBlockEnd(p.curToken.Type):
+		p.parseBlockNode(&section.Children)
+	default:
+		child := p.parseElement()
+		if child != nil {
+			section.Children = append(section.Children, child)
+		}
+	}
+}
+
 // parseElement parses an element like [p-start]...[p-end]
 func (p *Parser) parseElement() *ast.Element {
 	if !tokens.IsOpeningTag(p.curToken.Type) {
@@ -93,38 +328,488 @@ func (p *Parser) parseElement() *ast.Element {
 		TagType:    ast.GetTagName(p.curToken.Type),
 		Properties: make(map[string]ast.Value),
 		Children:   []ast.Node{},
+		File:       p.file,
+	}
+	if p.curToken.Type == tokens.VOID_START {
+		elem.TagType = p.curToken.Literal // [img src="x.png"] is named by its literal
 	}
 
+	if !p.descend(elem.Token) {
+		return elem
+	}
+	defer p.ascend()
+
 	openingType := p.curToken.Type
 	p.nextToken() // move past opening tag
+	defer p.readingTag(elem.TagType)()
+
+	if p.indented && openingType != tokens.VOID_START {
+		p.parseIndentedBody(elem.Properties, func() { p.parseElementItem(elem) })
+		elem.Close = p.lastToken
+		return elem
+	}
 
 	// Parse properties and children until we hit the closing tag
 	for !p.isMatchingClose(openingType, p.curToken.Type) && p.curToken.Type != tokens.EOF {
-		if p.curToken.Type == tokens.IDENT {
-			// This is a property assignment
-			p.parseProperty(elem)
-		} else if tokens.IsOpeningTag(p.curToken.Type) {
-			// This is a nested element
-			child := p.parseElement()
-			if child != nil {
-				elem.Children = append(elem.Children, child)
-			}
-		} else {
-			p.nextToken()
-		}
+		p.parseElementItem(elem)
 	}
 
 	if p.isMatchingClose(openingType, p.curToken.Type) {
 		p.nextToken() // consume closing tag
 	} else {
-		p.addError(fmt.Sprintf("expected closing tag for element %s at line %d", elem.TagType, elem.Token.Line))
+		p.errorf(elem.Token, "expected closing tag for element %s", elem.TagType)
 	}
+	elem.Close = p.lastToken
 
 	return elem
 }
 
+// readingTag notes that the properties read next belong to the tag
+// named name, returning a function that restores the one before
+func (p *Parser) readingTag(name string) func() {
+	outer := p.tag
+	p.tag = name
+	return func() { p.tag = outer }
+}
+
+// parseElementItem parses one property, child, or run of text of an
+// element
+func (p *Parser) parseElementItem(elem *ast.Element) {
+	if p.indented && p.skipMisindented(func() { p.parseElementItem(elem) }) {
+		return
+	}
+	if p.curToken.Type == tokens.IDENT {
+		// This is a property assignment
+		p.parseProperty(elem.Properties)
+	} else if tokens.IsOpeningTag(p.curToken.Type) {
+		// This is a nested element
+		child := p.parseElement()
+		if child != nil {
+			elem.Children = append(elem.Children, child)
+		}
+	} else if p.curToken.Type == tokens.STRING {
+		// A bare string is a run of text interleaved with inline children
+		elem.Children = append(elem.Children, &ast.TextNode{Token: p.curToken, Value: p.curToken.Literal})
+		p.nextToken()
+	} else if p.curToken.Type == tokens.INCLUDE {
+		_, nodes := p.parseInclude(inElement)
+		elem.Children = append(elem.Children, nodes...)
+	} else if p.curToken.Type == tokens.IF_START || p.curToken.Type == tokens.REPEAT_START || isBlockEnd(p.curToken.Type) {
+		p.parseBlockNode(&elem.Children)
+	} else if p.curToken.Type == tokens.TEMPLATE_START {
+		p.errorf(p.curToken, "${...} only works in property values; write \\${ for the text itself")
+		p.parseTemplate("")
+	} else if p.curToken.Type == tokens.ATTRS_START || p.curToken.Type == tokens.ATTRS_END {
+		p.nextToken() // The tag's own properties are read like the rest
+	} else {
+		p.errorf(p.curToken, "unexpected %q in [%s]; quote it to write it as text", p.curToken.Literal, elem.TagType)
+		p.nextToken()
+	}
+}
+
+// parseIndentedBody parses what belongs to a tag in an indented file: the
+// properties inside the tag itself, the rest of the line it ends on, then
+// the lines indented under it, each read by parseItem. Those lines belong
+// to the first tag on the line above. A tag with nothing after it on its
+// line or indented under it is empty.
+func (p *Parser) parseIndentedBody(props map[string]ast.Value, parseItem func()) {
+	if p.curToken.Type == tokens.ATTRS_START {
+		p.nextToken()
+		for p.curToken.Type == tokens.IDENT {
+			p.parseProperty(props)
+		}
+		if p.curToken.Type == tokens.ATTRS_END {
+			p.nextToken()
+		}
+	}
+	// Tags later on the line hold only what follows them on it
+	inLine := p.inLine
+	p.inLine = true
+	for line := p.lastToken.EndLine; p.curToken.Line == line && p.curToken.EndLine > 0 && p.curToken.Type != tokens.EOF; {
+		parseItem()
+	}
+	p.inLine = inLine
+	if p.curToken.Type == tokens.INDENT && !p.inLine {
+		p.parseIndented(parseItem)
+	}
+}
+
+// parseIndented parses lines from an INDENT to its DEDENT, each item with
+// parseItem
+func (p *Parser) parseIndented(parseItem func()) {
+	p.nextToken() // move past the INDENT
+	for p.curToken.Type != tokens.DEDENT && p.curToken.Type != tokens.EOF {
+		parseItem()
+	}
+	if p.curToken.Type == tokens.DEDENT {
+		p.nextToken()
+	}
+}
+
+// skipMisindented reports and reads past what has no place in an
+// indented file: end tags, which indentation makes unnecessary, and lines
+// indented under something other than a tag or not lined up with any line
+// above. Those lines are still read, with parseItem, so the DEDENT closing
+// them isn't taken for the end of the enclosing tag. It reports whether
+// there was anything to skip.
+func (p *Parser) skipMisindented(parseItem func()) bool {
+	tok := p.curToken
+	switch {
+	case tok.Type == tokens.ILLEGAL && tok.Literal == "dedent":
+		p.errorf(tok, "indentation doesn't line up with any line above")
+		p.nextToken()
+		if p.curToken.Type == tokens.INDENT {
+			p.parseIndented(parseItem)
+		}
+		return true
+	case tok.Type == tokens.INDENT:
+		p.errorf(tok, "unexpected indentation; only lines under a tag are indented further")
+		p.parseIndented(parseItem)
+		return true
+	case tokens.IsClosingTag(tok.Type) && tok.Type != tokens.VOID_END || tok.Type == tokens.IF_END || tok.Type == tokens.REPEAT_END:
+		p.errorf(tok, "[%s] isn't needed in an [indented] file; indentation closes tags", tok.Literal)
+		p.nextToken()
+		return true
+	}
+	return false
+}
+
+// parseInclude splices in the file an [include] names: page sections
+// between sections, and elements inside them
+func (p *Parser) parseInclude(site includeSite) ([]*ast.PageSection, []ast.Node) {
+	tok := p.curToken
+	p.nextToken() // move past [include]
+
+	if p.includes == nil {
+		return nil, nil
+	}
+	if tok.Literal == "" {
+		p.errorf(tok, "[include] needs a file, like [include file=\"partials/header.lpml\"]")
+		return nil, nil
+	}
+
+	path := filepath.Join(filepath.Dir(p.file), filepath.FromSlash(tok.Literal))
+	for i, open := range p.includes.open {
+		if open == path {
+			cycle := append(append([]string{}, p.includes.open[i:]...), path)
+			p.errorf(tok, "[include] cycle: %s", strings.Join(cycle, " -> "))
+			return nil, nil
+		}
+	}
+	if len(p.includes.open) > p.limits.MaxIncludeDepth {
+		p.stop(tok, "[include] nested more than %d deep, so the rest of the file isn't read", p.limits.MaxIncludeDepth)
+		return nil, nil
+	}
+	content, err := p.includes.read(path)
+	if err != nil {
+		p.errorf(tok, "[include]: %v", err)
+		return nil, nil
+	}
+	p.includes.files = append(p.includes.files, path)
+
+	child := newParser(lexer.New(string(content)), path)
+	child.includes = p.includes
+	child.defines = p.defines
+	child.definedAt = p.definedAt
+	child.presets = p.presets
+	child.comments = p.comments
+	p.limits.tokens += child.limits.tokens // The two it's read ahead
+	child.limits = p.limits
+	p.includes.open = append(p.includes.open, path)
+	sections, nodes := child.parseFragment()
+	p.includes.open = p.includes.open[:len(p.includes.open)-1]
+
+	roots := append([]ast.Node{}, nodes...)
+	for _, section := range sections {
+		roots = append(roots, section)
+	}
+	child.attachComments(roots)
+	for _, root := range roots {
+		p.spliced[root] = true
+	}
+	p.errors = append(p.errors, child.errors...)
+	p.warnings = append(p.warnings, child.warnings...)
+
+	switch {
+	case site == betweenSections && len(nodes) > 0:
+		p.errorf(tok, "%s has elements outside a page section, so it can only be included inside one", path)
+	case site == inElement && len(sections) > 0:
+		p.errorf(tok, "%s has page sections, so it can only be included between them", path)
+	}
+	return sections, nodes
+}
+
+// parseFragment parses an included file: page sections, or the elements
+// and text to splice into one
+func (p *Parser) parseFragment() ([]*ast.PageSection, []ast.Node) {
+	var sections []*ast.PageSection
+	var nodes []ast.Node
+
+	for p.curToken.Type != tokens.EOF {
+		switch {
+		case ast.IsPageSection(p.curToken.Type):
+			sections = append(sections, p.parsePageSection())
+		case p.curToken.Type == tokens.DEFINE:
+			p.parseDefine()
+		case p.curToken.Type == tokens.PRESET:
+			p.parsePreset()
+		case p.curToken.Type == tokens.INCLUDE:
+			s, n := p.parseInclude(inFragment)
+			sections, nodes = append(sections, s...), append(nodes, n...)
+		case p.curToken.Type == tokens.IF_START || p.curToken.Type == tokens.REPEAT_START || isBlockEnd(p.curToken.Type):
+			p.parseBlockNode(&nodes)
+		case tokens.IsOpeningTag(p.curToken.Type):
+			nodes = append(nodes, p.parseElement())
+		case p.curToken.Type == tokens.STRING:
+			nodes = append(nodes, &ast.TextNode{Token: p.curToken, Value: p.curToken.Literal})
+			p.nextToken()
+		default:
+			p.nextToken()
+		}
+	}
+
+	return sections, nodes
+}
+
+// parseConditional parses [if cond=...] ... [else] ... [if-end]
+func (p *Parser) parseConditional() *ast.Conditional {
+	cond := &ast.Conditional{Token: p.curToken}
+	if !p.descend(cond.Token) {
+		return cond
+	}
+	defer p.ascend()
+	p.parseCondition(cond)
+	p.nextToken() // move past [if]
+
+	if p.indented {
+		p.parseIndentedBody(nil, func() { p.parseBlockNode(&cond.Then) })
+		if p.curToken.Type == tokens.ELSE {
+			p.nextToken()
+			p.parseIndentedBody(nil, func() { p.parseBlockNode(&cond.Else) })
+		}
+		cond.Close = p.lastToken
+		return cond
+	}
+
+	branch := &cond.Then
+	for p.curToken.Type != tokens.IF_END && p.curToken.Type != tokens.EOF && !tokens.IsClosingTag(p.curToken.Type) {
+		if p.curToken.Type == tokens.ELSE {
+			if branch == &cond.Else {
+				p.errorf(p.curToken, "[if] at line %d has a second [else]", cond.Token.Line)
+			}
+			branch = &cond.Else
+			p.nextToken()
+			continue
+		}
+		p.parseBlockNode(branch)
+	}
+
+	if p.curToken.Type == tokens.IF_END || p.curToken.Type == tokens.END {
+		p.nextToken() // consume [if-end]
+	} else {
+		p.errorf(cond.Token, "expected [if-end] for [if]")
+	}
+	cond.Close = p.lastToken
+	return cond
+}
+
+// parseRepeat parses [repeat over=$items as="item"] ... [repeat-end]. The
+// loop variable is named item unless as gives another name.
+func (p *Parser) parseRepeat() *ast.Repeat {
+	repeat := &ast.Repeat{Token: p.curToken, As: "item"}
+	if !p.descend(repeat.Token) {
+		return repeat
+	}
+	defer p.ascend()
+	p.parseRepeatAttrs(repeat)
+	p.nextToken() // move past [repeat]
+
+	if p.indented {
+		p.parseIndentedBody(nil, func() { p.parseBlockNode(&repeat.Children) })
+		repeat.Close = p.lastToken
+		return repeat
+	}
+
+	for p.curToken.Type != tokens.REPEAT_END && p.curToken.Type != tokens.EOF && !tokens.IsClosingTag(p.curToken.Type) {
+		p.parseBlockNode(&repeat.Children)
+	}
+
+	if p.curToken.Type == tokens.REPEAT_END || p.curToken.Type == tokens.END {
+		p.nextToken() // consume [repeat-end]
+	} else {
+		p.errorf(repeat.Token, "expected [repeat-end] for [repeat]")
+	}
+	repeat.Close = p.lastToken
+	return repeat
+}
+
+// parseRepeatAttrs reads a [repeat] tag's over and as attributes
+func (p *Parser) parseRepeatAttrs(repeat *ast.Repeat) {
+	tok := repeat.Token
+	l := lexer.NewForAttrs(tok.Literal)
+	hasOver := false
+	for cur := l.NextToken(); cur.Type != tokens.EOF; cur = l.NextToken() {
+		name := cur
+		if name.Type != tokens.IDENT || l.NextToken().Type != tokens.EQUALS {
+			p.errorf(tok, "can't read [repeat %s]; write [repeat over=$items as=\"item\"]", tok.Literal)
+			return
+		}
+		val := l.NextToken()
+		val.Line, val.Column = tok.Line, tok.Column
+		val.EndLine, val.EndColumn = tok.EndLine, tok.EndColumn
+		switch name.Literal {
+		case "over":
+			hasOver = true
+			if val.Type != tokens.DOLLAR {
+				p.errorf(tok, "[repeat] over must be a $reference to an array, like over=$photos")
+				continue
+			}
+			repeat.Over = &ast.VariableRef{Token: val, Name: val.Literal}
+		case "as":
+			if (val.Type != tokens.STRING && val.Type != tokens.IDENT) || !isName(val.Literal) {
+				p.errorf(tok, "[repeat] as must be a name like \"photo\"")
+				continue
+			}
+			repeat.As = val.Literal
+		default:
+			p.errorf(tok, "[repeat] has no %s attribute; it takes over and as", name.Literal)
+		}
+	}
+	if !hasOver {
+		p.errorf(tok, "[repeat] needs an array to repeat over, like [repeat over=$photos]")
+	}
+}
+
+// parseBlockNode parses the next node in the body of an [if] or [repeat],
+// or of a section, element, or included file reaching one: elements,
+// text, includes, and nested blocks are added to nodes. Properties can't
+// be set from inside a block.
+func (p *Parser) parseBlockNode(nodes *[]ast.Node) {
+	if p.indented && p.skipMisindented(func() { p.parseBlockNode(nodes) }) {
+		return
+	}
+	switch {
+	case p.curToken.Type == tokens.IF_START:
+		*nodes = append(*nodes, p.parseConditional())
+	case p.curToken.Type == tokens.REPEAT_START:
+		*nodes = append(*nodes, p.parseRepeat())
+	case isBlockEnd(p.curToken.Type):
+		opening := "[if]"
+		if p.curToken.Type == tokens.REPEAT_END {
+			opening = "[repeat]"
+		}
+		p.errorf(p.curToken, "[%s] has no matching %s", p.curToken.Literal, opening)
+		p.nextToken()
+	case p.curToken.Type == tokens.INCLUDE:
+		_, included := p.parseInclude(inElement)
+		*nodes = append(*nodes, included...)
+	case tokens.IsOpeningTag(p.curToken.Type):
+		*nodes = append(*nodes, p.parseElement())
+	case p.curToken.Type == tokens.STRING:
+		*nodes = append(*nodes, &ast.TextNode{Token: p.curToken, Value: p.curToken.Literal})
+		p.nextToken()
+	case p.curToken.Type == tokens.IDENT:
+		p.errorf(p.curToken, "%s can't be set inside [if] or [repeat]; put elements there instead", p.curToken.Literal)
+		p.parseProperty(make(map[string]ast.Value))
+	case p.curToken.Type == tokens.TEMPLATE_START:
+		p.errorf(p.curToken, "${...} only works in property values; write \\${ for the text itself")
+		p.parseTemplate("")
+	default:
+		p.nextToken()
+	}
+}
+
+// isBlockEnd reports whether t continues or closes an [if] or [repeat]
+func isBlockEnd(t tokens.TokenType) bool {
+	return t == tokens.ELSE || t == tokens.IF_END || t == tokens.REPEAT_END
+}
+
+// isName reports whether s can be used as a $name
+func isName(s string) bool {
+	for i, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// parseCondition parses an [if] condition into cond: an optional !, then
+// a value, optionally compared with == or != to another
+func (p *Parser) parseCondition(cond *ast.Conditional) {
+	tok := cond.Token
+	if tok.Literal == "" {
+		p.errorf(tok, "[if] needs a condition, like [if cond=$draft]")
+		return
+	}
+
+	// Operands are values as a property takes them; a bare word isn't one
+	l := lexer.NewForAttrs(tok.Literal)
+	cur := l.NextToken()
+	var bare string
+	operand := func() ast.Value {
+		t := cur
+		t.Line, t.Column = tok.Line, tok.Column
+		t.EndLine, t.EndColumn = tok.EndLine, tok.EndColumn
+		cur = l.NextToken()
+		switch t.Type {
+		case tokens.DOLLAR:
+			return &ast.VariableRef{Token: t, Name: t.Literal}
+		case tokens.STRING:
+			return &ast.StringValue{Token: t, Value: t.Literal}
+		case tokens.IDENT:
+			bare = t.Literal
+		case tokens.NUMBER:
+			return &ast.NumberValue{Token: t, Value: t.Literal}
+		case tokens.DIMENSION:
+			return p.dimension(t)
+		case tokens.COLOR:
+			return p.color(t)
+		case tokens.DATE:
+			return p.date(t)
+		case tokens.BOOL:
+			return &ast.BoolValue{Token: t, Value: t.Literal == "true"}
+		}
+		return nil
+	}
+
+	if cur.Type == tokens.ILLEGAL && cur.Literal == "!" {
+		cond.Not = true
+		cur = l.NextToken()
+	}
+	cond.Left = operand()
+
+	switch {
+	case cur.Type == tokens.EQUALS:
+		cur = l.NextToken()
+		if cur.Type == tokens.EQUALS {
+			cond.Op = "=="
+			cur = l.NextToken()
+		}
+	case cur.Type == tokens.ILLEGAL && cur.Literal == "!":
+		cur = l.NextToken()
+		if cur.Type == tokens.EQUALS {
+			cond.Op = "!="
+			cur = l.NextToken()
+		}
+	}
+	if cond.Op != "" {
+		cond.Right = operand()
+	}
+
+	switch {
+	case bare != "":
+		p.errorf(tok, "[if] condition %q: %s isn't a value; write $%s for the constant or field, or \"%s\" for the text", tok.Literal, bare, bare, bare)
+	case cond.Left == nil || (cond.Op != "" && cond.Right == nil) || cur.Type != tokens.EOF:
+		p.errorf(tok, "can't read [if] condition %q; write $name, !$name, or $name == value", tok.Literal)
+	}
+}
+
 // isMatchingClose checks if the current token is a valid closing tag for the opening tag
 func (p *Parser) isMatchingClose(open, close tokens.TokenType) bool {
+	if close == tokens.END {
+		return true // [end] closes whatever is open
+	}
 	// Special case: lst-end closes both lst-ord and lst-unord
 	if (open == tokens.LIST_ORD_START || open == tokens.LIST_UNORD_START) &&
 		(close == tokens.LIST_ORD_END || close == tokens.LIST_UNORD_END) {
@@ -134,24 +819,50 @@ func (p *Parser) isMatchingClose(open, close tokens.TokenType) bool {
 }
 
 // parseProperty parses a property assignment like label = "value" or linked = $ref or items = [1,2,3]
-func (p *Parser) parseProperty(elem *ast.Element) {
+func (p *Parser) parseProperty(props map[string]ast.Value) {
+	nameTok := p.curToken
 	propName := p.curToken.Literal
 	p.nextToken() // move past property name
 
 	// Expect '='
 	if p.curToken.Type != tokens.EQUALS {
-		p.addError(fmt.Sprintf("expected '=' after property name %s, got %s", propName, p.curToken.Type))
+		got := string(p.curToken.Type)
+		if p.curToken.Type == tokens.ATTRS_END || p.curToken.Type == tokens.VOID_END {
+			got = "]" // the end of the tag the property was written in
+		}
+		p.errorf(p.curToken, "expected '=' after property name %s, got %s", propName, got)
 		return
 	}
 	p.nextToken() // consume '='
 
 	// Parse value (string, number, variable reference, or array)
 	value := p.parseValue(propName)
-	if value != nil {
-		elem.Properties[propName] = value
+	if value == nil {
+		return
+	}
+	if _, ok := props[propName]; ok {
+		p.warnf(ruleProperty, nameTok, "%s is set twice; the last value is used", propName)
+	}
+	if tag, ok := schema.Lookup(p.tag); ok && !hasProperty(tag, propName) {
+		p.warnf(ruleProperty, nameTok, "[%s] has no property %s; it's ignored", tag.Open, propName)
+	}
+	props[propName] = value
+	if p.defining {
+		p.definedAt[propName] = Symbol{File: p.file, Pos: ast.Position{Line: nameTok.Line, Column: nameTok.Column}}
 	}
 }
 
+// hasProperty reports whether tag takes the property name, its own or a
+// common one
+func hasProperty(tag schema.Tag, name string) bool {
+	for _, prop := range tag.AllProperties() {
+		if prop.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // parseValue parses a value (string, number, variable reference, array, or code block)
 func (p *Parser) parseValue(propName string) ast.Value {
 	switch p.curToken.Type {
@@ -171,16 +882,43 @@ func (p *Parser) parseValue(propName string) ast.Value {
 		p.nextToken()
 		return value
 
-	case tokens.DOLLAR:
-		value := &ast.VariableRef{
+	case tokens.DIMENSION:
+		value := p.dimension(p.curToken)
+		p.nextToken()
+		return value
+
+	case tokens.COLOR:
+		value := p.color(p.curToken)
+		p.nextToken()
+		return value
+
+	case tokens.DATE:
+		value := p.date(p.curToken)
+		p.nextToken()
+		return value
+
+	case tokens.BOOL:
+		value := &ast.BoolValue{
 			Token: p.curToken,
-			Name:  p.curToken.Literal,
+			Value: p.curToken.Literal == "true",
 		}
 		p.nextToken()
 		return value
 
+	case tokens.DOLLAR:
+		return p.parsePipe(p.parseReference(propName), propName)
+
+	case tokens.TEMPLATE_START:
+		return p.parseTemplate(propName)
+
 	case tokens.LBRACKET:
-		return p.parseArray()
+		return p.parseArray(propName)
+
+	case tokens.LBRACE:
+		return p.parseMap(propName)
+
+	case tokens.CALL:
+		return p.parseCall(propName)
 
 	case tokens.CODEBLOCK:
 		value := &ast.CodeBlockValue{
@@ -191,13 +929,200 @@ func (p *Parser) parseValue(propName string) ast.Value {
 		return value
 
 	default:
-		p.addError(fmt.Sprintf("expected value for property %s, got %s", propName, p.curToken.Type))
+		p.errorf(p.curToken, "expected value for property %s, got %s", propName, p.curToken.Type)
 		return nil
 	}
 }
 
+// cssUnits are the units a dimension like 16px may have
+var cssUnits = map[string]bool{
+	"%": true, "px": true, "em": true, "rem": true, "ex": true, "ch": true, "lh": true, "rlh": true,
+	"vw": true, "vh": true, "vmin": true, "vmax": true, "svw": true, "svh": true, "lvw": true, "lvh": true, "dvw": true, "dvh": true,
+	"cm": true, "mm": true, "q": true, "in": true, "pt": true, "pc": true,
+	"s": true, "ms": true, "deg": true, "rad": true, "grad": true, "turn": true, "fr": true, "x": true, "dpi": true, "dppx": true,
+}
+
+// dimension splits a DIMENSION token into its number and unit, reporting
+// units CSS doesn't have
+func (p *Parser) dimension(tok tokens.Token) *ast.DimensionValue {
+	number := strings.TrimRightFunc(tok.Literal, func(r rune) bool { return r == '%' || unicode.IsLetter(r) })
+	unit := tok.Literal[len(number):]
+	if !cssUnits[strings.ToLower(unit)] {
+		p.errorf(tok, "%s has an unknown unit %q; quote it if it's meant as text", tok.Literal, unit)
+	}
+	return &ast.DimensionValue{Token: tok, Value: number, Unit: unit}
+}
+
+// color makes a ColorValue of a COLOR token, reporting colors that can't
+// be read
+func (p *Parser) color(tok tokens.Token) *ast.ColorValue {
+	value := &ast.ColorValue{Token: tok, Value: tok.Literal}
+	if _, _, _, _, ok := value.RGBA(); !ok {
+		p.errorf(tok, "%s isn't a color; write #rgb, #rrggbb, rgb(r, g, b), or hsl(h, s%%, l%%)", tok.Literal)
+	}
+	return value
+}
+
+// date makes a DateValue of a DATE token, reporting dates that can't be
+// read, like 2024-13-01
+func (p *Parser) date(tok tokens.Token) *ast.DateValue {
+	value := &ast.DateValue{Token: tok, Value: tok.Literal}
+	if _, ok := value.Time(); !ok {
+		p.errorf(tok, "%s isn't a date; write 2024-06-01, 2024-06-01T18:00, or 2024-06-01T18:00:00+02:00", tok.Literal)
+	}
+	return value
+}
+
+// parseTemplate parses an interpolated string's parts
+func (p *Parser) parseTemplate(propName string) *ast.TemplateValue {
+	tmpl := &ast.TemplateValue{Token: p.curToken}
+	p.nextToken() // consume template start
+
+	for p.curToken.Type != tokens.TEMPLATE_END && p.curToken.Type != tokens.EOF {
+		switch p.curToken.Type {
+		case tokens.STRING:
+			tmpl.Parts = append(tmpl.Parts, &ast.StringValue{Token: p.curToken, Value: p.curToken.Literal})
+		case tokens.DOLLAR:
+			tmpl.Parts = append(tmpl.Parts, &ast.VariableRef{Token: p.curToken, Name: p.curToken.Literal})
+		case tokens.CALL:
+			tmpl.Parts = append(tmpl.Parts, p.parseCall(propName))
+			continue
+		}
+		p.nextToken()
+	}
+
+	p.nextToken() // consume template end
+	return tmpl
+}
+
+// parseMap parses a map value like { color = "red", padding = "large" }.
+// Entries are separated by commas or line breaks.
+func (p *Parser) parseMap(propName string) *ast.MapValue {
+	m := &ast.MapValue{Token: p.curToken}
+	if !p.descend(m.Token) {
+		return m
+	}
+	defer p.ascend()
+	p.nextToken() // move past {
+
+	for p.curToken.Type != tokens.RBRACE && p.curToken.Type != tokens.EOF {
+		if p.curToken.Type == tokens.COMMA {
+			p.nextToken()
+			continue
+		}
+		if p.curToken.Type != tokens.IDENT || p.peekToken.Type != tokens.EQUALS {
+			p.errorf(p.curToken, "expected key = value in map for %s, got %s", propName, p.curToken.Type)
+			p.nextToken()
+			continue
+		}
+
+		key := p.curToken
+		p.nextToken() // move past key
+		p.nextToken() // move past =
+		value := p.parseValue(propName + "." + key.Literal)
+		if value == nil {
+			continue
+		}
+		if _, exists := m.Get(key.Literal); exists {
+			p.errorf(key, "%s is set twice in map for %s", key.Literal, propName)
+			continue
+		}
+		if !p.countItem(m.Token, len(m.Entries)+1, "map for "+propName) {
+			break
+		}
+		m.Entries = append(m.Entries, ast.Property{Name: key.Literal, Value: value})
+	}
+
+	if p.curToken.Type == tokens.RBRACE {
+		p.nextToken() // consume }
+	} else {
+		p.errorf(m.Token, "map for %s is missing its closing }", propName)
+	}
+	m.Close = p.lastToken
+	return m
+}
+
+// parseReference parses a $reference and the fallback value after a ??,
+// if it has one. A fallback that's a reference leaves the filters after
+// it to parsePipe, so they filter whichever of the two is used.
+func (p *Parser) parseReference(propName string) *ast.VariableRef {
+	ref := &ast.VariableRef{Token: p.curToken, Name: p.curToken.Literal}
+	p.nextToken()
+	if p.curToken.Type == tokens.FALLBACK && p.descend(p.curToken) {
+		defer p.ascend()
+		p.nextToken() // consume '??'
+		if p.curToken.Type == tokens.DOLLAR {
+			ref.Default = p.parseReference(propName)
+		} else {
+			ref.Default = p.parseValue(propName)
+		}
+	}
+	return ref
+}
+
+// filterArgs are the arguments each filter takes
+var filterArgs = map[string]int{
+	"upper":    0,
+	"lower":    0,
+	"title":    0,
+	"trim":     0,
+	"slug":     0,
+	"truncate": 1, // truncate(length)
+	"words":    1, // words(count)
+	"replace":  2, // replace(old, new)
+}
+
+// parsePipe parses the filters after a reference, like | upper |
+// truncate(80), returning the reference alone if it has none
+func (p *Parser) parsePipe(ref *ast.VariableRef, propName string) ast.Value {
+	if p.curToken.Type != tokens.PIPE {
+		return ref
+	}
+	pipe := &ast.PipeValue{Token: p.curToken, Value: ref}
+	for p.curToken.Type == tokens.PIPE {
+		p.nextToken() // consume '|'
+		filter := ast.Filter{Token: p.curToken, Name: p.curToken.Literal}
+		switch p.curToken.Type {
+		case tokens.IDENT:
+			filter.Close = p.curToken
+			p.nextToken()
+		case tokens.CALL:
+			filter.Args, filter.Close = p.parseArgs(propName, p.curToken)
+		default:
+			p.errorf(p.curToken, "expected a filter after | in %s, like | upper, got %s", propName, p.curToken.Type)
+			return ref
+		}
+
+		args, ok := filterArgs[filter.Name]
+		switch {
+		case !ok:
+			p.errorf(filter.Token, "unknown filter %q; filters are %s", filter.Name, strings.Join(filterNames(), ", "))
+		case len(filter.Args) != args && args == 0:
+			p.errorf(filter.Token, "%s takes no arguments, got %d", filter.Name, len(filter.Args))
+		case len(filter.Args) != args:
+			noun := "arguments"
+			if args == 1 {
+				noun = "argument"
+			}
+			p.errorf(filter.Token, "%s takes %d %s, got %d", filter.Name, args, noun, len(filter.Args))
+		}
+		pipe.Filters = append(pipe.Filters, filter)
+	}
+	return pipe
+}
+
+// filterNames returns the names of the filters, sorted
+func filterNames() []string {
+	names := make([]string, 0, len(filterArgs))
+	for name := range filterArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // parseArray parses an array like [1, 2, 3] or [$ref1, $ref2] or ["a", "b"]
-func (p *Parser) parseArray() *ast.ArrayValue {
+func (p *Parser) parseArray(propName string) *ast.ArrayValue {
 	arr := &ast.ArrayValue{
 		Token:  p.curToken,
 		Values: []ast.Value{},
@@ -216,9 +1141,24 @@ func (p *Parser) parseArray() *ast.ArrayValue {
 		case tokens.NUMBER:
 			val = &ast.NumberValue{Token: p.curToken, Value: p.curToken.Literal}
 			p.nextToken()
-		case tokens.DOLLAR:
-			val = &ast.VariableRef{Token: p.curToken, Name: p.curToken.Literal}
+		case tokens.DIMENSION:
+			val = p.dimension(p.curToken)
 			p.nextToken()
+		case tokens.COLOR:
+			val = p.color(p.curToken)
+			p.nextToken()
+		case tokens.DATE:
+			val = p.date(p.curToken)
+			p.nextToken()
+		case tokens.BOOL:
+			val = &ast.BoolValue{Token: p.curToken, Value: p.curToken.Literal == "true"}
+			p.nextToken()
+		case tokens.DOLLAR:
+			val = p.parsePipe(p.parseReference(propName), propName)
+		case tokens.TEMPLATE_START:
+			val = p.parseTemplate(propName)
+		case tokens.CALL:
+			val = p.parseCall(propName)
 		case tokens.COMMA:
 			p.nextToken() // skip comma
 			continue
@@ -228,6 +1168,9 @@ func (p *Parser) parseArray() *ast.ArrayValue {
 		}
 
 		if val != nil {
+			if !p.countItem(arr.Token, len(arr.Values)+1, "array for "+propName) {
+				break
+			}
 			arr.Values = append(arr.Values, val)
 		}
 	}
@@ -235,11 +1178,107 @@ func (p *Parser) parseArray() *ast.ArrayValue {
 	if p.curToken.Type == tokens.RBRACKET {
 		p.nextToken() // consume ']'
 	}
+	arr.Close = p.lastToken
 
 	return arr
 }
 
-// addError adds a parsing error
-func (p *Parser) addError(msg string) {
-	p.errors = append(p.errors, msg)
+// callArgs are how many arguments each build-time function takes, at
+// least and at most
+var callArgs = map[string][2]int{
+	"now":      {0, 2}, // now(layout, zone)
+	"date":     {1, 3}, // date(value, layout, zone)
+	"number":   {1, 3}, // number(value, decimals, locale)
+	"currency": {2, 3}, // currency(value, code, locale)
+	"percent":  {1, 3}, // percent(value, decimals, locale)
+}
+
+// parseCall parses a build-time function call like now() or
+// date($page.date, "Monday", "Europe/London"), reporting calls with the
+// wrong number of arguments
+func (p *Parser) parseCall(propName string) *ast.CallValue {
+	call := &ast.CallValue{Token: p.curToken, Name: p.curToken.Literal}
+	call.Args, call.Close = p.parseArgs(propName, call.Token)
+	if limits := callArgs[call.Name]; len(call.Args) < limits[0] || len(call.Args) > limits[1] {
+		p.errorf(call.Token, "%s() takes %d to %d arguments, got %d", call.Name, limits[0], limits[1], len(call.Args))
+	}
+	return call
+}
+
+// parseArgs parses the arguments of a call or filter, from the CALL token
+// open with its name and '(' to the closing ')', which it returns. It
+// returns the last token read instead if the arguments can't be read.
+func (p *Parser) parseArgs(propName string, open tokens.Token) ([]ast.Value, tokens.Token) {
+	var args []ast.Value
+	if !p.descend(open) {
+		return nil, open
+	}
+	defer p.ascend()
+	p.nextToken() // consume the name and '('
+
+	// A call is written on one line, so one still open after it never closes
+	for p.curToken.Type != tokens.RPAREN && p.curToken.Line == open.Line && p.curToken.Type != tokens.EOF {
+		if len(args) > 0 {
+			if p.curToken.Type != tokens.COMMA {
+				p.errorf(p.curToken, "expected , or ) in %s(), got %s", open.Literal, p.curToken.Type)
+				return args, p.lastToken
+			}
+			p.nextToken() // consume ','
+		}
+		arg := p.parseValue(propName)
+		if arg == nil {
+			return args, p.lastToken
+		}
+		args = append(args, arg)
+	}
+
+	if p.curToken.Type != tokens.RPAREN {
+		p.errorf(open, "%s( isn't closed with ) on the same line", open.Literal)
+		return args, p.lastToken
+	}
+	p.nextToken() // consume ')'
+	return args, p.lastToken
+}
+
+// bugReport ends the error for a failure of the parser itself
+const bugReport = "this is a bug in lpml, please report it with the source"
+
+// recoverPanic turns a panic while parsing into an error at the token
+// being read, so any input gives diagnostics rather than a crash. Call it
+// deferred.
+func (p *Parser) recoverPanic() {
+	if r := recover(); r != nil {
+		p.errors = append(p.errors, p.diagnostic(p.curToken, "the parser failed here: %v; %s", r, bugReport))
+		p.limits.stopped = true
+	}
+}
+
+// errorf adds a parsing error at tok
+func (p *Parser) errorf(tok tokens.Token, format string, args ...any) {
+	if p.limits.stopped {
+		return // Past a limit, the rest of the source was never read
+	}
+	p.errors = append(p.errors, p.diagnostic(tok, format, args...))
+}
+
+// ruleProperty is the rule, as generator.RuleProperty names it, that
+// warnings about properties come under
+const ruleProperty = "property"
+
+// warnf adds a parsing warning under rule at tok
+func (p *Parser) warnf(rule string, tok tokens.Token, format string, args ...any) {
+	d := p.diagnostic(tok, format, args...)
+	d.Rule = rule
+	p.warnings = append(p.warnings, d)
+}
+
+// diagnostic describes a problem found at tok
+func (p *Parser) diagnostic(tok tokens.Token, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		File:    p.file,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, args...),
+		Text:    p.l.SourceLine(tok.Line),
+	}
 }
@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	"lpml/ast"
+)
+
+// SymbolKind is what defines a Symbol
+type SymbolKind int
+
+const (
+	LabelSymbol    SymbolKind = iota // An element's label
+	ConstantSymbol                   // A [define] constant
+)
+
+// Symbol is a name a document defines for $references to it
+type Symbol struct {
+	Name  string
+	Kind  SymbolKind
+	File  string       // Source file it's defined in, an included file's for names from one
+	Pos   ast.Position // The label's string, or the constant's name
+	Elem  *ast.Element // The labeled element; nil for a constant
+	Value ast.Value    // The constant's value; nil for a label
+}
+
+// Module returns the name of the included file the symbol is defined in,
+// which $module.name references it by, or "" if it's in the document's
+// own file. Constants are shared by every file, so they have none.
+func (s *Symbol) Module() string {
+	if s.Elem == nil {
+		return ""
+	}
+	return s.Elem.Module()
+}
+
+// Reference is a $reference and the symbol it names
+type Reference struct {
+	Ref    *ast.VariableRef
+	File   string  // Source file it's written in
+	Symbol *Symbol // nil for a name the document doesn't define, like $page.title
+}
+
+// SymbolTable holds the names a document defines and the references to
+// them, for editors to go to a definition, rename one, or find those
+// nothing references
+type SymbolTable struct {
+	Symbols    []*Symbol    // Constants by name, then labels in source order
+	References []*Reference // Every $reference, in the order ast.Walk visits them
+
+	constants map[string]*Symbol
+	labels    map[string]*Symbol            // The last element with each label, which references name
+	modules   map[string]map[string]*Symbol // Labels by the module they're in, then label
+}
+
+// Symbols returns the symbol table of the document ParseDocument parsed,
+// included files and all, or nil before it has
+func (p *Parser) Symbols() *SymbolTable {
+	if p.doc == nil {
+		return nil
+	}
+	t := &SymbolTable{constants: make(map[string]*Symbol), labels: make(map[string]*Symbol), modules: make(map[string]map[string]*Symbol)}
+	names := make([]string, 0, len(p.doc.Defines))
+	for name := range p.doc.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sym := &Symbol{Name: name, Kind: ConstantSymbol, File: p.file, Pos: p.doc.Defines[name].Pos(), Value: p.doc.Defines[name]}
+		if at, ok := p.definedAt[name]; ok {
+			sym.File, sym.Pos = at.File, at.Pos
+		}
+		t.Symbols = append(t.Symbols, sym)
+		t.constants[name] = sym
+	}
+	ast.Walk(p.doc, symbolVisitor{t, p.file})
+	for _, ref := range t.References {
+		ref.Symbol = t.Lookup(ref.Ref.Name)
+	}
+	return t
+}
+
+// symbolVisitor gathers labels and references into a SymbolTable, noting
+// the file the nodes it visits are in
+type symbolVisitor struct {
+	t    *SymbolTable
+	file string
+}
+
+func (v symbolVisitor) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.Element:
+		if n.File != "" {
+			v.file = n.File
+		}
+		label, ok := n.Properties["label"].(*ast.StringValue)
+		if !ok {
+			break
+		}
+		sym := &Symbol{Name: label.Value, Kind: LabelSymbol, File: v.file, Pos: label.Pos(), Elem: n}
+		v.t.Symbols = append(v.t.Symbols, sym)
+		v.t.labels[sym.Name] = sym
+		if module := sym.Module(); module != "" {
+			if v.t.modules[module] == nil {
+				v.t.modules[module] = make(map[string]*Symbol)
+			}
+			v.t.modules[module][sym.Name] = sym
+		}
+	case *ast.VariableRef:
+		v.t.References = append(v.t.References, &Reference{Ref: n, File: v.file})
+	}
+	return v
+}
+
+// Lookup returns the symbol a $reference to name resolves to, as the
+// generator resolves it: a constant, else the last element with that
+// label, else for module.label the label in that included file. It
+// returns nil if the document doesn't define the name.
+func (t *SymbolTable) Lookup(name string) *Symbol {
+	if sym, ok := t.constants[name]; ok {
+		return sym
+	}
+	if sym, ok := t.labels[name]; ok {
+		return sym
+	}
+	if i := strings.LastIndex(name, "."); i > 0 {
+		return t.modules[name[:i]][name[i+1:]]
+	}
+	return nil
+}
+
+// Uses returns the references that resolve to sym, in the order of
+// References
+func (t *SymbolTable) Uses(sym *Symbol) []*Reference {
+	var uses []*Reference
+	for _, ref := range t.References {
+		if ref.Symbol == sym {
+			uses = append(uses, ref)
+		}
+	}
+	return uses
+}
+
+// Unused returns the symbols no reference resolves to. A label may still
+// be linked to as an anchor, like "#intro", or from another page.
+func (t *SymbolTable) Unused() []*Symbol {
+	used := make(map[*Symbol]bool)
+	for _, ref := range t.References {
+		used[ref.Symbol] = true
+	}
+	var unused []*Symbol
+	for _, sym := range t.Symbols {
+		if !used[sym] {
+			unused = append(unused, sym)
+		}
+	}
+	return unused
+}
@@ -0,0 +1,74 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lpml/generator"
+	"lpml/tokens"
+)
+
+// Command renders a custom tag by running a program. The program gets the
+// element as generator.CustomTag JSON on stdin and prints the HTML to use
+// in its place; a non-zero exit fails the element with its stderr.
+type Command struct {
+	Program string // Path to the program, or a name looked up on PATH
+	Dir     string // Working directory, usually the project root
+}
+
+// RenderTag runs the program for one element
+func (c *Command) RenderTag(tag generator.CustomTag) (string, error) {
+	input, err := json.Marshal(tag)
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(c.Program)
+	cmd.Dir = c.Dir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", c.Program, msg)
+		}
+		return "", fmt.Errorf("%s: %v", c.Program, err)
+	}
+	return stdout.String(), nil
+}
+
+// Register adds a custom tag for each plugin, mapping tag names to
+// programs, and returns the renderers to put in generator.Options. The
+// programs run in dir.
+func Register(programs map[string]string, dir string) (map[string]generator.TagRenderer, error) {
+	names := make([]string, 0, len(programs))
+	for name := range programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	renderers := make(map[string]generator.TagRenderer)
+	for _, name := range names {
+		if err := tokens.RegisterTag(name); err != nil {
+			return nil, fmt.Errorf("plugin %s: %v", name, err)
+		}
+		// Programs given by path are relative to the current directory,
+		// not the one they run in
+		program := programs[name]
+		if strings.ContainsRune(program, filepath.Separator) {
+			abs, err := filepath.Abs(program)
+			if err != nil {
+				return nil, fmt.Errorf("plugin %s: %v", name, err)
+			}
+			program = abs
+		}
+		renderers[name] = &Command{Program: program, Dir: dir}
+	}
+	return renderers, nil
+}
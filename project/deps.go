@@ -0,0 +1,118 @@
+package project
+
+import (
+	"sort"
+	"strings"
+
+	"lpml/ast"
+)
+
+// Dependencies returns every file a page's output depends on, including
+// the page's own source: pages defining labels it references from
+// elsewhere, transitively, the files it includes, the linked_file of its
+// code blocks, and images read at build time for a placeholder or resized
+// copies. A page referencing a name nothing defines yet depends on every
+// page and partial. Paths are sorted and unique.
+func (proj *Project) Dependencies(page *Page, idx SymbolIndex) []string {
+	bySource := make(map[string]*Page)
+	for _, p := range proj.Pages {
+		bySource[p.Source] = p
+	}
+
+	seen := map[string]bool{page.Source: true}
+	queue := []*Page{page}
+	unresolved := false
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		unresolved = unresolved || idx.hasUnresolved(current)
+
+		for _, dep := range proj.directDependencies(current, idx) {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			if p, ok := bySource[dep]; ok {
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	// A reference nothing defines yet resolves as soon as some page or
+	// partial defines it, so until then the page depends on all of them
+	if unresolved {
+		for _, p := range proj.Pages {
+			seen[p.Source] = true
+			for _, inc := range p.Includes {
+				seen[inc] = true
+			}
+		}
+	}
+
+	deps := make([]string, 0, len(seen))
+	for dep := range seen {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+// directDependencies returns the files a page uses directly
+func (proj *Project) directDependencies(page *Page, idx SymbolIndex) []string {
+	deps := append([]string{}, page.Includes...)
+
+	external, _ := idx.External(page)
+	for name := range external {
+		for _, sym := range idx[name] {
+			if sym.Page != page {
+				deps = append(deps, sym.Page.Source)
+			}
+		}
+	}
+
+	for _, elem := range Elements(page.Doc) {
+		if sv, ok := elem.Properties["linked_file"].(*ast.StringValue); ok && IsLocalPath(sv.Value) {
+			deps = append(deps, proj.ResolvePath(page, sv.Value))
+		}
+		if elem.TagType == "img" && (elem.Properties["placeholder"] != nil || elem.Properties["sizes"] != nil) {
+			if sv, ok := elem.Properties["src"].(*ast.StringValue); ok && IsLocalPath(sv.Value) {
+				deps = append(deps, proj.ResolvePath(page, sv.Value))
+			}
+		}
+	}
+
+	return deps
+}
+
+// hasUnresolved reports whether page references a name that neither it
+// nor any other page defines. Built-in $build. and $page. variables
+// always resolve.
+func (idx SymbolIndex) hasUnresolved(page *Page) bool {
+	local := LocalNames(page.Doc)
+	external, _ := idx.External(page)
+	for _, ref := range References(page.Doc) {
+		if strings.HasPrefix(ref.Name, "build.") || strings.HasPrefix(ref.Name, "page.") {
+			continue
+		}
+		if !local[ref.Name] && external[ref.Name] == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Inlined returns the local files a page's images and scripts load, for
+// self-contained builds that read every one into the page
+func (proj *Project) Inlined(page *Page) []string {
+	var files []string
+	for _, elem := range Elements(page.Doc) {
+		if elem.TagType != "img" && elem.TagType != "script" {
+			continue
+		}
+		if sv, ok := elem.Properties["src"].(*ast.StringValue); ok && IsLocalPath(sv.Value) {
+			files = append(files, proj.ResolvePath(page, sv.Value))
+		}
+	}
+	return files
+}
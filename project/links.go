@@ -0,0 +1,109 @@
+package project
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lpml/ast"
+)
+
+// LinkGraph is which pages of a project link to which, by source path
+type LinkGraph struct {
+	To   map[string][]string // The pages each page links to, sorted
+	From map[string][]string // The pages linking to each page, sorted
+}
+
+// Links builds the project's internal link graph from the link_url and
+// href of its elements. A link counts when it names another page's .html
+// output, its .lpml source, or the directory of its index page; links to
+// anything else, or back to the same page, are left out.
+func (proj *Project) Links() *LinkGraph {
+	byOutput := make(map[string]string)
+	for _, page := range proj.Pages {
+		byOutput[filepath.Clean(page.Output)] = page.Source
+	}
+
+	to := make(map[string]map[string]bool)
+	from := make(map[string]map[string]bool)
+	for _, page := range proj.Pages {
+		for _, elem := range Elements(page.Doc) {
+			for _, prop := range []string{"link_url", "href"} {
+				sv, ok := elem.Properties[prop].(*ast.StringValue)
+				if !ok || !IsLocalPath(sv.Value) {
+					continue
+				}
+				target := ""
+				for _, output := range linkedOutputs(proj.ResolvePath(page, sv.Value)) {
+					if source, ok := byOutput[output]; ok {
+						target = source
+						break
+					}
+				}
+				if target == "" || target == page.Source {
+					continue
+				}
+				if to[page.Source] == nil {
+					to[page.Source] = make(map[string]bool)
+				}
+				if from[target] == nil {
+					from[target] = make(map[string]bool)
+				}
+				to[page.Source][target] = true
+				from[target][page.Source] = true
+			}
+		}
+	}
+
+	return &LinkGraph{To: sortedSets(to), From: sortedSets(from)}
+}
+
+// linkedOutputs returns the .html files a resolved link may load: the
+// file itself, the output of a .lpml source, or for a path without an
+// extension, like /blog/ or /about, its index.html or the .html of that
+// name
+func linkedOutputs(path string) []string {
+	switch {
+	case strings.HasSuffix(path, ".lpml"):
+		return []string{OutputPath(path)}
+	case filepath.Ext(path) == "":
+		return []string{filepath.Join(path, "index.html"), path + ".html"}
+	}
+	return []string{filepath.Clean(path)}
+}
+
+// sortedSets turns sets of paths into sorted lists
+func sortedSets(sets map[string]map[string]bool) map[string][]string {
+	lists := make(map[string][]string, len(sets))
+	for key, set := range sets {
+		for path := range set {
+			lists[key] = append(lists[key], path)
+		}
+		sort.Strings(lists[key])
+	}
+	return lists
+}
+
+// Orphans returns the pages no other page links to. The project's root
+// index page is where visitors arrive, so it's never an orphan.
+func (proj *Project) Orphans(graph *LinkGraph) []string {
+	root := filepath.Join(proj.Dir, "index.lpml")
+	var orphans []string
+	for _, page := range proj.Pages {
+		if len(graph.From[page.Source]) == 0 && filepath.Clean(page.Source) != root {
+			orphans = append(orphans, page.Source)
+		}
+	}
+	return orphans
+}
+
+// DeadEnds returns the pages that link to no other page
+func (proj *Project) DeadEnds(graph *LinkGraph) []string {
+	var ends []string
+	for _, page := range proj.Pages {
+		if len(graph.To[page.Source]) == 0 {
+			ends = append(ends, page.Source)
+		}
+	}
+	return ends
+}
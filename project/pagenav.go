@@ -0,0 +1,75 @@
+package project
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lpml/ast"
+)
+
+// Series returns the pages in page's directory in reading order, the
+// order [pagenav] steps through them: by the order number in their
+// [meta], then by source path. Pages without an order come after those
+// with one.
+func (proj *Project) Series(page *Page) []*Page {
+	dir := filepath.Dir(filepath.Clean(page.Source))
+	var series []*Page
+	for _, p := range proj.Pages {
+		if filepath.Dir(filepath.Clean(p.Source)) == dir {
+			series = append(series, p)
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		a, aOK := pageOrder(series[i])
+		b, bOK := pageOrder(series[j])
+		if aOK != bOK {
+			return aOK
+		}
+		return aOK && a < b
+	})
+	return series
+}
+
+// pageOrder returns the order = number in a page's [meta]
+func pageOrder(page *Page) (float64, bool) {
+	if page.Doc == nil {
+		return 0, false
+	}
+	return ast.NumberOf(page.Doc.Meta["order"])
+}
+
+// Adjacent returns the pages before and after page in its Series, nil at
+// either end
+func (proj *Project) Adjacent(page *Page) (prev, next *Page) {
+	series := proj.Series(page)
+	for i, p := range series {
+		if p != page {
+			continue
+		}
+		if i > 0 {
+			prev = series[i-1]
+		}
+		if i+1 < len(series) {
+			next = series[i+1]
+		}
+	}
+	return prev, next
+}
+
+// Title returns what links to the page call it: the title in its [meta],
+// else its first heading, else its file name
+func (page *Page) Title() string {
+	if page.Doc != nil {
+		if title, ok := ast.StringOf(page.Doc.Meta["title"]); ok && title != "" {
+			return title
+		}
+		for _, block := range ast.ExtractText(page.Doc) {
+			if block.IsHeading() {
+				return block.Text
+			}
+		}
+	}
+	base := filepath.Base(page.Source)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
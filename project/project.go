@@ -0,0 +1,167 @@
+package project
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lpml/ast"
+	"lpml/lexer"
+	"lpml/parser"
+)
+
+// Project is a directory tree of LPML pages
+type Project struct {
+	Dir      string   // Root directory
+	Pages    []*Page  // Pages sorted by source path
+	Partials []string // Sources that other pages include, which aren't pages themselves
+}
+
+// Page is a single parsed source file
+type Page struct {
+	Source             string              // Path to the .lpml file
+	Output             string              // Path the generated .html is written to
+	Doc                *ast.Document       // Parsed document, partial if there were errors
+	Errors             []string            // Parse errors
+	Diagnostics        []parser.Diagnostic // Parse errors with their positions and source lines
+	Warnings           []string            // Parse warnings, like properties the tag doesn't have
+	WarningDiagnostics []parser.Diagnostic // Parse warnings with their positions and rules
+	Includes           []string            // Files spliced in with [include]
+}
+
+// Load finds and parses every .lpml file under dir. Files that another
+// page includes are partials, listed separately rather than built.
+func Load(dir string) (*Project, error) {
+	sources, err := FindSources(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []*Page
+	included := make(map[string]bool)
+	for _, src := range sources {
+		page, err := LoadPage(src)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+		for _, inc := range page.Includes {
+			included[inc] = true
+		}
+	}
+
+	proj := &Project{Dir: dir}
+	for _, page := range pages {
+		if included[filepath.Clean(page.Source)] {
+			proj.Partials = append(proj.Partials, page.Source)
+			continue
+		}
+		proj.Pages = append(proj.Pages, page)
+	}
+
+	return proj, nil
+}
+
+// LoadPage reads and parses a single source file
+func LoadPage(source string) (*Page, error) {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.NewForFile(lexer.New(string(content)), source, os.ReadFile)
+	doc := p.ParseDocument()
+
+	return &Page{
+		Source:             source,
+		Output:             OutputPath(source),
+		Doc:                doc,
+		Errors:             p.Errors(),
+		Diagnostics:        p.Diagnostics(),
+		Warnings:           p.Warnings(),
+		WarningDiagnostics: p.WarningDiagnostics(),
+		Includes:           p.Includes(),
+	}, nil
+}
+
+// FindSources returns all .lpml files under dir in sorted order,
+// skipping hidden directories like .git
+func FindSources(dir string) ([]string, error) {
+	var sources []string
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".lpml") {
+			sources = append(sources, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(sources)
+	return sources, nil
+}
+
+// OutputPath returns the default .html path for a source file
+func OutputPath(source string) string {
+	return strings.TrimSuffix(source, ".lpml") + ".html"
+}
+
+// Elements returns every element in the document in source order,
+// including the contents of each [if] and [repeat]
+func Elements(doc *ast.Document) []*ast.Element {
+	var elems []*ast.Element
+	ast.Inspect(doc, func(node ast.Node) bool {
+		if _, ok := node.(ast.Value); ok {
+			return false
+		}
+		if elem, ok := node.(*ast.Element); ok {
+			elems = append(elems, elem)
+		}
+		return true
+	})
+	return elems
+}
+
+// Label returns the literal label of an element, if any
+func Label(elem *ast.Element) string {
+	label, _ := ast.StringOf(elem.Properties["label"])
+	return label
+}
+
+// IsLocalPath reports whether a src/href refers to a file in the project
+// rather than a URL, anchor, or inline data
+func IsLocalPath(ref string) bool {
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "//") {
+		return false
+	}
+	if i := strings.Index(ref, ":"); i > 0 && !strings.ContainsAny(ref[:i], "/.") {
+		return false // has a scheme like https:, mailto:, data:
+	}
+	return true
+}
+
+// ResolvePath resolves a local reference made from a page. Paths starting
+// with "/" are relative to the project root, others to the page's directory.
+func (proj *Project) ResolvePath(page *Page, ref string) string {
+	// Drop any query or fragment
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		ref = ref[:i]
+	}
+	if strings.HasPrefix(ref, "/") {
+		return filepath.Join(proj.Dir, filepath.FromSlash(ref))
+	}
+	return filepath.Join(filepath.Dir(page.Source), filepath.FromSlash(ref))
+}
@@ -0,0 +1,224 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"lpml/ast"
+)
+
+// Symbol is a labeled element somewhere in the project
+type Symbol struct {
+	Label string
+	Page  *Page
+	Elem  *ast.Element
+}
+
+// SymbolIndex maps each label to every element that defines it
+type SymbolIndex map[string][]Symbol
+
+// Symbols builds the project-wide symbol index
+func (proj *Project) Symbols() SymbolIndex {
+	idx := make(SymbolIndex)
+	for _, page := range proj.Pages {
+		for _, elem := range Elements(page.Doc) {
+			if label := Label(elem); label != "" {
+				idx[label] = append(idx[label], Symbol{Label: label, Page: page, Elem: elem})
+			}
+		}
+	}
+	return idx
+}
+
+// External returns the labels from other pages that page references but
+// doesn't define itself. Labels defined in more than one other page can't
+// be resolved and are reported as errors instead.
+func (idx SymbolIndex) External(page *Page) (map[string]*ast.Element, []string) {
+	local := LocalNames(page.Doc)
+
+	external := make(map[string]*ast.Element)
+	var errors []string
+	reported := make(map[string]bool)
+
+	for _, ref := range References(page.Doc) {
+		if local[ref.Name] || reported[ref.Name] {
+			continue
+		}
+
+		// Pages including the same file each have a copy of its labels,
+		// which count as one definition
+		var defs []Symbol
+		files := make(map[string]bool)
+		for _, sym := range idx[ref.Name] {
+			if sym.Page != page && (sym.Elem.File == "" || !files[sym.Elem.File]) {
+				files[sym.Elem.File] = true
+				defs = append(defs, sym)
+			}
+		}
+		if i := strings.LastIndex(ref.Name, "."); len(defs) == 0 && i > 0 {
+			// $module.label names the file the label is in, another page
+			// or a file one includes
+			module, label := ref.Name[:i], ref.Name[i+1:]
+			for _, sym := range idx[label] {
+				if sym.Page != page && sym.Elem.Module() == module && !files[sym.Elem.File] {
+					files[sym.Elem.File] = true
+					defs = append(defs, sym)
+				}
+			}
+		}
+
+		switch len(defs) {
+		case 0:
+			// Unknown everywhere; the generator leaves it as written
+		case 1:
+			external[ref.Name] = defs[0].Elem
+		default:
+			var sources []string
+			for _, d := range defs {
+				sources = append(sources, d.Page.Source)
+			}
+			errors = append(errors, fmt.Sprintf("line %d: reference $%s is ambiguous, defined in %s",
+				ref.Token.Line, ref.Name, strings.Join(sources, ", ")))
+			reported[ref.Name] = true
+		}
+	}
+
+	return external, errors
+}
+
+// LocalNames returns the $names a document defines itself: its labels,
+// each also as $module.label, [define] constants, [repeat] loop
+// variables, and the $as.name fields of each page a [query-start] finds
+func LocalNames(doc *ast.Document) map[string]bool {
+	local := make(map[string]bool)
+	for _, elem := range Elements(doc) {
+		if label := Label(elem); label != "" {
+			local[label] = true
+			if module := elem.Module(); module != "" {
+				local[module+"."+label] = true
+			}
+		}
+	}
+	for name := range doc.Defines {
+		local[name] = true
+	}
+
+	var visit func(nodes []ast.Node)
+	visit = func(nodes []ast.Node) {
+		for _, node := range nodes {
+			switch n := node.(type) {
+			case *ast.Repeat:
+				local[n.As], local[n.As+".index"] = true, true
+				visit(n.Children)
+			case ast.Block:
+				visit(n.Contents())
+			case *ast.Element:
+				if n.TagType == "query" {
+					queryNames(n, local)
+				}
+				visit(n.Children)
+			}
+		}
+	}
+	for _, section := range doc.Sections {
+		visit(section.Children)
+	}
+	return local
+}
+
+// References returns every variable reference in the document's
+// constants, section and element properties, in document order
+func References(doc *ast.Document) []*ast.VariableRef {
+	var refs []*ast.VariableRef
+
+	var collect func(val ast.Value)
+	collect = func(val ast.Value) {
+		switch v := val.(type) {
+		case *ast.VariableRef:
+			refs = append(refs, v)
+			collect(v.Default)
+		case *ast.ArrayValue:
+			for _, item := range v.Values {
+				collect(item)
+			}
+		case *ast.TemplateValue:
+			for _, part := range v.Parts {
+				collect(part)
+			}
+		case *ast.MapValue:
+			for _, e := range v.Entries {
+				collect(e.Value)
+			}
+		case *ast.CallValue:
+			for _, arg := range v.Args {
+				collect(arg)
+			}
+		case *ast.PipeValue:
+			collect(v.Value)
+			for _, filter := range v.Filters {
+				for _, arg := range filter.Args {
+					collect(arg)
+				}
+			}
+		}
+	}
+
+	// Properties are a map, so visit them by name to keep the order stable
+	collectProps := func(props map[string]ast.Value) {
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			collect(props[name])
+		}
+	}
+
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		if block, ok := node.(ast.Block); ok {
+			for _, child := range block.Contents() {
+				visit(child)
+			}
+			return
+		}
+		elem, ok := node.(*ast.Element)
+		if !ok {
+			return
+		}
+		collectProps(elem.Properties)
+		for _, child := range elem.Children {
+			visit(child)
+		}
+	}
+
+	collectProps(doc.Defines)
+	for _, section := range doc.Sections {
+		collectProps(section.Properties)
+		for _, child := range section.Children {
+			visit(child)
+		}
+	}
+
+	return refs
+}
+
+// queryNames adds the $as.name references inside a [query-start] to
+// local. Which names a found page has depends on its [meta], so any name
+// under as counts.
+func queryNames(query *ast.Element, local map[string]bool) {
+	as := "item"
+	if name, ok := ast.StringOf(query.Properties["as"]); ok && name != "" {
+		as = name
+	}
+	for _, child := range query.Children {
+		ast.Inspect(child, func(node ast.Node) bool {
+			if ref, ok := node.(*ast.VariableRef); ok && strings.HasPrefix(ref.Name, as+".") {
+				local[ref.Name] = true
+			}
+			return true
+		})
+	}
+}
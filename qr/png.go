@@ -0,0 +1,66 @@
+package qr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// quietZone is the light margin around a code, in modules, that scanners
+// need to find its edges
+const quietZone = 4
+
+// Width returns the width and height in pixels of the code's PNG image
+// at a scale, quiet zone included
+func (c *Code) Width(scale int) int {
+	return (c.Size + 2*quietZone) * scale
+}
+
+// PNG returns the code as a black and white PNG image, each module scale
+// pixels square, with the quiet zone around it
+func (c *Code) PNG(scale int) []byte {
+	side := c.Width(scale)
+
+	// Each row of pixels is a filter type byte, 0 for none, then a byte
+	// per pixel: 0 for dark, 255 for light
+	var raw bytes.Buffer
+	for py := range side {
+		raw.WriteByte(0)
+		y := py/scale - quietZone
+		for px := range side {
+			x := px/scale - quietZone
+			if x >= 0 && x < c.Size && y >= 0 && y < c.Size && c.Dark(x, y) {
+				raw.WriteByte(0)
+			} else {
+				raw.WriteByte(255)
+			}
+		}
+	}
+	var compressed bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+	zw.Write(raw.Bytes())
+	zw.Close()
+
+	var out bytes.Buffer
+	out.WriteString("\x89PNG\r\n\x1a\n")
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(side))
+	binary.BigEndian.PutUint32(header[4:], uint32(side))
+	header[8] = 8 // Bits per pixel; color type 0, grayscale, and the rest stay 0
+	writeChunk(&out, "IHDR", header)
+	writeChunk(&out, "IDAT", compressed.Bytes())
+	writeChunk(&out, "IEND", nil)
+	return out.Bytes()
+}
+
+// writeChunk writes a PNG chunk: its length, type, data, and CRC
+func writeChunk(out *bytes.Buffer, kind string, data []byte) {
+	binary.Write(out, binary.BigEndian, uint32(len(data)))
+	out.WriteString(kind)
+	out.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
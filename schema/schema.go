@@ -0,0 +1,436 @@
+package schema
+
+import "strings"
+
+// Value types a property accepts
+const (
+	TypeString    = "string"    // "quoted text"
+	TypeNumber    = "number"    // 42 or 1.5
+	TypeArray     = "array"     // [1, "two", $three]
+	TypeReference = "reference" // $label
+	TypeCode      = "code"      // { verbatim code }
+	TypeBool      = "bool"      // true or false
+	TypeMap       = "map"       // { key = value, ... }
+	TypeDate      = "date"      // 2024-06-01 or 2024-06-01T18:00
+	TypeAny       = "any"       // Any of the above resolved to text
+)
+
+// Property describes one property a tag accepts
+type Property struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Values      []string `json:"values,omitempty"` // Friendly names with built-in meanings
+	Example     string   `json:"example,omitempty"`
+}
+
+// Tag describes an element or page section
+type Tag struct {
+	Name        string     `json:"name"` // Name as it appears in the AST, e.g. "divide"
+	Open        string     `json:"open"`
+	Close       string     `json:"close"`
+	HTML        string     `json:"html"` // Element it generates
+	Section     bool       `json:"section,omitempty"`
+	Void        bool       `json:"void,omitempty"` // Can be written as one tag, like [img src="x.png"]; Close is "" if that's the only way
+	Description string     `json:"description"`
+	Properties  []Property `json:"properties"` // Tag-specific, in addition to Common
+	Example     string     `json:"example"`
+}
+
+// Common lists the properties every element and section accepts
+var Common = []Property{
+	{Name: "label", Type: TypeString, Description: "Name for $references; also becomes the element's id", Example: `label = "intro"`},
+	{Name: "class", Type: TypeString, Description: "Extra CSS classes", Example: `class = "card wide"`},
+	{Name: "color", Type: TypeString, Description: "Text color", Example: `color = "#333"`},
+	{Name: "text_color", Type: TypeString, Description: "Text color (alias of color)", Example: `text_color = "navy"`},
+	{Name: "background", Type: TypeString, Description: "Background color, gradient, or url()", Example: `background = "linear-gradient(...)"`},
+	{Name: "bg_color", Type: TypeString, Description: "Background color", Example: `bg_color = "#f5f5f5"`},
+	{Name: "text_size", Type: TypeString, Description: "Font size", Values: []string{"tiny", "small", "normal", "medium", "large", "huge", "giant"}, Example: `text_size = "large"`},
+	{Name: "font", Type: TypeString, Description: "Font family", Example: `font = "Georgia, serif"`},
+	{Name: "align", Type: TypeString, Description: "Text alignment", Values: []string{"left", "center", "right"}, Example: `align = "center"`},
+	{Name: "padding", Type: TypeString, Description: "Inner spacing", Values: []string{"none", "tiny", "small", "medium", "large", "huge"}, Example: `padding = "large"`},
+	{Name: "margin", Type: TypeString, Description: "Outer spacing", Values: []string{"none", "tiny", "small", "medium", "large", "huge"}, Example: `margin = "medium"`},
+	{Name: "border", Type: TypeString, Description: "Border", Values: []string{"none", "thin", "medium", "thick"}, Example: `border = "thin"`},
+	{Name: "rounded", Type: TypeString, Description: "Corner radius", Values: []string{"none", "small", "medium", "large", "full", "circle"}, Example: `rounded = "medium"`},
+	{Name: "shadow", Type: TypeString, Description: "Drop shadow", Values: []string{"none", "small", "medium", "large", "huge"}, Example: `shadow = "medium"`},
+	{Name: "width", Type: TypeString, Description: "CSS width", Example: `width = "50%"`},
+	{Name: "max_width", Type: TypeString, Description: "CSS max-width, centered unless margin is set", Example: `max_width = "800px"`},
+	{Name: "height", Type: TypeString, Description: "CSS height", Example: `height = "100vh"`},
+	{Name: "line_spacing", Type: TypeString, Description: "CSS line-height", Example: `line_spacing = "1.6"`},
+	{Name: "display", Type: TypeString, Description: "CSS display", Example: `display = "flex"`},
+	{Name: "style", Type: TypeMap, Description: "The styling properties grouped in one map; ones set directly win", Example: `style = { color = "red", padding = "large" }`},
+	{Name: "use_preset", Type: TypeString, Description: "Name of a [preset] whose styling properties the element takes; the style map and ones set directly win", Example: `use_preset = "card_style"`},
+	{Name: "css", Type: TypeCode, Description: "CSS declarations added to the element's style as written, after the ones the other properties make", Example: "css = { letter-spacing: 0.1em; text-shadow: 0 1px 2px #0003; }"},
+	{Name: "date_format", Type: TypeString, Description: "How unquoted dates in the element are written: long, short, iso, rfc3339, or a Go layout like \"January 2, 2006\"", Values: []string{"long", "short", "iso", "rfc3339"}, Example: `date_format = "short"`},
+	{Name: "center_content", Type: TypeBool, Description: "true centers children with flexbox", Example: `center_content = true`},
+	{Name: "break_before", Type: TypeString, Description: "Page break before the element when printed", Values: []string{"page", "avoid", "auto"}, Example: `break_before = "page"`},
+	{Name: "break_after", Type: TypeString, Description: "Page break after the element when printed", Values: []string{"page", "avoid", "auto"}, Example: `break_after = "page"`},
+}
+
+// contains, formatWith, and linkURL are shared by the text elements
+var (
+	contains   = Property{Name: "contains", Type: TypeAny, Description: "Text content", Example: `contains = "Hello World!"`}
+	formatWith = Property{Name: "format_with", Type: TypeArray, Description: "Formatting wrapped around the text; color:<value> colors it", Values: []string{"bold", "italic", "underline", "strike", "code", "mark", "link", "color:<value>"}, Example: `format_with = ["bold", "italic"]`}
+	linkURL    = Property{Name: "link_url", Type: TypeString, Description: "Link target, used by the link format", Example: `link_url = "https://example.com"`}
+	listItems  = Property{Name: "items", Type: TypeArray, Description: "List items", Example: `items = ["Apple", "Banana"]`}
+)
+
+// tags is every tag in the language, in documentation order
+var tags = []Tag{
+	section("top-of-page", "top", "Page header area"),
+	section("mid-page", "mid", "Main content area"),
+	section("bottom-of-page", "bottom", "Page footer area"),
+	{
+		Name: "h", Open: "h-start", Close: "h-end", HTML: "h1-h6",
+		Description: "Heading",
+		Properties: []Property{
+			contains, formatWith, linkURL,
+			{Name: "level", Type: TypeAny, Description: "Heading level", Values: []string{"title", "subtitle", "1", "2", "3", "4", "5", "6"}, Example: `level = 2`},
+			{Name: "size", Type: TypeString, Description: "Font size, as for text_size", Values: []string{"tiny", "small", "normal", "medium", "large", "huge", "giant"}, Example: `size = "huge"`},
+		},
+		Example: "[h-start]\n  contains = \"Welcome\"\n  level = 2\n[h-end]",
+	},
+	{
+		Name: "p", Open: "p-start", Close: "p-end", HTML: "p",
+		Description: "Paragraph",
+		Properties:  []Property{contains, formatWith, linkURL},
+		Example:     "[p-start]\n  contains = \"Some text\"\n  format_with = [\"italic\"]\n[p-end]",
+	},
+	{
+		Name: "divide", Open: "divide-start", Close: "divide-end", HTML: "div",
+		Description: "Container for grouping and styling other elements",
+		Example:     "[divide-start]\n  padding = \"large\"\n  [p-start]\n    contains = \"Inside\"\n  [p-end]\n[divide-end]",
+	},
+	{
+		Name: "nav", Open: "nav-start", Close: "nav-end", HTML: "nav",
+		Description: "Container for a page's main links, like a menu or table of contents",
+		Example:     "[nav-start]\n  [link-start]\n    contains = \"Home\"\n    link_url = \"/\"\n  [link-end]\n[nav-end]",
+	},
+	{
+		Name: "article", Open: "article-start", Close: "article-end", HTML: "article",
+		Description: "Container for content that makes sense on its own, like a post or a comment",
+		Example:     "[article-start]\n  [h-start]\n    contains = \"Release notes\"\n  [h-end]\n[article-end]",
+	},
+	{
+		Name: "section", Open: "section-start", Close: "section-end", HTML: "section",
+		Description: "Container for a part of the page on one topic, usually with a heading",
+		Example:     "[section-start]\n  [h-start]\n    contains = \"Pricing\"\n  [h-end]\n[section-end]",
+	},
+	{
+		Name: "aside", Open: "aside-start", Close: "aside-end", HTML: "aside",
+		Description: "Container for content to the side of the page's, like a sidebar or a note",
+		Example:     "[aside-start]\n  [p-start]\n    contains = \"Related reading\"\n  [p-end]\n[aside-end]",
+	},
+	{
+		Name: "link", Open: "link-start", Close: "link-end", HTML: "a",
+		Description: "Hyperlink",
+		Properties: []Property{
+			contains, formatWith,
+			{Name: "link_url", Type: TypeString, Description: "Link target", Example: `link_url = "https://example.com"`},
+			{Name: "href", Type: TypeString, Description: "Link target (legacy alias of link_url)", Example: `href = "page.html"`},
+		},
+		Example: "[link-start]\n  contains = \"Visit\"\n  link_url = \"https://example.com\"\n[link-end]",
+	},
+	{
+		Name: "img", Open: "img-start", Close: "img-end", HTML: "img", Void: true,
+		Description: "Image",
+		Properties: []Property{
+			{Name: "src", Type: TypeString, Description: "Image path or URL", Example: `src = "logo.png"`},
+			{Name: "alt", Type: TypeString, Description: "Alternative text", Example: `alt = "Company logo"`},
+			{Name: "aspect", Type: TypeString, Description: "Aspect ratio reserved before the image loads", Example: `aspect = "16:9"`},
+			{Name: "sizes", Type: TypeArray, Description: "Widths to make resized copies of a local image at, for srcset", Example: `sizes = [480, 960, 1920]`},
+			{Name: "placeholder", Type: TypeString, Description: "Shown while a local image loads, read from it at build time", Values: []string{"color", "blur"}, Example: `placeholder = "blur"`},
+		},
+		Example: "[img-start]\n  src = \"logo.png\"\n  alt = \"Logo\"\n[img-end]",
+	},
+	{
+		Name: "lst-ord", Open: "lst-ord", Close: "lst-end", HTML: "ol",
+		Description: "Numbered list",
+		Properties:  []Property{listItems},
+		Example:     "[lst-ord]\n  items = [\"First\", \"Second\"]\n[lst-end]",
+	},
+	{
+		Name: "lst-unord", Open: "lst-unord", Close: "lst-end", HTML: "ul",
+		Description: "Bulleted list",
+		Properties:  []Property{listItems},
+		Example:     "[lst-unord]\n  items = [\"Apple\", \"Banana\"]\n[lst-end]",
+	},
+	{
+		Name: "list", Open: "list-start", Close: "list-end", HTML: "ul or ol",
+		Description: "List whose kind is chosen by type",
+		Properties: []Property{
+			listItems,
+			{Name: "type", Type: TypeString, Description: "List kind", Values: []string{"ordered", "unordered"}, Example: `type = "ordered"`},
+		},
+		Example: "[list-start]\n  type = \"ordered\"\n  items = [1, 2, 3]\n[list-end]",
+	},
+	{
+		Name: "item", Open: "item-start", Close: "item-end", HTML: "li",
+		Description: "List item, for items with their own styling or children",
+		Properties:  []Property{contains, formatWith, linkURL},
+		Example:     "[item-start]\n  contains = \"Custom item\"\n[item-end]",
+	},
+	{
+		Name: "table", Open: "table-start", Close: "table-end", HTML: "table",
+		Description: "Table made of rows",
+		Example:     "[table-start]\n  [row-start]\n    [cell-start]\n      contains = \"A1\"\n    [cell-end]\n  [row-end]\n[table-end]",
+	},
+	{
+		Name: "row", Open: "row-start", Close: "row-end", HTML: "tr",
+		Description: "Table row made of cells",
+		Example:     "[row-start]\n  [cell-start]\n    contains = \"A1\"\n  [cell-end]\n[row-end]",
+	},
+	{
+		Name: "cell", Open: "cell-start", Close: "cell-end", HTML: "td",
+		Description: "Table cell",
+		Properties:  []Property{contains, formatWith, linkURL},
+		Example:     "[cell-start]\n  contains = \"A1\"\n[cell-end]",
+	},
+	{
+		Name: "form", Open: "form-start", Close: "form-end", HTML: "form",
+		Description: "Form holding inputs and buttons",
+		Properties: []Property{
+			{Name: "action", Type: TypeString, Description: "URL the form submits to", Example: `action = "/subscribe"`},
+			{Name: "method", Type: TypeString, Description: "HTTP method", Values: []string{"GET", "POST"}, Example: `method = "POST"`},
+			{Name: "provider", Type: TypeString, Description: "Form service that receives submissions", Values: []string{"formspree", "netlify", "mailto"}, Example: `provider = "formspree"`},
+			{Name: "provider_id", Type: TypeString, Description: "Formspree form id", Example: `provider_id = "xyzabcd"`},
+			{Name: "email", Type: TypeString, Description: "Address a mailto form sends to", Example: `email = "hello@example.com"`},
+			{Name: "subject", Type: TypeString, Description: "Email subject for formspree and mailto", Example: `subject = "New message"`},
+			{Name: "name", Type: TypeString, Description: "Form name, used by netlify", Example: `name = "contact"`},
+		},
+		Example: "[form-start]\n  action = \"/subscribe\"\n  [input-start]\n    type = \"email\"\n    name = \"email\"\n  [input-end]\n[form-end]",
+	},
+	{
+		Name: "input", Open: "input-start", Close: "input-end", HTML: "input", Void: true,
+		Description: "Form field",
+		Properties: []Property{
+			{Name: "type", Type: TypeString, Description: "Input type, default text", Values: []string{"text", "email", "password", "number", "checkbox", "submit"}, Example: `type = "email"`},
+			{Name: "name", Type: TypeString, Description: "Field name submitted with the form", Example: `name = "email"`},
+			{Name: "placeholder", Type: TypeString, Description: "Hint shown in the empty field", Example: `placeholder = "you@example.com"`},
+			{Name: "required", Type: TypeBool, Description: "true makes the field required", Example: `required = true`},
+			{Name: "disabled", Type: TypeBool, Description: "true disables the field", Example: `disabled = true`},
+			{Name: "checked", Type: TypeBool, Description: "true pre-checks a checkbox", Example: `checked = true`},
+		},
+		Example: "[input-start]\n  type = \"email\"\n  name = \"email\"\n[input-end]",
+	},
+	{
+		Name: "btn", Open: "btn-start", Close: "btn-end", HTML: "button",
+		Description: "Button",
+		Properties: []Property{contains, formatWith, linkURL,
+			{Name: "disabled", Type: TypeBool, Description: "true disables the button", Example: `disabled = true`},
+		},
+		Example: "[btn-start]\n  contains = \"Sign up\"\n[btn-end]",
+	},
+	{
+		Name: "hr", Open: "hr", HTML: "hr", Void: true,
+		Description: "Horizontal rule between blocks of content",
+		Example:     "[hr]\n[hr margin=\"large\"]",
+	},
+	{
+		Name: "br", Open: "br", HTML: "br", Void: true,
+		Description: "Line break, usable inline between strings",
+		Example:     "[p-start]\n  \"First line\"\n  [br]\n  \"Second line\"\n[p-end]",
+	},
+	{
+		Name: "pagenav", Open: "pagenav", HTML: "nav", Void: true,
+		Description: "Links to the previous and next pages in the directory, ordered by their [meta] order, then file name",
+		Example:     "[pagenav]",
+	},
+	{
+		Name: "versions", Open: "versions", HTML: "div", Void: true,
+		Description: "Version switcher for a site built with --versions, with a banner on older versions",
+		Properties: []Property{
+			{Name: "banner", Type: TypeBool, Description: "false leaves out the banner pointing readers of older versions to the latest", Example: `banner = false`},
+		},
+		Example: "[versions]\n[versions banner=false]",
+	},
+	{
+		Name: "time", Open: "time", HTML: "time", Void: true,
+		Description: "A date or time, written for readers the way date_format says and in full for machines; usable inline between strings",
+		Properties: []Property{
+			{Name: "datetime", Type: TypeDate, Description: "The date, or date and time, to show; a string or now() or date() call works too", Example: `datetime = 2024-06-01T18:00Z`},
+			{Name: "zone", Type: TypeString, Description: "Time zone to show a time of day in, as named in the IANA database", Example: `zone = "Europe/London"`},
+			contains,
+		},
+		Example: "[time datetime=2024-06-01T18:00Z zone=\"America/New_York\"]",
+	},
+	{
+		Name: "script", Open: "script", HTML: "script", Void: true,
+		Description: "JavaScript, from a file or written in braces, added to the head or the end of the body rather than where the tag is",
+		Properties: []Property{
+			{Name: "src", Type: TypeString, Description: "Script file to load; inlined in --self-contained builds when it's local", Example: `src = "app.js"`},
+			{Name: "syntax", Type: TypeCode, Description: "The code to run, kept verbatim, for a script without a src", Example: "syntax = {\ndocument.body.classList.add(\"js\");\n}"},
+			{Name: "placement", Type: TypeString, Description: "Where the script goes: head, or end for just before </body>; head for defer, async, and module scripts unless set, end otherwise", Values: []string{"head", "end"}, Example: `placement = "head"`},
+			{Name: "defer", Type: TypeBool, Description: "true runs a script with a src once the page is read, without holding it up", Example: `defer = true`},
+			{Name: "async", Type: TypeBool, Description: "true runs a script with a src, or a module, as soon as it loads, without holding up the page", Example: `async = true`},
+			{Name: "module", Type: TypeBool, Description: "true makes it a JavaScript module, which can import others and is deferred", Example: `module = true`},
+		},
+		Example: "[script src=\"app.js\" defer=true]\n[script syntax={\n  document.body.classList.add(\"js\");\n}]",
+	},
+	{
+		Name: "lorem", Open: "lorem", HTML: "p", Void: true,
+		Description: "Filler text for laying out a page before its content is written; usable inline between strings, as words alone",
+		Properties: []Property{
+			{Name: "words", Type: TypeNumber, Description: "Words in each paragraph, 50 if unset", Example: `words = 50`},
+			{Name: "paragraphs", Type: TypeNumber, Description: "Paragraphs to write, 1 if unset", Example: `paragraphs = 3`},
+		},
+		Example: "[lorem words=50]\n[lorem words=30 paragraphs=3]",
+	},
+	{
+		Name: "placeholder-img", Open: "placeholder-img", HTML: "img", Void: true,
+		Description: "A flat SVG image of a size, labeled with it, standing in for a picture not taken yet",
+		Properties: []Property{
+			{Name: "width", Type: TypeNumber, Description: "Width in pixels, 400 if unset", Example: `width = 400`},
+			{Name: "height", Type: TypeNumber, Description: "Height in pixels, 300 if unset", Example: `height = 300`},
+			{Name: "text", Type: TypeString, Description: "Label written across it, instead of the size", Example: `text = "Team photo"`},
+			{Name: "alt", Type: TypeString, Description: "Alternative text, the label if unset", Example: `alt = "Team photo to come"`},
+			{Name: "fill", Type: TypeString, Description: "Color it's filled with, #cccccc if unset", Example: `fill = "#e0e7ff"`},
+		},
+		Example: "[placeholder-img width=400 height=300]",
+	},
+	{
+		Name: "qr", Open: "qr", HTML: "img", Void: true,
+		Description: "A QR code of a link or text, written as a PNG next to the page",
+		Properties: []Property{
+			{Name: "data", Type: TypeString, Description: "Link or text to encode, up to 2331 bytes", Example: `data = "https://example.com"`},
+			{Name: "scale", Type: TypeNumber, Description: "Pixels per module, 4 if unset", Example: `scale = 4`},
+			{Name: "alt", Type: TypeString, Description: `Alternative text, "QR code for" the data if unset`, Example: `alt = "Scan to open the menu"`},
+		},
+		Example: "[qr data=\"https://example.com/menu\"]",
+	},
+	{
+		Name: "bold", Open: "bold-start", Close: "bold-end", HTML: "strong",
+		Description: "Bold text, usable inline between strings",
+		Properties:  []Property{contains, formatWith, linkURL},
+		Example:     "[bold-start]\n  contains = \"Important\"\n[bold-end]",
+	},
+	{
+		Name: "italic", Open: "italic-start", Close: "italic-end", HTML: "em",
+		Description: "Italic text, usable inline between strings",
+		Properties:  []Property{contains, formatWith, linkURL},
+		Example:     "[italic-start]\n  contains = \"Emphasis\"\n[italic-end]",
+	},
+	{
+		Name: "faq", Open: "faq-start", Close: "faq-end", HTML: "div",
+		Description: "Frequently asked questions, each question collapsible with its answers",
+		Properties: []Property{
+			{Name: "structured_data", Type: TypeBool, Description: "true adds schema.org FAQPage JSON-LD to the head", Example: `structured_data = true`},
+		},
+		Example: "[faq-start]\n  [question-start]\n    contains = \"What is LPML?\"\n  [question-end]\n  [answer-start]\n    contains = \"A simple markup language.\"\n  [answer-end]\n[faq-end]",
+	},
+	{
+		Name: "question", Open: "question-start", Close: "question-end", HTML: "summary",
+		Description: "FAQ question, starting a new collapsible item",
+		Properties:  []Property{contains, formatWith, linkURL},
+		Example:     "[question-start]\n  contains = \"Is it free?\"\n[question-end]",
+	},
+	{
+		Name: "answer", Open: "answer-start", Close: "answer-end", HTML: "div",
+		Description: "FAQ answer, shown when the question before it is expanded",
+		Properties:  []Property{contains, formatWith, linkURL},
+		Example:     "[answer-start]\n  contains = \"Yes, MIT licensed.\"\n[answer-end]",
+	},
+	{
+		Name: "event", Open: "event-start", Close: "event-end", HTML: "div",
+		Description: "Event with its time and place, schema.org Event JSON-LD, and an .ics calendar download",
+		Properties: []Property{
+			{Name: "title", Type: TypeString, Description: "Event name, shown as a heading", Example: `title = "Launch Party"`},
+			{Name: "start", Type: TypeString, Description: "Start as YYYY-MM-DD, YYYY-MM-DDTHH:MM, or with a UTC offset like 2025-06-01T18:00+02:00", Example: `start = "2025-06-01T18:00"`},
+			{Name: "end", Type: TypeString, Description: "End, in the same formats as start", Example: `end = "2025-06-01T21:00"`},
+			{Name: "location", Type: TypeString, Description: "Where the event takes place", Example: `location = "Town Hall, Springfield"`},
+			contains,
+			formatWith,
+			{Name: "calendar_text", Type: TypeString, Description: `Text of the .ics download link, "none" to leave it out`, Example: `calendar_text = "Add to calendar"`},
+		},
+		Example: "[event-start]\n  title = \"Launch Party\"\n  start = \"2025-06-01T18:00\"\n  end = \"2025-06-01T21:00\"\n  location = \"Town Hall\"\n  contains = \"Drinks and demos.\"\n[event-end]",
+	},
+	{
+		Name: "contact", Open: "contact-start", Close: "contact-end", HTML: "div",
+		Description: "Contact card for a person or organisation, with a .vcf download for address books",
+		Properties: []Property{
+			{Name: "name", Type: TypeString, Description: "Full name, shown first", Example: `name = "Ada Lovelace"`},
+			{Name: "role", Type: TypeString, Description: "Job title", Example: `role = "Analyst"`},
+			{Name: "org", Type: TypeString, Description: "Organisation", Example: `org = "Analytical Engines Ltd"`},
+			{Name: "email", Type: TypeString, Description: "Email address, linked with mailto:", Example: `email = "ada@example.com"`},
+			{Name: "phone", Type: TypeString, Description: "Phone number, linked with tel:", Example: `phone = "+44 20 7946 0000"`},
+			{Name: "url", Type: TypeString, Description: "Website", Example: `url = "https://example.com"`},
+			{Name: "address", Type: TypeString, Description: "Postal address on one line", Example: `address = "12 St James's Square, London"`},
+			contains,
+			formatWith,
+			{Name: "download_text", Type: TypeString, Description: `Text of the .vcf download link, "none" to leave it out`, Example: `download_text = "Save contact"`},
+			{Name: "qr", Type: TypeBool, Description: "true adds a QR code of the card, which phones scan to save it", Example: `qr = true`},
+			{Name: "scale", Type: TypeNumber, Description: "Pixels per module of the QR code, 4 if unset", Example: `scale = 4`},
+		},
+		Example: "[contact-start]\n  name = \"Ada Lovelace\"\n  email = \"ada@example.com\"\n  phone = \"+44 20 7946 0000\"\n[contact-end]",
+	},
+	{
+		Name: "query", Open: "query-start", Close: "query-end", HTML: "div",
+		Description: "Pages of the project picked by their [meta], with the elements inside repeated for each",
+		Properties: []Property{
+			{Name: "from", Type: TypeString, Description: "Directory the pages are in, or below, from the project root", Example: `from = "blog"`},
+			{Name: "tagged", Type: TypeString, Description: "Only pages whose [meta] tags include this one", Example: `tagged = "go"`},
+			{Name: "sort", Type: TypeString, Description: "[meta] property to order the pages by, or title; a leading - puts the latest or largest first", Example: `sort = "-date"`},
+			{Name: "limit", Type: TypeNumber, Description: "Most pages to show", Example: `limit = 5`},
+			{Name: "as", Type: TypeString, Description: "Name each page's fields go by, like $post.title; item by default", Example: `as = "post"`},
+		},
+		Example: "[query-start]\n  from = \"blog\"\n  tagged = \"go\"\n  sort = \"-date\"\n  limit = 5\n  as = \"post\"\n  [link-start]\n    url = $post.url\n    contains = $post.title\n  [link-end]\n[query-end]",
+	},
+	{
+		Name: "code", Open: "code-start", Close: "code-end", HTML: "pre",
+		Description: "Code block",
+		Properties: []Property{
+			{Name: "syntax", Type: TypeCode, Description: "The code, kept verbatim", Example: "syntax = {\nconsole.log(\"hi\");\n}"},
+			{Name: "file_type", Type: TypeString, Description: "Language, added as a language-<name> class for highlighters", Example: `file_type = "javascript"`},
+			{Name: "linked_file", Type: TypeString, Description: "Source file the code comes from", Example: `linked_file = "main.go"`},
+		},
+		Example: "[code-start]\n  file_type = \"go\"\n  syntax = {\nfmt.Println(\"hi\")\n}\n[code-end]",
+	},
+}
+
+// section builds the entry for a page section
+func section(name, astName, description string) Tag {
+	return Tag{
+		Name: astName, Open: name + "-start", Close: name + "-end", HTML: "div", Section: true,
+		Description: description,
+		Example:     "[" + name + "-start]\n  [p-start]\n    contains = \"...\"\n  [p-end]\n[" + name + "-end]",
+	}
+}
+
+// Tags returns every tag in documentation order
+func Tags() []Tag {
+	return tags
+}
+
+// Lookup finds a tag by its AST name, either of its tag names, or a tag
+// name written with brackets, like "[p-start]"
+func Lookup(name string) (Tag, bool) {
+	name = strings.Trim(name, "[]")
+	for _, tag := range tags {
+		if name == tag.Name || name == tag.Open || (name == tag.Close && name != "") {
+			return tag, true
+		}
+	}
+	return Tag{}, false
+}
+
+// AllProperties returns the tag's own properties followed by the common
+// ones it doesn't redefine
+func (t Tag) AllProperties() []Property {
+	props := append([]Property{}, t.Properties...)
+	for _, c := range Common {
+		if _, ok := t.Property(c.Name); !ok {
+			props = append(props, c)
+		}
+	}
+	return props
+}
+
+// Property finds one of the tag's own properties by name
+func (t Tag) Property(name string) (Property, bool) {
+	for _, p := range t.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lpml/config"
+	"lpml/generator"
+	"lpml/project"
+)
+
+// runServe serves a directory over HTTP for previewing. Requests for a
+// page whose .lpml source exists are rendered from the source on every
+// request, so edits show up on reload, as are files pages generate
+// alongside their HTML; everything else is served as a static file. It
+// returns the exit status.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	baseCSS := fs.String("base-css", generator.BaseCSSDefault, "base stylesheet: default, none, reset, or a CSS file path")
+	target := fs.String("target", generator.TargetWeb, "output target: web, or print-pdf to preview printing")
+	permalinks := fs.Bool("permalinks", false, "add a ¶ link to each heading with a label")
+	divSections := fs.Bool("div-sections", false, "write page sections as <div>s instead of <header>, <main>, and <footer>")
+	set := setValues{}
+	fs.Var(set, "set", "set `name=value` on every page, like lpml build --set; repeatable")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml serve [flags] [dir]")
+		fmt.Println("  Serves dir (default: current directory), rendering .lpml pages on request")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+
+	dir := "."
+	if len(positional) > 0 {
+		dir = positional[0]
+	}
+
+	if *target != generator.TargetWeb && *target != generator.TargetPrintPDF {
+		fmt.Printf("Unknown -target value %q (want %s or %s)\n", *target, generator.TargetWeb, generator.TargetPrintPDF)
+		return exitUsage
+	}
+
+	// Preview with the project file's settings, as a build would
+	opts := generator.Options{Target: *target, Set: set, Permalinks: *permalinks, DivSections: *divSections}
+	projectFile, err := config.Find(dir)
+	if err != nil {
+		fmt.Printf("Failed to read project file: %v\n", err)
+		return exitForError(err)
+	}
+	if projectFile != nil {
+		dir = projectFile.Input
+		opts.SiteTitle = projectFile.Title
+		opts.Permalinks = opts.Permalinks || projectFile.Permalinks
+		opts.DivSections = opts.DivSections || projectFile.DivSections
+		opts.Palette = projectFile.Palette
+		opts.Severity = projectFile.Severity
+		opts.CustomTags, err = loadPlugins(projectFile)
+		if err != nil {
+			fmt.Printf("Failed to load plugins: %v\n", err)
+			return exitUsage
+		}
+		if projectFile.Theme != "" && !flagsSet(fs)["base-css"] {
+			*baseCSS = projectFile.Theme
+		}
+	}
+
+	if err := applyBaseCSS(&opts, *baseCSS); err != nil {
+		fmt.Printf("Failed to read base CSS: %v\n", err)
+		return exitIO
+	}
+
+	static := http.FileServer(http.Dir(dir))
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if source := sourceFor(dir, r.URL.Path); source != "" {
+			servePage(w, r, dir, source, opts)
+			return
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))); os.IsNotExist(err) {
+			serveLinkedFile(w, r, dir, opts)
+			return
+		}
+		static.ServeHTTP(w, r)
+	})
+
+	fmt.Printf("Serving %s at http://%s/\n", dir, *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		fmt.Printf("Failed to serve: %v\n", err)
+		return exitIO
+	}
+	return exitOK
+}
+
+// sourceFor maps a request path to the .lpml file that generates it, or
+// "" if the path isn't a page with a source. Directory paths map to their
+// index page.
+func sourceFor(dir, urlPath string) string {
+	p := path.Clean("/" + urlPath)
+	if strings.HasSuffix(urlPath, "/") {
+		p = path.Join(p, "index.html")
+	}
+	if !strings.HasSuffix(p, ".html") {
+		return ""
+	}
+
+	source := filepath.Join(dir, filepath.FromSlash(strings.TrimSuffix(p, ".html")+".lpml"))
+	if _, err := os.Stat(source); err != nil {
+		return ""
+	}
+	return source
+}
+
+// servePage renders one page of the project in dir, reporting errors in
+// the response instead of failing
+func servePage(w http.ResponseWriter, r *http.Request, dir, source string, base generator.Options) {
+	result, err := renderPage(dir, source, base)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := result.writeTo(w); err != nil {
+		fmt.Printf("Failed to serve %s: %v\n", source, err)
+	}
+}
+
+// serveLinkedFile serves a file a page generates alongside its HTML, like
+// an event's .ics or a resized image, by rendering the pages until one
+// produces it. Pages in the requested directory are tried first.
+func serveLinkedFile(w http.ResponseWriter, r *http.Request, dir string, base generator.Options) {
+	p := path.Clean("/" + r.URL.Path)
+	requested := filepath.Join(dir, filepath.FromSlash(p))
+	sources, _ := project.FindSources(dir)
+	sort.SliceStable(sources, func(i, j int) bool {
+		return filepath.Dir(sources[i]) == filepath.Dir(requested) && filepath.Dir(sources[j]) != filepath.Dir(requested)
+	})
+	for _, source := range sources {
+		result, err := renderPage(dir, source, base)
+		if err != nil || result == nil {
+			continue
+		}
+		for _, f := range result.files {
+			if filepath.Join(filepath.Dir(source), filepath.FromSlash(f.Name)) == requested {
+				if ctype := mime.TypeByExtension(path.Ext(p)); ctype != "" {
+					w.Header().Set("Content-Type", ctype)
+				}
+				w.Write(f.Data)
+				return
+			}
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// renderPage renders the page of the project in dir built from source,
+// printing any warnings. It returns nil if the project has no such page.
+func renderPage(dir, source string, base generator.Options) (*rendered, error) {
+	proj, err := project.Load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load project: %v", err)
+	}
+
+	var page *project.Page
+	for _, p := range proj.Pages {
+		if filepath.Clean(p.Source) == filepath.Clean(source) {
+			page = p
+		}
+	}
+	if page == nil {
+		return nil, nil
+	}
+
+	external, refErrors := proj.Symbols().External(page)
+	if errs := append(withSnippets(page.Diagnostics, "  - "), refErrors...); len(errs) > 0 {
+		return nil, fmt.Errorf("errors in %s:\n  - %s", page.Source, strings.Join(errs, "\n  - "))
+	}
+
+	opts := base
+	opts.SourceFile = page.Source
+	opts.RootDir = dir
+	opts.ExternalLabels = external
+	opts.Prev, opts.Next = pageLinks(proj, page)
+	opts.Collection = collection(proj, dir, page, opts)
+
+	result, err := render(page.Doc, opts, emitHTML)
+	if err != nil {
+		return nil, err
+	}
+	warnings, errs := parseWarnings(page, opts.Severity)
+	for _, warning := range append(warnings, result.warnings...) {
+		fmt.Printf("Warning: %s: %s\n", page.Source, warning)
+	}
+	if errs = append(errs, result.errors...); len(errs) > 0 {
+		return nil, fmt.Errorf("errors in %s:\n  - %s", page.Source, strings.Join(errs, "\n  - "))
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"lpml/ast"
+	"lpml/config"
+	"lpml/project"
+)
+
+// runStats prints size and reading statistics for a file or every page in
+// a directory. It returns the exit status.
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	site := fs.Bool("site", false, "also report how a directory's pages link to each other: orphan pages and dead ends")
+	fs.Usage = func() {
+		fmt.Println("Usage: lpml stats [--site] [file.lpml | dir]")
+		fmt.Println("  Prints element, word, and reading-time counts (default: current directory)")
+		fmt.Println("Flags:")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+
+	target := "."
+	if len(positional) > 0 {
+		target = positional[0]
+	}
+
+	var pages []*project.Page
+	var proj *project.Project
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		// Plugins' custom tags have to be known to parse the pages
+		projectFile, err := config.Find(target)
+		if err == nil {
+			_, err = loadPlugins(projectFile)
+		}
+		if err != nil {
+			fmt.Printf("Failed to load plugins: %v\n", err)
+			return exitForError(err)
+		}
+		proj, err = project.Load(target)
+		if err != nil {
+			fmt.Printf("Failed to load project: %v\n", err)
+			return exitIO
+		}
+		pages = proj.Pages
+	} else if *site {
+		fmt.Println("--site reports on a directory of pages, not a single file")
+		return exitUsage
+	} else {
+		page, err := project.LoadPage(target)
+		if err != nil {
+			fmt.Printf("Failed to read file: %v\n", err)
+			return exitIO
+		}
+		pages = []*project.Page{page}
+	}
+
+	fmt.Printf("%-40s %9s %7s %8s\n", "PAGE", "ELEMENTS", "WORDS", "READING")
+
+	totalElems, totalWords := 0, 0
+	for _, page := range pages {
+		elems := len(project.Elements(page.Doc))
+		words := ast.WordCount(ast.ExtractText(page.Doc))
+		totalElems += elems
+		totalWords += words
+		fmt.Printf("%-40s %9d %7d %4d min\n", page.Source, elems, words, ast.ReadingMinutes(words))
+	}
+
+	if len(pages) > 1 {
+		fmt.Printf("%-40s %9d %7d %4d min\n", fmt.Sprintf("total (%d pages)", len(pages)),
+			totalElems, totalWords, ast.ReadingMinutes(totalWords))
+	}
+
+	if *site {
+		printLinkReport(proj)
+	}
+	return exitOK
+}
+
+// printLinkReport prints how a project's pages link to each other, and
+// the pages navigation can't reach or leads nowhere from
+func printLinkReport(proj *project.Project) {
+	graph := proj.Links()
+	links := 0
+	for _, targets := range graph.To {
+		links += len(targets)
+	}
+	fmt.Printf("\n%d pages, %d links between them\n", len(proj.Pages), links)
+
+	list := func(heading, none string, pages []string) {
+		if len(pages) == 0 {
+			fmt.Println(none)
+			return
+		}
+		fmt.Println(heading)
+		for _, page := range pages {
+			fmt.Printf("  %s\n", page)
+		}
+	}
+	list("Orphan pages, which no other page links to:", "No orphan pages", proj.Orphans(graph))
+	list("Dead ends, which link to no other page:", "No dead ends", proj.DeadEnds(graph))
+}
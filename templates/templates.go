@@ -0,0 +1,87 @@
+// Package templates holds the starter projects `lpml new` scaffolds, each
+// a complete project that builds as is
+package templates
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+//go:embed blog docs landing resume
+var files embed.FS
+
+// Default is the template used when none is named
+const Default = "landing"
+
+// Names returns the available templates, sorted
+func Names() []string {
+	entries, _ := files.ReadDir(".")
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write copies the named template into dir, creating it if needed, and
+// returns the paths written. Existing files are never overwritten: if any
+// would be, nothing is written.
+func Write(name, dir string) ([]string, error) {
+	root, err := fs.Sub(files, name)
+	if err != nil || !isTemplate(name) {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+
+	var rels []string
+	err = fs.WalkDir(root, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rels = append(rels, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range rels {
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if _, err := os.Stat(target); err == nil {
+			return nil, fmt.Errorf("%s already exists", target)
+		}
+	}
+
+	var written []string
+	for _, rel := range rels {
+		data, err := fs.ReadFile(root, rel)
+		if err != nil {
+			return written, err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return written, err
+		}
+		written = append(written, target)
+	}
+	return written, nil
+}
+
+// isTemplate reports whether name is one of the templates
+func isTemplate(name string) bool {
+	for _, n := range Names() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
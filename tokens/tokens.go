@@ -1,5 +1,11 @@
 package tokens
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type TokenType string
 
 const (
@@ -7,21 +13,84 @@ const (
 	ILLEGAL TokenType = "ILLEGAL"
 	EOF     TokenType = "EOF"
 
+	// A bracketed name that isn't a tag, like [lnk-start]
+	UNKNOWN_TAG TokenType = "UNKNOWN_TAG"
+
 	// Structural tokens
 	LBRACKET TokenType = "["  // [
 	RBRACKET TokenType = "]"  // ]
-	LBRACE   TokenType = "{"  // { for code blocks
-	RBRACE   TokenType = "}"  // } for code blocks
+	LBRACE   TokenType = "{"  // { opening a map value
+	RBRACE   TokenType = "}"  // } closing a map value
 	EQUALS   TokenType = "="  // =
 	DOLLAR   TokenType = "$"  // $ for variable references
 	COMMA    TokenType = ","  // , for array items
+	FALLBACK TokenType = "??" // ?? giving a $reference a fallback value
+	PIPE     TokenType = "|"  // | passing a $reference through a filter
+	RPAREN   TokenType = ")"  // ) closing a function call
 	NEWLINE  TokenType = "NEWLINE"
 
 	// Literals
-	STRING    TokenType = "STRING"    // "quoted string"
+	STRING    TokenType = "STRING"    // "quoted string", or bare text between tags
 	NUMBER    TokenType = "NUMBER"    // numeric literal
+	DIMENSION TokenType = "DIMENSION" // number with a unit, like 16px or 50%
+	COLOR     TokenType = "COLOR"     // color literal, like #ff6600 or rgb(255, 102, 0)
+	DATE      TokenType = "DATE"      // date literal, like 2024-06-01 or 2024-06-01T18:00Z
+	BOOL      TokenType = "BOOL"      // true or false
 	IDENT     TokenType = "IDENT"     // identifier (property names, labels)
 	CODEBLOCK TokenType = "CODEBLOCK" // code content inside { }
+	CALL      TokenType = "CALL"      // build-time function and its '(', like now(, with the name as its literal
+	COMMENT   TokenType = "COMMENT"   // // line or /* block */ comment, only from lexer.NewWithComments
+
+	// Interpolated strings like "Hello, ${name}!" arrive as their STRING and
+	// DOLLAR parts between these two
+	TEMPLATE_START TokenType = "TEMPLATE_START"
+	TEMPLATE_END   TokenType = "TEMPLATE_END"
+
+	// Front matter: [meta] followed by document properties
+	META TokenType = "META"
+
+	// Constants: [define] followed by name = value properties
+	DEFINE TokenType = "DEFINE"
+
+	// Style presets: [preset name="card"], with the name as its literal,
+	// followed by the style properties it bundles
+	PRESET TokenType = "PRESET"
+
+	// [include file="path"], with the path as its literal
+	INCLUDE TokenType = "INCLUDE"
+
+	// Conditionals: [if cond=...], with the condition as its literal, an
+	// optional [else], and [if-end]
+	IF_START TokenType = "IF_START"
+	ELSE     TokenType = "ELSE"
+	IF_END   TokenType = "IF_END"
+
+	// Loops: [repeat over=$items as="item"], with its attributes as its
+	// literal, and [repeat-end]
+	REPEAT_START TokenType = "REPEAT_START"
+	REPEAT_END   TokenType = "REPEAT_END"
+
+	// Void tags written without an end tag, like [img src="x.png"]: the
+	// tag name as VOID_START's literal, its attributes as properties, then
+	// VOID_END
+	VOID_START TokenType = "VOID_START"
+	VOID_END   TokenType = "VOID_END"
+
+	// Properties written inside an opening tag, like [p-start align="center"],
+	// arrive between these two, right after the tag
+	ATTRS_START TokenType = "ATTRS_START"
+	ATTRS_END   TokenType = "ATTRS_END"
+
+	// [end] closes whatever was opened last: a section, an element, an
+	// [if], or a [repeat]
+	END TokenType = "END"
+
+	// [indented] as a file's first tag nests by indentation instead of end
+	// tags. The lexer then brackets each run of lines indented under a tag
+	// with INDENT and DEDENT.
+	INDENTED TokenType = "INDENTED"
+	INDENT   TokenType = "INDENT"
+	DEDENT   TokenType = "DEDENT"
 
 	// Page section tags
 	TOP_OF_PAGE_START    TokenType = "TOP_OF_PAGE_START"
@@ -32,24 +101,34 @@ const (
 	BOTTOM_OF_PAGE_END   TokenType = "BOTTOM_OF_PAGE_END"
 
 	// Element tags - opening
-	DIVIDE_START   TokenType = "DIVIDE_START"
-	P_START        TokenType = "P_START"
-	H_START        TokenType = "H_START"
-	LINK_START     TokenType = "LINK_START"
-	IMG_START      TokenType = "IMG_START"
-	LIST_START     TokenType = "LIST_START"
-	LIST_ORD_START TokenType = "LIST_ORD_START"   // [lst-ord]
+	DIVIDE_START     TokenType = "DIVIDE_START"
+	P_START          TokenType = "P_START"
+	H_START          TokenType = "H_START"
+	LINK_START       TokenType = "LINK_START"
+	IMG_START        TokenType = "IMG_START"
+	LIST_START       TokenType = "LIST_START"
+	LIST_ORD_START   TokenType = "LIST_ORD_START"   // [lst-ord]
 	LIST_UNORD_START TokenType = "LIST_UNORD_START" // [lst-unord]
-	ITEM_START     TokenType = "ITEM_START"
-	TABLE_START  TokenType = "TABLE_START"
-	ROW_START    TokenType = "ROW_START"
-	CELL_START   TokenType = "CELL_START"
-	FORM_START   TokenType = "FORM_START"
-	INPUT_START  TokenType = "INPUT_START"
-	BTN_START    TokenType = "BTN_START"
-	BOLD_START   TokenType = "BOLD_START"
-	ITALIC_START TokenType = "ITALIC_START"
-	CODE_START   TokenType = "CODE_START"
+	ITEM_START       TokenType = "ITEM_START"
+	TABLE_START      TokenType = "TABLE_START"
+	ROW_START        TokenType = "ROW_START"
+	CELL_START       TokenType = "CELL_START"
+	FORM_START       TokenType = "FORM_START"
+	INPUT_START      TokenType = "INPUT_START"
+	BTN_START        TokenType = "BTN_START"
+	BOLD_START       TokenType = "BOLD_START"
+	ITALIC_START     TokenType = "ITALIC_START"
+	CODE_START       TokenType = "CODE_START"
+	FAQ_START        TokenType = "FAQ_START"
+	QUESTION_START   TokenType = "QUESTION_START"
+	ANSWER_START     TokenType = "ANSWER_START"
+	EVENT_START      TokenType = "EVENT_START"
+	CONTACT_START    TokenType = "CONTACT_START"
+	QUERY_START      TokenType = "QUERY_START"
+	NAV_START        TokenType = "NAV_START"
+	ARTICLE_START    TokenType = "ARTICLE_START"
+	SECTION_START    TokenType = "SECTION_START"
+	ASIDE_START      TokenType = "ASIDE_START"
 
 	// Element tags - closing
 	DIVIDE_END     TokenType = "DIVIDE_END"
@@ -61,27 +140,54 @@ const (
 	LIST_ORD_END   TokenType = "LIST_ORD_END"   // [lst-end] for ordered
 	LIST_UNORD_END TokenType = "LIST_UNORD_END" // [lst-end] for unordered
 	ITEM_END       TokenType = "ITEM_END"
-	TABLE_END  TokenType = "TABLE_END"
-	ROW_END    TokenType = "ROW_END"
-	CELL_END   TokenType = "CELL_END"
-	FORM_END   TokenType = "FORM_END"
-	INPUT_END  TokenType = "INPUT_END"
-	BTN_END    TokenType = "BTN_END"
-	BOLD_END   TokenType = "BOLD_END"
-	ITALIC_END TokenType = "ITALIC_END"
-	CODE_END   TokenType = "CODE_END"
+	TABLE_END      TokenType = "TABLE_END"
+	ROW_END        TokenType = "ROW_END"
+	CELL_END       TokenType = "CELL_END"
+	FORM_END       TokenType = "FORM_END"
+	INPUT_END      TokenType = "INPUT_END"
+	BTN_END        TokenType = "BTN_END"
+	BOLD_END       TokenType = "BOLD_END"
+	ITALIC_END     TokenType = "ITALIC_END"
+	CODE_END       TokenType = "CODE_END"
+	FAQ_END        TokenType = "FAQ_END"
+	QUESTION_END   TokenType = "QUESTION_END"
+	ANSWER_END     TokenType = "ANSWER_END"
+	EVENT_END      TokenType = "EVENT_END"
+	CONTACT_END    TokenType = "CONTACT_END"
+	QUERY_END      TokenType = "QUERY_END"
+	NAV_END        TokenType = "NAV_END"
+	ARTICLE_END    TokenType = "ARTICLE_END"
+	SECTION_END    TokenType = "SECTION_END"
+	ASIDE_END      TokenType = "ASIDE_END"
 )
 
 // Token represents a lexical token
 type Token struct {
-	Type    TokenType
-	Literal string
-	Line    int
-	Column  int
+	Type      TokenType
+	Literal   string
+	Line      int
+	Column    int
+	EndLine   int // Where the token ends: just past its last character
+	EndColumn int
 }
 
 // keywords maps tag names to token types
 var keywords = map[string]TokenType{
+	// Front matter and composition
+	"meta":    META,
+	"define":  DEFINE,
+	"include": INCLUDE,
+	"preset":  PRESET,
+	"if":      IF_START,
+	"else":    ELSE,
+	"if-end":  IF_END,
+
+	"repeat":     REPEAT_START,
+	"repeat-end": REPEAT_END,
+
+	"end":      END,
+	"indented": INDENTED,
+
 	// Page sections
 	"top-of-page-start":    TOP_OF_PAGE_START,
 	"top-of-page-end":      TOP_OF_PAGE_END,
@@ -91,43 +197,132 @@ var keywords = map[string]TokenType{
 	"bottom-of-page-end":   BOTTOM_OF_PAGE_END,
 
 	// Element opening tags
-	"divide-start": DIVIDE_START,
-	"p-start":      P_START,
-	"h-start":      H_START,
-	"link-start":   LINK_START,
-	"img-start":    IMG_START,
-	"list-start":   LIST_START,
-	"lst-ord":      LIST_ORD_START,
-	"lst-unord":    LIST_UNORD_START,
-	"item-start":   ITEM_START,
-	"table-start":  TABLE_START,
-	"row-start":    ROW_START,
-	"cell-start":   CELL_START,
-	"form-start":   FORM_START,
-	"input-start":  INPUT_START,
-	"btn-start":    BTN_START,
-	"bold-start":   BOLD_START,
-	"italic-start": ITALIC_START,
-	"code-start":   CODE_START,
+	"divide-start":   DIVIDE_START,
+	"p-start":        P_START,
+	"h-start":        H_START,
+	"link-start":     LINK_START,
+	"img-start":      IMG_START,
+	"list-start":     LIST_START,
+	"lst-ord":        LIST_ORD_START,
+	"lst-unord":      LIST_UNORD_START,
+	"item-start":     ITEM_START,
+	"table-start":    TABLE_START,
+	"row-start":      ROW_START,
+	"cell-start":     CELL_START,
+	"form-start":     FORM_START,
+	"input-start":    INPUT_START,
+	"btn-start":      BTN_START,
+	"bold-start":     BOLD_START,
+	"italic-start":   ITALIC_START,
+	"code-start":     CODE_START,
+	"faq-start":      FAQ_START,
+	"question-start": QUESTION_START,
+	"answer-start":   ANSWER_START,
+	"event-start":    EVENT_START,
+	"contact-start":  CONTACT_START,
+	"query-start":    QUERY_START,
+	"nav-start":      NAV_START,
+	"article-start":  ARTICLE_START,
+	"section-start":  SECTION_START,
+	"aside-start":    ASIDE_START,
 
 	// Element closing tags
-	"divide-end": DIVIDE_END,
-	"p-end":      P_END,
-	"h-end":      H_END,
-	"link-end":   LINK_END,
-	"img-end":    IMG_END,
-	"list-end":   LIST_END,
-	"lst-end":    LIST_ORD_END, // shared closing tag for both list types
-	"item-end":   ITEM_END,
-	"table-end":  TABLE_END,
-	"row-end":    ROW_END,
-	"cell-end":   CELL_END,
-	"form-end":   FORM_END,
-	"input-end":  INPUT_END,
-	"btn-end":    BTN_END,
-	"bold-end":   BOLD_END,
-	"italic-end": ITALIC_END,
-	"code-end":   CODE_END,
+	"divide-end":   DIVIDE_END,
+	"p-end":        P_END,
+	"h-end":        H_END,
+	"link-end":     LINK_END,
+	"img-end":      IMG_END,
+	"list-end":     LIST_END,
+	"lst-end":      LIST_ORD_END, // shared closing tag for both list types
+	"item-end":     ITEM_END,
+	"table-end":    TABLE_END,
+	"row-end":      ROW_END,
+	"cell-end":     CELL_END,
+	"form-end":     FORM_END,
+	"input-end":    INPUT_END,
+	"btn-end":      BTN_END,
+	"bold-end":     BOLD_END,
+	"italic-end":   ITALIC_END,
+	"code-end":     CODE_END,
+	"faq-end":      FAQ_END,
+	"question-end": QUESTION_END,
+	"answer-end":   ANSWER_END,
+	"event-end":    EVENT_END,
+	"contact-end":  CONTACT_END,
+	"query-end":    QUERY_END,
+	"nav-end":      NAV_END,
+	"article-end":  ARTICLE_END,
+	"section-end":  SECTION_END,
+	"aside-end":    ASIDE_END,
+}
+
+// voidTags are the elements that can be written as one tag with their
+// properties inside it, like [img src="x.png" alt="Logo"]
+var voidTags = map[string]bool{
+	"img":             true,
+	"input":           true,
+	"hr":              true,
+	"br":              true,
+	"pagenav":         true,
+	"versions":        true,
+	"time":            true,
+	"script":          true,
+	"lorem":           true,
+	"placeholder-img": true,
+	"qr":              true,
+}
+
+// IsVoidTag reports whether name can be written as a single tag with no
+// end tag
+func IsVoidTag(name string) bool {
+	return voidTags[name]
+}
+
+// customTags maps the opening token of each tag added with RegisterTag to
+// the tag's name
+var customTags = map[TokenType]string{}
+
+// RegisterTag adds [name-start] and [name-end] as a custom tag, for
+// elements rendered by a plugin. Registering a name again does nothing.
+// Tags must be registered before lexing, and not concurrently with it.
+func RegisterTag(name string) error {
+	valid := name != ""
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			valid = false
+		}
+	}
+	if !valid {
+		return fmt.Errorf("invalid tag name %q: use letters, digits, - and _", name)
+	}
+
+	open := TokenType("CUSTOM_START:" + name)
+	if _, ok := customTags[open]; ok {
+		return nil
+	}
+	for _, keyword := range []string{name, name + "-start", name + "-end"} {
+		if _, ok := keywords[keyword]; ok {
+			return fmt.Errorf("tag %q is built in", name)
+		}
+	}
+
+	customTags[open] = name
+	keywords[name+"-start"] = open
+	keywords[name+"-end"] = TokenType("CUSTOM_END:" + name)
+	return nil
+}
+
+// CustomTagName returns the name of a custom tag from its opening or
+// closing token type
+func CustomTagName(t TokenType) (string, bool) {
+	if name, ok := customTags[t]; ok {
+		return name, true
+	}
+	if name, ok := strings.CutPrefix(string(t), "CUSTOM_END:"); ok {
+		_, registered := customTags[TokenType("CUSTOM_START:"+name)]
+		return name, registered
+	}
+	return "", false
 }
 
 // LookUpIdent checks if an identifier is a keyword and returns its token type
@@ -138,6 +333,55 @@ func LookUpIdent(ident string) TokenType {
 	return IDENT
 }
 
+// SuggestTag returns the tag name closest to name, to suggest for an
+// unknown tag, or "" if none is close: within two edits, or one for names
+// of up to five characters
+func SuggestTag(name string) string {
+	limit := 2
+	if len(name) <= 5 {
+		limit = 1
+	}
+
+	candidates := make([]string, 0, len(keywords)+len(voidTags))
+	for keyword := range keywords {
+		candidates = append(candidates, keyword)
+	}
+	for tag := range voidTags {
+		candidates = append(candidates, tag)
+	}
+	sort.Strings(candidates)
+
+	best, bestDist := "", limit+1
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDist {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b: the fewest
+// characters inserted, deleted, or replaced to turn one into the other
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
 // IsOpeningTag returns true if the token type is an opening tag
 func IsOpeningTag(t TokenType) bool {
 	switch t {
@@ -146,10 +390,13 @@ func IsOpeningTag(t TokenType) bool {
 		LIST_START, LIST_ORD_START, LIST_UNORD_START, ITEM_START,
 		TABLE_START, ROW_START, CELL_START,
 		FORM_START, INPUT_START, BTN_START, BOLD_START, ITALIC_START,
-		CODE_START:
+		CODE_START, FAQ_START, QUESTION_START, ANSWER_START, EVENT_START, CONTACT_START, QUERY_START,
+		NAV_START, ARTICLE_START, SECTION_START, ASIDE_START,
+		VOID_START:
 		return true
 	}
-	return false
+	_, custom := customTags[t]
+	return custom
 }
 
 // IsClosingTag returns true if the token type is a closing tag
@@ -160,10 +407,13 @@ func IsClosingTag(t TokenType) bool {
 		LIST_END, LIST_ORD_END, LIST_UNORD_END, ITEM_END,
 		TABLE_END, ROW_END, CELL_END,
 		FORM_END, INPUT_END, BTN_END, BOLD_END, ITALIC_END,
-		CODE_END:
+		CODE_END, FAQ_END, QUESTION_END, ANSWER_END, EVENT_END, CONTACT_END, QUERY_END,
+		NAV_END, ARTICLE_END, SECTION_END, ASIDE_END,
+		VOID_END, END:
 		return true
 	}
-	return false
+	_, custom := CustomTagName(t)
+	return custom && !IsOpeningTag(t)
 }
 
 // GetMatchingClose returns the closing tag type for an opening tag
@@ -211,6 +461,31 @@ func GetMatchingClose(open TokenType) TokenType {
 		return ITALIC_END
 	case CODE_START:
 		return CODE_END
+	case FAQ_START:
+		return FAQ_END
+	case QUESTION_START:
+		return QUESTION_END
+	case ANSWER_START:
+		return ANSWER_END
+	case EVENT_START:
+		return EVENT_END
+	case CONTACT_START:
+		return CONTACT_END
+	case QUERY_START:
+		return QUERY_END
+	case NAV_START:
+		return NAV_END
+	case ARTICLE_START:
+		return ARTICLE_END
+	case SECTION_START:
+		return SECTION_END
+	case ASIDE_START:
+		return ASIDE_END
+	case VOID_START:
+		return VOID_END
+	}
+	if name, ok := customTags[open]; ok {
+		return TokenType("CUSTOM_END:" + name)
 	}
 	return ILLEGAL
 }
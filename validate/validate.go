@@ -0,0 +1,174 @@
+package validate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Problem is a structural issue found in generated HTML
+type Problem struct {
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// openElement is an element waiting for its end tag
+type openElement struct {
+	tag  string
+	line int
+}
+
+// voidElements never have an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// blockElements can't appear inside a <p>; the browser closes the
+// paragraph early instead, splitting the content
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"details": true, "div": true, "dl": true, "fieldset": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "main": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "table": true, "ul": true,
+}
+
+// paragraphScope elements hide a <p> outside them from the blocks
+// inside, so a <table> in a <td> doesn't close the paragraph around the
+// table the cell belongs to
+var paragraphScope = map[string]bool{
+	"button": true, "caption": true, "object": true, "table": true,
+	"td": true, "template": true, "th": true,
+}
+
+// requiredParents lists elements that are only valid directly inside
+// one of the given parents
+var requiredParents = map[string][]string{
+	"li":    {"ul", "ol", "menu"},
+	"tr":    {"table", "thead", "tbody", "tfoot"},
+	"td":    {"tr"},
+	"th":    {"tr"},
+	"thead": {"table"},
+	"tbody": {"table"},
+	"tfoot": {"table"},
+}
+
+// interactiveElements can't be nested inside <a> or <button>
+var interactiveElements = map[string]bool{
+	"a": true, "button": true, "input": true, "select": true, "textarea": true,
+}
+
+// HTML checks a document for unclosed or stray tags and invalid nesting.
+// It works on the token stream rather than html.Parse, which silently
+// repairs exactly the mistakes this is meant to report.
+func HTML(r io.Reader) ([]Problem, error) {
+	var problems []Problem
+	var stack []openElement
+	line := 1
+
+	report := func(format string, args ...any) {
+		problems = append(problems, Problem{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return problems, err
+			}
+			break
+		}
+
+		// Problems are reported at the line the token starts on
+		raw := string(z.Raw())
+		tok := z.Token()
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag := tok.Data
+			checkNesting(tag, stack, report)
+			if tt == html.StartTagToken && !voidElements[tag] {
+				stack = append(stack, openElement{tag: tag, line: line})
+			}
+
+		case html.EndTagToken:
+			tag := tok.Data
+			if voidElements[tag] {
+				report("end tag </%s> for void element", tag)
+				break
+			}
+
+			i := len(stack) - 1
+			for i >= 0 && stack[i].tag != tag {
+				i--
+			}
+			if i < 0 {
+				report("stray end tag </%s>", tag)
+				break
+			}
+			for _, unclosed := range stack[i+1:] {
+				report("<%s> opened on line %d is not closed before </%s>", unclosed.tag, unclosed.line, tag)
+			}
+			stack = stack[:i]
+		}
+
+		line += strings.Count(raw, "\n")
+	}
+
+	for _, unclosed := range stack {
+		problems = append(problems, Problem{
+			Line:    unclosed.line,
+			Message: fmt.Sprintf("<%s> is never closed", unclosed.tag),
+		})
+	}
+
+	return problems, nil
+}
+
+// checkNesting reports a start tag that isn't allowed where it appears
+func checkNesting(tag string, stack []openElement, report func(string, ...any)) {
+	if len(stack) == 0 {
+		return
+	}
+	parent := stack[len(stack)-1]
+
+	if blockElements[tag] {
+		for i := len(stack) - 1; i >= 0 && !paragraphScope[stack[i].tag]; i-- {
+			if stack[i].tag == "p" {
+				report("<%s> inside <p> (opened on line %d)", tag, stack[i].line)
+				break
+			}
+		}
+	}
+
+	if parents, ok := requiredParents[tag]; ok {
+		valid := false
+		for _, p := range parents {
+			if parent.tag == p {
+				valid = true
+			}
+		}
+		if !valid {
+			report("<%s> inside <%s>, expected a parent of <%s>", tag, parent.tag, strings.Join(parents, ">, <"))
+		}
+	}
+
+	if interactiveElements[tag] {
+		for _, open := range stack {
+			if open.tag == "a" || open.tag == "button" {
+				report("<%s> nested inside <%s> (opened on line %d)", tag, open.tag, open.line)
+				break
+			}
+		}
+	}
+}
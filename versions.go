@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lpml/generator"
+	"lpml/project"
+)
+
+// parseVersions splits a --versions list like v1,v2 into version names,
+// each a subdirectory of the input
+func parseVersions(list string) ([]string, error) {
+	var versions []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`):
+			return nil, fmt.Errorf("%q isn't a version directory name", name)
+		case seen[name]:
+			return nil, fmt.Errorf("%s is listed twice", name)
+		}
+		seen[name] = true
+		versions = append(versions, name)
+	}
+	return versions, nil
+}
+
+// buildVersions builds each version's subdirectory of dir as a project of
+// its own, into the same subdirectory of the output directory. Each page
+// gets $version, the version's name, and $version_base, its path from the
+// site root, like /v2/, unless --set gives them. Asset directories are
+// copied once, after every version is built.
+func buildVersions(dir string, versions []string, cfg *buildConfig) int {
+	status := exitOK
+	for _, version := range versions {
+		versionDir := filepath.Join(dir, version)
+		if info, err := os.Stat(versionDir); err != nil || !info.IsDir() {
+			fmt.Printf("Version %s has no directory %s\n", version, versionDir)
+			status = firstFailure(status, exitIO)
+			continue
+		}
+
+		vcfg := *cfg
+		vcfg.versions, vcfg.version, vcfg.assets = versions, version, nil
+		if cfg.outDir != "" {
+			vcfg.outDir = filepath.Join(cfg.outDir, version)
+		}
+		vcfg.opts.Set = setValues{"version": version, "version_base": "/" + version + "/"}
+		for name, value := range cfg.opts.Set {
+			vcfg.opts.Set[name] = value
+		}
+
+		cfg.logf("Building version %s", version)
+		status = firstFailure(status, buildDir(versionDir, &vcfg))
+	}
+
+	if err := cfg.copyAssets(); err != nil {
+		fmt.Printf("Failed to copy assets: %v\n", err)
+		return exitIO
+	}
+	return status
+}
+
+// versionLinks returns what a page's [versions] links to in a --versions
+// build: the page at the same path in each version, or that version's
+// index page if it has none. dir is the version being built.
+func (cfg *buildConfig) versionLinks(dir string, page *project.Page) []generator.VersionLink {
+	if len(cfg.versions) == 0 {
+		return nil
+	}
+	rel, err := filepath.Rel(dir, page.Source)
+	if err != nil {
+		return nil
+	}
+	up := strings.Repeat("../", strings.Count(filepath.ToSlash(rel), "/")+1)
+
+	var links []generator.VersionLink
+	for _, version := range cfg.versions {
+		target := rel
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dir), version, rel)); err != nil {
+			target = "index.lpml"
+		}
+		links = append(links, generator.VersionLink{
+			Name:    version,
+			Href:    up + version + "/" + filepath.ToSlash(project.OutputPath(target)),
+			Current: version == cfg.version,
+		})
+	}
+	return links
+}